@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fastjson"
+
+	"acfunlivedb/store"
+)
+
+// 直播间的访问限制，这些直播的弹幕和录播可能无法获取。AcFun没有密码直播间
+const (
+	accessPaid      = "paid"      // 付费直播，没有购买的用户无法观看
+	accessNoDanmaku = "noDanmaku" // 直播间禁止显示弹幕
+)
+
+var accessText = map[string]string{
+	accessPaid:      "付费直播",
+	accessNoDanmaku: "禁止显示弹幕",
+}
+
+// 从直播间列表的数据里获取直播间的访问限制
+func parseAccess(liveRoom *fastjson.Value) string {
+	var access []string
+	// 只有付费直播才有这个字段
+	if liveRoom.Exists("paidShowUserBuyStatus") {
+		access = append(access, accessPaid)
+	}
+	if liveRoom.GetBool("disableDanmakuShow") {
+		access = append(access, accessNoDanmaku)
+	}
+	return strings.Join(access, ",")
+}
+
+// 访问限制的说明
+func describeAccess(access string) string {
+	if access == "" {
+		return ""
+	}
+	list := strings.Split(access, ",")
+	for i, a := range list {
+		if text, ok := accessText[a]; ok {
+			list[i] = text
+		}
+	}
+	return strings.Join(list, "、")
+}
+
+// 更新直播间的访问限制
+func updateAccess(liveID store.LiveID, access string) {
+	queueWrite(fmt.Sprintf("更新liveID为 %s 的直播间访问限制", liveID), func([]int64) {
+		markChanged(changeUpdate, liveID)
+	}, store.UpdateAccessWrite(liveID, access))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 访问日志的一行，以JSON保存
+type accessEntry struct {
+	Time      string `json:"time"`       // 收到请求的时间
+	IP        string `json:"ip"`         // 客户端IP
+	Method    string `json:"method"`     // 请求方法
+	URI       string `json:"uri"`        // 请求的路径和参数
+	Status    int    `json:"status"`     // 响应的状态码
+	Bytes     int64  `json:"bytes"`      // 响应的字节数
+	Duration  int64  `json:"durationMs"` // 处理请求的时间，单位为毫秒
+	UserAgent string `json:"userAgent"`  // 客户端的User-Agent
+}
+
+// 记录响应的状态码和字节数
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// SSE需要Flush
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// 请求处理完后把访问日志以JSON Lines写入out
+func accessLogMiddleware(out io.Writer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		data, err := json.Marshal(accessEntry{
+			Time:      start.Format(time.RFC3339Nano),
+			IP:        clientIP(r),
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Duration:  time.Since(start).Milliseconds(),
+			UserAgent: r.UserAgent(),
+		})
+		if err != nil {
+			return
+		}
+		if _, err = out.Write(append(data, '\n')); err != nil {
+			log.Printf("写入访问日志失败：%v", err)
+		}
+	})
+}
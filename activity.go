@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	activityMinutesPerRow = 60 // 弹幕走势图每行的分钟数
+	activityPeakCount     = 5  // 打印弹幕最多的分钟数
+)
+
+// 弹幕走势图从少到多的字符，没有弹幕时为空格
+var sparkLevels = []rune(" ▁▂▃▄▅▆▇█")
+
+// 处理"activity liveID"命令，在终端打印直播每分钟弹幕数的走势图和弹幕最多的几分钟
+func printActivity(ctx context.Context, liveID store.LiveID) {
+	l, err := queryLive(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播数据出现错误：%v", liveID, err)
+		return
+	}
+	counts, source, err := activityCounts(ctx, l)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的弹幕数量出现错误：%v", liveID, err)
+		return
+	}
+	if len(counts) == 0 {
+		log.Printf("liveID为 %s 的直播没有弹幕记录，需要在watch里开启danmaku或stats", liveID)
+		return
+	}
+
+	total, peak := 0, 0
+	for _, c := range counts {
+		total += c
+		if c > peak {
+			peak = c
+		}
+	}
+	fmt.Printf("%s 的直播「%s」开播时间：%s 弹幕数：%d（%s） 每个字符为一分钟，最多的一分钟有 %d 条弹幕\n",
+		l.name, liveTitle(l), time.UnixMilli(l.startTime).Format(timeLayout), total, source, peak)
+	for start := 0; start < len(counts); start += activityMinutesPerRow {
+		end := start + activityMinutesPerRow
+		if end > len(counts) {
+			end = len(counts)
+		}
+		fmt.Printf("%s │%s│\n", formatOffset(int64(start)*time.Minute.Milliseconds()), sparkline(counts[start:end], peak))
+	}
+
+	minutes := make([]int, 0, len(counts))
+	for i, c := range counts {
+		if c != 0 {
+			minutes = append(minutes, i)
+		}
+	}
+	sort.SliceStable(minutes, func(i, j int) bool { return counts[minutes[i]] > counts[minutes[j]] })
+	if len(minutes) > activityPeakCount {
+		minutes = minutes[:activityPeakCount]
+	}
+	peaks := make([]string, len(minutes))
+	for i, m := range minutes {
+		peaks[i] = fmt.Sprintf("%s（%d 条）", formatOffset(int64(m)*time.Minute.Milliseconds()), counts[m])
+	}
+	fmt.Printf("弹幕最多的分钟：%s\n", strings.Join(peaks, " "))
+}
+
+// 直播开始后每分钟的弹幕数，优先使用记录的弹幕，没有时使用每分钟的采样，返回数据的来源
+func activityCounts(ctx context.Context, l *live) ([]int, string, error) {
+	buckets, err := db.QueryDanmakuPeaks(ctx, l.liveID, time.Minute.Milliseconds(), -1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(buckets) != 0 {
+		counts := make([]int, activityMinutes(l, buckets[len(buckets)-1].Offset))
+		for _, b := range buckets {
+			counts[b.Offset/time.Minute.Milliseconds()] = b.Count
+		}
+		return counts, "记录的弹幕", nil
+	}
+
+	samples, err := db.QuerySamples(ctx, l.liveID)
+	if err != nil || len(samples) == 0 {
+		return nil, "", err
+	}
+	last := samples[len(samples)-1].Time - l.startTime
+	if last < 0 {
+		last = 0
+	}
+	counts := make([]int, activityMinutes(l, last))
+	for _, s := range samples {
+		// 采样的弹幕数是上一次采样后的弹幕数，算到上一分钟里
+		offset := s.Time - l.startTime - time.Minute.Milliseconds()
+		if offset < 0 {
+			offset = 0
+		}
+		counts[offset/time.Minute.Milliseconds()] += s.DanmakuCount
+	}
+	return counts, "每分钟的采样", nil
+}
+
+// 走势图的分钟数，last为最后一条数据在直播里的时间，单位为毫秒。
+// 有直播时长时覆盖整场直播，还在直播或没有直播时长时到最后一条数据为止
+func activityMinutes(l *live, last int64) int {
+	length := l.duration
+	if length < last+1 {
+		length = last + 1
+	}
+	return int((length + time.Minute.Milliseconds() - 1) / time.Minute.Milliseconds())
+}
+
+// 把每分钟的弹幕数转换为走势图，peak为所有分钟里最多的弹幕数
+func sparkline(counts []int, peak int) string {
+	var b strings.Builder
+	top := len(sparkLevels) - 1
+	for _, c := range counts {
+		if c <= 0 {
+			b.WriteRune(sparkLevels[0])
+			continue
+		}
+		// 有弹幕时至少显示最低的一格
+		b.WriteRune(sparkLevels[1+(c*top-1)/peak])
+	}
+	return b.String()
+}
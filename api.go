@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	apiDefaultLimit    = 100  // /api/sessions默认返回的直播数量
+	apiMaxLimit        = 1000 // /api/sessions最多返回的直播数量
+	playbackRefreshMax = 10   // /api/playbacks每次最多重新获取录播链接的直播数量
+)
+
+// API返回的直播间标题变更记录
+type titleJSON struct {
+	Title      string `json:"title"`      // 直播间标题
+	ChangeTime int64  `json:"changeTime"` // 变更时间，单位为毫秒
+}
+
+// API返回的单场直播，包括标题变更记录
+type sessionJSON struct {
+	*liveJSON
+	Titles []titleJSON `json:"titles"` // 直播间标题的变更记录
+}
+
+// API返回的主播昵称
+type streamerJSON struct {
+	UID       store.UID `json:"uid"`       // 主播uid
+	Name      string    `json:"name"`      // 主播昵称
+	FirstSeen int64     `json:"firstSeen"` // 第一次看到该昵称的时间，单位为毫秒
+	LastSeen  int64     `json:"lastSeen"`  // 最后一次看到该昵称的时间，单位为毫秒
+}
+
+// API返回的关注的主播
+type watchJSON struct {
+	UID     store.UID `json:"uid"`     // 主播uid
+	Name    string    `json:"name"`    // 主播最近使用的昵称，没有记录时为空
+	Danmaku bool      `json:"danmaku"` // 是否记录弹幕
+	Stats   bool      `json:"stats"`   // 是否每分钟记录在线人数、点赞数和弹幕数
+	Cover   bool      `json:"cover"`   // 是否下载直播封面
+}
+
+// API返回的直播录播链接
+type playbackJSON struct {
+	LiveID         store.LiveID `json:"liveID"`         // 直播ID
+	StartTime      int64        `json:"startTime"`      // 直播开始时间，单位为毫秒
+	Title          string       `json:"title"`          // 直播间标题
+	SuggestedTitle string       `json:"suggestedTitle"` // 没有直播间标题时的建议标题
+	Duration       int64        `json:"duration"`       // 直播时长，单位为毫秒
+	PlaybackURL    string       `json:"playbackURL"`    // 录播链接，获取不到时为空
+	BackupURL      string       `json:"backupURL"`      // 录播备份链接，获取不到时为空
+}
+
+// POST /api/watch的请求，没有的记录功能保持不变，新关注的主播默认不开启
+type watchRequest struct {
+	UID     store.UID `json:"uid"`
+	Danmaku *bool     `json:"danmaku"`
+	Stats   *bool     `json:"stats"`
+	Cover   *bool     `json:"cover"`
+}
+
+// 注册查询直播数据的REST API、RSS和日历
+func registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/sessions", requireAuth(handleSessions))
+	mux.HandleFunc("/api/sessions/", requireAuth(handleSession))
+	mux.HandleFunc("/api/streamers", requireAuth(handleStreamers))
+	mux.HandleFunc("/api/live", requireAuth(handleLive))
+	mux.HandleFunc("/api/playbacks", requireAuth(handlePlaybacks))
+	mux.HandleFunc("/api/watch", requireAuth(handleWatch))
+	mux.HandleFunc("/api/watch/", requireAuth(handleUnwatch))
+	mux.HandleFunc("/api/tenant", requireAuth(handleTenant))
+	mux.HandleFunc("/api/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/feed/", requireAuth(handleFeed))
+	mux.HandleFunc("/calendar/", requireAuth(handleCalendar))
+}
+
+// 以JSON返回v
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Printf("返回HTTP响应出现错误：%v", err)
+	}
+}
+
+// 以JSON返回错误信息
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// 只允许GET请求
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("只支持GET请求"))
+		return false
+	}
+	return true
+}
+
+// 解析时间参数，可以是毫秒时间戳或日期（格式为2006-01-02），endOfDay为true时日期表示当天结束的时间
+func parseTimeParam(name, value string, endOfDay bool) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("%s 参数 %s 不是毫秒时间戳或格式为 %s 的日期", name, value, dateLayout)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.UnixMilli(), nil
+}
+
+// 解析/api/sessions的参数
+func parseSessionQuery(r *http.Request) (q store.LiveQuery, err error) {
+	params := r.URL.Query()
+	if s := params.Get("uid"); s != "" {
+		uid, err := store.ParseUID(s)
+		if err != nil {
+			return q, fmt.Errorf("uid 参数：%w", err)
+		}
+		q.UID = uid
+	}
+	if q.From, err = parseTimeParam("from", params.Get("from"), false); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTimeParam("to", params.Get("to"), true); err != nil {
+		return q, err
+	}
+	q.Limit = apiDefaultLimit
+	if s := params.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("limit 参数 %s 不是正整数", s)
+		}
+		if q.Limit > apiMaxLimit {
+			q.Limit = apiMaxLimit
+		}
+	}
+	if s := params.Get("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset 参数 %s 不是非负整数", s)
+		}
+	}
+	switch s := params.Get("sort"); s {
+	case "", store.SortStartTime, store.SortDuration:
+		q.Sort = s
+	default:
+		return q, fmt.Errorf("sort 参数 %s 只能是 %s 或 %s", s, store.SortStartTime, store.SortDuration)
+	}
+	switch s := params.Get("order"); s {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("order 参数 %s 只能是 asc 或 desc", s)
+	}
+	q.Title = params.Get("title")
+	return q, nil
+}
+
+// GET /api/sessions?uid=&from=&to=&title=&sort=&order=&limit=&offset= 返回直播列表，默认按开播时间降序排列
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	q, err := parseSessionQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lives, err := fromStoreList(db.QueryLives(r.Context(), q))
+	if err != nil {
+		log.Printf("API查询直播数据出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+	sessions := make([]*liveJSON, len(lives))
+	for i := range lives {
+		sessions[i] = lives[i].toJSON()
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// GET /api/sessions/{liveID} 返回单场直播和直播间标题的变更记录
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	s := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if s == "" || strings.Contains(s, "/") {
+		writeError(w, http.StatusNotFound, errors.New("请求的路径不存在"))
+		return
+	}
+	liveID, err := store.ParseLiveID(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lives, err := fromStoreList(db.QueryLives(r.Context(), store.LiveQuery{LiveID: liveID, Limit: 1}))
+	if err == nil && len(lives) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("没有liveID为 %s 的直播数据", liveID))
+		return
+	}
+	var titles []store.TitleChange
+	if err == nil {
+		titles, err = db.QueryTitles(r.Context(), liveID)
+	}
+	if err != nil {
+		log.Printf("API查询liveID为 %s 的直播数据出现错误：%v", liveID, err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+	session := sessionJSON{liveJSON: lives[0].toJSON(), Titles: make([]titleJSON, len(titles))}
+	for i, t := range titles {
+		session.Titles[i] = titleJSON{Title: t.Title, ChangeTime: t.ChangeTime}
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+// GET /api/streamers?q= 返回所有主播最近使用的昵称，有q参数时返回用过含有q的昵称的主播
+func handleStreamers(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	var names []store.StreamerName
+	var err error
+	if keyword := r.URL.Query().Get("q"); keyword != "" {
+		names, err = db.SearchStreamers(r.Context(), keyword)
+	} else {
+		names, err = db.QueryLatestStreamers(r.Context())
+	}
+	if err != nil {
+		log.Printf("API查询主播昵称出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询主播昵称出现错误"))
+		return
+	}
+	streamers := make([]streamerJSON, len(names))
+	for i, n := range names {
+		streamers[i] = streamerJSON(n)
+	}
+	writeJSON(w, http.StatusOK, streamers)
+}
+
+// GET /api/live 按开播时间降序返回关注的主播正在进行的直播，没有设置watchUIDs时返回所有正在进行的直播，
+// 用用户的API key访问时返回用户关注的主播正在进行的直播
+func handleLive(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	var tenantWatched map[store.UID]bool
+	if t := requestTenant(r); t != nil {
+		var err error
+		if tenantWatched, err = tenantWatchSet(r.Context(), t); err != nil {
+			log.Printf("API查询用户 %s 关注的主播出现错误：%v", t.Name, err)
+			writeError(w, http.StatusInternalServerError, errors.New("查询关注的主播出现错误"))
+			return
+		}
+	}
+	lives, err := queryActiveLives(r.Context())
+	if err != nil {
+		log.Printf("API查询正在进行的直播出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+	sort.Slice(lives, func(i, j int) bool {
+		return lives[i].startTime > lives[j].startTime
+	})
+	sessions := make([]*liveJSON, 0, len(lives))
+	for i := range lives {
+		if tenantWatched != nil {
+			if tenantWatched[lives[i].uid] {
+				sessions = append(sessions, lives[i].toJSON())
+			}
+		} else if len(watchedUIDs()) == 0 || isWatched(lives[i].uid) {
+			sessions = append(sessions, lives[i].toJSON())
+		}
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// GET /api/playbacks?uid= 返回主播已经结束的直播的录播链接，没有录播链接的直播会重新获取并保存，
+// 参数和/api/sessions相同
+func handlePlaybacks(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	q, err := parseSessionQuery(r)
+	if err == nil && q.UID == 0 {
+		err = errors.New("需要 uid 参数")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Finished = true
+	lives, err := fromStoreList(db.QueryLives(r.Context(), q))
+	if err != nil {
+		log.Printf("API查询直播数据出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+	playbacks := make([]playbackJSON, len(lives))
+	refreshed := 0
+	for i, l := range lives {
+		if l.playbackURL == "" && refreshed < playbackRefreshMax {
+			// 只请求一次，避免接口出错时请求等待太久
+			refreshed++
+			if playback, err := tryPlayback(l.liveID); err != nil {
+				log.Printf("API重新获取录播链接出现错误：%v", err)
+			} else if playback.URL != "" {
+				l.playbackURL, l.backupURL = playback.URL, playback.BackupURL
+				updatePlayback(r.Context(), l.liveID, l.playbackURL, l.backupURL)
+			}
+		}
+		playbacks[i] = playbackJSON{
+			LiveID:         l.liveID,
+			StartTime:      l.startTime,
+			Title:          l.title,
+			SuggestedTitle: l.suggestedTitle,
+			Duration:       l.duration,
+			PlaybackURL:    l.playbackURL,
+			BackupURL:      l.backupURL,
+		}
+	}
+	writeJSON(w, http.StatusOK, playbacks)
+}
+
+// 没有设置鉴权时不允许通过API修改设置
+func allowModify(w http.ResponseWriter) bool {
+	if conf.HTTP.APIToken == "" && conf.HTTP.Username == "" {
+		writeError(w, http.StatusForbidden, errors.New("需要设置apiToken或username才能通过API修改设置"))
+		return false
+	}
+	return true
+}
+
+func toWatchJSON(r *http.Request, t watchTarget) watchJSON {
+	return watchJSON{UID: t.UID, Name: latestStreamerName(r.Context(), t.UID), Danmaku: t.Danmaku, Stats: t.Stats, Cover: t.Cover}
+}
+
+// GET /api/watch 返回关注的主播和开启的记录功能
+// POST /api/watch 添加关注的主播或修改开启的记录功能，新关注时返回201。
+// 用用户的API key访问时修改用户自己的关注列表，记录功能只能由管理员修改
+func handleWatch(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if tenant != nil {
+			tenantWatchList(w, r, tenant)
+			return
+		}
+		list := watchList()
+		watched := make([]watchJSON, len(list))
+		for i, t := range list {
+			watched[i] = toWatchJSON(r, t)
+		}
+		writeJSON(w, http.StatusOK, watched)
+	case http.MethodPost:
+		if tenant == nil && !allowModify(w) {
+			return
+		}
+		var req watchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("请求不是有效的JSON：%w", err))
+			return
+		}
+		if !req.UID.Valid() {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("uid %d 不是有效的uid", req.UID))
+			return
+		}
+		if tenant != nil {
+			changed, ok := setTenantWatch(w, r, tenant, req.UID, true)
+			if !ok {
+				return
+			}
+			status := http.StatusOK
+			if changed {
+				status = http.StatusCreated
+			}
+			writeJSON(w, status, toWatchJSON(r, watchFeatures(req.UID)))
+			return
+		}
+		t := watchFeatures(req.UID)
+		if req.Danmaku != nil {
+			t.Danmaku = *req.Danmaku
+		}
+		if req.Stats != nil {
+			t.Stats = *req.Stats
+		}
+		if req.Cover != nil {
+			t.Cover = *req.Cover
+		}
+		existed, err := setWatch(t)
+		if err != nil {
+			log.Printf("API修改关注的主播出现错误：%v", err)
+			writeError(w, http.StatusInternalServerError, errors.New("保存设置出现错误"))
+			return
+		}
+		status := http.StatusOK
+		if !existed {
+			status = http.StatusCreated
+			log.Printf("通过API关注uid为 %d 的主播", t.UID)
+		} else {
+			log.Printf("通过API修改uid为 %d 的主播的记录功能", t.UID)
+		}
+		writeJSON(w, status, toWatchJSON(r, t))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("只支持GET和POST请求"))
+	}
+}
+
+// DELETE /api/watch/{uid} 取消关注主播
+func handleUnwatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("只支持DELETE请求"))
+		return
+	}
+	uid, err := store.ParseUID(strings.TrimPrefix(r.URL.Path, "/api/watch/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("请求的路径不存在"))
+		return
+	}
+	if t := requestTenant(r); t != nil {
+		removed, ok := setTenantWatch(w, r, t, uid, false)
+		if !ok {
+			return
+		}
+		if !removed {
+			writeError(w, http.StatusNotFound, fmt.Errorf("没有关注uid为 %d 的主播", uid))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !allowModify(w) {
+		return
+	}
+	removed, err := removeWatch(uid)
+	if err != nil {
+		log.Printf("API取消关注主播出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("保存设置出现错误"))
+		return
+	}
+	if !removed {
+		writeError(w, http.StatusNotFound, fmt.Errorf("没有关注uid为 %d 的主播", uid))
+		return
+	}
+	log.Printf("通过API取消关注uid为 %d 的主播", uid)
+	w.WriteHeader(http.StatusNoContent)
+}
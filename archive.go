@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+const archiveInterval = 24 * time.Hour // 自动归档的间隔
+
+// 把在before之前开播的直播按开播年份移到归档数据库
+func archiveLives(ctx context.Context, before time.Time) {
+	result, err := db.Archive(ctx, before.UnixMilli())
+	years := make([]int, 0, len(result))
+	for year := range result {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	for _, year := range years {
+		log.Printf("已把 %d 场 %d 年的直播数据移到归档数据库", result[year], year)
+	}
+	if err != nil {
+		log.Printf("归档直播数据出现错误：%v", err)
+	}
+}
+
+// 定期归档开播超过设置天数的直播
+func archiveCycle(ctx context.Context) {
+	if conf.ArchiveDays <= 0 {
+		return
+	}
+	for {
+		archiveLives(ctx, time.Now().AddDate(0, 0, -conf.ArchiveDays))
+		if !sleepCtx(ctx, archiveInterval) {
+			return
+		}
+	}
+}
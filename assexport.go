@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"acfunlivedb/store"
+)
+
+// 导出的ASS字幕的设置，和acfundanmu录播时生成的弹幕字幕相同
+const (
+	assPlayResX    = 1920             // 视频的宽度
+	assPlayResY    = 1080             // 视频的高度
+	assFontSize    = 40               // 弹幕的字体大小，也是每行弹幕的高度
+	assScrollTime  = 10 * time.Second // 弹幕从右边移动到左边的时间
+	assLaneSpacing = 4                // 弹幕行之间的间距
+)
+
+const assHeader = `[Script Info]
+; LiveID: %s
+Title: %s
+ScriptType: v4.00+
+Collisions: Normal
+PlayResX: %d
+PlayResY: %d
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Danmu,Microsoft YaHei,%d,&H00FFFFFF,&H00FFFFFF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,1,0,7,0,0,0,0
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// 弹幕内容里的{和}会被当作特效标签，\会被当作转义，换成全角字符
+var assTextEscaper = strings.NewReplacer(`{`, `｛`, `}`, `｝`, `\`, `＼`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// ASS的Name字段不能含有逗号
+var assNameEscaper = strings.NewReplacer(",", " ", "\n", " ", "\r", " ")
+
+// 一行弹幕里最后一条弹幕的时间，单位为毫秒，用来避免同一行的弹幕重叠
+type assLane struct {
+	emerge    int64 // 弹幕完全出现在画面右边的时间
+	disappear int64 // 弹幕移出画面左边的时间
+}
+
+// 把毫秒转换为ASS的时间格式，如0:01:02.34
+func assTime(ms int64) string {
+	if ms < 0 {
+		ms = 0
+	}
+	cs := ms / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// 把弹幕写成从右向左滚动的ASS字幕，时间以直播开始为0，和录播的时间轴对齐。
+// 画面里放不下的弹幕会被丢弃，返回写入的弹幕数量
+func writeASS(out io.Writer, liveID store.LiveID, title string, list []store.TimedDanmaku) (int, error) {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, assHeader, liveID, assNameEscaper.Replace(title), assPlayResX, assPlayResY, assFontSize)
+	scroll := assScrollTime.Milliseconds()
+	lanes := make([]assLane, assPlayResY/(assFontSize+assLaneSpacing))
+	n := 0
+	for _, d := range list {
+		if d.Offset < 0 {
+			continue
+		}
+		text := assTextEscaper.Replace(d.Content)
+		width := int64(utf8.RuneCountInString(text) * assFontSize)
+		// 弹幕的速度和长度有关，保证每条弹幕在画面里停留的时间相同
+		speed := float64(assPlayResX+width) / float64(scroll)
+		lane := assLane{
+			emerge:    d.Offset + int64(float64(width)/speed),
+			disappear: d.Offset + scroll,
+		}
+		// 弹幕的左端到达画面左边的时间
+		left := d.Offset + int64(assPlayResX/speed)
+		for i, l := range lanes {
+			if d.Offset < l.emerge || left < l.disappear {
+				continue
+			}
+			lanes[i] = lane
+			y := i*(assFontSize+assLaneSpacing) + assLaneSpacing
+			fmt.Fprintf(w, "Dialogue: 0,%s,%s,Danmu,%s,0,0,0,,{\\move(%d,%d,%d,%d)}%s\n",
+				assTime(d.Offset), assTime(lane.disappear), assNameEscaper.Replace(d.Nickname),
+				assPlayResX, y, -width, y, text)
+			n++
+			break
+		}
+	}
+	return n, w.Flush()
+}
+
+// 把直播记录的弹幕导出为ASS字幕文件，返回导出和丢弃的弹幕数量
+func exportASS(ctx context.Context, liveID store.LiveID, file string) (written, dropped int, e error) {
+	l, err := queryLive(ctx, liveID)
+	if err != nil {
+		return 0, 0, err
+	}
+	sess, err := db.QueryDanmakuSession(ctx, liveID)
+	if err != nil {
+		return 0, 0, err
+	}
+	list, err := db.QueryTimedDanmaku(ctx, liveID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(list) == 0 {
+		return 0, 0, errors.New("这场直播没有记录弹幕")
+	}
+	texts := make([]string, len(list))
+	for i, d := range list {
+		texts[i] = d.Content
+	}
+	if texts, err = translateExport(ctx, texts); err != nil {
+		return 0, 0, err
+	}
+	for i := range list {
+		list[i].Content = texts[i]
+	}
+	switch {
+	case sess == nil:
+		// 旧版本记录的弹幕或者补全的弹幕没有弹幕记录
+	case sess.Status == store.SessionOpen:
+		log.Printf("liveID为 %s 的直播还在记录弹幕，导出的字幕不完整", liveID)
+	case sess.Status == store.SessionInterrupted:
+		log.Printf("liveID为 %s 的直播的弹幕记录曾经中断，可能缺少 %s 之后的弹幕", liveID, time.UnixMilli(sess.CloseTime).Format(timeLayout))
+	}
+	title := l.title
+	if title == "" {
+		title = l.suggestedTitle
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && e == nil {
+			e = err
+		}
+	}()
+	written, err = writeASS(f, liveID, fmt.Sprintf("%s %s", l.name, title), list)
+	return written, len(list) - written, err
+}
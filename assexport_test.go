@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"acfunlivedb/store"
+)
+
+// 弹幕所在行的y坐标
+var assMoveRegexp = regexp.MustCompile(`\\move\(\d+,(\d+),`)
+
+// 写入ASS，返回每条写入的弹幕的y坐标
+func writeTestASS(t *testing.T, list []store.TimedDanmaku) (int, []int, string) {
+	t.Helper()
+	var b strings.Builder
+	n, err := writeASS(&b, "live1", "标题", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ys []int
+	for _, m := range assMoveRegexp.FindAllStringSubmatch(b.String(), -1) {
+		y, _ := strconv.Atoi(m[1])
+		ys = append(ys, y)
+	}
+	return n, ys, b.String()
+}
+
+func TestWriteASSLanes(t *testing.T) {
+	lane := assFontSize + assLaneSpacing
+	scroll := assScrollTime.Milliseconds()
+
+	// 同时发送的弹幕放在不同的行，之前发送的弹幕被丢弃
+	n, ys, _ := writeTestASS(t, []store.TimedDanmaku{
+		{Offset: -1000, Content: "开播前"},
+		{Offset: 0, Content: "第一条"},
+		{Offset: 0, Content: "第二条"},
+		{Offset: 0, Content: "第三条"},
+	})
+	if want := []int{assLaneSpacing, assLaneSpacing + lane, assLaneSpacing + 2*lane}; n != 3 || fmt.Sprint(ys) != fmt.Sprint(want) {
+		t.Errorf("写入 %d 条弹幕，y坐标为 %v，应该写入3条，y坐标为 %v", n, ys, want)
+	}
+
+	// 前一条弹幕移出画面后同一行可以再用
+	n, ys, _ = writeTestASS(t, []store.TimedDanmaku{
+		{Offset: 0, Content: "第一条"},
+		{Offset: 100, Content: "第二条"},
+		{Offset: scroll, Content: "第三条"},
+	})
+	if want := []int{assLaneSpacing, assLaneSpacing + lane, assLaneSpacing}; n != 3 || fmt.Sprint(ys) != fmt.Sprint(want) {
+		t.Errorf("写入 %d 条弹幕，y坐标为 %v，应该写入3条，y坐标为 %v", n, ys, want)
+	}
+
+	// 画面里放不下的弹幕被丢弃
+	lanes := assPlayResY / lane
+	list := make([]store.TimedDanmaku, lanes+5)
+	for i := range list {
+		list[i] = store.TimedDanmaku{Offset: 1000, Content: "刷屏"}
+	}
+	if n, _, _ = writeTestASS(t, list); n != lanes {
+		t.Errorf("同时发送 %d 条弹幕时写入 %d 条，应该写入 %d 条", len(list), n, lanes)
+	}
+}
+
+func TestWriteASSEscape(t *testing.T) {
+	_, _, out := writeTestASS(t, []store.TimedDanmaku{{Offset: 0, Nickname: "a,b", Content: "{\\pos(0,0)}换\n行"}})
+	if !strings.Contains(out, ",Danmu,a b,") {
+		t.Errorf("昵称里的逗号没有替换：%s", out)
+	}
+	if !strings.Contains(out, "}｛＼pos(0,0)｝换 行\n") {
+		t.Errorf("弹幕内容没有转义：%s", out)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 关注的主播开播时检查头像，和记录过的头像都不同时下载保存，保留主播头像的变化
+func startAvatarArchive(ctx context.Context, l *live) {
+	if conf.AvatarDir == "" || l.avatarURL == "" || !isWatched(l.uid) {
+		return
+	}
+	uid, avatarURL := l.uid, l.avatarURL
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer recoverCrash("archiveAvatar")
+		archiveAvatar(ctx, uid, avatarURL)
+	}()
+}
+
+// 记录主播的头像，没有下载过这个头像时下载到avatarDir/主播的uid/日期.扩展名
+func archiveAvatar(ctx context.Context, uid store.UID, avatarURL string) {
+	avatars, err := db.QueryAvatars(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的头像记录出现错误：%v", uid, err)
+		return
+	}
+	now := time.Now()
+	for _, a := range avatars {
+		if a.URL == avatarURL && a.File != "" {
+			queueWrite(fmt.Sprintf("记录uid为 %d 的主播的头像", uid), nil, store.AvatarWrite(uid, avatarURL, now.UnixMilli(), ""))
+			return
+		}
+	}
+
+	var file string
+	err = runThrice(func() error {
+		var err error
+		file, err = downloadAvatar(uid, avatarURL, now)
+		return err
+	})
+	if err != nil {
+		log.Printf("下载uid为 %d 的主播的头像失败：%v", uid, err)
+		return
+	}
+	if len(avatars) == 0 {
+		log.Printf("已保存uid为 %d 的主播的头像 %s", uid, file)
+	} else {
+		log.Printf("uid为 %d 的主播更换了头像，已保存新头像 %s", uid, file)
+	}
+	queueWrite(fmt.Sprintf("保存uid为 %d 的主播的头像文件", uid), nil, store.AvatarWrite(uid, avatarURL, now.UnixMilli(), file))
+}
+
+// 下载头像，保存为avatarDir/主播的uid/日期.扩展名，同一天换了多次头像时在日期后面加上序号，返回保存的文件路径
+func downloadAvatar(uid store.UID, avatarURL string, t time.Time) (string, error) {
+	body, err := fetchImage(avatarURL)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(absPath(conf.AvatarDir), uid.String())
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	date, ext := t.Format("2006-01-02"), imageExt(avatarURL)
+	file := filepath.Join(dir, date+ext)
+	for i := 2; ; i++ {
+		if _, err = os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		file = filepath.Join(dir, fmt.Sprintf("%s-%d%s", date, i, ext))
+	}
+	return file, os.WriteFile(file, body, 0644)
+}
+
+// 打印主播用过的头像
+func printAvatars(ctx context.Context, uid store.UID) {
+	avatars, err := db.QueryAvatars(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的头像记录出现错误：%v", uid, err)
+		return
+	}
+	if len(avatars) == 0 {
+		log.Printf("没有uid为 %d 的主播的头像记录，需要设置avatarDir并关注这个主播", uid)
+		return
+	}
+	for _, a := range avatars {
+		fmt.Printf("首次出现：%s 最后出现：%s 文件：%s 链接：%s\n",
+			time.UnixMilli(a.FirstSeen).Format(timeLayout), time.UnixMilli(a.LastSeen).Format(timeLayout), a.File, a.URL)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	benchLiveID      = "bench"          // 回放的弹幕保存到的直播的liveID
+	benchMaxGap      = 10 * time.Second // 回放时两条弹幕之间最长的间隔，超过时缩短，避免多场直播之间长时间等待
+	benchLogInterval = 10 * time.Second // 打印回放进度的间隔
+)
+
+// bench子命令的参数
+type benchOptions struct {
+	source string       // 读取弹幕的sqlite数据库
+	liveID store.LiveID // 只回放这场直播的弹幕，为空时回放全部
+	speed  float64      // 回放速度的倍数，为0时不等待，尽快写入
+	keep   bool         // 结束后是否保留测试用的数据库
+}
+
+// 解析"bench [数据库文件] [--live liveID] [--speed 倍数] [--keep]"的参数
+func parseBenchArgs(args []string) (*benchOptions, error) {
+	opts := &benchOptions{source: absPath(conf.DBFile), speed: 1}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--live", "--speed":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s 后面需要参数", args[i])
+			}
+			value := args[i+1]
+			if args[i] == "--live" {
+				liveID, err := store.ParseLiveID(value)
+				if err != nil {
+					return nil, err
+				}
+				opts.liveID = liveID
+			} else {
+				speed, err := strconv.ParseFloat(value, 64)
+				if err != nil || speed < 0 {
+					return nil, fmt.Errorf("%s 不是有效的回放速度", value)
+				}
+				opts.speed = speed
+			}
+			i++
+		case "--keep":
+			opts.keep = true
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return nil, fmt.Errorf("不支持的参数 %s", args[i])
+			}
+			opts.source = args[i]
+		}
+	}
+	return opts, nil
+}
+
+// 按原来的时间间隔回放已经保存的弹幕，经过和记录直播间弹幕相同的缓存和写入队列，写入数据库旁边的测试数据库，
+// 用来测量本机能承受的弹幕写入速度
+func bench(ctx context.Context, args []string) (e error) {
+	opts, err := parseBenchArgs(args)
+	if err != nil {
+		return fmt.Errorf(`%w，测试命令为"bench [数据库文件] [--live liveID] [--speed 倍数] [--keep]"`, err)
+	}
+	if _, err = os.Stat(opts.source); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite", "file:"+filepath.ToSlash(opts.source)+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	query := `SELECT sendTime, uid, nickname, content FROM danmaku ORDER BY sendTime;`
+	var queryArgs []interface{}
+	if opts.liveID != "" {
+		query = `SELECT sendTime, uid, nickname, content FROM danmaku WHERE liveID = ? ORDER BY sendTime;`
+		queryArgs = append(queryArgs, opts.liveID)
+	}
+	rows, err := src.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("读取 %s 里的弹幕失败：%w", opts.source, err)
+	}
+	defer rows.Close()
+
+	// 测试数据库和数据库在同一个文件夹里，使用同一个硬盘
+	path := filepath.Join(filepath.Dir(absPath(conf.DBFile)), fmt.Sprintf("bench-%d.db", time.Now().Unix()))
+	target, err := store.OpenSQLite(ctx, path, store.Options{})
+	if err != nil {
+		return fmt.Errorf("创建测试数据库 %s 失败：%w", path, err)
+	}
+	defer func() {
+		_ = target.Close()
+		if opts.keep {
+			log.Printf("测试数据库保存在 %s", path)
+			return
+		}
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) && e == nil {
+				e = err
+			}
+		}
+	}()
+	// 写入队列改为写入测试数据库，结束后等待剩下的写入完成再改回来
+	setWriteTarget(target)
+	defer setWriteTarget(db)
+	// 观众统计的触发器需要直播数据
+	queueWrite("保存测试用的直播数据", nil, store.InsertLiveWrite(&store.Live{
+		LiveID: benchLiveID, UID: 1, Name: "bench", StreamName: benchLiveID, StartTime: time.Now().UnixMilli(),
+	}))
+	flushWrites()
+
+	return replayDanmaku(ctx, rows, opts.speed)
+}
+
+// 回放rows里的弹幕，打印写入速度
+func replayDanmaku(ctx context.Context, rows *sql.Rows, speed float64) error {
+	r := &roomRecorder{liveID: benchLiveID}
+	writeQueue.Lock()
+	total, batches, totalFlush := writeQueue.total, writeQueue.batches, writeQueue.totalFlush
+	writeQueue.maxFlush = 0
+	writeQueue.Unlock()
+
+	start := time.Now()
+	lastFlush, lastLog := start, start
+	var replayed, maxDepth int
+	var first, prev int64
+	var delay time.Duration // 回放到当前弹幕时应该经过的时间
+	for rows.Next() {
+		var d store.Danmaku
+		if err := rows.Scan(&d.SendTime, &d.UID, &d.Nickname, &d.Content); err != nil {
+			return err
+		}
+		if replayed == 0 {
+			first, prev = d.SendTime, d.SendTime
+		}
+		if speed > 0 {
+			gap := time.Duration(d.SendTime-prev) * time.Millisecond
+			if gap > benchMaxGap {
+				gap = benchMaxGap
+			}
+			delay += time.Duration(float64(gap) / speed)
+			if wait := time.Until(start.Add(delay)); wait > 0 && !sleepCtx(ctx, wait) {
+				break
+			}
+		} else if ctx.Err() != nil {
+			break
+		}
+		prev = d.SendTime
+		d.LiveID = benchLiveID
+		d.SendTime = time.Now().UnixMilli()
+		r.Lock()
+		r.danmaku = append(r.danmaku, d)
+		r.Unlock()
+		replayed++
+
+		now := time.Now()
+		if now.Sub(lastFlush) >= danmakuFlushInterval {
+			r.flushDanmaku()
+			lastFlush = now
+		}
+		if depth := len(writeQueue.ch); depth > maxDepth {
+			maxDepth = depth
+		}
+		if now.Sub(lastLog) >= benchLogInterval {
+			log.Printf("已回放 %d 条弹幕，%s", replayed, writeQueueStatus())
+			lastLog = now
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	r.flushDanmaku()
+	flushWrites()
+	elapsed := time.Since(start)
+	if replayed == 0 {
+		return errors.New("没有可以回放的弹幕")
+	}
+
+	writeQueue.Lock()
+	written, flushes := writeQueue.total-total, writeQueue.batches-batches
+	flushTime, maxFlush := writeQueue.totalFlush-totalFlush, writeQueue.maxFlush
+	writeQueue.Unlock()
+	seconds := elapsed.Seconds()
+	log.Printf("回放了 %d 条弹幕（原来的时间跨度为 %s），用时 %s，平均每秒 %.1f 条", replayed,
+		(time.Duration(prev-first) * time.Millisecond).Round(time.Second), elapsed.Round(time.Millisecond), float64(replayed)/seconds)
+	log.Printf("写入了 %d 条数据，共 %d 个事务，写入数据库用时 %s，最长的事务用时 %s，写入队列最长为 %d",
+		written, flushes, flushTime.Round(time.Millisecond), maxFlush.Round(time.Millisecond), maxDepth)
+	if flushTime > 0 {
+		log.Printf("数据库每秒最多能写入约 %.0f 条弹幕", float64(written)/flushTime.Seconds())
+	}
+	return nil
+}
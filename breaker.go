@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	breakerThreshold   = 5                // 连续失败这么多次后断开
+	breakerCooldown    = 30 * time.Second // 断开后第一次尝试恢复的等待时间，之后每次恢复失败翻倍
+	breakerMaxCooldown = 10 * time.Minute // 尝试恢复的最长等待时间
+	retryDelay         = 10 * time.Second // 重试的等待时间
+	retryBudgetMax     = 10               // 最多可以累积的重试次数
+	retryBudgetRatio   = 0.2              // 每次成功的请求增加的重试次数
+)
+
+// errBreakerOpen 表示接口的熔断器已经断开，没有发出请求
+var errBreakerOpen = errors.New("接口连续失败，暂时停止请求")
+
+// 每个接口的熔断器，连续失败后断开一段时间，之后只放行一个请求试探接口是否恢复。
+// 重试需要消耗重试次数，成功的请求会慢慢补充，避免接口出错时大量重试
+type breaker struct {
+	sync.Mutex
+	name      string
+	failures  int       // 连续失败的次数
+	openUntil time.Time // 断开到这个时间，为零值时没有断开
+	cooldown  time.Duration
+	probing   bool    // 是否正在试探接口是否恢复
+	budget    float64 // 剩余的重试次数
+	rejected  int64   // 因为断开没有发出的请求数量
+	lastErr   string  // 最近一次请求的错误
+}
+
+var (
+	liveListBreaker = newBreaker("直播间列表")
+	liveCutBreaker  = newBreaker("直播剪辑")
+	summaryBreaker  = newBreaker("直播总结")
+	playbackBreaker = newBreaker("录播")
+	liveInfoBreaker = newBreaker("主播直播信息")
+	fanClubBreaker  = newBreaker("守护团")
+
+	breakers = []*breaker{liveListBreaker, liveCutBreaker, summaryBreaker, playbackBreaker, liveInfoBreaker, fanClubBreaker}
+)
+
+func newBreaker(name string) *breaker {
+	return &breaker{name: name, budget: retryBudgetMax}
+}
+
+// 是否可以发出请求，断开的时间结束后放行一个试探的请求
+func (b *breaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return true
+	case b.probing || time.Now().Before(b.openUntil):
+		b.rejected++
+		return false
+	default:
+		b.probing = true
+		log.Printf("尝试恢复请求%s接口", b.name)
+		return true
+	}
+}
+
+// 记录请求的结果
+func (b *breaker) record(err error) {
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		if !b.openUntil.IsZero() {
+			log.Printf("%s接口已经恢复", b.name)
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.cooldown = 0
+		b.probing = false
+		b.lastErr = ""
+		if b.budget += retryBudgetRatio; b.budget > retryBudgetMax {
+			b.budget = retryBudgetMax
+		}
+		return
+	}
+	b.failures++
+	b.lastErr = err.Error()
+	switch {
+	case b.probing:
+		b.probing = false
+		if b.cooldown *= 2; b.cooldown > breakerMaxCooldown {
+			b.cooldown = breakerMaxCooldown
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+		log.Printf("%s接口仍然出错，%s后再尝试恢复", b.name, b.cooldown)
+	case b.openUntil.IsZero() && b.failures >= breakerThreshold:
+		b.cooldown = breakerCooldown
+		b.openUntil = time.Now().Add(b.cooldown)
+		log.Printf("%s接口连续失败 %d 次，%s内停止请求", b.name, b.failures, b.cooldown)
+	}
+}
+
+// 消耗一次重试次数，没有剩余的重试次数时返回false
+func (b *breaker) takeRetry() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.budget < 1 {
+		return false
+	}
+	b.budget--
+	return true
+}
+
+// 通过熔断器请求一次接口，不重试
+func (b *breaker) once(f func() error) error {
+	if !b.allow() {
+		return fmt.Errorf("请求%s接口失败：%w", b.name, errBreakerOpen)
+	}
+	err := f()
+	b.record(err)
+	return err
+}
+
+// 通过熔断器请求接口，出错时最多请求三次，熔断器断开或没有剩余的重试次数时不再重试
+func (b *breaker) run(f func() error) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			if !b.takeRetry() {
+				break
+			}
+			time.Sleep(retryDelay)
+		}
+		if !b.allow() {
+			if err == nil {
+				err = errBreakerOpen
+			}
+			break
+		}
+		if err = f(); err == nil {
+			b.record(nil)
+			return nil
+		}
+		b.record(err)
+		log.Printf("%v", err)
+	}
+	return fmt.Errorf("请求%s接口失败：%w", b.name, err)
+}
+
+// 熔断器的状态，用于expvar
+func breakerVars() map[string]interface{} {
+	vars := make(map[string]interface{}, len(breakers))
+	for _, b := range breakers {
+		b.Lock()
+		vars[b.name] = map[string]interface{}{
+			"open":     !b.openUntil.IsZero(),
+			"failures": b.failures,
+			"budget":   b.budget,
+			"rejected": b.rejected,
+			"lastErr":  b.lastErr,
+		}
+		b.Unlock()
+	}
+	return vars
+}
+
+// 所有熔断器的状态
+func breakerStatus() string {
+	lines := make([]string, 0, len(breakers))
+	for _, b := range breakers {
+		b.Lock()
+		state := "正常"
+		if !b.openUntil.IsZero() {
+			if b.probing {
+				state = "正在尝试恢复"
+			} else {
+				state = fmt.Sprintf("断开到 %s", b.openUntil.Format(timeLayout))
+			}
+		}
+		line := fmt.Sprintf("%s接口：%s，连续失败 %d 次，剩余重试次数 %.1f，停止请求 %d 次", b.name, state, b.failures, b.budget, b.rejected)
+		if b.lastErr != "" {
+			line += "，最近的错误：" + b.lastErr
+		}
+		b.Unlock()
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 保存的一次获取直播间列表的结果
+type captureRecord struct {
+	Time       int64          `json:"time"`                 // 获取的时间，单位为毫秒
+	Initial    bool           `json:"initial,omitempty"`    // 为true时是启动时从数据库读取的上次运行时正在直播的直播
+	Error      string         `json:"error,omitempty"`      // 获取失败时的错误，这时没有其他数据
+	Lives      []captureLive  `json:"lives"`                // 直播间列表接口返回的直播
+	ForceEnded []store.LiveID `json:"forceEnded,omitempty"` // 直播时长超过maxLiveHours并确认已经下播或直播间弹幕收到下播信号，从列表里去掉的liveID
+	Kept       []store.LiveID `json:"kept,omitempty"`       // 不在列表里但确认仍在进行，从上一次的列表放回的liveID
+}
+
+// 保存的直播，只有对比直播间列表时用到的数据
+type captureLive struct {
+	LiveID     store.LiveID `json:"liveID"`
+	UID        store.UID    `json:"uid"`
+	Name       string       `json:"name"`
+	Title      string       `json:"title"`
+	StartTime  int64        `json:"startTime"`
+	Access     string       `json:"access,omitempty"`
+	StreamName string       `json:"streamName,omitempty"`
+}
+
+// 按天保存每次获取的直播间列表，没有设置captureDir时为nil，所有方法都不做任何事
+type monitorCapture struct {
+	w *dailyWriter
+}
+
+// 打开captureDir，没有设置或打开失败时返回nil
+func newMonitorCapture() *monitorCapture {
+	dir := absPath(conf.CaptureDir)
+	if dir == "" {
+		return nil
+	}
+	w, err := newDailyWriter(dir)
+	if err != nil {
+		log.Printf("打开保存直播间列表的文件夹 %s 失败，不保存直播间列表：%v", dir, err)
+		return nil
+	}
+	log.Printf("每次获取的直播间列表会保存到 %s", dir)
+	return &monitorCapture{w: w}
+}
+
+func (c *monitorCapture) close() {
+	if c != nil {
+		_ = c.w.Close()
+	}
+}
+
+// 保存启动时读取的上次运行时正在直播的直播
+func (c *monitorCapture) initial(list map[store.LiveID]live) {
+	if c == nil {
+		return
+	}
+	c.write(&captureRecord{Time: time.Now().UnixMilli(), Initial: true, Lives: toCaptureLives(list)})
+}
+
+// 保存获取失败
+func (c *monitorCapture) failed(fetchTime time.Time, err error) {
+	if c == nil {
+		return
+	}
+	c.write(&captureRecord{Time: fetchTime.UnixMilli(), Error: err.Error()})
+}
+
+// 复制接口返回的直播间列表，之后的检查会修改列表
+func (c *monitorCapture) snapshot(list map[store.LiveID]live) map[store.LiveID]live {
+	if c == nil {
+		return nil
+	}
+	raw := make(map[store.LiveID]live, len(list))
+	for liveID, l := range list {
+		raw[liveID] = l
+	}
+	return raw
+}
+
+// 保存接口返回的直播间列表raw，和检查后用于对比的列表newList的区别
+func (c *monitorCapture) cycle(fetchTime time.Time, raw, newList map[store.LiveID]live) {
+	if c == nil {
+		return
+	}
+	r := &captureRecord{Time: fetchTime.UnixMilli(), Lives: toCaptureLives(raw)}
+	for _, liveID := range sortedLiveIDs(raw) {
+		if _, ok := newList[liveID]; !ok {
+			r.ForceEnded = append(r.ForceEnded, liveID)
+		}
+	}
+	for _, liveID := range sortedLiveIDs(newList) {
+		if _, ok := raw[liveID]; !ok {
+			r.Kept = append(r.Kept, liveID)
+		}
+	}
+	c.write(r)
+}
+
+func (c *monitorCapture) write(r *captureRecord) {
+	data, err := json.Marshal(r)
+	if err == nil {
+		_, err = c.w.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("保存直播间列表失败：%v", err)
+	}
+}
+
+func toCaptureLives(list map[store.LiveID]live) []captureLive {
+	lives := make([]captureLive, 0, len(list))
+	for _, liveID := range sortedLiveIDs(list) {
+		l := list[liveID]
+		lives = append(lives, captureLive{
+			LiveID:     l.liveID,
+			UID:        l.uid,
+			Name:       l.name,
+			Title:      l.title,
+			StartTime:  l.startTime,
+			Access:     l.access,
+			StreamName: l.streamName,
+		})
+	}
+	return lives
+}
+
+func fromCaptureLives(lives []captureLive) map[store.LiveID]live {
+	list := make(map[store.LiveID]live, len(lives))
+	for _, c := range lives {
+		list[c.LiveID] = live{
+			liveID:     c.LiveID,
+			uid:        c.UID,
+			name:       c.Name,
+			title:      c.Title,
+			startTime:  c.StartTime,
+			access:     c.Access,
+			streamName: c.StreamName,
+		}
+	}
+	return list
+}
+
+// replay子命令，按顺序读取captureDir里保存的直播间列表，用和运行时相同的对比逻辑打印每次的处理，不访问网络也不修改数据库
+func replay(ctx context.Context, args []string) error {
+	const usage = "replay 子命令的参数为 [--uid 主播的uid] 文件..."
+	var uid store.UID
+	var files []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--uid" {
+			if i+1 >= len(args) {
+				return errors.New(usage)
+			}
+			id, err := store.ParseUID(args[i+1])
+			if err != nil {
+				return err
+			}
+			uid = id
+			i++
+			continue
+		}
+		files = append(files, args[i])
+	}
+	if len(files) == 0 {
+		return errors.New(usage)
+	}
+
+	var oldList map[store.LiveID]live
+	var cycles, failures, decisions int
+	for _, file := range files {
+		err := readCapture(file, func(r *captureRecord) {
+			if ctx.Err() != nil {
+				return
+			}
+			at := time.UnixMilli(r.Time).Format(timeLayout)
+			switch {
+			case r.Initial:
+				oldList = fromCaptureLives(r.Lives)
+				fmt.Printf("%s 启动，上次运行时正在直播的直播有 %d 场\n", at, len(oldList))
+				return
+			case r.Error != "":
+				failures++
+				fmt.Printf("%s 获取直播间列表失败：%s\n", at, r.Error)
+				return
+			}
+			if oldList == nil {
+				// 从中途开始保存的文件，第一次的列表作为之前的状态
+				oldList = fromCaptureLives(r.Lives)
+				fmt.Printf("%s 没有启动时的记录，从这次的 %d 场直播开始回放\n", at, len(oldList))
+				return
+			}
+			cycles++
+			newList := fromCaptureLives(r.Lives)
+			for _, liveID := range r.ForceEnded {
+				if uid == 0 || newList[liveID].uid == uid {
+					fmt.Printf("%s liveID为 %s 的直播已经确认下播（超过最长直播时长或直播间弹幕收到下播信号），从列表里去掉\n", at, liveID)
+				}
+				delete(newList, liveID)
+			}
+			for _, liveID := range r.Kept {
+				if l, ok := oldList[liveID]; ok {
+					newList[liveID] = l
+					if uid == 0 || l.uid == uid {
+						fmt.Printf("%s liveID为 %s 的直播不在列表里，但确认仍在进行\n", at, liveID)
+					}
+				}
+			}
+			for _, d := range diffLiveLists(oldList, newList) {
+				if uid == 0 || d.l.uid == uid {
+					decisions++
+					fmt.Printf("%s %s\n", at, d.describe())
+				}
+			}
+			oldList = newList
+		})
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败：%w", file, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	fmt.Printf("回放了 %d 次获取，%d 次获取失败，共 %d 个处理\n", cycles, failures, decisions)
+	return nil
+}
+
+// 按顺序读取保存的直播间列表，.gz结尾的文件先解压
+func readCapture(file string, f func(r *captureRecord)) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var r io.Reader = src
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec captureRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("第 %d 行不是有效的记录：%w", line, err)
+		}
+		f(&rec)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"acfunlivedb/store"
+)
+
+const (
+	changesDefaultLimit = 500  // /changes默认返回的变更数量
+	changesMaxLimit     = 5000 // /changes最多返回的变更数量
+	minCursorTime       = 1e12 // since不小于这个数字时当作毫秒时间戳，否则当作seq
+)
+
+// /changes返回的一条变更
+type changeJSON struct {
+	Seq        int64        `json:"seq"`            // 变更的序号
+	LiveID     store.LiveID `json:"liveID"`         // 直播ID
+	ChangeTime int64        `json:"changeTime"`     // 变更时间，单位为毫秒
+	Deleted    bool         `json:"deleted"`        // 直播是否已经被删除
+	Live       *liveJSON    `json:"live,omitempty"` // 直播数据，直播被彻底删除时没有
+}
+
+// /changes的返回结果
+type changesJSON struct {
+	Changes []changeJSON `json:"changes"` // 按seq从小到大排列的变更
+	Next    int64        `json:"next"`    // 下一次请求的since
+	More    bool         `json:"more"`    // 是否还有没有返回的变更
+}
+
+// GET /changes?since=&limit= 返回since之后有变更的直播，since可以是上一次返回的next或毫秒时间戳、日期，
+// 没有since时从头开始。下游按next依次请求就能增量同步所有直播数据
+func handleChanges(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	params := r.URL.Query()
+	var q store.ChangeQuery
+	since := params.Get("since")
+	if n, err := strconv.ParseInt(since, 10, 64); err == nil && n >= 0 && n < minCursorTime {
+		q.After = n
+	} else if q.Since, err = parseTimeParam("since", since, false); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Limit = changesDefaultLimit
+	if s := params.Get("limit"); s != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit 参数 %s 不是正整数", s))
+			return
+		}
+		if q.Limit > changesMaxLimit {
+			q.Limit = changesMaxLimit
+		}
+	}
+
+	// 按时间查询时先取得最后的seq，没有变更时从这里继续不会遗漏之后的变更
+	next := q.After
+	var err error
+	if q.Since != 0 {
+		next, err = db.LastChangeSeq(r.Context())
+	}
+	var changes []store.LiveChange
+	if err == nil {
+		changes, err = db.QueryChanges(r.Context(), q)
+	}
+	if err != nil {
+		log.Printf("查询直播数据的变更出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据的变更出现错误"))
+		return
+	}
+
+	result := changesJSON{Changes: make([]changeJSON, len(changes)), Next: next, More: len(changes) == q.Limit}
+	for i, c := range changes {
+		result.Changes[i] = changeJSON{Seq: c.Seq, LiveID: c.LiveID, ChangeTime: c.ChangeTime, Deleted: c.Deleted}
+		if c.Live != nil {
+			l := fromStore(c.Live)
+			result.Changes[i].Live = l.toJSON()
+		}
+		result.Next = c.Seq
+	}
+	writeJSON(w, http.StatusOK, result)
+}
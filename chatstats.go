@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 处理"stats liveID"命令，打印直播的弹幕统计和每分钟弹幕数的走势图
+func printChatStats(ctx context.Context, liveID store.LiveID) {
+	s, err := db.QueryChatStats(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的弹幕统计出现错误：%v", liveID, err)
+		return
+	}
+	if s == nil {
+		log.Printf("liveID为 %s 的直播没有弹幕统计，需要记录弹幕，以前记录的弹幕可以用 recompute chat 生成统计", liveID)
+		return
+	}
+	counts := s.Minutes()
+	average := 0.0
+	if len(counts) != 0 {
+		average = float64(s.MessageCount) / float64(len(counts))
+	}
+	peakOffset := int64(s.PeakMinute) * time.Minute.Milliseconds()
+	fmt.Printf("liveID：%s 开播时间：%s 弹幕数：%d 发送弹幕的观众：%d 平均每分钟：%.1f 条\n",
+		s.LiveID, time.UnixMilli(s.StartTime).Format(timeLayout), s.MessageCount, s.ChatterCount, average)
+	fmt.Printf("弹幕最多的一分钟：%s（%s）%d 条\n", formatOffset(peakOffset),
+		time.UnixMilli(s.StartTime+peakOffset).Format(timeLayout), s.PeakCount)
+	for start := 0; start < len(counts); start += activityMinutesPerRow {
+		end := start + activityMinutesPerRow
+		if end > len(counts) {
+			end = len(counts)
+		}
+		fmt.Printf("%s │%s│\n", formatOffset(int64(start)*time.Minute.Milliseconds()), sparkline(counts[start:end], s.PeakCount))
+	}
+}
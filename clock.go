@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultClockSource   = "https://live.acfun.cn/" // 默认对时的网址
+	defaultClockMaxDrift = 10                       // 默认的本机时间最大误差，单位为秒
+	clockCheckInterval   = time.Hour                // 检查本机时间的间隔
+)
+
+// 检查本机时间的设置
+type clockConfig struct {
+	Source          string `json:"source"`          // 对时的网址，用响应头Date里的时间和本机时间比较
+	MaxDriftSeconds int    `json:"maxDriftSeconds"` // 本机时间和对时网址的时间相差超过这个秒数时警告，小于等于0时不检查
+}
+
+// 最近一次检查本机时间的结果
+var clockStatus = struct {
+	sync.Mutex
+	drift   time.Duration // 本机时间减去对时网址的时间，本机时间较快时为正数
+	checked bool          // 是否成功检查过
+	warned  bool          // 上一次检查是否超过误差
+}{}
+
+// 定期检查本机时间，误差超过设置时警告
+func clockCycle(ctx context.Context) {
+	if conf.Clock.MaxDriftSeconds <= 0 {
+		return
+	}
+	for {
+		checkClock()
+		if !sleepCtx(ctx, clockCheckInterval) {
+			return
+		}
+	}
+}
+
+// 检查一次本机时间，误差超过设置时警告，恢复正常时也会提示
+func checkClock() {
+	source := conf.Clock.Source
+	if source == "" {
+		source = defaultClockSource
+	}
+	drift, err := fetchClockDrift(source)
+	if err != nil {
+		log.Printf("检查本机时间失败：%v", err)
+		return
+	}
+	maxDrift := time.Duration(conf.Clock.MaxDriftSeconds) * time.Second
+	over := drift > maxDrift || drift < -maxDrift
+	clockStatus.Lock()
+	warned := clockStatus.warned
+	clockStatus.drift, clockStatus.checked, clockStatus.warned = drift, true, over
+	clockStatus.Unlock()
+	if over {
+		log.Printf("警告：本机时间比 %s 的时间%s %s，超过了 %d 秒，开播时间的比较和定时任务可能出错，请检查本机的时间同步（NTP）设置",
+			source, clockDriftDirection(drift), drift.Abs().Round(time.Second), conf.Clock.MaxDriftSeconds)
+	} else if warned {
+		log.Printf("本机时间已经恢复正常，和 %s 的时间相差 %s", source, drift.Round(time.Second))
+	}
+}
+
+// 本机时间较快还是较慢
+func clockDriftDirection(drift time.Duration) string {
+	if drift > 0 {
+		return "快"
+	}
+	return "慢"
+}
+
+// 用HEAD请求获取网址的响应头Date，返回本机时间减去网址的时间，以请求前后的中间时间为本机时间
+func fetchClockDrift(url string) (time.Duration, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodHead)
+	req.Header.SetUserAgent(userAgent)
+	resp.SkipBody = true
+	start := time.Now()
+	if err := client.Do(req, resp); err != nil {
+		return 0, err
+	}
+	local := start.Add(time.Since(start) / 2)
+	date := string(resp.Header.Peek(fasthttp.HeaderDate))
+	if date == "" {
+		return 0, fmt.Errorf("%s 的响应没有Date头", url)
+	}
+	remote, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("解析 %s 的响应头Date %q 失败：%w", url, date, err)
+	}
+	// Date只精确到秒，取这一秒的中间
+	return local.Sub(remote.Add(500 * time.Millisecond)), nil
+}
+
+// 最近一次检查的本机时间误差，单位为毫秒，还没有成功检查时ok为false
+func clockDrift() (drift int64, ok bool) {
+	clockStatus.Lock()
+	defer clockStatus.Unlock()
+	return clockStatus.drift.Milliseconds(), clockStatus.checked
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 本程序的子命令，所有子命令共用设置文件和数据库
+type subcommand struct {
+	name  string                                         // 子命令名
+	usage string                                         // 参数的用法
+	desc  string                                         // 说明
+	run   func(ctx context.Context, args []string) error // 运行子命令，args为子命令名之后的参数
+	write bool                                           // 是否写入数据库，写入时锁定数据库，否则只读打开，可以和运行中的本程序同时使用
+}
+
+// 所有子命令，没有指定子命令时运行serve
+var subcommands = []subcommand{
+	{"serve", "", "获取直播间列表并记录直播数据，可以在终端输入命令，没有指定子命令时运行这个", serve, true},
+	{"query", "[--csv|--json] SELECT ...", "执行只读的SQL查询并打印结果后退出", func(ctx context.Context, args []string) error {
+		return runSQL(ctx, strings.Join(args, " "))
+	}, false},
+	{"export", "jsonl 文件路径 [--chunk 行数] [--workers 数量] | csv 文件路径 [编码] [--chunk 行数] [--workers 数量] | ics 主播的uid 文件路径 | ass liveID [文件路径] | openapi 文件路径", "导出直播数据、日历、弹幕字幕或OpenAPI文档后退出", runExport, false},
+	{"export-ass", "liveID [文件路径]", "把直播记录的弹幕导出为ASS字幕后退出，和 export ass 相同", func(ctx context.Context, args []string) error {
+		return runExport(ctx, append([]string{"ass"}, args...))
+	}, false},
+	{"migrate", "", "创建或更新数据库的表和触发器后退出，升级本程序后可以先运行这个确认数据库能正常打开", migrate, true},
+	{"backfill", "[stats|schedule|engagement|chat]", "根据已有的直播数据和弹幕重新生成统计数据后退出，省略时重新生成全部", recompute, true},
+	{"tenant", "list | add 用户名 | key 用户名 | revoke 用户名 | remove 用户名", "管理共用本实例的用户和用户的API key后退出", runTenant, true},
+	{"replay", "[--uid 主播的uid] 文件...", "回放captureDir里保存的直播间列表，打印每次获取时的开播下播等处理后退出", replay, false},
+	{"bench", "[数据库文件] [--live liveID] [--speed 倍数] [--keep]", "回放数据库里的弹幕，测量本机能承受的弹幕写入速度后退出", bench, true},
+}
+
+// 查找子命令，没有时返回nil
+func findSubcommand(name string) *subcommand {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// 打印本程序的用法
+func printUsage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "用法：%s [选项] [子命令] [参数]\n\n子命令：\n", filepath.Base(os.Args[0]))
+	for _, c := range subcommands {
+		fmt.Fprintf(w, "  %s\n    \t%s\n", strings.TrimSpace(c.name+" "+c.usage), c.desc)
+	}
+	fmt.Fprintln(w, "\n选项：")
+	flag.PrintDefaults()
+}
+
+// 打开数据库时已经创建或更新了表和触发器，这里只需要报告结果
+func migrate(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("migrate 子命令没有参数")
+	}
+	log.Printf("数据库 %s 的表和触发器已经是最新的", absPath(conf.DBFile))
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	commandHookStderrLimit   = 500 // 命令出错时打印的错误输出的最大字节数
+	defaultCommandHookMaxAge = 600 // 默认的事件过期时间，单位为秒
+)
+
+// 关注的主播开播、下播和录播生成时运行的外部命令的设置
+type commandHookConfig struct {
+	OnLiveStart     string `json:"onLiveStart"`     // 开播时运行的命令，为空时不运行
+	OnLiveEnd       string `json:"onLiveEnd"`       // 下播时运行的命令，为空时不运行
+	OnPlaybackReady string `json:"onPlaybackReady"` // 下播后录播生成时运行的命令，为空时不运行
+	Timeout         int    `json:"timeout"`         // 命令运行的最长时间，单位为秒，超过后结束命令，小于等于0时不限制
+	MaxAge          int    `json:"maxAge"`          // 事件产生后超过这个秒数还没有运行时不再运行，小于等于0时不限制
+}
+
+// 开播时运行外部命令
+func commandHookLiveStart(l *live) {
+	if conf.CommandHook.OnLiveStart == "" || !isWatched(l.uid) {
+		return
+	}
+	queueCommandHook(&liveHookJSON{
+		Event:     changeStart,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+	})
+}
+
+// 重连时运行开播时的命令，事件为reconnect
+func commandHookLiveReconnect(prev store.LiveID, l *live) {
+	if conf.CommandHook.OnLiveStart == "" || !isWatched(l.uid) {
+		return
+	}
+	queueCommandHook(&liveHookJSON{
+		Event:          changeReconnect,
+		LiveID:         l.liveID,
+		UID:            l.uid,
+		Name:           l.name,
+		Title:          l.title,
+		StartTime:      l.startTime,
+		PreviousLiveID: prev,
+	})
+}
+
+// 下播时运行外部命令
+func commandHookLiveEnd(l *live, duration int64) {
+	if conf.CommandHook.OnLiveEnd == "" || !isWatched(l.uid) {
+		return
+	}
+	queueCommandHook(&liveHookJSON{
+		Event:     changeEnd,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+		Duration:  duration,
+	})
+}
+
+// 录播生成时运行命令
+func commandHookPlaybackReady(hook *liveHookJSON) {
+	if conf.CommandHook.OnPlaybackReady == "" {
+		return
+	}
+	queueCommandHook(hook)
+}
+
+// 事件对应的命令，没有设置时为空
+func commandHookCommand(event changeKind) string {
+	switch event {
+	case changeStart, changeReconnect:
+		return conf.CommandHook.OnLiveStart
+	case changePlayback:
+		return conf.CommandHook.OnPlaybackReady
+	}
+	return conf.CommandHook.OnLiveEnd
+}
+
+// 把事件保存到通知队列，由notifyCycle运行命令，命令启动失败时重试，本程序重启后不会丢失事件
+func queueCommandHook(hook *liveHookJSON) {
+	queueNotification("commandHook", hook.UID, hook.LiveID, hook)
+}
+
+// 通知队列里的事件过期的时间，本程序长时间停止后重启时不再运行过期的开播命令等
+func commandHookMaxAge() time.Duration {
+	return time.Duration(conf.CommandHook.MaxAge) * time.Second
+}
+
+// 运行通知队列里的事件对应的命令，命令已经从设置里删除时不再运行
+func sendCommandHookPayload(payload []byte) error {
+	var hook liveHookJSON
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return err
+	}
+	command := commandHookCommand(hook.Event)
+	if command == "" {
+		return errNotifyDisabled
+	}
+	return runCommandHook(command, &hook)
+}
+
+// 在后台运行命令，事件数据通过环境变量和标准输入的JSON传给命令，不等待命令结束，返回启动命令的错误
+func runCommandHook(command string, hook *liveHookJSON) error {
+	args := strings.Fields(command)
+	stdin, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.Background(), func() {}
+	if conf.CommandHook.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(conf.CommandHook.Timeout)*time.Second)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), commandHookEnv(hook)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stderr := &tailBuffer{limit: commandHookStderrLimit}
+	cmd.Stderr = stderr
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return fmt.Errorf("运行%s命令失败：%w", liveHookName(hook.Event), err)
+	}
+	go func() {
+		defer recoverCrash("runCommandHook")
+		defer cancel()
+		if err := cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%w，%s", err, msg)
+			}
+			log.Printf("liveID为 %s 的%s命令出现错误：%v", hook.LiveID, liveHookName(hook.Event), err)
+		}
+	}()
+	return nil
+}
+
+// 传给命令的环境变量
+func commandHookEnv(hook *liveHookJSON) []string {
+	env := []string{
+		"ACFUNLIVEDB_EVENT=" + string(hook.Event),
+		"ACFUNLIVEDB_LIVE_ID=" + hook.LiveID.String(),
+		"ACFUNLIVEDB_UID=" + hook.UID.String(),
+		"ACFUNLIVEDB_NAME=" + hook.Name,
+		"ACFUNLIVEDB_TITLE=" + hook.Title,
+		"ACFUNLIVEDB_START_TIME=" + strconv.FormatInt(hook.StartTime, 10),
+		"ACFUNLIVEDB_ROOM_URL=" + liveRoomURL(hook.UID),
+	}
+	if hook.PreviousLiveID != "" {
+		env = append(env, "ACFUNLIVEDB_PREVIOUS_LIVE_ID="+hook.PreviousLiveID.String())
+	}
+	if hook.Event != changeStart && hook.Event != changeReconnect {
+		env = append(env, "ACFUNLIVEDB_DURATION="+strconv.FormatInt(hook.Duration, 10))
+	}
+	if hook.PlaybackURL != "" {
+		env = append(env, "ACFUNLIVEDB_PLAYBACK_URL="+hook.PlaybackURL, "ACFUNLIVEDB_BACKUP_URL="+hook.BackupURL)
+	}
+	return env
+}
+
+// 只保留最后写入的limit字节，避免长时间运行的命令的错误输出占用太多内存
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > 2*b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	if len(b.buf) > b.limit {
+		return strings.ToValidUTF8(string(b.buf[len(b.buf)-b.limit:]), "")
+	}
+	return string(b.buf)
+}
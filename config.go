@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"acfunlivedb/store"
+)
+
+const (
+	configFile          = "config.json"
+	defaultMaxLiveHours = 72
+)
+
+// 本程序的设置，字段带有`secret:"true"`标签的设置在打印时会被隐藏
+type config struct {
+	ShowBanner bool   `json:"showBanner"` // 启动时是否打印版本和设置信息
+	DBFile     string `json:"dbFile"`     // 数据库文件路径，相对路径以本程序所在文件夹为准
+	LogDir     string `json:"logDir"`     // 按天保存日志的文件夹，相对路径以本程序所在文件夹为准，为空时不保存日志
+	CrashDir   string `json:"crashDir"`   // 保存崩溃记录的文件夹，相对路径以本程序所在文件夹为准，为空时出现panic会结束运行
+	CaptureDir string `json:"captureDir"` // 按天保存每次获取的直播间列表的文件夹，用于replay子命令，为空时不保存
+
+	EncryptionKey string `json:"encryptionKey" secret:"true"` // 加密数据库里录播链接的密钥，为空时不加密
+
+	MaxLiveHours     int  `json:"maxLiveHours"`     // 直播持续超过这个小时数时重新确认直播状态，已下播的会强制结束，小于等于0时不检查
+	VerifyLiveEnd    bool `json:"verifyLiveEnd"`    // 直播不在直播间列表里时是否先通过主播的直播信息确认已经下播
+	SuggestTitle     bool `json:"suggestTitle"`     // 直播间没有标题时是否根据弹幕或主播签名生成建议标题
+	DeletedRetention int  `json:"deletedRetention"` // 删除的直播数据保留的天数，超过后彻底删除，小于等于0时不彻底删除
+	ArchiveDays      int  `json:"archiveDays"`      // 开播超过这个天数的直播按年份移到归档数据库，小于等于0时不自动归档
+	ShutdownTimeout  int  `json:"shutdownTimeout"`  // 退出时等待未完成的任务的最长秒数，超过后写入退出报告并强制退出，小于等于0时一直等待
+
+	WatchUIDs       []store.UID   `json:"watchUIDs"`       // 关注的主播uid，只记录直播数据
+	Watch           []watchTarget `json:"watch"`           // 关注的主播和对这些主播开启的记录功能
+	CoverDir        string        `json:"coverDir"`        // 保存直播封面的文件夹，相对路径以本程序所在文件夹为准
+	AvatarDir       string        `json:"avatarDir"`       // 保存关注的主播用过的头像的文件夹，相对路径以本程序所在文件夹为准，为空时不保存
+	LiveCut         liveCutConfig `json:"liveCut"`         // 定期确认关注的主播的直播剪辑是否还存在和下载直播剪辑的设置
+	IdleHours       int           `json:"idleHours"`       // 关注的主播超过这个小时数没有直播时进入空闲模式，小于等于0时不进入空闲模式
+	IdlePollSeconds int           `json:"idlePollSeconds"` // 空闲模式下获取直播间列表的间隔，单位为秒
+	Clock           clockConfig   `json:"clock"`           // 检查本机时间的设置
+
+	InvalidateWebhooks []string          `json:"invalidateWebhooks" secret:"true"` // 直播数据有变动时通知的webhook链接
+	ReconnectWindow    int               `json:"reconnectWindow"`                  // 主播下播后在这个秒数内重新开播时合并开播和下播通知，小于等于0时不合并
+	LiveHook           liveHookConfig    `json:"liveHook"`                         // 开播和下播时通知的webhook的设置
+	Telegram           telegramConfig    `json:"telegram"`                         // 关注的主播开播和有直播剪辑、录播时发送的Telegram机器人通知的设置
+	Push               pushConfig        `json:"push"`                             // 关注的主播开播和下播时推送到自建的ntfy或Gotify服务器的设置
+	OneBot             oneBotConfig      `json:"oneBot"`                           // 关注的主播开播时通过OneBot协议的QQ机器人发送到QQ群的设置
+	Matrix             matrixConfig      `json:"matrix"`                           // 关注的主播开播和下播时发送到Matrix房间的设置
+	Desktop            desktopConfig     `json:"desktop"`                          // 关注的主播开播时在本机弹出桌面通知的设置
+	NotifyRoutes       notifyRouteConfig `json:"notifyRoutes"`                     // 按主播uid或直播间标题把通知发送到指定的通知目标的设置
+	Templates          templateConfig    `json:"templates"`                        // 各个通知的消息模板，为空时使用默认的消息
+	Sink               sinkConfig        `json:"sink"`                             // 把开播和下播事件发送到Kafka或NATS JetStream的设置
+	CommandHook        commandHookConfig `json:"commandHook"`                      // 关注的主播开播、下播和录播生成时运行的外部命令的设置
+
+	RankingTop       int  `json:"rankingTop"`       // 每次获取直播间列表时保存在线人数前几名的直播间，小于等于0时不保存
+	RecordViewers    bool `json:"recordViewers"`    // 是否在每次获取直播间列表时保存关注的主播的直播间的在线人数和点赞数
+	RecordModeration bool `json:"recordModeration"` // 是否记录关注的主播的直播间的违规警告等管理事件，记录弹幕的直播总是记录
+	RecordDanmaku    bool `json:"recordDanmaku"`    // 是否记录所有关注的主播的弹幕和礼物，为false时只记录watch里设置了danmaku的主播
+	FollowerHours    int  `json:"followerHours"`    // 每隔这个小时数保存一次关注的主播的粉丝数和关注数，小于等于0时不保存
+
+	CSVEncoding string          `json:"csvEncoding"` // 导出CSV文件的编码，可以是utf-8、utf-8-bom或gbk，用Excel打开时建议使用utf-8-bom或gbk
+	Translate   translateConfig `json:"translate"`   // 导出弹幕时的翻译设置
+	Digest      digestConfig    `json:"digest"`      // 关注的主播的每周摘要的设置
+
+	HTTP httpConfig `json:"http"` // HTTP服务器的设置
+	GRPC grpcConfig `json:"grpc"` // gRPC服务器的设置
+
+	Recorder recorderConfig `json:"recorder"` // 和orzogc/acfunlive录播工具集成的设置
+	Mirror   mirrorConfig   `json:"mirror"`   // 作为镜像从主实例同步直播数据的设置
+
+	DebugListen string `json:"debugListen"` // 调试服务器的监听地址，提供pprof和expvar，为空时不启动
+
+	ComputedColumns []computedColumn `json:"computedColumns"` // 查询直播数据时用sqlite表达式计算的列
+}
+
+// 查询直播数据时计算的列，不会保存到数据库
+type computedColumn struct {
+	Name string `json:"name"` // 列名，只能含有字母、数字和下划线
+	Expr string `json:"expr"` // sqlite表达式，可以使用acfunlive表的列，如"duration / 3600000.0"
+}
+
+var (
+	basePath   string // 本程序所在文件夹
+	configPath string // 设置文件路径
+	conf       = defaultConfig()
+)
+
+// 默认设置
+func defaultConfig() *config {
+	return &config{
+		ShowBanner: true,
+		DBFile:     "acfunlive.db",
+		LogDir:     "logs",
+		CrashDir:   "crashes",
+		CoverDir:   defaultCoverDir,
+
+		MaxLiveHours:     defaultMaxLiveHours,
+		VerifyLiveEnd:    true,
+		DeletedRetention: 30,
+		ShutdownTimeout:  defaultShutdownTimeout,
+		IdlePollSeconds:  defaultIdlePollSeconds,
+		ReconnectWindow:  defaultReconnectWindow,
+		CSVEncoding:      csvUTF8,
+
+		Digest:   digestConfig{Language: defaultDigestLang},
+		Recorder: recorderConfig{Interval: defaultRecorderInterval},
+		Mirror:   mirrorConfig{Interval: defaultMirrorInterval},
+		LiveCut:  liveCutConfig{CheckDays: defaultLiveCutCheckDays, DownloadDir: defaultLiveCutDir},
+		Push: pushConfig{
+			Ntfy:   ntfyConfig{Server: defaultNtfyServer, Priority: defaultNtfyPriority},
+			Gotify: gotifyConfig{Priority: defaultGotifyPriority},
+		},
+		Clock:       clockConfig{Source: defaultClockSource, MaxDriftSeconds: defaultClockMaxDrift},
+		CommandHook: commandHookConfig{MaxAge: defaultCommandHookMaxAge},
+		Sink: sinkConfig{
+			Kafka: kafkaSinkConfig{Topic: defaultKafkaTopic},
+			NATS:  natsSinkConfig{Subject: defaultNATSSubject},
+		},
+	}
+}
+
+// 读取设置文件，文件不存在时使用默认设置
+func loadConfig(path string) (*config, error) {
+	c := defaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("读取设置文件 %s 失败：%w", path, err)
+	}
+	if err = checkConfigData(data); err != nil {
+		return nil, fmt.Errorf("设置文件 %s 有错误：\n%w", path, err)
+	}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("解析设置文件 %s 失败：%w", path, err)
+	}
+	if err = c.Templates.check(); err != nil {
+		return nil, fmt.Errorf("设置文件 %s 的%w", path, err)
+	}
+	if err = c.Translate.check(); err != nil {
+		return nil, fmt.Errorf("设置文件 %s 的%w", path, err)
+	}
+	if err = c.checkNotifyLimits(); err != nil {
+		return nil, fmt.Errorf("设置文件 %s 的%w", path, err)
+	}
+	if err = c.checkNotifyRoutes(); err != nil {
+		return nil, fmt.Errorf("设置文件 %s 的%w", path, err)
+	}
+	return c, nil
+}
+
+// 相对路径以本程序所在文件夹为准
+func absPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(basePath, path)
+}
+
+// 获取本程序所在文件夹
+func getBasePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(exe), nil
+}
+
+// 返回设置的摘要，每项一行，隐藏密码和token等敏感设置
+func (c *config) summary() []string {
+	var lines []string
+	summarize(reflect.ValueOf(c).Elem(), "", &lines)
+	return lines
+}
+
+// 隐藏webhook链接的路径和参数，webhook的token通常在这里，只保留协议和主机用于日志
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "******"
+	}
+	if u.Path == "" && u.RawQuery == "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return u.Scheme + "://" + u.Host + "/******"
+}
+
+// 递归生成设置摘要
+func summarize(v reflect.Value, prefix string, lines *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		name = prefix + name
+		fv := v.Field(i)
+
+		if field.Tag.Get("secret") == "true" {
+			if fv.IsZero() {
+				*lines = append(*lines, fmt.Sprintf("%s: (未设置)", name))
+			} else {
+				*lines = append(*lines, fmt.Sprintf("%s: ******", name))
+			}
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.Struct:
+			summarize(fv, name+".", lines)
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.Struct {
+				for j := 0; j < fv.Len(); j++ {
+					summarize(fv.Index(j), fmt.Sprintf("%s[%d].", name, j), lines)
+				}
+				if fv.Len() == 0 {
+					*lines = append(*lines, fmt.Sprintf("%s: []", name))
+				}
+				continue
+			}
+			*lines = append(*lines, fmt.Sprintf("%s: %v", name, fv.Interface()))
+		default:
+			*lines = append(*lines, fmt.Sprintf("%s: %v", name, fv.Interface()))
+		}
+	}
+}
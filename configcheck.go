@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 一次最多报告的设置错误数
+const configErrorLimit = 20
+
+// 按config的结构检查设置文件，报告不存在的设置和类型不对的值，错误带有行号和列号。
+// encoding/json会忽略不存在的键，拼错的设置不检查的话会悄悄使用默认值
+type configChecker struct {
+	data   []byte
+	dec    *json.Decoder
+	errors []string
+}
+
+// 检查设置文件的内容，有错误时返回所有错误，每行一个
+func checkConfigData(data []byte) error {
+	c := &configChecker{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	c.dec.UseNumber()
+	if err := c.value(reflect.TypeOf(config{}), ""); err != nil {
+		return c.syntaxError(err)
+	}
+	if _, err := c.dec.Token(); err != io.EOF {
+		c.report(c.dec.InputOffset(), "设置文件的JSON对象后面还有其他内容")
+	}
+	if len(c.errors) == 0 {
+		return nil
+	}
+	if len(c.errors) > configErrorLimit {
+		more := len(c.errors) - configErrorLimit
+		c.errors = append(c.errors[:configErrorLimit], fmt.Sprintf("还有 %d 个错误没有显示", more))
+	}
+	return errors.New(strings.Join(c.errors, "\n"))
+}
+
+// 读取一个值，检查是否符合类型t，path为设置的名字，如"http.listen"
+func (c *configChecker) value(t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	start := c.nextOffset()
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		// null保留默认值
+		return nil
+	}
+	if t.Kind() == reflect.Interface || t == reflect.TypeOf(json.RawMessage{}) {
+		return c.skip(tok)
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch {
+		case tok == '{' && t.Kind() == reflect.Struct:
+			return c.object(t, path)
+		case tok == '{' && t.Kind() == reflect.Map:
+			for c.dec.More() {
+				key, err := c.dec.Token()
+				if err != nil {
+					return err
+				}
+				if err = c.value(t.Elem(), joinConfigPath(path, key.(string))); err != nil {
+					return err
+				}
+			}
+			_, err = c.dec.Token()
+			return err
+		case tok == '[' && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+			for i := 0; c.dec.More(); i++ {
+				if err = c.value(t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = c.dec.Token()
+			return err
+		}
+		got := "对象"
+		if tok == '[' {
+			got = "数组"
+		}
+		c.mismatch(start, path, t, got)
+		return c.skip(tok)
+	case string:
+		if t.Kind() != reflect.String {
+			c.mismatch(start, path, t, "字符串")
+		}
+	case bool:
+		if t.Kind() != reflect.Bool {
+			c.mismatch(start, path, t, "true或false")
+		}
+	case json.Number:
+		c.number(start, path, t, tok)
+	}
+	return nil
+}
+
+// 读取对象的所有键，'{'已经读取
+func (c *configChecker) object(t reflect.Type, path string) error {
+	fields := configFields(t)
+	for c.dec.More() {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		keyOffset := c.keyOffset()
+		field, ok := matchConfigField(fields, key)
+		if !ok {
+			msg := fmt.Sprintf("没有 %s 这项设置", joinConfigPath(path, key))
+			if s := suggestConfigField(fields, key); s != "" {
+				msg += fmt.Sprintf("，是不是 %s？", joinConfigPath(path, s))
+			}
+			c.report(keyOffset, msg)
+			if err = c.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = c.value(field.Type, joinConfigPath(path, configFieldName(field))); err != nil {
+			return err
+		}
+	}
+	_, err := c.dec.Token()
+	return err
+}
+
+// 检查数字是否符合类型t
+func (c *configChecker) number(offset int64, path string, t reflect.Type, n json.Number) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(string(n), 10, t.Bits()); err != nil {
+			c.report(offset, fmt.Sprintf("%s 应该是整数，%s 不是有效的整数", path, n))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseUint(string(n), 10, t.Bits()); err != nil {
+			c.report(offset, fmt.Sprintf("%s 应该是非负整数，%s 不是有效的非负整数", path, n))
+		}
+	case reflect.Float32, reflect.Float64:
+	default:
+		c.mismatch(offset, path, t, "数字")
+	}
+}
+
+// 跳过下一个值
+func (c *configChecker) skipValue() error {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+	return c.skip(tok)
+}
+
+// 跳过已经读取了第一个token的值
+func (c *configChecker) skip(tok json.Token) error {
+	if d, ok := tok.(json.Delim); !ok || (d != '{' && d != '[') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+func (c *configChecker) mismatch(offset int64, path string, t reflect.Type, got string) {
+	c.report(offset, fmt.Sprintf("%s 应该是%s，不是%s", path, configTypeName(t), got))
+}
+
+func (c *configChecker) report(offset int64, msg string) {
+	c.errors = append(c.errors, c.position(offset)+msg)
+}
+
+// 把JSON语法错误转换为带行号的错误，之前发现的错误也一起返回
+func (c *configChecker) syntaxError(err error) error {
+	var se *json.SyntaxError
+	switch {
+	case errors.As(err, &se):
+		c.report(se.Offset, "JSON格式错误："+se.Error())
+	case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+		c.report(int64(len(c.data)), "JSON不完整")
+	default:
+		c.report(c.dec.InputOffset(), err.Error())
+	}
+	return errors.New(strings.Join(c.errors, "\n"))
+}
+
+// 下一个token开始的位置
+func (c *configChecker) nextOffset() int64 {
+	off := c.dec.InputOffset()
+	for off < int64(len(c.data)) {
+		switch c.data[off] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			off++
+			continue
+		}
+		break
+	}
+	return off
+}
+
+// 刚读取的键开始的位置，即键的左引号
+func (c *configChecker) keyOffset() int64 {
+	off := c.dec.InputOffset() - 1
+	for off > 0 {
+		off--
+		if c.data[off] == '"' && (off == 0 || c.data[off-1] != '\\') {
+			break
+		}
+	}
+	return off
+}
+
+// offset所在的行号和列号，列号按字符计算，从1开始
+func (c *configChecker) position(offset int64) string {
+	if offset > int64(len(c.data)) {
+		offset = int64(len(c.data))
+	}
+	before := c.data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return fmt.Sprintf("第 %d 行第 %d 列：", line, col)
+}
+
+// 结构体所有可以设置的字段
+func configFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.IsExported() && configFieldName(f) != "-" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// 字段在设置文件里的名字
+func configFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// 和encoding/json一样，优先完全相同的名字，没有时不区分大小写
+func matchConfigField(fields []reflect.StructField, key string) (reflect.StructField, bool) {
+	for _, f := range fields {
+		if configFieldName(f) == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(configFieldName(f), key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// 找出和key最接近的设置名，差别太大时返回空字符串
+func suggestConfigField(fields []reflect.StructField, key string) string {
+	best, bestDist := "", 0
+	for _, f := range fields {
+		name := configFieldName(f)
+		d := editDistance(strings.ToLower(name), strings.ToLower(key))
+		if best == "" || d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if bestDist > 2 && bestDist > utf8.RuneCountInString(key)/3 {
+		return ""
+	}
+	return best
+}
+
+// 两个字符串的编辑距离
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// 设置的类型的中文名
+func configTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "字符串"
+	case reflect.Bool:
+		return "true或false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "整数"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "非负整数"
+	case reflect.Float32, reflect.Float64:
+		return "数字"
+	case reflect.Slice, reflect.Array:
+		return configTypeName(t.Elem()) + "的数组"
+	}
+	return "对象"
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConfigData(t *testing.T) {
+	valid := `{
+	"dbFile": "acfunlive.db",
+	"showBanner": true,
+	"maxLiveHours": 48,
+	"watchUIDs": [1, 2],
+	"telegram": {"limit": {"quietHours": "23:00-07:00", "minInterval": 10}},
+	"DBFILE": null
+}`
+	if err := checkConfigData([]byte(valid)); err != nil {
+		t.Errorf("有效的设置返回错误：%v", err)
+	}
+
+	for _, tt := range []struct {
+		data string
+		want []string // 错误里需要包含的内容
+	}{
+		{`{"dbFil": "a.db"}`, []string{"第 1 行第 2 列：没有 dbFil 这项设置，是不是 dbFile？"}},
+		{"{\n  \"showBanner\": \"yes\"\n}", []string{"第 2 行第 17 列：showBanner 应该是"}},
+		{`{"maxLiveHours": 1.5}`, []string{"maxLiveHours 应该是整数"}},
+		{`{"watchUIDs": 1}`, []string{"watchUIDs 应该是"}},
+		{`{"telegram": {"limit": {"quietHour": ""}}}`, []string{"没有 telegram.limit.quietHour 这项设置，是不是 telegram.limit.quietHours？"}},
+		// 多个错误都会报告
+		{`{"a1": 1, "showBanner": 1}`, []string{"没有 a1 这项设置", "showBanner 应该是"}},
+		{`{"dbFile": }`, []string{"JSON格式错误"}},
+		{`{"dbFile": "a.db"`, []string{"第 1 行第 18 列：JSON格式错误"}},
+		{``, []string{"JSON不完整"}},
+		{`{} {}`, []string{"设置文件的JSON对象后面还有其他内容"}},
+	} {
+		err := checkConfigData([]byte(tt.data))
+		if err == nil {
+			t.Errorf("%s 应该返回错误", tt.data)
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("%s 的错误 %q 里没有 %q", tt.data, err, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 打印主播下载过的直播封面，封面文件已经不存在时提示
+func printCovers(ctx context.Context, uid store.UID) {
+	covers, err := db.QueryCovers(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的直播封面记录出现错误：%v", uid, err)
+		return
+	}
+	if len(covers) == 0 {
+		log.Printf("没有uid为 %d 的主播的直播封面记录，需要设置coverDir并在 watch 里对这个主播设置 cover", uid)
+		return
+	}
+	for _, c := range covers {
+		missing := ""
+		if _, err := os.Stat(absPath(c.File)); errors.Is(err, os.ErrNotExist) {
+			missing = "（文件已不存在）"
+		}
+		fmt.Printf("开播时间：%s liveID：%s 文件：%s%s 链接：%s\n",
+			time.UnixMilli(c.StartTime).Format(timeLayout), c.LiveID, c.File, missing, c.URL)
+	}
+}
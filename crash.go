@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	crashLogLines     = 200              // 崩溃记录里保存的最近的日志行数
+	crashRestartDelay = 10 * time.Second // 出现panic后重新运行的等待时间
+	maxCrashRestarts  = 5                // 出现panic后最多重新运行的次数
+	crashFileLayout   = "20060102-150405.000"
+)
+
+// 最近的日志，出现panic时写到崩溃记录里
+var recentLogs = &logRing{lines: make([]string, 0, crashLogLines)}
+
+// 保存最近crashLogLines行日志的环形缓冲区
+type logRing struct {
+	sync.Mutex
+	lines []string
+	next  int    // lines已满时下一行写入的位置
+	part  []byte // 还没有换行的日志
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	data := append(r.part, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.add(string(data[:i]))
+		data = data[i+1:]
+	}
+	r.part = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (r *logRing) add(line string) {
+	if len(r.lines) < cap(r.lines) {
+		r.lines = append(r.lines, line)
+		return
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+}
+
+// 按时间顺序返回保存的日志
+func (r *logRing) snapshot() []string {
+	r.Lock()
+	defer r.Unlock()
+	lines := make([]string, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
+
+// 运行f，出现panic时写崩溃记录并在一段时间后重新运行，没有设置crashDir时不恢复panic
+func runRecovered(ctx context.Context, name string, f func(context.Context)) {
+	for restarts := 0; ; restarts++ {
+		if !runOnce(ctx, name, f) {
+			return
+		}
+		if restarts >= maxCrashRestarts {
+			log.Printf("%s 出现panic的次数太多，不再重新运行", name)
+			return
+		}
+		log.Printf("%s 出现panic，%s后重新运行", name, crashRestartDelay)
+		if !sleepCtx(ctx, crashRestartDelay) {
+			return
+		}
+	}
+}
+
+// 运行一次f，返回是否出现panic
+func runOnce(ctx context.Context, name string, f func(context.Context)) (panicked bool) {
+	defer func() {
+		if conf.CrashDir == "" {
+			return
+		}
+		if v := recover(); v != nil {
+			panicked = true
+			handleCrash(name, v, debug.Stack())
+		}
+	}()
+	f(ctx)
+	return false
+}
+
+// 在goroutine里defer调用，出现panic时写崩溃记录，只结束这个goroutine，没有设置crashDir时不恢复panic
+func recoverCrash(name string) {
+	if conf.CrashDir == "" {
+		return
+	}
+	if v := recover(); v != nil {
+		handleCrash(name, v, debug.Stack())
+	}
+}
+
+// 记录panic
+func handleCrash(name string, v interface{}, stack []byte) {
+	log.Printf("%s 出现panic：%v", name, v)
+	path, err := writeCrashDump(name, v, stack)
+	if err != nil {
+		log.Printf("保存崩溃记录失败：%v", err)
+		log.Printf("panic的调用栈：\n%s", stack)
+		return
+	}
+	log.Printf("崩溃记录已保存到 %s", path)
+}
+
+// 把panic的调用栈、最近的日志和设置写到crashDir里，返回崩溃记录的路径
+func writeCrashDump(name string, v interface{}, stack []byte) (string, error) {
+	dir := absPath(conf.CrashDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "时间：%s\n", now.Format(timeLayout))
+	fmt.Fprintf(&b, "位置：%s\n", name)
+	fmt.Fprintf(&b, "panic：%v\n\n", v)
+	fmt.Fprintf(&b, "== 调用栈 ==\n%s\n", stack)
+	fmt.Fprintf(&b, "== 版本 ==\n%s\n\n", versionInfo())
+	fmt.Fprintf(&b, "== 设置 ==\n配置文件：%s\n", configPath)
+	for _, line := range conf.summary() {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\n== 最近的日志 ==\n")
+	for _, line := range recentLogs.snapshot() {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+
+	path := filepath.Join(dir, "crash-"+now.Format(crashFileLayout)+".log")
+	return path, os.WriteFile(path, []byte(b.String()), 0600)
+}
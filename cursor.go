@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 可以中断后继续的批处理任务
+const (
+	jobRecoverUnfinished = "recoverUnfinished" // 启动时恢复没有直播时长的直播
+	jobFixLiveCut        = "fixLiveCut"        // fsck --fix 获取缺少的直播剪辑编号
+)
+
+// 批处理任务的中文名
+func jobName(job string) string {
+	switch job {
+	case jobRecoverUnfinished:
+		return "恢复直播时长"
+	case jobFixLiveCut:
+		return "获取缺少的直播剪辑编号"
+	default:
+		return job
+	}
+}
+
+// 批处理任务的进度，任务按key（liveID）从小到大处理，每处理完一项保存一次，中断后从上次处理到的位置继续
+type jobCursor struct {
+	job    string
+	cursor string // 上次中断时处理到的key，没有中断过时为空
+}
+
+// 读取批处理任务上次中断时的进度
+func loadJobCursor(ctx context.Context, job string) *jobCursor {
+	c := &jobCursor{job: job}
+	cursor, err := db.QueryJobCursor(ctx, job)
+	switch {
+	case err != nil:
+		log.Printf("查询%s的进度出现错误，从头开始：%v", jobName(job), err)
+	case cursor != "":
+		log.Printf("%s上次在 %s 处中断，从这里继续", jobName(job), cursor)
+		c.cursor = cursor
+	}
+	return c
+}
+
+// key是否在上次中断前已经处理过
+func (c *jobCursor) done(key string) bool {
+	return c.cursor != "" && key <= c.cursor
+}
+
+// 保存处理完的key
+func (c *jobCursor) save(key string) {
+	queueWrite(fmt.Sprintf("保存%s的进度", jobName(c.job)), nil, store.JobCursorWrite(c.job, key, time.Now().UnixMilli()))
+}
+
+// 任务完成，删除进度，下次从头开始
+func (c *jobCursor) finish() {
+	queueWrite(fmt.Sprintf("删除%s的进度", jobName(c.job)), nil, store.JobCursorWrite(c.job, "", time.Now().UnixMilli()))
+}
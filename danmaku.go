@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	danmakuSearchLimit = 200 // 搜索弹幕最多显示的数量
+	replayBatchSize    = 500 // 导入弹幕时每次加入写入队列的数量
+)
+
+// ASS字幕里的特效标签，如{\move(...)}
+var assOverrideRegexp = regexp.MustCompile(`\{[^}]*\}`)
+
+// 解析"search_danmaku 关键词... [--uid 主播的uid] [--since 日期]"的参数
+func parseDanmakuQuery(args []string) (*store.DanmakuQuery, error) {
+	q := &store.DanmakuQuery{Limit: danmakuSearchLimit}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--uid", "--since":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s 后面需要参数", args[i])
+			}
+			value := args[i+1]
+			if args[i] == "--uid" {
+				uid, err := store.ParseUID(value)
+				if err != nil {
+					return nil, err
+				}
+				q.UID = uid
+			} else {
+				since, err := time.ParseInLocation(dateLayout, value, time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("%s 不是有效的日期，格式为 %s", value, dateLayout)
+				}
+				q.Since = since.UnixMilli()
+			}
+			i++
+		default:
+			q.Keywords = append(q.Keywords, args[i])
+		}
+	}
+	if len(q.Keywords) == 0 {
+		return nil, errors.New("需要至少一个关键词")
+	}
+	return q, nil
+}
+
+// 在所有记录的直播里搜索弹幕并打印
+func searchDanmaku(ctx context.Context, args []string) {
+	q, err := parseDanmakuQuery(args)
+	if err != nil {
+		log.Printf(`%v，搜索弹幕的命令为"search_danmaku 关键词... [--uid 主播的uid] [--since 日期]"`, err)
+		return
+	}
+	list, err := db.SearchDanmaku(ctx, *q)
+	if err != nil {
+		log.Printf("搜索弹幕出现错误：%v", err)
+		return
+	}
+	if len(list) == 0 {
+		log.Println("没有找到含有这些关键词的弹幕")
+		return
+	}
+	for _, m := range list {
+		fmt.Printf("liveID：%s 主播uid：%d 昵称：%s 直播时间：%s 发送时间：%s 用户：%s(%d) 弹幕：%s\n",
+			m.LiveID, m.LiverUID, m.LiverName,
+			(time.Duration(m.Offset) * time.Millisecond).String(),
+			time.UnixMilli(m.SendTime).Format(timeLayout),
+			m.Nickname, m.UID, m.Content,
+		)
+		if m.Source == store.DanmakuReplay {
+			fmt.Println("  （从录播的ASS弹幕文件导入，发送时间是估算的）")
+		}
+	}
+	if len(list) == danmakuSearchLimit {
+		log.Printf("只显示了最早的 %d 条弹幕，可以用更多关键词或 --since 缩小范围", danmakuSearchLimit)
+	}
+}
+
+// 处理"import_ass_danmaku liveID [ASS文件]"命令，直播时没有记录弹幕时从录播的ASS弹幕文件导入，
+// 没有指定文件时使用外部录播工具保存的录播文件旁边的同名.ass文件。
+// AcFun和acfundanmu都没有录播的弹幕回放接口，这里只导入本地的弹幕文件，不是官方的弹幕回放
+func importASSDanmaku(ctx context.Context, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		log.Println(`导入弹幕的命令为"import_ass_danmaku liveID [ASS文件]"`)
+		return
+	}
+	liveID, err := store.ParseLiveID(args[0])
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	l, err := queryLive(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播数据出现错误：%v", liveID, err)
+		return
+	}
+	if l.duration == 0 {
+		log.Printf("liveID为 %s 的直播还没有结束，不能导入弹幕", liveID)
+		return
+	}
+	for _, source := range []string{store.DanmakuLive, store.DanmakuReplay} {
+		n, err := db.CountDanmaku(ctx, liveID, source)
+		if err != nil {
+			log.Printf("查询liveID为 %s 的弹幕数量出现错误：%v", liveID, err)
+			return
+		}
+		if n != 0 {
+			if source == store.DanmakuLive {
+				log.Printf("liveID为 %s 的直播已经记录了 %d 条弹幕，不需要导入", liveID, n)
+			} else {
+				log.Printf("liveID为 %s 的直播已经导入了 %d 条弹幕", liveID, n)
+			}
+			return
+		}
+	}
+
+	var file string
+	if len(args) == 2 {
+		file = args[1]
+	} else if l.recordFile != "" {
+		file = strings.TrimSuffix(l.recordFile, filepath.Ext(l.recordFile)) + ".ass"
+	} else {
+		log.Printf("liveID为 %s 的直播没有录播文件，需要指定ASS弹幕文件", liveID)
+		return
+	}
+	list, err := readASSDanmaku(absPath(file), l)
+	if err != nil {
+		log.Printf("读取弹幕文件出现错误：%v", err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("%s 里没有弹幕", file)
+		return
+	}
+	for i := 0; i < len(list); i += replayBatchSize {
+		end := i + replayBatchSize
+		if end > len(list) {
+			end = len(list)
+		}
+		batch := list[i:end]
+		writes := make([]store.Write, len(batch))
+		for j := range batch {
+			writes[j] = store.DanmakuWrite(&batch[j])
+		}
+		queueWrite(fmt.Sprintf("保存liveID为 %s 导入的弹幕", liveID), nil, writes...)
+	}
+	flushWrites()
+	accountDanmaku(ctx, liveID)
+	log.Printf("已从 %s 导入liveID为 %s 的直播的 %d 条弹幕", file, liveID, len(list))
+}
+
+// 读取acfundanmu生成的ASS弹幕文件，文件里的时间是相对录播开始的时间，用直播开始时间估算发送时间
+func readASSDanmaku(file string, l *live) ([]store.Danmaku, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []store.Danmaku
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if id, ok := strings.CutPrefix(line, "; LiveID:"); ok {
+			if id = strings.TrimSpace(id); id != "" && store.LiveID(id) != l.liveID {
+				return nil, fmt.Errorf("%s 是liveID为 %s 的直播的弹幕文件", file, id)
+			}
+			continue
+		}
+		// Dialogue: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+		rest, ok := strings.CutPrefix(line, "Dialogue:")
+		if !ok {
+			continue
+		}
+		fields := strings.SplitN(rest, ",", 10)
+		if len(fields) != 10 {
+			continue
+		}
+		offset, err := parseASSTime(strings.TrimSpace(fields[1]))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(assOverrideRegexp.ReplaceAllString(fields[9], ""))
+		if content == "" {
+			continue
+		}
+		nickname, uid := parseASSName(fields[4])
+		list = append(list, store.Danmaku{
+			LiveID:   l.liveID,
+			SendTime: l.startTime + offset,
+			UID:      uid,
+			Nickname: nickname,
+			Content:  content,
+			Source:   store.DanmakuReplay,
+		})
+	}
+	return list, scanner.Err()
+}
+
+// 把ASS的时间H:MM:SS.cc转换为毫秒
+func parseASSTime(s string) (int64, error) {
+	var h, m, sec, cs int64
+	if _, err := fmt.Sscanf(s, "%d:%d:%d.%d", &h, &m, &sec, &cs); err != nil {
+		return 0, err
+	}
+	return ((h*60+m)*60+sec)*1000 + cs*10, nil
+}
+
+// 解析ASS里"昵称(uid)"格式的Name
+func parseASSName(name string) (string, int64) {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndexByte(name, '(')
+	if i < 0 || !strings.HasSuffix(name, ")") {
+		return name, 0
+	}
+	uid, err := strconv.ParseInt(name[i+1:len(name)-1], 10, 64)
+	if err != nil {
+		return name, 0
+	}
+	return name[:i], uid
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"acfunlivedb/store"
+)
+
+func TestParseASSTime(t *testing.T) {
+	for _, tt := range []struct {
+		s  string
+		ms int64
+	}{
+		{"0:00:00.00", 0},
+		{"0:01:02.34", 62340},
+		{"1:00:00.05", 3600050},
+	} {
+		ms, err := parseASSTime(tt.s)
+		if err != nil || ms != tt.ms {
+			t.Errorf("parseASSTime(%q) = %d, %v，应该为 %d", tt.s, ms, err, tt.ms)
+		}
+		if s := assTime(tt.ms); s != tt.s {
+			t.Errorf("assTime(%d) = %q，应该为 %q", tt.ms, s, tt.s)
+		}
+	}
+	if _, err := parseASSTime("abc"); err == nil {
+		t.Error("parseASSTime(\"abc\") 应该返回错误")
+	}
+}
+
+func TestReadWrittenASS(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "live1.ass")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []store.TimedDanmaku{
+		{Offset: 1230, Nickname: "观众(123)", Content: "你好"},
+		{Offset: 61000, Nickname: "另一个观众", Content: "再见"},
+	}
+	if _, err = writeASS(f, "live1", "标题", list); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &live{liveID: "live1", startTime: 1700000000000}
+	got, err := readASSDanmaku(file, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []store.Danmaku{
+		{LiveID: "live1", SendTime: l.startTime + 1230, UID: 123, Nickname: "观众", Content: "你好", Source: store.DanmakuReplay},
+		{LiveID: "live1", SendTime: l.startTime + 61000, Nickname: "另一个观众", Content: "再见", Source: store.DanmakuReplay},
+	}
+	if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("读取的弹幕为 %+v，应该为 %+v", got, want)
+	}
+
+	// 其他直播的弹幕文件
+	if _, err = readASSDanmaku(file, &live{liveID: "live2"}); err == nil {
+		t.Error("读取其他直播的弹幕文件应该返回错误")
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// 浏览直播数据的网页，通过REST API获取数据
+//
+//go:embed web
+var webFiles embed.FS
+
+// 在/提供浏览直播数据的网页
+func registerDashboard(mux *http.ServeMux) {
+	sub, err := fs.Sub(webFiles, "web")
+	checkErr(err)
+	mux.Handle("/", requireAuth(http.FileServer(http.FS(sub)).ServeHTTP))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 设置数据库密钥的环境变量，优先于设置文件
+const encryptionKeyEnv = "ACFUNLIVEDB_KEY"
+
+var db store.Store // 保存直播数据的数据库
+
+// 打开数据库，readOnly为true时只读打开
+func openDB(ctx context.Context, path string, readOnly bool) error {
+	key := conf.EncryptionKey
+	if env := os.Getenv(encryptionKeyEnv); env != "" {
+		key = env
+	}
+	computed := make([]store.ComputedColumn, len(conf.ComputedColumns))
+	for i, c := range conf.ComputedColumns {
+		computed[i] = store.ComputedColumn{Name: c.Name, Expr: c.Expr}
+	}
+	s, err := store.OpenSQLite(ctx, path, store.Options{EncryptionKey: key, Computed: computed, ReadOnly: readOnly})
+	if err != nil {
+		return fmt.Errorf("打开数据库 %s 失败：%w", path, err)
+	}
+	db = s
+	return nil
+}
+
+// 关闭数据库
+func closeDB() {
+	if db != nil {
+		_ = db.Close()
+	}
+}
+
+// 转换为数据库保存的直播数据
+func (l *live) toStore() *store.Live {
+	return &store.Live{
+		LiveID:         l.liveID,
+		UID:            l.uid,
+		Name:           l.name,
+		StreamName:     l.streamName,
+		StartTime:      l.startTime,
+		Title:          l.title,
+		Duration:       l.duration,
+		PlaybackURL:    l.playbackURL,
+		BackupURL:      l.backupURL,
+		LiveCutNum:     l.liveCutNum,
+		SuggestedTitle: l.suggestedTitle,
+		Access:         l.access,
+		RecordFile:     l.recordFile,
+		Computed:       l.computed,
+	}
+}
+
+// 转换数据库保存的直播数据
+func fromStore(sl *store.Live) live {
+	return live{
+		liveID:         sl.LiveID,
+		uid:            sl.UID,
+		name:           sl.Name,
+		streamName:     sl.StreamName,
+		startTime:      sl.StartTime,
+		title:          sl.Title,
+		duration:       sl.Duration,
+		playbackURL:    sl.PlaybackURL,
+		backupURL:      sl.BackupURL,
+		liveCutNum:     sl.LiveCutNum,
+		suggestedTitle: sl.SuggestedTitle,
+		access:         sl.Access,
+		recordFile:     sl.RecordFile,
+		computed:       sl.Computed,
+	}
+}
+
+// 转换数据库保存的直播列表
+func fromStoreList(list []store.Live, err error) ([]live, error) {
+	if err != nil {
+		return nil, err
+	}
+	lives := make([]live, len(list))
+	for i := range list {
+		lives[i] = fromStore(&list[i])
+	}
+	return lives, nil
+}
+
+// 插入直播数据
+func insert(l *live) {
+	liveID := l.liveID
+	queueWrite(fmt.Sprintf("插入liveID为 %s 的直播数据", liveID), func(affected []int64) {
+		if affected[0] != 0 {
+			markChanged(changeInsert, liveID)
+		}
+	}, store.InsertLiveWrite(l.toStore()))
+}
+
+// 更新直播时长
+func updateLiveDuration(ctx context.Context, liveID store.LiveID, duration int64) {
+	if err := db.FinalizeLive(ctx, liveID, duration); err != nil {
+		log.Printf("更新liveID为 %s 的直播时长出现错误：%v", liveID, err)
+		return
+	}
+	markChanged(changeUpdate, liveID)
+}
+
+// 保存直播剪辑编号，编号和之前保存的不同时只记录到历史记录里
+func updateLiveCut(ctx context.Context, liveID store.LiveID, num int) {
+	oldNum, err := db.UpdateLiveCut(ctx, liveID, num)
+	switch {
+	case err != nil:
+		log.Printf("更新liveID为 %s 的直播剪辑编号出现错误：%v", liveID, err)
+	case oldNum == num:
+	case oldNum == 0:
+		markChanged(changeUpdate, liveID)
+	default:
+		log.Printf("liveID为 %s 的直播剪辑编号从 %d 变为 %d", liveID, oldNum, num)
+	}
+}
+
+// 记录直播间标题
+func insertTitleChange(liveID store.LiveID, title string) {
+	queueWrite(fmt.Sprintf("记录liveID为 %s 的直播间标题", liveID), func([]int64) {
+		markChanged(changeUpdate, liveID)
+	}, store.InsertTitleWrite(liveID, title, time.Now().UnixMilli()))
+}
+
+// 保存没有标题的直播的建议标题
+func updateSuggestedTitle(ctx context.Context, liveID store.LiveID, title string) {
+	if err := db.UpdateSuggestedTitle(ctx, liveID, title); err != nil {
+		log.Printf("保存liveID为 %s 的直播的建议标题出现错误：%v", liveID, err)
+		return
+	}
+	markChanged(changeUpdate, liveID)
+}
+
+// 保存外部录播工具录制完成的录播文件名
+func updateRecordFile(ctx context.Context, liveID store.LiveID, file string) {
+	ok, err := db.UpdateRecordFile(ctx, liveID, file)
+	switch {
+	case err != nil:
+		log.Printf("保存liveID为 %s 的录播文件名出现错误：%v", liveID, err)
+	case !ok:
+		log.Printf("数据库里没有liveID为 %s 的直播，无法保存录播文件名 %s", liveID, file)
+	default:
+		markChanged(changeUpdate, liveID)
+		accountFile(liveID, store.StorageRecording, file)
+	}
+}
+
+// 保存重新获取到的录播链接
+func updatePlayback(ctx context.Context, liveID store.LiveID, url, backupURL string) {
+	ok, err := db.UpdatePlayback(ctx, liveID, url, backupURL)
+	switch {
+	case err != nil:
+		log.Printf("保存liveID为 %s 的录播链接出现错误：%v", liveID, err)
+	case ok:
+		markChanged(changeUpdate, liveID)
+	}
+}
+
+// 查询数据库里是否存在指定liveID的直播
+func queryExist(ctx context.Context, liveID store.LiveID) bool {
+	exist, err := db.Exists(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播数据出现错误：%v", liveID, err)
+		return false
+	}
+	return exist
+}
+
+// 查询指定liveID的直播，包括已删除的直播，不存在时返回store.ErrNotFound
+func queryLive(ctx context.Context, liveID store.LiveID) (*live, error) {
+	sl, err := db.QueryLive(ctx, liveID)
+	if err != nil {
+		return nil, err
+	}
+	l := fromStore(sl)
+	return &l, nil
+}
+
+// 查询指定主播的直播，limit小于等于0时查询所有直播
+func queryLiveList(ctx context.Context, uid store.UID, limit int) ([]live, error) {
+	return fromStoreList(db.QueryByUID(ctx, uid, limit))
+}
+
+// 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+func queryUnfinished(ctx context.Context, since int64) ([]live, error) {
+	return fromStoreList(db.QueryUnfinished(ctx, since))
+}
+
+// 记录正在直播的liveID
+func insertActiveLive(liveID store.LiveID) {
+	queueWrite(fmt.Sprintf("记录liveID为 %s 的直播正在进行", liveID), nil, store.InsertActiveWrite(liveID))
+}
+
+// 删除已经下播的liveID
+func deleteActiveLive(liveID store.LiveID) {
+	queueWrite(fmt.Sprintf("删除liveID为 %s 的正在直播记录", liveID), nil, store.DeleteActiveWrite(liveID))
+}
+
+// 查询上次运行时正在直播的直播
+func queryActiveLives(ctx context.Context) ([]live, error) {
+	return fromStoreList(db.QueryActive(ctx))
+}
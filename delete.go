@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const purgeInterval = 24 * time.Hour // 清理软删除数据的间隔
+
+// 软删除指定liveID的直播数据，返回是否有数据被删除
+func deleteLive(ctx context.Context, liveID store.LiveID) (bool, error) {
+	ok, err := db.SoftDelete(ctx, liveID)
+	if ok {
+		markChanged(changeDelete, liveID)
+	}
+	return ok, err
+}
+
+// 恢复软删除的直播数据，返回是否有数据被恢复
+func restoreDeletedLive(ctx context.Context, liveID store.LiveID) (bool, error) {
+	ok, err := db.Restore(ctx, liveID)
+	if ok {
+		markChanged(changeUpdate, liveID)
+	}
+	return ok, err
+}
+
+// 彻底删除软删除时间超过保留天数的直播数据
+func purgeDeleted(ctx context.Context) {
+	if conf.DeletedRetention <= 0 {
+		return
+	}
+	before := time.Now().AddDate(0, 0, -conf.DeletedRetention).UnixMilli()
+	n, err := db.PurgeDeleted(ctx, before)
+	if err != nil {
+		log.Printf("清理已删除的直播数据出现错误：%v", err)
+		return
+	}
+	if n != 0 {
+		log.Printf("已彻底删除 %d 条删除超过 %d 天的直播数据", n, conf.DeletedRetention)
+	}
+}
+
+// 定期清理软删除的直播数据
+func purgeCycle(ctx context.Context) {
+	for {
+		purgeDeleted(ctx)
+		if !sleepCtx(ctx, purgeInterval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const desktopNotifyTimeout = 10 * time.Second // 运行发送桌面通知的命令的最长时间
+
+// 本机桌面通知的设置
+type desktopConfig struct {
+	Enabled bool        `json:"enabled"` // 关注的主播开播时是否在本机弹出桌面通知
+	Limit   notifyLimit `json:"limit"`   // 安静时段和频率限制
+}
+
+// 开播时弹出桌面通知，文字和ntfy、Gotify的开播推送相同
+func desktopLiveStart(l *live) {
+	desktopStartNotify(l, "start", defaultPushStartTitleTemplate)
+}
+
+// 重连时弹出桌面通知，文字和ntfy、Gotify的重连推送相同
+func desktopLiveReconnect(l *live) {
+	desktopStartNotify(l, "reconnect", defaultPushReconnectTitleTemplate)
+}
+
+func desktopStartNotify(l *live, event, defTitle string) {
+	name := templateEventName(event) + "通知"
+	if !conf.Desktop.Enabled || !isWatched(l.uid) || !notifyRouted(routeDesktop, l.uid, l.title) {
+		return
+	}
+	if !desktopSession() {
+		log.Printf("没有检测到桌面环境，不弹出uid为 %d 的主播的%s", l.uid, name)
+		return
+	}
+	if !conf.Desktop.Limit.allow("桌面通知", l.uid, name) {
+		return
+	}
+	data := newTemplateData(event, l, 0)
+	title := renderTemplate(conf.Templates.Push.StartTitle, defTitle, data)
+	message := renderTemplate(conf.Templates.Push.StartMessage, defaultPushStartMessageTemplate, data)
+	if err := desktopNotify(title, message); err != nil {
+		log.Printf("弹出liveID为 %s 的%s失败：%v", l.liveID, name, err)
+	}
+}
+
+// 运行系统的通知命令弹出桌面通知
+func desktopNotify(title, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), desktopNotifyTimeout)
+	defer cancel()
+	cmd := desktopNotifyCmd(ctx, title, message)
+	stderr := &tailBuffer{limit: commandHookStderrLimit}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("找不到命令 %s：%w", cmd.Path, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w，%s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build darwin
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+// macOS总是有桌面
+func desktopSession() bool {
+	return true
+}
+
+// 用osascript弹出通知中心的通知，文字作为参数传入，不需要转义
+func desktopNotifyCmd(ctx context.Context, title, message string) *exec.Cmd {
+	return exec.CommandContext(ctx, "osascript",
+		"-e", "on run argv",
+		"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+		"-e", "end run",
+		title, message)
+}
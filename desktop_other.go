@@ -0,0 +1,19 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// 是否运行在图形桌面里，没有X11或Wayland的显示时弹不出通知
+func desktopSession() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// 用libnotify的notify-send弹出通知
+func desktopNotifyCmd(ctx context.Context, title, message string) *exec.Cmd {
+	return exec.CommandContext(ctx, "notify-send", "--app-name=acfunlivedb", "--", title, message)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// 用PowerShell弹出Windows的toast通知，以PowerShell的名义发送，文字通过环境变量传入，不需要转义
+const desktopToastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:ACFUNLIVEDB_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:ACFUNLIVEDB_MESSAGE)) > $null
+$appID = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appID).Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+// Windows总是有桌面
+func desktopSession() bool {
+	return true
+}
+
+// 用PowerShell弹出toast通知
+func desktopNotifyCmd(ctx context.Context, title, message string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", desktopToastScript)
+	cmd.Env = append(os.Environ(), "ACFUNLIVEDB_TITLE="+title, "ACFUNLIVEDB_MESSAGE="+message)
+	return cmd
+}
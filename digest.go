@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	digestCheckInterval = time.Hour       // 检查是否需要生成每周摘要的间隔
+	digestMomentBucket  = time.Minute     // 统计高能时刻的弹幕时使用的时间段长度
+	digestMomentCount   = 3               // 每场直播显示的高能时刻数量
+	digestDateLayout    = "2006-01-02"    // 摘要里的日期格式
+	digestTimeLayout    = "01-02 15:04"   // 摘要里的开播时间格式
+	defaultDigestLang   = "zh"            // 默认的摘要语言
+	digestWeekLayout    = "%d-W%02d.html" // 摘要文件名，为ISO周的年份和周数
+)
+
+// 每周摘要的设置
+type digestConfig struct {
+	Dir      string   `json:"dir"`                    // 保存每周摘要网页的文件夹，相对路径以本程序所在文件夹为准，为空时不生成
+	Language string   `json:"language"`               // 摘要网页的语言，可以是zh或en
+	Webhooks []string `json:"webhooks" secret:"true"` // 生成摘要后通知的webhook链接
+}
+
+// 摘要网页的文字，key为语言
+var digestText = map[string]map[string]string{
+	"zh": {
+		"title":     "每周直播摘要",
+		"sessions":  "直播次数",
+		"hours":     "直播总时长（小时）",
+		"start":     "开播时间",
+		"liveTitle": "标题",
+		"duration":  "时长",
+		"playback":  "录播",
+		"backup":    "备份",
+		"moments":   "高能时刻",
+		"danmaku":   "条弹幕",
+		"none":      "本周没有直播",
+		"unknown":   "未知",
+		"generated": "生成时间",
+		"colon":     "：",
+	},
+	"en": {
+		"title":     "Weekly live digest",
+		"sessions":  "Sessions",
+		"hours":     "Hours live",
+		"start":     "Start",
+		"liveTitle": "Title",
+		"duration":  "Duration",
+		"playback":  "Playback",
+		"backup":    "Backup",
+		"moments":   "Top moments",
+		"danmaku":   "comments",
+		"none":      "No live sessions this week",
+		"unknown":   "unknown",
+		"generated": "Generated at",
+		"colon":     ": ",
+	},
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - {{.T.title}} {{.Week}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: .4em; text-align: left; vertical-align: top; }
+.summary span { margin-right: 2em; }
+ul { margin: 0; padding-left: 1.2em; }
+footer { margin-top: 2em; color: #888; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} <small>uid {{.UID}}</small></h1>
+<h2>{{.T.title}} {{.From}} ~ {{.To}}</h2>
+<p class="summary"><span>{{.T.sessions}}{{.T.colon}}{{len .Sessions}}</span><span>{{.T.hours}}{{.T.colon}}{{.Hours}}</span></p>
+{{if .Sessions}}
+<table>
+<tr><th>{{.T.start}}</th><th>{{.T.liveTitle}}</th><th>{{.T.duration}}</th><th>{{.T.moments}}</th><th>{{.T.playback}}</th></tr>
+{{range .Sessions}}
+<tr>
+<td>{{.Start}}</td>
+<td>{{.Title}}</td>
+<td>{{.Duration}}</td>
+<td>{{if .Moments}}<ul>{{range .Moments}}<li>{{.Offset}} ({{.Count}} {{$.T.danmaku}})</li>{{end}}</ul>{{end}}</td>
+<td>{{if .PlaybackURL}}<a href="{{.PlaybackURL}}">{{$.T.playback}}</a>{{end}}{{if .BackupURL}} <a href="{{.BackupURL}}">{{$.T.backup}}</a>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>{{.T.none}}</p>
+{{end}}
+<footer>{{.T.generated}}{{.T.colon}}{{.Generated}}</footer>
+</body>
+</html>
+`))
+
+// 摘要网页的数据
+type digestPage struct {
+	T         map[string]string
+	Lang      string
+	UID       store.UID
+	Name      string
+	Week      string
+	From      string
+	To        string
+	Hours     string
+	Sessions  []digestSession
+	Generated string
+}
+
+// 摘要里的一场直播
+type digestSession struct {
+	Start       string
+	Title       string
+	Duration    string
+	PlaybackURL string
+	BackupURL   string
+	Moments     []digestMoment
+}
+
+// 直播里弹幕最多的时刻
+type digestMoment struct {
+	Offset string // 在直播里的时间，格式为时:分:秒
+	Count  int    // 这一分钟里的弹幕数量
+}
+
+// 本周的开始时间，每周从星期一开始
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// 格式化在直播里的时间
+func formatOffset(ms int64) string {
+	s := ms / 1000
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// 定期为关注的主播生成上一周的摘要
+func digestCycle(ctx context.Context) {
+	if conf.Digest.Dir == "" || len(watchedUIDs()) == 0 {
+		return
+	}
+	for {
+		lastWeek := weekStart(time.Now()).AddDate(0, 0, -7)
+		for _, uid := range watchedUIDs() {
+			path, page, err := writeDigest(ctx, uid, lastWeek, false)
+			if err != nil {
+				log.Printf("生成uid为 %d 的主播的每周摘要出现错误：%v", uid, err)
+				continue
+			}
+			if page != nil {
+				log.Printf("已生成uid为 %d 的主播 %s 的每周摘要 %s", uid, page.Name, path)
+				notifyDigest(path, page)
+			}
+		}
+		if !sleepCtx(ctx, digestCheckInterval) {
+			return
+		}
+	}
+}
+
+// 生成主播在start开始的一周的摘要，摘要已存在并且force为false时不生成，返回的page为nil
+func writeDigest(ctx context.Context, uid store.UID, start time.Time, force bool) (string, *digestPage, error) {
+	year, week := start.ISOWeek()
+	path := filepath.Join(absPath(conf.Digest.Dir), uid.String(), fmt.Sprintf(digestWeekLayout, year, week))
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", nil, err
+		}
+	}
+
+	page, err := buildDigest(ctx, uid, start)
+	if err != nil {
+		return "", nil, err
+	}
+	var buf bytes.Buffer
+	if err = digestTemplate.Execute(&buf, page); err != nil {
+		return "", nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", nil, err
+	}
+	// 先写到临时文件再重命名，避免读到写了一半的网页
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return "", nil, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return "", nil, err
+	}
+	return path, page, nil
+}
+
+// 查询主播在start开始的一周的直播数据
+func buildDigest(ctx context.Context, uid store.UID, start time.Time) (*digestPage, error) {
+	lang := conf.Digest.Language
+	if digestText[lang] == nil {
+		lang = defaultDigestLang
+	}
+	text := digestText[lang]
+	end := start.AddDate(0, 0, 7)
+	year, week := start.ISOWeek()
+	page := &digestPage{
+		T:         text,
+		Lang:      lang,
+		UID:       uid,
+		Name:      uid.String(),
+		Week:      fmt.Sprintf("%d-W%02d", year, week),
+		From:      start.Format(digestDateLayout),
+		To:        end.AddDate(0, 0, -1).Format(digestDateLayout),
+		Generated: time.Now().Format(timeLayout),
+	}
+
+	lives, err := fromStoreList(db.QueryLives(ctx, store.LiveQuery{UID: uid, From: start.UnixMilli(), To: end.UnixMilli()}))
+	if err != nil {
+		return nil, err
+	}
+	if name := latestStreamerName(ctx, uid); name != "" {
+		page.Name = name
+	}
+	var total int64
+	// 按开播时间从早到晚排列
+	for i := len(lives) - 1; i >= 0; i-- {
+		l := lives[i]
+		title := l.title
+		if title == "" {
+			title = l.suggestedTitle
+		}
+		s := digestSession{
+			Start:       time.UnixMilli(l.startTime).Format(digestTimeLayout),
+			Title:       title,
+			Duration:    text["unknown"],
+			PlaybackURL: l.playbackURL,
+			BackupURL:   l.backupURL,
+		}
+		if l.duration != 0 {
+			s.Duration = formatOffset(l.duration)
+			total += l.duration
+		}
+		peaks, err := db.QueryDanmakuPeaks(ctx, l.liveID, digestMomentBucket.Milliseconds(), digestMomentCount)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range peaks {
+			s.Moments = append(s.Moments, digestMoment{Offset: formatOffset(p.Offset), Count: p.Count})
+		}
+		page.Sessions = append(page.Sessions, s)
+	}
+	page.Hours = fmt.Sprintf("%.1f", float64(total)/float64(time.Hour.Milliseconds()))
+	return page, nil
+}
+
+// 把生成的摘要通知到设置的webhook
+func notifyDigest(path string, page *digestPage) {
+	if len(conf.Digest.Webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(struct {
+		UID      store.UID `json:"uid"`
+		Name     string    `json:"name"`
+		Week     string    `json:"week"`
+		Sessions int       `json:"sessions"`
+		Hours    string    `json:"hours"`
+		File     string    `json:"file"`
+	}{page.UID, page.Name, page.Week, len(page.Sessions), page.Hours, path})
+	checkErr(err)
+	for _, url := range conf.Digest.Webhooks {
+		err := runThrice(func() error {
+			return postJSON(url, body)
+		})
+		if err != nil {
+			log.Printf("发送每周摘要通知到 %s 失败：%v", redactURL(url), err)
+		}
+	}
+}
+
+// 生成指定日期所在一周的摘要，覆盖已有的摘要，dateStr为空时生成上一周的摘要
+func generateDigest(ctx context.Context, dateStr string) {
+	if conf.Digest.Dir == "" || len(watchedUIDs()) == 0 {
+		log.Println("需要设置digest.dir和watchUIDs或watch才能生成每周摘要")
+		return
+	}
+	start := weekStart(time.Now()).AddDate(0, 0, -7)
+	if dateStr != "" {
+		t, err := time.ParseInLocation(dateLayout, dateStr, time.Local)
+		if err != nil {
+			log.Printf("%s 不是有效的日期，格式为 %s", dateStr, dateLayout)
+			return
+		}
+		start = weekStart(t)
+	}
+	for _, uid := range watchedUIDs() {
+		path, _, err := writeDigest(ctx, uid, start, true)
+		if err != nil {
+			log.Printf("生成uid为 %d 的主播的每周摘要出现错误：%v", uid, err)
+			continue
+		}
+		log.Printf("已生成uid为 %d 的主播的每周摘要 %s", uid, path)
+	}
+}
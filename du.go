@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// du打印的数据种类和顺序
+var storageKinds = []string{store.StorageDanmaku, store.StorageCover, store.StorageRecording, store.StorageLiveCut}
+
+// 记录直播的一个文件占用的空间，文件不存在时删除记录
+func accountFile(liveID store.LiveID, kind, file string) {
+	var size int64
+	if file != "" {
+		if info, err := os.Stat(absPath(file)); err == nil {
+			size = info.Size()
+		}
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的%s占用的空间", liveID, storageKindName(kind)), nil,
+		store.LiveStorageWrite(liveID, kind, size, time.Now().UnixMilli()))
+}
+
+// 记录直播的弹幕占用的空间，弹幕需要已经写入数据库
+func accountDanmaku(ctx context.Context, liveID store.LiveID) {
+	size, err := db.QueryDanmakuBytes(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的弹幕占用的空间出现错误：%v", liveID, err)
+		return
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的弹幕占用的空间", liveID), nil,
+		store.LiveStorageWrite(liveID, store.StorageDanmaku, size, time.Now().UnixMilli()))
+}
+
+// 直播封面文件，没有下载时为空
+func coverFile(uid store.UID, liveID store.LiveID) string {
+	if conf.CoverDir == "" {
+		return ""
+	}
+	files, _ := filepath.Glob(filepath.Join(absPath(conf.CoverDir), uid.String(), liveID.String()+".*"))
+	if len(files) == 0 {
+		return ""
+	}
+	return files[0]
+}
+
+// 重新计算主播每场直播占用的空间，文件被删除或移动后可以用来更新记录
+func refreshStorage(ctx context.Context, uid store.UID) error {
+	list, err := db.QueryStorageSources(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for _, src := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		accountDanmaku(ctx, src.LiveID)
+		accountFile(src.LiveID, store.StorageCover, coverFile(uid, src.LiveID))
+		accountFile(src.LiveID, store.StorageRecording, src.RecordFile)
+		accountFile(src.LiveID, store.StorageLiveCut, src.LiveCutFile)
+	}
+	flushWrites()
+	return nil
+}
+
+// 处理"du [主播的uid]"命令，有uid时重新计算并打印主播每场直播占用的空间，没有时打印每个主播占用的空间
+func printStorage(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		printStreamerStorage(ctx)
+		return
+	}
+	for _, uid := range parseUIDArgs(args) {
+		if err := refreshStorage(ctx, uid); err != nil {
+			log.Printf("计算uid为 %d 的主播占用的空间出现错误：%v", uid, err)
+			continue
+		}
+		printLiveStorage(ctx, uid)
+	}
+}
+
+// 打印主播每场直播占用的空间
+func printLiveStorage(ctx context.Context, uid store.UID) {
+	list, err := db.QueryLiveStorage(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播占用的空间出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("uid为 %d 的主播没有占用空间的数据", uid)
+		return
+	}
+	total := make(map[string]int64)
+	for i := 0; i < len(list); {
+		ls := list[i]
+		sizes := make(map[string]int64)
+		for ; i < len(list) && list[i].LiveID == ls.LiveID; i++ {
+			sizes[list[i].Kind] = list[i].Bytes
+			total[list[i].Kind] += list[i].Bytes
+		}
+		fmt.Printf("liveID：%s 开播时间：%s %s\n", ls.LiveID, time.UnixMilli(ls.StartTime).Format(timeLayout), formatStorage(sizes))
+	}
+	fmt.Printf("uid为 %d 的主播合计：%s\n", uid, formatStorage(total))
+}
+
+// 打印每个主播占用的空间，占用最多的在前面
+func printStreamerStorage(ctx context.Context) {
+	list, err := db.QueryStreamerStorage(ctx)
+	if err != nil {
+		log.Printf("查询主播占用的空间出现错误：%v", err)
+		return
+	}
+	if len(list) == 0 {
+		log.Println(`没有占用空间的记录，可以用"du 主播的uid"计算主播占用的空间`)
+		return
+	}
+	sizes := make(map[store.UID]map[string]int64)
+	var uids []store.UID
+	for _, ss := range list {
+		if sizes[ss.UID] == nil {
+			sizes[ss.UID] = make(map[string]int64)
+			uids = append(uids, ss.UID)
+		}
+		sizes[ss.UID][ss.Kind] = ss.Bytes
+	}
+	sum := func(m map[string]int64) (n int64) {
+		for _, b := range m {
+			n += b
+		}
+		return n
+	}
+	sort.SliceStable(uids, func(i, j int) bool { return sum(sizes[uids[i]]) > sum(sizes[uids[j]]) })
+	for _, uid := range uids {
+		fmt.Printf("主播uid：%d 昵称：%s %s\n", uid, latestStreamerName(ctx, uid), formatStorage(sizes[uid]))
+	}
+}
+
+// 按storageKinds的顺序打印每种数据和合计占用的空间
+func formatStorage(sizes map[string]int64) string {
+	var s string
+	var total int64
+	for _, kind := range storageKinds {
+		s += fmt.Sprintf("%s：%s ", storageKindName(kind), formatBytes(sizes[kind]))
+		total += sizes[kind]
+	}
+	return s + "合计：" + formatBytes(total)
+}
+
+// 数据种类的中文名
+func storageKindName(kind string) string {
+	switch kind {
+	case store.StorageDanmaku:
+		return "弹幕"
+	case store.StorageCover:
+		return "封面"
+	case store.StorageRecording:
+		return "录播"
+	case store.StorageLiveCut:
+		return "直播剪辑"
+	default:
+		return kind
+	}
+}
+
+// 把字节数转换为方便阅读的形式
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
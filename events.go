@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"acfunlivedb/store"
+)
+
+// 直播数据变动的类型
+type changeKind string
+
+const (
+	changeInsert changeKind = "insert" // 新的直播
+	changeUpdate changeKind = "update" // 直播数据有更新
+	changeDelete changeKind = "delete" // 直播数据被删除
+
+	changeStart     changeKind = "start"     // 开播
+	changeEnd       changeKind = "end"       // 下播
+	changeReconnect changeKind = "reconnect" // 下播后很快重新开播
+)
+
+// 所有的变动类型
+var changeKinds = []changeKind{changeInsert, changeUpdate, changeDelete, changeStart, changeEnd, changeReconnect}
+
+// 推送给订阅者的直播数据变动
+type liveEvent struct {
+	Type changeKind `json:"type"`
+	Live *live      `json:"-"`
+}
+
+// 转换为SSE推送的JSON
+func (e liveEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type changeKind `json:"type"`
+		Live *liveJSON  `json:"live"`
+	}{e.Type, e.Live.toJSON()})
+}
+
+type pendingEvent struct {
+	kind   changeKind
+	liveID store.LiveID
+}
+
+// 等待查询数据后推送的变动，推送时需要查询数据库，不在写入数据库的goroutine里推送
+var pendingEvents = make(chan pendingEvent, 1024)
+
+// SSE和gRPC的订阅者
+var eventHub = struct {
+	sync.Mutex
+	subs map[chan liveEvent]struct{}
+}{subs: make(map[chan liveEvent]struct{})}
+
+// 记录直播数据变动，用于webhook通知、SSE和gRPC推送
+func markChanged(kind changeKind, liveID store.LiveID) {
+	addInvalidation(liveID)
+	if conf.HTTP.Listen == "" && conf.GRPC.Listen == "" {
+		return
+	}
+	select {
+	case pendingEvents <- pendingEvent{kind: kind, liveID: liveID}:
+	default:
+		log.Printf("待推送的直播数据变动过多，丢弃liveID为 %s 的变动", liveID)
+	}
+}
+
+// 订阅直播数据变动
+func subscribeEvents() chan liveEvent {
+	ch := make(chan liveEvent, 64)
+	eventHub.Lock()
+	eventHub.subs[ch] = struct{}{}
+	eventHub.Unlock()
+	return ch
+}
+
+// 取消订阅
+func unsubscribeEvents(ch chan liveEvent) {
+	eventHub.Lock()
+	delete(eventHub.subs, ch)
+	eventHub.Unlock()
+}
+
+// 推送数据给所有订阅者，订阅者处理不过来时丢弃
+func broadcastEvent(e liveEvent) {
+	eventHub.Lock()
+	defer eventHub.Unlock()
+	for ch := range eventHub.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// 查询变动的直播数据并推送给订阅者
+func eventCycle(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-pendingEvents:
+			eventHub.Lock()
+			n := len(eventHub.subs)
+			eventHub.Unlock()
+			if n == 0 {
+				continue
+			}
+			l, err := queryLive(ctx, e.liveID)
+			if err != nil {
+				log.Printf("查询liveID为 %s 的直播数据出现错误：%v", e.liveID, err)
+				continue
+			}
+			broadcastEvent(liveEvent{Type: e.kind, Live: l})
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+
+	"acfunlivedb/store"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// 导出用的直播数据
+type liveJSON struct {
+	LiveID         store.LiveID `json:"liveID"`         // 直播ID
+	UID            store.UID    `json:"uid"`            // 主播uid
+	Name           string       `json:"name"`           // 主播昵称
+	StreamName     string       `json:"streamName"`     // 直播源ID
+	StartTime      int64        `json:"startTime"`      // 直播开始时间，单位为毫秒
+	StartTimeText  string       `json:"startTimeText"`  // 直播开始时间，本地时间
+	Title          string       `json:"title"`          // 直播间标题
+	SuggestedTitle string       `json:"suggestedTitle"` // 没有直播间标题时的建议标题
+	Duration       int64        `json:"duration"`       // 直播时长，单位为毫秒
+	DurationText   string       `json:"durationText"`   // 直播时长
+	PlaybackURL    string       `json:"playbackURL"`    // 录播链接
+	BackupURL      string       `json:"backupURL"`      // 录播备份链接
+	LiveCutNum     int          `json:"liveCutNum"`     // 直播剪辑编号
+	Access         string       `json:"access"`         // 直播间的访问限制，如付费直播
+	RecordFile     string       `json:"recordFile"`     // 外部录播工具保存的本地录播文件名
+
+	Computed map[string]interface{} `json:"computed,omitempty"` // 设置里的计算列
+}
+
+// 转换为导出用的直播数据
+func (l *live) toJSON() *liveJSON {
+	return &liveJSON{
+		LiveID:         l.liveID,
+		UID:            l.uid,
+		Name:           l.name,
+		StreamName:     l.streamName,
+		StartTime:      l.startTime,
+		StartTimeText:  time.UnixMilli(l.startTime).Format(timeLayout),
+		Title:          l.title,
+		SuggestedTitle: l.suggestedTitle,
+		Duration:       l.duration,
+		DurationText:   (time.Duration(l.duration) * time.Millisecond).String(),
+		PlaybackURL:    l.playbackURL,
+		BackupURL:      l.backupURL,
+		LiveCutNum:     l.liveCutNum,
+		Access:         l.access,
+		RecordFile:     l.recordFile,
+		Computed:       l.computed,
+	}
+}
+
+const exportUsage = `导出命令为"export jsonl 文件路径 [--chunk 行数] [--workers 数量]"、"export csv 文件路径 [编码] [--chunk 行数] [--workers 数量]"、"export ics 主播的uid 文件路径"、"export ass liveID [文件路径]"或"export openapi 文件路径"`
+
+// 运行export命令，args为去掉命令名的参数，终端输入和export子命令共用
+func runExport(ctx context.Context, args []string) error {
+	args, opts, err := parseExportOptions(args)
+	if err != nil {
+		return err
+	}
+	if (opts.chunkRows > 0 || opts.workers > 0) && (len(args) == 0 || (args[0] != "jsonl" && args[0] != "csv")) {
+		return errors.New("只有 export jsonl 和 export csv 可以使用 --chunk 和 --workers")
+	}
+	switch {
+	case len(args) == 2 && args[0] == "jsonl":
+		log.Println("正在导出，请等待")
+		n, err := exportJSONL(ctx, args[1], opts)
+		if err != nil {
+			return fmt.Errorf("导出到 %s 失败，已导出 %d 条数据：%w", args[1], n, err)
+		}
+		log.Printf("已导出 %d 条数据到 %s", n, exportTarget(args[1], opts))
+	case (len(args) == 2 || len(args) == 3) && args[0] == "csv":
+		encoding := conf.CSVEncoding
+		if len(args) == 3 {
+			encoding = args[2]
+		}
+		log.Println("正在导出，请等待")
+		n, err := exportCSV(ctx, args[1], encoding, opts)
+		if err != nil {
+			return fmt.Errorf("导出到 %s 失败，已导出 %d 条数据：%w", args[1], n, err)
+		}
+		log.Printf("已以 %s 编码导出 %d 条数据到 %s", encoding, n, exportTarget(args[1], opts))
+	case len(args) == 3 && args[0] == "ics":
+		uid, err := store.ParseUID(args[1])
+		if err != nil {
+			return err
+		}
+		n, err := exportICAL(ctx, uid, args[2])
+		if err != nil {
+			return fmt.Errorf("导出uid为 %d 的主播的日历到 %s 失败：%w", uid, args[2], err)
+		}
+		log.Printf("已导出 %d 场直播到 %s", n, args[2])
+	case (len(args) == 2 || len(args) == 3) && args[0] == "ass":
+		liveID, err := store.ParseLiveID(args[1])
+		if err != nil {
+			return err
+		}
+		file := liveID.String() + ".ass"
+		if len(args) == 3 {
+			file = args[2]
+		}
+		written, dropped, err := exportASS(ctx, liveID, file)
+		if err != nil {
+			return fmt.Errorf("导出liveID为 %s 的弹幕字幕到 %s 失败：%w", liveID, file, err)
+		}
+		log.Printf("已导出 %d 条弹幕到 %s，%d 条弹幕因为画面里放不下被丢弃", written, file, dropped)
+	case len(args) == 2 && args[0] == "openapi":
+		if err := exportOpenAPI(args[1]); err != nil {
+			return fmt.Errorf("导出OpenAPI文档到 %s 失败：%w", args[1], err)
+		}
+		log.Printf("已导出OpenAPI文档到 %s", args[1])
+	default:
+		return errors.New(exportUsage)
+	}
+	return nil
+}
+
+// 将数据库里所有直播数据以JSON Lines格式导出到file，返回导出的行数
+func exportJSONL(ctx context.Context, file string, opts exportOptions) (int, error) {
+	return exportLives(ctx, file, &exportFormat{
+		name: "jsonl",
+		encode: func(lives []*live) ([]byte, error) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			for _, l := range lives {
+				if err := enc.Encode(l.toJSON()); err != nil {
+					return nil, err
+				}
+			}
+			return buf.Bytes(), nil
+		},
+	}, opts)
+}
+
+// 导出CSV文件支持的编码
+const (
+	csvUTF8    = "utf-8"     // 不带BOM的UTF-8
+	csvUTF8BOM = "utf-8-bom" // 带BOM的UTF-8，Excel能正确识别
+	csvGBK     = "gbk"       // 中文Windows上的Excel默认使用的编码
+)
+
+// 导出CSV文件的列，和导入支持的列名一致
+var csvColumns = []string{"liveID", "uid", "name", "streamName", "startTime", "startTimeText", "title", "suggestedTitle",
+	"duration", "durationText", "playbackURL", "backupURL", "liveCutNum", "access", "recordFile"}
+
+// 检查并规范化CSV文件的编码，为空时为UTF-8
+func csvEncodingName(encoding string) (string, error) {
+	switch encoding = strings.ToLower(encoding); encoding {
+	case "":
+		return csvUTF8, nil
+	case csvUTF8, csvUTF8BOM, csvGBK:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("不支持的编码 %s，只支持 %s、%s 和 %s", encoding, csvUTF8, csvUTF8BOM, csvGBK)
+	}
+}
+
+// 按encoding编码写入w，GBK无法表示的字符会被替换为?，调用者需要在写入完成后Close
+func newCSVEncoder(w io.Writer, encoding string) (io.WriteCloser, error) {
+	encoding, err := csvEncodingName(encoding)
+	if err != nil {
+		return nil, err
+	}
+	switch encoding {
+	case csvUTF8BOM:
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+		return nopWriteCloser{w}, nil
+	case csvGBK:
+		t := transform.Chain(runes.Map(gbkRune), simplifiedchinese.GBK.NewEncoder())
+		return transform.NewWriter(w, t), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// 不需要Close的io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// 不能用GBK编码的字符替换为?
+func gbkRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		return r
+	}
+	if _, _, err := transform.String(simplifiedchinese.GBK.NewEncoder(), string(r)); err != nil {
+		return '?'
+	}
+	return r
+}
+
+// 将数据库里所有直播数据以encoding编码的CSV格式导出到file，返回导出的行数
+func exportCSV(ctx context.Context, file, encoding string, opts exportOptions) (int, error) {
+	encoding, err := csvEncodingName(encoding)
+	if err != nil {
+		return 0, err
+	}
+	header := append([]string(nil), csvColumns...)
+	for _, c := range conf.ComputedColumns {
+		header = append(header, c.Name)
+	}
+	headerData, err := encodeCSV(encoding, [][]string{header})
+	if err != nil {
+		return 0, err
+	}
+	// BOM只在每个文件的开头
+	rowEncoding := encoding
+	if rowEncoding == csvUTF8BOM {
+		rowEncoding = csvUTF8
+	}
+	return exportLives(ctx, file, &exportFormat{
+		name:     "csv",
+		encoding: encoding,
+		header:   headerData,
+		encode: func(lives []*live) ([]byte, error) {
+			records := make([][]string, len(lives))
+			for i, l := range lives {
+				records[i] = csvRecord(l)
+			}
+			return encodeCSV(rowEncoding, records)
+		},
+	}, opts)
+}
+
+// 直播数据在CSV文件里的一行，列的顺序和csvColumns一致，之后是计算列
+func csvRecord(l *live) []string {
+	j := l.toJSON()
+	record := []string{j.LiveID.String(), j.UID.String(), j.Name, j.StreamName, strconv.FormatInt(j.StartTime, 10), j.StartTimeText,
+		j.Title, j.SuggestedTitle, strconv.FormatInt(j.Duration, 10), j.DurationText, j.PlaybackURL, j.BackupURL,
+		strconv.Itoa(j.LiveCutNum), j.Access, j.RecordFile}
+	for _, c := range conf.ComputedColumns {
+		if v := j.Computed[c.Name]; v != nil {
+			record = append(record, fmt.Sprint(v))
+		} else {
+			record = append(record, "")
+		}
+	}
+	return record
+}
+
+// 把CSV的行按encoding编码
+func encodeCSV(encoding string, records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc, err := newCSVEncoder(&buf, encoding)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(enc)
+	if err = w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
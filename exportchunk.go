@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const exportBatchRows = 500 // 每个编码任务的行数，内存里最多同时有约3*workers个任务
+
+// 导出jsonl和csv时的选项
+type exportOptions struct {
+	chunkRows int // 每个文件最多的行数，小于等于0时不分割
+	workers   int // 同时编码的goroutine数，小于等于0时为CPU核数
+}
+
+// 导出的格式
+type exportFormat struct {
+	name     string                              // jsonl或csv
+	encoding string                              // CSV文件的编码
+	header   []byte                              // 每个文件开头的内容
+	encode   func(lives []*live) ([]byte, error) // 把一批直播编码为文件内容，会被多个goroutine同时调用
+}
+
+// 分割导出时的清单，保存为"文件名.manifest.json"
+type exportManifest struct {
+	Format     string        `json:"format"`             // jsonl或csv
+	Encoding   string        `json:"encoding,omitempty"` // CSV文件的编码
+	CreateTime string        `json:"createTime"`         // 导出的时间
+	Rows       int           `json:"rows"`               // 总行数，不包括CSV的列名
+	ChunkRows  int           `json:"chunkRows"`          // 每个文件最多的行数
+	Chunks     []exportChunk `json:"chunks"`             // 按开播时间排列的文件
+}
+
+// 分割导出的一个文件
+type exportChunk struct {
+	File           string `json:"file"`           // 文件名，和清单在同一个文件夹
+	Rows           int    `json:"rows"`           // 行数
+	Bytes          int64  `json:"bytes"`          // 文件大小
+	SHA256         string `json:"sha256"`         // 文件的SHA-256
+	FirstStartTime int64  `json:"firstStartTime"` // 第一场直播的开播时间，单位为毫秒
+	LastStartTime  int64  `json:"lastStartTime"`  // 最后一场直播的开播时间，单位为毫秒
+}
+
+// 一批需要编码的直播
+type exportBatch struct {
+	chunk          int     // 写入的文件序号
+	lives          []*live // 编码后清空
+	rows           int
+	firstStartTime int64
+	lastStartTime  int64
+	data           []byte
+	err            error
+	done           chan struct{} // 编码完成后关闭
+}
+
+// 解析并去掉args里的--chunk和--workers参数
+func parseExportOptions(args []string) ([]string, exportOptions, error) {
+	var opts exportOptions
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		var target *int
+		switch args[i] {
+		case "--chunk":
+			target = &opts.chunkRows
+		case "--workers":
+			target = &opts.workers
+		default:
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, opts, fmt.Errorf("%s 后面需要一个数字", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n <= 0 {
+			return nil, opts, fmt.Errorf("%s 的值 %s 不是正整数", args[i], args[i+1])
+		}
+		*target = n
+		i++
+	}
+	return rest, opts, nil
+}
+
+// 导出后打印的文件，分割时为清单
+func exportTarget(file string, opts exportOptions) string {
+	if opts.chunkRows <= 0 {
+		return file
+	}
+	return manifestPath(file)
+}
+
+// 按开播时间遍历所有直播，由多个goroutine分批编码，再按原来的顺序写入文件，内存里最多有有限的几批直播。
+// 设置了chunkRows时每chunkRows行写入一个文件，最后写入清单
+func exportLives(ctx context.Context, file string, format *exportFormat, opts exportOptions) (n int, e error) {
+	workers := opts.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *exportBatch, workers)
+	ordered := make(chan *exportBatch, workers*2)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				b.data, b.err = format.encode(b.lives)
+				b.lives = nil
+				close(b.done)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		var b *exportBatch
+		send := func() error {
+			for _, ch := range []chan *exportBatch{ordered, jobs} {
+				select {
+				case ch <- b:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			b = nil
+			return nil
+		}
+		rows := 0
+		err := db.ForEachLive(ctx, func(sl *store.Live) error {
+			chunk := 0
+			if opts.chunkRows > 0 {
+				chunk = rows / opts.chunkRows
+			}
+			if b != nil && (b.chunk != chunk || b.rows == exportBatchRows) {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+			if b == nil {
+				b = &exportBatch{chunk: chunk, firstStartTime: sl.StartTime, done: make(chan struct{})}
+			}
+			l := fromStore(sl)
+			b.lives = append(b.lives, &l)
+			b.rows++
+			b.lastStartTime = sl.StartTime
+			rows++
+			return nil
+		})
+		if err == nil && b != nil {
+			err = send()
+		}
+		readErr <- err
+	}()
+
+	w := &chunkWriter{file: file, format: format, split: opts.chunkRows > 0, index: -1}
+	for b := range ordered {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+		}
+		if e != nil {
+			continue
+		}
+		switch {
+		case ctx.Err() != nil:
+			e = ctx.Err()
+		case b.err != nil:
+			e = b.err
+		default:
+			e = w.write(b)
+		}
+		if e != nil {
+			cancel()
+			continue
+		}
+		n += b.rows
+	}
+	wg.Wait()
+	if err := <-readErr; err != nil && e == nil {
+		e = err
+	}
+	if err := w.finish(e == nil); err != nil && e == nil {
+		e = err
+	}
+	if e != nil || !w.split {
+		return n, e
+	}
+	return n, writeManifest(file, &exportManifest{
+		Format:     format.name,
+		Encoding:   format.encoding,
+		CreateTime: time.Now().Format(time.RFC3339),
+		Rows:       n,
+		ChunkRows:  opts.chunkRows,
+		Chunks:     w.chunks,
+	})
+}
+
+// 按顺序写入编码后的数据，分割时按文件序号切换文件
+type chunkWriter struct {
+	file   string
+	format *exportFormat
+	split  bool
+	index  int // 当前文件的序号，还没有打开文件时为-1
+
+	f      *os.File
+	w      *bufio.Writer
+	hash   hash.Hash
+	chunk  exportChunk
+	chunks []exportChunk
+}
+
+func (c *chunkWriter) write(b *exportBatch) error {
+	if b.chunk != c.index {
+		if err := c.close(); err != nil {
+			return err
+		}
+		if err := c.open(b.chunk); err != nil {
+			return err
+		}
+	}
+	if c.chunk.Rows == 0 {
+		c.chunk.FirstStartTime = b.firstStartTime
+	}
+	c.chunk.Rows += b.rows
+	c.chunk.LastStartTime = b.lastStartTime
+	return c.writeData(b.data)
+}
+
+// 打开第index个文件，写入文件开头的内容
+func (c *chunkWriter) open(index int) error {
+	path := c.file
+	if c.split {
+		path = chunkPath(c.file, index)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	c.f, c.index = f, index
+	c.hash = sha256.New()
+	c.w = bufio.NewWriter(f)
+	c.chunk = exportChunk{File: filepath.Base(path)}
+	return c.writeData(c.format.header)
+}
+
+func (c *chunkWriter) writeData(data []byte) error {
+	if _, err := c.w.Write(data); err != nil {
+		return fmt.Errorf("写入文件 %s 失败：%w", c.f.Name(), err)
+	}
+	c.hash.Write(data)
+	c.chunk.Bytes += int64(len(data))
+	return nil
+}
+
+// 关闭当前文件
+func (c *chunkWriter) close() error {
+	if c.f == nil {
+		return nil
+	}
+	f := c.f
+	c.f = nil
+	err := c.w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入文件 %s 失败：%w", f.Name(), err)
+	}
+	c.chunk.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+	c.chunks = append(c.chunks, c.chunk)
+	return nil
+}
+
+// 关闭最后一个文件，ok时没有数据也会创建一个只有文件开头内容的文件
+func (c *chunkWriter) finish(ok bool) error {
+	if ok && c.index < 0 {
+		if err := c.open(0); err != nil {
+			return err
+		}
+	}
+	return c.close()
+}
+
+// 第index个分割文件的路径，如lives.csv分割为lives-00001.csv、lives-00002.csv等
+func chunkPath(file string, index int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(file, ext), index+1, ext)
+}
+
+// 清单的路径，如lives.csv的清单为lives.manifest.json
+func manifestPath(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".manifest.json"
+}
+
+func writeManifest(file string, m *exportManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := manifestPath(file)
+	if err = os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("写入清单 %s 失败：%w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+
+	"github.com/orzogc/acfundanmu"
+)
+
+// 获取并保存关注的主播现在的守护团信息，phase为store.FanClubStart或store.FanClubEnd
+func recordFanClub(uid store.UID, liveID store.LiveID, phase string) {
+	if !isWatched(uid) {
+		return
+	}
+	var list *acfundanmu.MedalRankList
+	err := fanClubBreaker.run(func() error {
+		var err error
+		list, err = ac.GetMedalRankList(int64(uid))
+		return err
+	})
+	if err != nil {
+		log.Printf("获取uid为 %d 的主播的守护团信息失败：%v", uid, err)
+		return
+	}
+	f := &store.FanClub{LiveID: liveID, Phase: phase, Time: time.Now().UnixMilli()}
+	if list.HasFansClub {
+		f.ClubName = list.ClubName
+		f.MemberCount = list.MedalCount
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的直播的守护团信息", liveID), nil, store.FanClubWrite(f))
+}
+
+// 打印直播开始和结束时主播的守护团名字和人数
+func printFanClub(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QueryFanClub(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播的守护团信息出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有守护团信息，只记录关注的主播的直播", liveID)
+		return
+	}
+	for _, f := range list {
+		phase := "开播时"
+		if f.Phase == store.FanClubEnd {
+			phase = "下播时"
+		}
+		if f.ClubName == "" {
+			fmt.Printf("%s（%s） 主播没有守护团\n", phase, time.UnixMilli(f.Time).Format(timeLayout))
+			continue
+		}
+		fmt.Printf("%s（%s） 守护团：%s 人数：%d\n", phase, time.UnixMilli(f.Time).Format(timeLayout), f.ClubName, f.MemberCount)
+	}
+	if len(list) == 2 && list[0].ClubName != "" && list[1].ClubName != "" {
+		fmt.Printf("直播期间守护团人数变化了 %+d\n", list[1].MemberCount-list[0].MemberCount)
+	}
+}
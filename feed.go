@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const feedItems = 50 // RSS里的直播数量
+
+// RSS 2.0的根元素
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// 主播的直播间链接
+func liveRoomURL(uid store.UID) string {
+	return fmt.Sprintf("https://live.acfun.cn/live/%d", uid)
+}
+
+// GET /feed/{uid}.xml 返回主播最近已经结束的直播的RSS
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/feed/"), ".xml")
+	uid, err := store.ParseUID(name)
+	if !ok || err != nil {
+		writeError(w, http.StatusNotFound, errors.New("请求的路径不存在"))
+		return
+	}
+	lives, err := fromStoreList(db.QueryLives(r.Context(), store.LiveQuery{UID: uid, Finished: true, Limit: feedItems}))
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的RSS出现错误：%v", uid, err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+
+	streamer := latestStreamerName(r.Context(), uid)
+	if streamer == "" {
+		streamer = fmt.Sprintf("uid %d", uid)
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         streamer + " 的直播记录",
+			Link:          liveRoomURL(uid),
+			Description:   fmt.Sprintf("uid为 %d 的主播 %s 最近结束的直播", uid, streamer),
+			Language:      "zh-cn",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+			Items:         make([]rssItem, len(lives)),
+		},
+	}
+	for i, l := range lives {
+		title := l.title
+		if title == "" {
+			title = l.suggestedTitle
+		}
+		if title == "" {
+			title = "没有标题的直播"
+		}
+		link := l.playbackURL
+		if link == "" {
+			link = liveRoomURL(uid)
+		}
+		start := time.UnixMilli(l.startTime)
+		var desc strings.Builder
+		fmt.Fprintf(&desc, "开播时间：%s<br>直播时长：%s", start.Format(timeLayout), time.Duration(l.duration)*time.Millisecond)
+		if l.playbackURL != "" {
+			fmt.Fprintf(&desc, `<br><a href="%s">录播</a>`, xmlAttr(l.playbackURL))
+		}
+		if l.backupURL != "" {
+			fmt.Fprintf(&desc, ` <a href="%s">备份</a>`, xmlAttr(l.backupURL))
+		}
+		feed.Channel.Items[i] = rssItem{
+			Title:       title,
+			Link:        link,
+			Description: desc.String(),
+			PubDate:     start.Format(time.RFC1123Z),
+			GUID:        rssGUID{Value: l.liveID.String()},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("返回RSS出现错误：%v", err)
+	}
+}
+
+// 转义description里的HTML属性值
+func xmlAttr(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
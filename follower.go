@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+
+	"github.com/orzogc/acfundanmu"
+)
+
+// 获取两个主播的粉丝数之间的间隔，避免频繁请求接口
+const followerFetchDelay = 2 * time.Second
+
+// 每隔followerHours小时保存一次关注的主播的粉丝数和关注数
+func followerCycle(ctx context.Context) {
+	if conf.FollowerHours <= 0 || conf.Mirror.Source != "" {
+		return
+	}
+	for {
+		recordFollowers(ctx)
+		if !sleepCtx(ctx, time.Duration(conf.FollowerHours)*time.Hour) {
+			return
+		}
+	}
+}
+
+// 获取并保存关注的主播现在的粉丝数和关注数
+func recordFollowers(ctx context.Context) {
+	for i, uid := range watchedUIDs() {
+		if i > 0 && !sleepCtx(ctx, followerFetchDelay) {
+			return
+		}
+		var info *acfundanmu.UserLiveInfo
+		err := liveInfoBreaker.run(func() error {
+			var err error
+			info, err = ac.GetUserLiveInfo(int64(uid))
+			return err
+		})
+		if err != nil {
+			log.Printf("获取uid为 %d 的主播的粉丝数失败：%v", uid, err)
+			continue
+		}
+		queueWrite(fmt.Sprintf("保存uid为 %d 的主播的粉丝数", uid), nil, store.FollowerWrite(&store.Follower{
+			UID:            uid,
+			Time:           time.Now().UnixMilli(),
+			FansCount:      info.Profile.FansCount,
+			FollowingCount: info.Profile.FollowingCount,
+		}))
+	}
+}
+
+// 打印主播每次获取的粉丝数和关注数，以及和上一次相比的变化
+func printFollowers(ctx context.Context, uid store.UID) {
+	list, err := db.QueryFollowers(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的粉丝数记录出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的粉丝数记录，需要设置 followerHours 并关注这个主播", uid)
+		return
+	}
+	for i, f := range list {
+		change := ""
+		if i > 0 {
+			change = fmt.Sprintf("（%+d）", f.FansCount-list[i-1].FansCount)
+		}
+		fmt.Printf("%s 粉丝数：%d%s 关注数：%d\n", time.UnixMilli(f.Time).Format(timeLayout), f.FansCount, change, f.FollowingCount)
+	}
+	first, last := list[0], list[len(list)-1]
+	fmt.Printf("从 %s 到 %s 粉丝数变化了 %+d\n", time.UnixMilli(first.Time).Format(timeLayout), time.UnixMilli(last.Time).Format(timeLayout), last.FansCount-first.FansCount)
+}
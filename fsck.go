@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 检查数据库的完整性和数据的一致性，fix为true时尝试修复发现的问题
+func fsck(ctx context.Context, fix bool) {
+	limit := maxLiveDuration()
+	if limit <= 0 {
+		limit = defaultMaxLiveHours * time.Hour
+	}
+	result, err := db.Check(ctx, limit.Milliseconds())
+	if err != nil {
+		log.Printf("检查数据库出现错误：%v", err)
+		return
+	}
+
+	problems := 0
+	report := func(format string, v ...interface{}) {
+		problems++
+		log.Printf(format, v...)
+	}
+	fixErr := func(err error) {
+		if err != nil {
+			log.Printf("修复数据库出现错误：%v", err)
+		}
+	}
+
+	// 数据库文件的完整性
+	for _, r := range result.Integrity {
+		report("数据库完整性检查：%s", r)
+	}
+
+	for _, liveID := range result.DuplicateLiveIDs {
+		report("liveID为 %s 的直播在主数据库和归档数据库里都有数据，需要手动处理", liveID)
+	}
+
+	for _, liveID := range result.BadDurations {
+		report("liveID为 %s 的直播的直播时长或开播时间异常", liveID)
+		if fix {
+			fixErr(db.FinalizeLive(ctx, liveID, 0))
+			if duration, err := getDuration(liveID); err == nil && duration > 0 && duration <= limit.Milliseconds() {
+				updateLiveDuration(ctx, liveID, duration)
+			}
+		}
+	}
+
+	if len(result.MissingLiveCut) != 0 {
+		report("有 %d 场已结束的直播没有获取过直播剪辑编号", len(result.MissingLiveCut))
+		if fix {
+			fixMissingLiveCut(ctx, result.MissingLiveCut)
+		}
+	}
+
+	for _, liveID := range result.OrphanPlayback {
+		report("liveID为 %s 的直播的录播链接不完整或者直播还没有结束", liveID)
+		if fix {
+			fixErr(db.ClearPlayback(ctx, liveID))
+		}
+	}
+
+	if len(result.OrphanActive) != 0 {
+		report("activeLive表里有 %d 条记录没有对应的直播", len(result.OrphanActive))
+	}
+	if len(result.OrphanLiveCut) != 0 {
+		report("liveCutHistory表里有 %d 场直播没有对应的直播数据", len(result.OrphanLiveCut))
+	}
+	if fix && len(result.OrphanActive)+len(result.OrphanLiveCut) != 0 {
+		fixErr(db.DeleteOrphans(ctx))
+	}
+
+	switch {
+	case problems == 0:
+		log.Println("数据库检查完毕，没有发现问题")
+	case fix:
+		log.Printf("数据库检查完毕，发现 %d 个问题，已尝试修复", problems)
+	default:
+		log.Printf("数据库检查完毕，发现 %d 个问题，可以用 fsck --fix 尝试修复", problems)
+	}
+}
+
+// 获取缺少的直播剪辑编号，每场直播都需要请求一次，中断后下次从上次处理到的直播继续，
+// 没有直播剪辑的直播也会记录为获取过，之后不再报告
+func fixMissingLiveCut(ctx context.Context, lives []store.Live) {
+	sort.Slice(lives, func(i, j int) bool { return lives[i].LiveID < lives[j].LiveID })
+	cursor := loadJobCursor(ctx, jobFixLiveCut)
+	for _, l := range lives {
+		if cursor.done(l.LiveID.String()) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		saveLiveCut(ctx, l.UID, l.LiveID)
+		cursor.save(l.LiveID.String())
+	}
+	flushWrites()
+	cursor.finish()
+}
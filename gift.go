@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 打印直播每种礼物的合计
+func printGiftTotals(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QueryGiftTotals(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播的礼物合计出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有礼物合计，需要记录弹幕和礼物，弹幕记录结束后才会合计", liveID)
+		return
+	}
+	var acCoin int64
+	bananas := 0
+	for _, t := range list {
+		acCoin += t.ACCoin
+		if t.ACCoin == 0 {
+			bananas += t.Count
+		}
+		fmt.Printf("%s（%d） 数量：%d AC币：%d 赠送的观众数：%d\n", t.GiftName, t.GiftID, t.Count, t.ACCoin, t.Senders)
+	}
+	fmt.Printf("合计 AC币：%d 免费礼物（香蕉）：%d\n", acCoin, bananas)
+}
+
+// 打印主播每场直播收到的礼物的合计
+func printIncome(ctx context.Context, uid store.UID) {
+	list, err := db.QueryIncome(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的礼物收入出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的礼物合计，需要记录弹幕和礼物", uid)
+		return
+	}
+	var acCoin int64
+	for _, in := range list {
+		acCoin += in.ACCoin
+		fmt.Printf("%s %s %s AC币：%d 付费礼物：%d 免费礼物（香蕉）：%d\n", time.UnixMilli(in.StartTime).Format(timeLayout), in.LiveID, in.Title,
+			in.ACCoin, in.PaidCount, in.Bananas)
+	}
+	fmt.Printf("%d 场直播共收到 %d AC币\n", len(list), acCoin)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"math"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"acfunlivedb/rpc"
+	"acfunlivedb/store"
+)
+
+// gRPC服务器的设置
+type grpcConfig struct {
+	Listen string `json:"listen"`              // 监听地址，如"127.0.0.1:9090"，为空时不启动gRPC服务器
+	Token  string `json:"token" secret:"true"` // 客户端需要在authorization元数据里带上的bearer token，为空时不鉴权
+}
+
+// 实现rpc.ArchiveServer
+type archiveServer struct {
+	rpc.UnimplementedArchiveServer
+}
+
+// 启动gRPC服务器，ctx结束时关闭
+func serveGRPC(ctx context.Context) {
+	if conf.GRPC.Listen == "" {
+		return
+	}
+	lis, err := net.Listen("tcp", conf.GRPC.Listen)
+	if err != nil {
+		log.Printf("gRPC服务器监听 %s 失败：%v", conf.GRPC.Listen, err)
+		return
+	}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkGRPCToken(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPCToken(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	rpc.RegisterArchiveServer(srv, archiveServer{})
+	go func() {
+		<-ctx.Done()
+		// StreamEvents会在ctx结束时返回，GracefulStop不会一直等待
+		srv.GracefulStop()
+	}()
+
+	log.Printf("gRPC服务器监听 %s", conf.GRPC.Listen)
+	if err := srv.Serve(lis); err != nil {
+		log.Printf("gRPC服务器出现错误：%v", err)
+	}
+}
+
+// 检查authorization元数据里的bearer token
+func checkGRPCToken(ctx context.Context) error {
+	if conf.GRPC.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token := strings.TrimPrefix(v, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(conf.GRPC.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "token不正确")
+}
+
+// 转换为gRPC返回的直播数据
+func (l *live) toProto() *rpc.Session {
+	return &rpc.Session{
+		LiveId:         l.liveID.String(),
+		Uid:            int64(l.uid),
+		Name:           l.name,
+		StreamName:     l.streamName,
+		StartTime:      l.startTime,
+		Title:          l.title,
+		SuggestedTitle: l.suggestedTitle,
+		Duration:       l.duration,
+		PlaybackUrl:    l.playbackURL,
+		BackupUrl:      l.backupURL,
+		LiveCutNum:     int32(l.liveCutNum),
+		Access:         l.access,
+		RecordFile:     l.recordFile,
+	}
+}
+
+// gRPC推送的变动类型
+var eventTypes = map[changeKind]rpc.Event_Type{
+	changeInsert: rpc.Event_INSERT,
+	changeUpdate: rpc.Event_UPDATE,
+	changeDelete: rpc.Event_DELETE,
+
+	changeStart:     rpc.Event_START,
+	changeEnd:       rpc.Event_END,
+	changeReconnect: rpc.Event_RECONNECT,
+}
+
+func (archiveServer) QuerySessions(ctx context.Context, req *rpc.QuerySessionsRequest) (*rpc.QuerySessionsResponse, error) {
+	if err := checkRPCUID(req.GetUid()); err != nil {
+		return nil, err
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = apiDefaultLimit
+	}
+	if limit > apiMaxLimit {
+		limit = apiMaxLimit
+	}
+	lives, err := fromStoreList(db.QueryLives(ctx, store.LiveQuery{
+		UID:   store.UID(req.GetUid()),
+		From:  req.GetFrom(),
+		To:    req.GetTo(),
+		Limit: limit,
+	}))
+	if err != nil {
+		log.Printf("gRPC查询直播数据出现错误：%v", err)
+		return nil, status.Error(codes.Internal, "查询直播数据出现错误")
+	}
+	resp := &rpc.QuerySessionsResponse{Sessions: make([]*rpc.Session, len(lives))}
+	for i := range lives {
+		resp.Sessions[i] = lives[i].toProto()
+	}
+	return resp, nil
+}
+
+func (archiveServer) GetPlayback(_ context.Context, req *rpc.GetPlaybackRequest) (*rpc.Playback, error) {
+	if req.GetLiveId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "需要liveID")
+	}
+	liveID, err := store.ParseLiveID(req.GetLiveId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	playback, err := getPlayback(liveID)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &rpc.Playback{Url: playback.URL, BackupUrl: playback.BackupURL, Duration: playback.Duration}, nil
+}
+
+func (archiveServer) StreamEvents(req *rpc.StreamEventsRequest, stream rpc.Archive_StreamEventsServer) error {
+	if err := checkRPCUID(req.GetUid()); err != nil {
+		return err
+	}
+	ch := subscribeEvents()
+	defer unsubscribeEvents(ch)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-ch:
+			if req.GetUid() != 0 && int64(e.Live.uid) != req.GetUid() {
+				continue
+			}
+			if err := stream.Send(&rpc.Event{Type: eventTypes[e.Type], Session: e.Live.toProto()}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// 检查请求里的uid，为0时不限制主播
+func checkRPCUID(uid int64) error {
+	if uid == 0 || (uid <= math.MaxInt32 && store.UID(uid).Valid()) {
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "uid %d 不是有效的uid", uid)
+}
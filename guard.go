@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	guardRecheckInterval = time.Hour // 超长直播重新确认直播状态的间隔
+	endVerifyWorkers     = 8         // 同时确认是否下播的直播数量
+)
+
+// 检查直播时长是否异常的长，防止直播间列表接口出错导致直播一直不结束
+type durationGuard struct {
+	checked    map[store.LiveID]time.Time                             // 上次确认直播状态的时间，key为liveID
+	forceEnded map[store.LiveID]bool                                  // 确认已经下播但还在直播间列表里的liveID
+	online     func(uid store.UID, liveID store.LiveID) (bool, error) // 确认直播是否还在进行
+}
+
+func newDurationGuard() *durationGuard {
+	return &durationGuard{
+		checked:    make(map[store.LiveID]time.Time),
+		forceEnded: make(map[store.LiveID]bool),
+		online:     isLiveOnline,
+	}
+}
+
+// 直播时长的上限
+func maxLiveDuration() time.Duration {
+	return time.Duration(conf.MaxLiveHours) * time.Hour
+}
+
+// 从newList里去掉已经确认下播的直播，包括超长直播和直播间弹幕收到下播信号后确认下播的直播
+func (g *durationGuard) filter(newList map[store.LiveID]live) {
+	for liveID := range g.forceEnded {
+		if _, ok := newList[liveID]; !ok {
+			// 直播间列表已经恢复正常
+			delete(g.forceEnded, liveID)
+		}
+	}
+	for liveID := range g.checked {
+		if _, ok := newList[liveID]; !ok {
+			delete(g.checked, liveID)
+		}
+	}
+
+	limit := maxLiveDuration()
+	now := time.Now()
+	for liveID, l := range newList {
+		if g.forceEnded[liveID] {
+			delete(newList, liveID)
+			continue
+		}
+		if danmakuStopped(liveID) {
+			// 直播间列表更新比弹幕的下播信号慢，不等直播从列表里消失。
+			// 弹幕连接被关闭时也会正常结束，需要确认直播状态
+			online, err := g.online(l.uid, liveID)
+			if err == nil && !online {
+				log.Printf("uid为 %d 的主播 %s 的liveID为 %s 的直播间弹幕收到下播信号，结束该直播", l.uid, l.name, liveID)
+				g.forceEnded[liveID] = true
+				delete(g.checked, liveID)
+				delete(newList, liveID)
+				continue
+			}
+			if err != nil {
+				log.Printf("直播间弹幕结束后确认liveID为 %s 的直播状态失败，等待直播间列表更新：%v", liveID, err)
+			} else {
+				log.Printf("uid为 %d 的主播 %s 的liveID为 %s 的直播间弹幕结束但直播仍在进行，重新连接直播间弹幕", l.uid, l.name, liveID)
+			}
+			// 没有确认下播时不使用弹幕结束的时间计算直播时长
+			clearDanmakuStop(liveID, online)
+		}
+		if limit <= 0 || now.Sub(time.UnixMilli(l.startTime)) < limit {
+			continue
+		}
+		if t, ok := g.checked[liveID]; ok && now.Sub(t) < guardRecheckInterval {
+			continue
+		}
+		g.checked[liveID] = now
+		log.Printf("uid为 %d 的主播 %s 的liveID为 %s 的直播已经持续超过 %d 小时，正在确认直播状态", l.uid, l.name, liveID, conf.MaxLiveHours)
+		online, err := g.online(l.uid, liveID)
+		if err != nil {
+			log.Printf("确认liveID为 %s 的直播状态失败：%v", liveID, err)
+			continue
+		}
+		if !online {
+			log.Printf("liveID为 %s 的直播实际上已经结束，强制结束该直播", liveID)
+			g.forceEnded[liveID] = true
+			delete(g.checked, liveID)
+			delete(newList, liveID)
+		}
+	}
+}
+
+// 通过主播的直播信息确认指定直播是否还在进行，出错时重试
+func isLiveOnline(uid store.UID, liveID store.LiveID) (online bool, e error) {
+	err := liveInfoBreaker.run(func() error {
+		var err error
+		online, err = fetchLiveOnline(uid, liveID)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("获取uid为 %d 的主播的直播信息失败：%w", uid, err)
+	}
+	return online, nil
+}
+
+// 通过主播的直播信息确认指定直播是否还在进行，只请求一次
+func checkLiveOnline(uid store.UID, liveID store.LiveID) (online bool, e error) {
+	err := liveInfoBreaker.once(func() error {
+		var err error
+		online, err = fetchLiveOnline(uid, liveID)
+		return err
+	})
+	return online, err
+}
+
+// 获取主播的直播信息，判断指定直播是否还在进行
+func fetchLiveOnline(uid store.UID, liveID store.LiveID) (bool, error) {
+	info, err := ac.GetUserLiveInfo(int64(uid))
+	if err != nil {
+		return false, err
+	}
+	return store.LiveID(info.LiveID) == liveID, nil
+}
+
+// 确认不在直播间列表里的直播是否真的下播，还在进行的直播放回newList。
+// 直播间列表接口负载高时返回的列表可能不完整，确认失败时和以前一样当作下播
+func (g *durationGuard) verifyEnded(oldList, newList map[store.LiveID]live) {
+	var missing []live
+	for liveID, l := range oldList {
+		if _, ok := newList[liveID]; !ok && !g.forceEnded[liveID] {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, endVerifyWorkers)
+	var kept []store.LiveID
+	for _, l := range missing {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(l live) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer recoverCrash("verifyEnded")
+			online, err := checkLiveOnline(l.uid, l.liveID)
+			if err != nil {
+				log.Printf("确认uid为 %d 的主播的liveID为 %s 的直播是否下播失败，当作已经下播：%v", l.uid, l.liveID, err)
+				return
+			}
+			if online {
+				mu.Lock()
+				defer mu.Unlock()
+				newList[l.liveID] = l
+				kept = append(kept, l.liveID)
+			}
+		}(l)
+	}
+	wg.Wait()
+	if len(kept) != 0 {
+		log.Printf("直播间列表里没有 %d 场直播，其中 %d 场确认仍在进行，直播间列表可能不完整：%v", len(missing), len(kept), kept)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+func TestGuardDanmakuStop(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		online    bool
+		err       error
+		ended     bool  // 是否结束直播
+		stop      int64 // 下播时用来计算直播时长的时间
+		reconnect bool  // 是否马上重连直播间弹幕
+	}{
+		{"确认下播", false, nil, true, 1000, false},
+		{"仍在直播", true, nil, false, 0, true},
+		{"确认失败", false, errors.New("接口出错"), false, 0, false},
+	} {
+		room := addTestRoom(t, "a", nil)
+		room.retryAt = time.Now().Add(time.Hour)
+		recordDanmakuStop("a", 1000)
+
+		calls := 0
+		g := newDurationGuard()
+		g.online = func(uid store.UID, liveID store.LiveID) (bool, error) {
+			calls++
+			return tt.online, tt.err
+		}
+		l := live{liveID: "a", uid: 1, startTime: time.Now().UnixMilli()}
+		newList := map[store.LiveID]live{"a": l}
+		g.filter(newList)
+		if _, ok := newList["a"]; ok == tt.ended || g.forceEnded["a"] != tt.ended {
+			t.Errorf("%s：直播是否还在列表里为 %v，是否强制结束为 %v", tt.name, ok, g.forceEnded["a"])
+		}
+		if got := len(reconnectingRooms(map[store.LiveID]live{"a": l}, time.Now())) != 0; got != tt.reconnect {
+			t.Errorf("%s：是否马上重连为 %v，应该为 %v", tt.name, got, tt.reconnect)
+		}
+
+		// 没有新的下播信号时不再确认
+		newList = map[store.LiveID]live{"a": l}
+		g.filter(newList)
+		if calls != 1 {
+			t.Errorf("%s：确认了 %d 次直播状态，应该确认1次", tt.name, calls)
+		}
+		if stop := stopRoomWatcher(context.Background(), "a"); stop != tt.stop {
+			t.Errorf("%s：下播时弹幕结束的时间为 %d，应该为 %d", tt.name, stop, tt.stop)
+		}
+	}
+}
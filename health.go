@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const healthPingTimeout = 5 * time.Second // 检查数据库的超时时间
+
+// 获取直播间列表的循环的状态
+var monitorHealth = struct {
+	sync.Mutex
+	started     time.Time     // 本程序的启动时间
+	lastAttempt time.Time     // 最近一次尝试获取直播间列表的时间
+	lastSuccess time.Time     // 最近一次成功获取直播间列表的时间
+	interval    time.Duration // 当前获取直播间列表的间隔
+}{started: time.Now()}
+
+// 记录开始获取直播间列表
+func markFetchAttempt(interval time.Duration) {
+	monitorHealth.Lock()
+	monitorHealth.lastAttempt = time.Now()
+	monitorHealth.interval = interval
+	monitorHealth.Unlock()
+}
+
+// 记录成功获取直播间列表
+func markFetchSuccess() {
+	monitorHealth.Lock()
+	monitorHealth.lastSuccess = time.Now()
+	monitorHealth.Unlock()
+}
+
+// /healthz返回的健康状态
+type healthJSON struct {
+	Healthy         bool   `json:"healthy"`         // 是否健康
+	LastFetch       int64  `json:"lastFetch"`       // 最近一次成功获取直播间列表的时间，单位为毫秒，还没有成功获取时为0
+	LastFetchText   string `json:"lastFetchText"`   // lastFetch的文字形式
+	SinceLastFetch  int64  `json:"sinceLastFetch"`  // 距离最近一次成功获取直播间列表的秒数
+	Stale           bool   `json:"stale"`           // 是否超过staleSeconds没有成功获取直播间列表
+	Stalled         bool   `json:"stalled"`         // 获取直播间列表的循环是否超过staleSeconds没有运行
+	PollInterval    int64  `json:"pollInterval"`    // 当前获取直播间列表的间隔，单位为秒
+	StaleSeconds    int64  `json:"staleSeconds"`    // 判断stale和stalled的秒数
+	DB              string `json:"db"`              // 数据库的状态，正常时为ok
+	WriteQueueDepth int    `json:"writeQueueDepth"` // 写入队列里等待的写入请求数量
+	ClockDrift      *int64 `json:"clockDrift"`      // 本机时间比对时网址快的毫秒数，较慢时为负数，还没有检查时为null
+}
+
+// 判断获取直播间列表停止的时间，没有设置时为获取间隔的3倍再加上重试的时间
+func staleThreshold(interval time.Duration) time.Duration {
+	if conf.HTTP.StaleSeconds > 0 {
+		return time.Duration(conf.HTTP.StaleSeconds) * time.Second
+	}
+	return 3*interval + time.Minute
+}
+
+// 检查获取直播间列表的循环和数据库，不健康时返回503
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	now := time.Now()
+	monitorHealth.Lock()
+	started, attempt, success, interval := monitorHealth.started, monitorHealth.lastAttempt, monitorHealth.lastSuccess, monitorHealth.interval
+	monitorHealth.Unlock()
+	if interval == 0 {
+		interval = pollInterval
+	}
+	threshold := staleThreshold(interval)
+
+	h := &healthJSON{
+		PollInterval:    int64(interval / time.Second),
+		StaleSeconds:    int64(threshold / time.Second),
+		DB:              "ok",
+		WriteQueueDepth: len(writeQueue.ch),
+	}
+	// 启动后还没有获取直播间列表时从启动时间开始计算
+	if success.IsZero() {
+		h.Stale = now.Sub(started) > threshold
+	} else {
+		h.LastFetch = success.UnixMilli()
+		h.LastFetchText = success.Format(timeLayout)
+		h.SinceLastFetch = int64(now.Sub(success) / time.Second)
+		h.Stale = now.Sub(success) > threshold
+	}
+	if attempt.IsZero() {
+		attempt = started
+	}
+	h.Stalled = now.Sub(attempt) > threshold
+	if drift, ok := clockDrift(); ok {
+		h.ClockDrift = &drift
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		h.DB = err.Error()
+	}
+
+	h.Healthy = !h.Stale && !h.Stalled && h.DB == "ok"
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
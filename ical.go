@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"acfunlivedb/store"
+)
+
+const (
+	icalTimeLayout = "20060102T150405Z" // iCalendar的UTC时间格式
+	icalLineLimit  = 75                 // iCalendar每行最多的字节数，超过时折行
+)
+
+// 转义iCalendar的文字
+var icalEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// 写iCalendar的一行，超过75字节时折行，不会截断UTF-8字符
+func writeICALLine(w *bufio.Writer, line string) {
+	limit := icalLineLimit
+	for len(line) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		w.WriteString(line[:n])
+		w.WriteString("\r\n ")
+		line = line[n:]
+		// 续行开头的空格也算在长度里
+		limit = icalLineLimit - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// 把主播的直播写成iCalendar日历，每场直播为一个事件
+func writeICAL(out io.Writer, uid store.UID, streamer string, lives []live) error {
+	w := bufio.NewWriter(out)
+	now := time.Now().UTC().Format(icalTimeLayout)
+	writeICALLine(w, "BEGIN:VCALENDAR")
+	writeICALLine(w, "VERSION:2.0")
+	writeICALLine(w, "PRODID:-//acfunlivedb//acfunlivedb//ZH")
+	writeICALLine(w, "CALSCALE:GREGORIAN")
+	writeICALLine(w, "X-WR-CALNAME:"+icalEscaper.Replace(streamer+" 的直播记录"))
+	for _, l := range lives {
+		title := l.title
+		if title == "" {
+			title = l.suggestedTitle
+		}
+		if title == "" {
+			title = "没有标题的直播"
+		}
+		url := l.playbackURL
+		if url == "" {
+			url = liveRoomURL(uid)
+		}
+		name := l.name
+		if name == "" {
+			name = streamer
+		}
+		desc := fmt.Sprintf("主播：%s（%d）\nliveID：%s", name, l.uid, l.liveID)
+		if l.playbackURL != "" {
+			desc += "\n录播：" + l.playbackURL
+		}
+		if l.backupURL != "" {
+			desc += "\n备份：" + l.backupURL
+		}
+		start := time.UnixMilli(l.startTime).UTC()
+
+		writeICALLine(w, "BEGIN:VEVENT")
+		writeICALLine(w, "UID:"+l.liveID.String()+"@acfunlivedb")
+		writeICALLine(w, "DTSTAMP:"+now)
+		writeICALLine(w, "DTSTART:"+start.Format(icalTimeLayout))
+		// 还没有直播时长的直播只有开始时间
+		if l.duration > 0 {
+			writeICALLine(w, "DTEND:"+start.Add(time.Duration(l.duration)*time.Millisecond).Format(icalTimeLayout))
+		}
+		writeICALLine(w, "SUMMARY:"+icalEscaper.Replace(title))
+		writeICALLine(w, "DESCRIPTION:"+icalEscaper.Replace(desc))
+		writeICALLine(w, "URL:"+url)
+		writeICALLine(w, "END:VEVENT")
+	}
+	writeICALLine(w, "END:VCALENDAR")
+	return w.Flush()
+}
+
+// 查询主播的所有直播和昵称
+func queryCalendar(ctx context.Context, uid store.UID) (string, []live, error) {
+	lives, err := fromStoreList(db.QueryLives(ctx, store.LiveQuery{UID: uid}))
+	if err != nil {
+		return "", nil, err
+	}
+	streamer := latestStreamerName(ctx, uid)
+	if streamer == "" {
+		streamer = fmt.Sprintf("uid %d", uid)
+	}
+	return streamer, lives, nil
+}
+
+// GET /calendar/{uid}.ics 返回主播所有直播的iCalendar日历
+func handleCalendar(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+	uid, err := store.ParseUID(name)
+	if !ok || err != nil {
+		writeError(w, http.StatusNotFound, errors.New("请求的路径不存在"))
+		return
+	}
+	streamer, lives, err := queryCalendar(r.Context(), uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的日历出现错误：%v", uid, err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询直播数据出现错误"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%d.ics"`, uid))
+	if err = writeICAL(w, uid, streamer, lives); err != nil {
+		log.Printf("返回日历出现错误：%v", err)
+	}
+}
+
+// 把主播所有直播的iCalendar日历导出到文件，返回导出的直播数量
+func exportICAL(ctx context.Context, uid store.UID, file string) (n int, e error) {
+	streamer, lives, err := queryCalendar(ctx, uid)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && e == nil {
+			e = err
+		}
+	}()
+	return len(lives), writeICAL(f, uid, streamer, lives)
+}
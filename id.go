@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+
+	"acfunlivedb/store"
+)
+
+// 解析命令参数里的uid，打印无效的uid后跳过
+func parseUIDArgs(args []string) []store.UID {
+	uids := make([]store.UID, 0, len(args))
+	for _, s := range args {
+		uid, err := store.ParseUID(s)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// 解析命令参数里的liveID，打印无效的liveID后跳过
+func parseLiveIDArgs(args []string) []store.LiveID {
+	liveIDs := make([]store.LiveID, 0, len(args))
+	for _, s := range args {
+		liveID, err := store.ParseLiveID(s)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		liveIDs = append(liveIDs, liveID)
+	}
+	return liveIDs
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const defaultIdlePollSeconds = 300 // 空闲模式下默认获取直播间列表的间隔，单位为秒
+
+// 空闲模式的状态，关注的主播长时间没有直播时延长获取直播间列表的间隔并释放资源
+type idleState struct {
+	lastWatched time.Time // 最后一次看到关注的主播在直播的时间
+	idle        bool      // 是否处于空闲模式
+}
+
+func newIdleState() *idleState {
+	return &idleState{lastWatched: time.Now()}
+}
+
+// 是否在list里看到关注的主播在直播，没有设置关注的主播时任何直播都算，关注的主播可以在运行时修改
+func (s *idleState) watchedLive(list map[store.LiveID]live) bool {
+	uids := watchedUIDs()
+	if len(uids) == 0 {
+		return len(list) != 0
+	}
+	watched := make(map[store.UID]bool, len(uids))
+	for _, uid := range uids {
+		watched[uid] = true
+	}
+	for _, l := range list {
+		if watched[l.uid] {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据获取到的直播间列表更新空闲模式的状态
+func (s *idleState) update(list map[store.LiveID]live) {
+	if conf.IdleHours <= 0 {
+		return
+	}
+	now := time.Now()
+	if s.watchedLive(list) {
+		s.lastWatched = now
+		if s.idle {
+			s.idle = false
+			log.Println("关注的主播开始直播，退出空闲模式")
+		}
+		return
+	}
+	if !s.idle && now.Sub(s.lastWatched) >= time.Duration(conf.IdleHours)*time.Hour {
+		s.idle = true
+		log.Printf("关注的主播已经 %d 小时没有直播，进入空闲模式，每 %s 获取一次直播间列表", conf.IdleHours, s.interval())
+		releaseIdleResources()
+	}
+}
+
+// 下次获取直播间列表的间隔
+func (s *idleState) interval() time.Duration {
+	if !s.idle {
+		return pollInterval
+	}
+	if conf.IdlePollSeconds > 0 {
+		return time.Duration(conf.IdlePollSeconds) * time.Second
+	}
+	return defaultIdlePollSeconds * time.Second
+}
+
+// 关闭空闲的HTTP连接并把内存还给系统
+func releaseIdleResources() {
+	client.CloseIdleConnections()
+	// fastjson的解析器池基于sync.Pool，两次GC后池里的解析器会被释放
+	runtime.GC()
+	debug.FreeOSMemory()
+}
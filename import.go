@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"acfunlivedb/store"
+	_ "modernc.org/sqlite"
+)
+
+// 从其他AcFun直播记录工具的数据库（如orzogc/acfunlive的live.db）或CSV文件导入直播数据，liveID已存在时跳过。
+// 支持的列为liveID、uid、name、streamName、startTime、title、duration、playbackURL、backupURL、liveCutNum和access，列名不区分大小写，
+// 必须有liveID、uid和startTime
+func importLives(ctx context.Context, file string) (imported, skipped int, e error) {
+	var records []map[string]string
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		records, err = readImportCSV(file)
+	default:
+		records, err = readImportDB(ctx, file)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lives := make([]store.Live, 0, len(records))
+	for i, r := range records {
+		l, err := recordToLive(r)
+		if err != nil {
+			return 0, 0, fmt.Errorf("第 %d 条数据有错误：%w", i+1, err)
+		}
+		lives = append(lives, *l.toStore())
+	}
+	return db.ImportLives(ctx, lives)
+}
+
+// 转换导入的数据
+func recordToLive(r map[string]string) (*live, error) {
+	l := new(live)
+	if r["liveid"] == "" {
+		return nil, fmt.Errorf("缺少liveID")
+	}
+	liveID, err := store.ParseLiveID(r["liveid"])
+	if err != nil {
+		return nil, err
+	}
+	uid, err := store.ParseUID(r["uid"])
+	if err != nil {
+		return nil, err
+	}
+	l.liveID, l.uid = liveID, uid
+	if l.startTime, err = strconv.ParseInt(r["starttime"], 10, 64); err != nil {
+		return nil, fmt.Errorf("startTime无效：%w", err)
+	}
+	l.name = r["name"]
+	l.streamName = r["streamname"]
+	if l.streamName == "" {
+		// streamName不能重复
+		l.streamName = l.liveID.String()
+	}
+	l.title = r["title"]
+	if s := r["duration"]; s != "" {
+		if l.duration, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("duration无效：%w", err)
+		}
+	}
+	l.playbackURL = r["playbackurl"]
+	l.backupURL = r["backupurl"]
+	l.access = r["access"]
+	if s := r["livecutnum"]; s != "" {
+		if l.liveCutNum, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("liveCutNum无效：%w", err)
+		}
+	}
+	return l, nil
+}
+
+// 读取CSV文件，第一行为列名，不是有效的UTF-8时当作GBK编码
+func readImportCSV(file string) ([]map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(data) {
+		if data, err = simplifiedchinese.GBK.NewDecoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("CSV文件 %s 不是UTF-8或GBK编码：%w", file, err)
+		}
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV文件 %s 的列名失败：%w", file, err)
+	}
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	}
+	var records []map[string]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取CSV文件 %s 失败：%w", file, err)
+		}
+		record := make(map[string]string, len(header))
+		for i, v := range row {
+			if i < len(header) {
+				record[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// 以只读方式读取其他sqlite数据库里含有liveID列的表，优先使用acfunlive表
+func readImportDB(ctx context.Context, file string) ([]map[string]string, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	src, err := sql.Open("sqlite", "file:"+filepath.ToSlash(file)+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	table, err := findImportTable(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := src.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM "%s";`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		record := make(map[string]string, len(cols))
+		for i, c := range cols {
+			record[strings.ToLower(c)] = values[i].String
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// 查找含有liveID、uid和startTime列的表
+func findImportTable(ctx context.Context, src *sql.DB) (string, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name = 'acfunlive' DESC, name;`)
+	if err != nil {
+		return "", err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return "", err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		cols := make(map[string]bool)
+		colRows, err := src.QueryContext(ctx, `SELECT name FROM pragma_table_info(?);`, table)
+		if err != nil {
+			return "", err
+		}
+		for colRows.Next() {
+			var name string
+			if err = colRows.Scan(&name); err == nil {
+				cols[strings.ToLower(name)] = true
+			}
+		}
+		colRows.Close()
+		if cols["liveid"] && cols["uid"] && cols["starttime"] {
+			return table, nil
+		}
+	}
+	return "", fmt.Errorf("数据库里没有含有liveID、uid和startTime列的表")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const invalidateInterval = 10 * time.Second // 合并发送变动的liveID的间隔
+
+// 数据有变动的liveID
+var changedLives = struct {
+	sync.Mutex
+	m map[store.LiveID]struct{}
+}{m: make(map[store.LiveID]struct{})}
+
+// 记录需要通知webhook的liveID
+func addInvalidation(liveID store.LiveID) {
+	if len(conf.InvalidateWebhooks) == 0 {
+		return
+	}
+	changedLives.Lock()
+	changedLives.m[liveID] = struct{}{}
+	changedLives.Unlock()
+}
+
+// 定期将数据有变动的liveID发送到设置的webhook，方便下游的静态网站或缓存增量更新
+func invalidateCycle(ctx context.Context) {
+	if len(conf.InvalidateWebhooks) == 0 {
+		return
+	}
+	for sleepCtx(ctx, invalidateInterval) {
+		sendInvalidation()
+	}
+	// 退出前发送剩下的
+	sendInvalidation()
+}
+
+// 发送数据有变动的liveID
+func sendInvalidation() {
+	changedLives.Lock()
+	if len(changedLives.m) == 0 {
+		changedLives.Unlock()
+		return
+	}
+	liveIDs := make([]store.LiveID, 0, len(changedLives.m))
+	for liveID := range changedLives.m {
+		liveIDs = append(liveIDs, liveID)
+	}
+	changedLives.m = make(map[store.LiveID]struct{})
+	changedLives.Unlock()
+	sort.Slice(liveIDs, func(i, j int) bool { return liveIDs[i] < liveIDs[j] })
+
+	body, err := json.Marshal(struct {
+		LiveIDs []store.LiveID `json:"liveIDs"`
+	}{liveIDs})
+	checkErr(err)
+	failed := false
+	for _, url := range conf.InvalidateWebhooks {
+		err := runThrice(func() error {
+			return postJSON(url, body)
+		})
+		if err != nil {
+			failed = true
+			log.Printf("发送数据变动通知到 %s 失败：%v", redactURL(url), err)
+		}
+	}
+	if failed {
+		// 放回去下次再发送，发送成功的webhook也会再收到这些liveID，重复的通知不影响增量更新
+		changedLives.Lock()
+		for _, liveID := range liveIDs {
+			changedLives.m[liveID] = struct{}{}
+		}
+		changedLives.Unlock()
+	}
+}
+
+// 以POST方式发送JSON数据
+func postJSON(url string, body []byte) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	req.SetBody(body)
+	if err := client.Do(req, resp); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d", redactURL(url), code)
+	}
+	return nil
+}
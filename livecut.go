@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	defaultLiveCutCheckDays = 7               // 默认重新确认直播剪辑的间隔，单位为天
+	defaultLiveCutDir       = "livecuts"      // 默认保存直播剪辑的文件夹
+	liveCutCheckInterval    = time.Hour       // 检查是否有需要确认的直播剪辑的间隔
+	liveCutCheckBatch       = 100             // 每次最多确认的直播剪辑数量
+	liveCutCheckDelay       = 2 * time.Second // 确认两个直播剪辑之间的间隔，避免频繁请求接口
+	liveCutDownloadTimeout  = 2 * time.Hour   // 下载一个直播剪辑的超时时间
+	liveCutStderrLimit      = 500             // 下载命令出错时打印的错误输出的最大字节数
+)
+
+// 定期确认直播剪辑是否还存在和下载直播剪辑的设置
+type liveCutConfig struct {
+	CheckDays       int    `json:"checkDays"`       // 每隔这个天数重新确认一次关注的主播的直播剪辑是否还存在，小于等于0时不确认
+	DownloadCommand string `json:"downloadCommand"` // 下载直播剪辑的命令，{url}和{file}会被替换为直播剪辑链接和保存的文件路径，为空时不下载
+	DownloadDir     string `json:"downloadDir"`     // 保存直播剪辑的文件夹，相对路径以本程序所在文件夹为准
+}
+
+// 定期确认关注的主播的直播剪辑是否还存在，还存在且没有下载过时下载
+func liveCutCycle(ctx context.Context) {
+	if conf.LiveCut.CheckDays <= 0 || conf.Mirror.Source != "" {
+		return
+	}
+	for {
+		checkLiveCuts(ctx)
+		if !sleepCtx(ctx, liveCutCheckInterval) {
+			return
+		}
+	}
+}
+
+// 确认一批很久没有确认过的直播剪辑
+func checkLiveCuts(ctx context.Context) {
+	before := time.Now().AddDate(0, 0, -conf.LiveCut.CheckDays).UnixMilli()
+	list, err := db.QueryLiveCutChecks(ctx, watchedUIDs(), before, liveCutCheckBatch)
+	if err != nil {
+		log.Printf("查询需要确认的直播剪辑出现错误：%v", err)
+		return
+	}
+	for _, c := range list {
+		if !sleepCtx(ctx, liveCutCheckDelay) {
+			return
+		}
+		checkLiveCut(ctx, c)
+	}
+}
+
+// 确认直播剪辑是否还存在，直播剪辑编号改变时当作原来的直播剪辑已经被删除
+func checkLiveCut(ctx context.Context, c store.LiveCutStatus) {
+	var num int
+	var cutURL string
+	err := liveCutBreaker.run(func() error {
+		var err error
+		num, cutURL, err = fetchLiveCut(c.UID, c.LiveID)
+		return err
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	removed := num != c.LiveCutNum
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的直播剪辑的确认结果", c.LiveID), nil,
+		store.LiveCutStatusWrite(c.LiveID, c.LiveCutNum, time.Now().UnixMilli(), removed))
+	if removed {
+		log.Printf("uid为 %d 的主播的liveID为 %s 的直播剪辑 %d 已经被删除", c.UID, c.LiveID, c.LiveCutNum)
+		if num != 0 {
+			// 记录重新生成的直播剪辑编号
+			updateLiveCut(ctx, c.LiveID, num)
+		}
+		return
+	}
+	if c.DownloadFile != "" || conf.LiveCut.DownloadCommand == "" {
+		return
+	}
+	file, err := downloadLiveCut(ctx, c, cutURL)
+	if err != nil {
+		log.Printf("下载liveID为 %s 的直播剪辑失败：%v", c.LiveID, err)
+		return
+	}
+	log.Printf("已下载uid为 %d 的主播的liveID为 %s 的直播剪辑到 %s", c.UID, c.LiveID, file)
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的直播剪辑文件", c.LiveID), nil, store.LiveCutDownloadWrite(c.LiveID, c.LiveCutNum, file))
+	accountFile(c.LiveID, store.StorageLiveCut, file)
+}
+
+// 用设置的命令下载直播剪辑，保存为downloadDir/主播的uid/liveID.mp4，返回保存的文件路径
+func downloadLiveCut(ctx context.Context, c store.LiveCutStatus, cutURL string) (string, error) {
+	dir := filepath.Join(absPath(conf.LiveCut.DownloadDir), c.UID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, c.LiveID.String()+".mp4")
+	r := strings.NewReplacer("{url}", cutURL, "{file}", file)
+	args := strings.Fields(conf.LiveCut.DownloadCommand)
+	for i := range args {
+		args[i] = r.Replace(args[i])
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, liveCutDownloadTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > liveCutStderrLimit {
+			msg = strings.ToValidUTF8(msg[len(msg)-liveCutStderrLimit:], "")
+		}
+		if msg == "" {
+			return "", fmt.Errorf("运行下载命令出现错误：%w", err)
+		}
+		return "", fmt.Errorf("运行下载命令出现错误：%w，%s", err, msg)
+	}
+	if _, err := os.Stat(file); err != nil {
+		return "", fmt.Errorf("下载命令没有生成文件 %s", file)
+	}
+	return file, nil
+}
+
+// 打印已经被删除的直播剪辑
+func printRemovedLiveCuts(ctx context.Context) {
+	list, err := db.QueryRemovedLiveCuts(ctx)
+	if err != nil {
+		log.Printf("查询被删除的直播剪辑出现错误：%v", err)
+		return
+	}
+	if len(list) == 0 {
+		log.Println("没有发现被删除的直播剪辑")
+		return
+	}
+	for _, c := range list {
+		file := c.DownloadFile
+		if file == "" {
+			file = "没有下载"
+		}
+		fmt.Printf("liveID：%s 主播uid：%d 直播剪辑编号：%d 发现删除的时间：%s 下载的文件：%s\n",
+			c.LiveID, c.UID, c.LiveCutNum, time.UnixMilli(c.RemovedAt).Format(timeLayout), file)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const (
+	liveHookSignatureHeader = "X-Signature-256" // 开播下播webhook的签名头，值为"sha256=签名的十六进制"
+	discordStartColor       = 0x2ecc71          // Discord开播通知的颜色
+	discordEndColor         = 0x95a5a6          // Discord下播通知的颜色
+)
+
+// 开播下播webhook的请求体格式
+const (
+	liveHookJSONFormat    = "json"    // liveHookJSON
+	liveHookDiscordFormat = "discord" // Discord的incoming webhook
+	liveHookSlackFormat   = "slack"   // Slack的incoming webhook
+)
+
+// 开播和下播时通知的webhook的设置
+type liveHookConfig struct {
+	URLs    []string         `json:"urls" secret:"true"`   // 开播和下播时通知的webhook链接，发送liveHookJSON
+	Targets []liveHookTarget `json:"targets"`              // 开播和下播时通知的webhook，可以指定格式
+	Secret  string           `json:"secret" secret:"true"` // 用HMAC-SHA256签名json格式的请求体的密钥，为空时不签名
+}
+
+// 开播和下播时通知的webhook
+type liveHookTarget struct {
+	Name   string      `json:"name"`              // 名字，用于notifyRoutes，为空时只能用liveHook匹配
+	URL    string      `json:"url" secret:"true"` // webhook链接
+	Format string      `json:"format"`            // 请求体的格式，可以是json、discord或slack，为空时为json
+	Limit  notifyLimit `json:"limit"`             // 安静时段和频率限制
+}
+
+// 所有开播和下播时通知的webhook
+func (c *liveHookConfig) targets() []liveHookTarget {
+	targets := make([]liveHookTarget, 0, len(c.URLs)+len(c.Targets))
+	for _, url := range c.URLs {
+		targets = append(targets, liveHookTarget{URL: url, Format: liveHookJSONFormat})
+	}
+	return append(targets, c.Targets...)
+}
+
+// 开播和下播时发送到webhook的数据
+type liveHookJSON struct {
+	Event       changeKind   `json:"event"`                 // start、reconnect、end或playback
+	LiveID      store.LiveID `json:"liveID"`                // 直播ID
+	UID         store.UID    `json:"uid"`                   // 主播uid
+	Name        string       `json:"name"`                  // 主播昵称
+	Title       string       `json:"title"`                 // 直播间标题
+	StartTime   int64        `json:"startTime"`             // 直播开始时间，单位为毫秒
+	Duration    int64        `json:"duration,omitempty"`    // 直播时长，单位为毫秒，只在下播和录播生成时有
+	PlaybackURL string       `json:"playbackURL,omitempty"` // 录播链接，只在下播和录播生成时有，下播时录播还没生成时为空
+	BackupURL   string       `json:"backupURL,omitempty"`   // 录播备份链接，只在下播和录播生成时有
+
+	PreviousLiveID store.LiveID `json:"previousLiveID,omitempty"` // 重连时下播的直播ID，只在重连时有
+}
+
+// 发送开播通知到设置里的webhook和关注了主播的用户的webhook
+func hookLiveStart(l *live) {
+	tenants := watchingTenants(l.uid)
+	if len(conf.LiveHook.targets()) == 0 && len(tenants) == 0 {
+		return
+	}
+	hook := &liveHookJSON{
+		Event:     changeStart,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+	}
+	sendLiveHook(hook)
+	sendTenantHooks(tenants, hook)
+}
+
+// 发送重连通知到设置里的webhook和关注了主播的用户的webhook，代替下播和开播通知
+func hookLiveReconnect(prev store.LiveID, l *live) {
+	tenants := watchingTenants(l.uid)
+	if len(conf.LiveHook.targets()) == 0 && len(tenants) == 0 {
+		return
+	}
+	hook := &liveHookJSON{
+		Event:          changeReconnect,
+		LiveID:         l.liveID,
+		UID:            l.uid,
+		Name:           l.name,
+		Title:          l.title,
+		StartTime:      l.startTime,
+		PreviousLiveID: prev,
+	}
+	sendLiveHook(hook)
+	sendTenantHooks(tenants, hook)
+}
+
+// 发送下播通知到设置里的webhook和关注了主播的用户的webhook，会尝试获取一次录播链接
+func hookLiveEnd(l *live, duration int64) {
+	tenants := watchingTenants(l.uid)
+	if len(conf.LiveHook.targets()) == 0 && len(tenants) == 0 {
+		return
+	}
+	body := &liveHookJSON{
+		Event:     changeEnd,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+		Duration:  duration,
+	}
+	playback, err := tryPlayback(l.liveID)
+	if err != nil {
+		log.Println(err)
+	} else {
+		body.PlaybackURL = playback.URL
+		body.BackupURL = playback.BackupURL
+	}
+	sendLiveHook(body)
+	sendTenantHooks(tenants, body)
+}
+
+// 把通知保存到通知队列，由notifyCycle按每个webhook的格式发送，失败时重试
+func sendLiveHook(hook *liveHookJSON) {
+	for _, t := range conf.LiveHook.targets() {
+		if !liveHookRouted(&t, hook.UID, hook.Title) || !t.Limit.allow(t.label(), hook.UID, liveHookName(hook.Event)+"通知") {
+			continue
+		}
+		queueNotification("liveHook", hook.UID, hook.LiveID, &liveHookPayload{Target: t.key(), Hook: *hook})
+	}
+}
+
+// webhook在通知队列里的标识，有名字时为名字，否则为链接
+func (t *liveHookTarget) key() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.URL
+}
+
+// 打印日志时webhook的名字，没有名字时为隐藏了路径的链接，链接里的token不会出现在日志里
+func (t *liveHookTarget) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return redactURL(t.URL)
+}
+
+// 保存到通知队列的webhook通知，发送时按webhook当前的设置生成请求体
+type liveHookPayload struct {
+	Target string       `json:"target"` // webhook的名字，没有名字时为链接
+	Hook   liveHookJSON `json:"hook"`
+}
+
+// 发送通知队列里的webhook通知，webhook已经从设置里删除时不再发送
+func sendLiveHookPayload(payload []byte) error {
+	var p liveHookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	for _, t := range conf.LiveHook.targets() {
+		if t.key() != p.Target {
+			continue
+		}
+		body, err := formatLiveHook(t.Format, &p.Hook)
+		if err != nil {
+			return err
+		}
+		var signature string
+		if conf.LiveHook.Secret != "" && (t.Format == "" || t.Format == liveHookJSONFormat) {
+			signature = signLiveHook(conf.LiveHook.Secret, body)
+		}
+		return postLiveHook(client, t.URL, body, p.Hook.Event, signature)
+	}
+	return errNotifyDisabled
+}
+
+// 按格式生成请求体
+func formatLiveHook(format string, hook *liveHookJSON) ([]byte, error) {
+	switch format {
+	case "", liveHookJSONFormat:
+		return json.Marshal(hook)
+	case liveHookDiscordFormat:
+		return json.Marshal(discordLiveHook(hook))
+	case liveHookSlackFormat:
+		return json.Marshal(slackLiveHook(hook))
+	default:
+		return nil, fmt.Errorf("不支持的格式 %s，可以是 %s、%s 或 %s", format, liveHookJSONFormat, liveHookDiscordFormat, liveHookSlackFormat)
+	}
+}
+
+// 通知的标题
+func liveHookTitle(hook *liveHookJSON) string {
+	l := &live{liveID: hook.LiveID, uid: hook.UID, name: hook.Name, title: hook.Title, startTime: hook.StartTime}
+	data := newTemplateData(string(hook.Event), l, hook.Duration)
+	data.PlaybackURL = hook.PlaybackURL
+	data.BackupURL = hook.BackupURL
+	switch hook.Event {
+	case changeStart:
+		return renderTemplate(conf.Templates.LiveHook.Start, defaultLiveHookStartTemplate, data)
+	case changeReconnect:
+		return renderTemplate(conf.Templates.LiveHook.Start, defaultLiveHookReconnectTemplate, data)
+	case changePlayback:
+		return renderTemplate(conf.Templates.LiveHook.Playback, defaultLiveHookPlaybackTemplate, data)
+	}
+	return renderTemplate(conf.Templates.LiveHook.End, defaultLiveHookEndTemplate, data)
+}
+
+// 通知里显示的字段，名字和值
+func liveHookFields(hook *liveHookJSON) [][2]string {
+	title := hook.Title
+	if strings.TrimSpace(title) == "" {
+		title = "无标题"
+	}
+	fields := [][2]string{
+		{"主播", fmt.Sprintf("%s（uid：%d）", hook.Name, hook.UID)},
+		{"标题", title},
+		{"开播时间", time.UnixMilli(hook.StartTime).Format(timeLayout)},
+	}
+	if hook.Event != changeStart && hook.Event != changeReconnect {
+		fields = append(fields, [2]string{"直播时长", (time.Duration(hook.Duration) * time.Millisecond).String()})
+	}
+	return fields
+}
+
+// Discord的incoming webhook的请求体，用embed显示
+func discordLiveHook(hook *liveHookJSON) interface{} {
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	}
+	type embed struct {
+		Title     string  `json:"title"`
+		URL       string  `json:"url"`
+		Color     int     `json:"color"`
+		Timestamp string  `json:"timestamp"`
+		Fields    []field `json:"fields"`
+	}
+	e := embed{
+		Title:     liveHookTitle(hook),
+		URL:       liveRoomURL(hook.UID),
+		Color:     discordStartColor,
+		Timestamp: time.UnixMilli(hook.StartTime).UTC().Format(time.RFC3339),
+	}
+	if hook.Event == changeEnd {
+		e.Color = discordEndColor
+	}
+	for _, f := range liveHookFields(hook) {
+		e.Fields = append(e.Fields, field{Name: f[0], Value: f[1], Inline: true})
+	}
+	if hook.PlaybackURL != "" {
+		e.Fields = append(e.Fields, field{Name: "录播", Value: fmt.Sprintf("[录播](%s)", hook.PlaybackURL)})
+	}
+	return struct {
+		Embeds []embed `json:"embeds"`
+	}{[]embed{e}}
+}
+
+// Slack的incoming webhook的请求体，用Block Kit显示
+func slackLiveHook(hook *liveHookJSON) interface{} {
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type block struct {
+		Type   string `json:"type"`
+		Text   *text  `json:"text,omitempty"`
+		Fields []text `json:"fields,omitempty"`
+	}
+	title := fmt.Sprintf("*<%s|%s>*", liveRoomURL(hook.UID), slackEscape(liveHookTitle(hook)))
+	fields := make([]text, 0, 5)
+	for _, f := range liveHookFields(hook) {
+		fields = append(fields, text{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", f[0], slackEscape(f[1]))})
+	}
+	if hook.PlaybackURL != "" {
+		fields = append(fields, text{Type: "mrkdwn", Text: fmt.Sprintf("*录播*\n<%s|录播链接>", hook.PlaybackURL)})
+	}
+	return struct {
+		Text   string  `json:"text"`
+		Blocks []block `json:"blocks"`
+	}{
+		Text: liveHookTitle(hook),
+		Blocks: []block{
+			{Type: "section", Text: &text{Type: "mrkdwn", Text: title}},
+			{Type: "section", Fields: fields},
+		},
+	}
+}
+
+// 转义Slack的mrkdwn里的特殊字符
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// 返回通知的中文名
+func liveHookName(event changeKind) string {
+	switch event {
+	case changeStart:
+		return "开播"
+	case changeReconnect:
+		return "重连"
+	case changePlayback:
+		return "录播生成"
+	}
+	return "下播"
+}
+
+// 用HMAC-SHA256签名请求体
+func signLiveHook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 以POST方式发送开播或下播通知，signature不为空时带上签名
+func postLiveHook(c *fasthttp.Client, url string, body []byte, event changeKind, signature string) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	req.Header.Set("X-Live-Event", string(event))
+	if signature != "" {
+		req.Header.Set(liveHookSignatureHeader, signature)
+	}
+	req.SetBody(body)
+	if err := c.Do(req, resp); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d", redactURL(url), code)
+	}
+	return nil
+}
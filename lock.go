@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 获取数据库文件对应的锁文件，防止多个本程序同时使用同一个数据库
+func acquireLock(dbFile string) (*os.File, error) {
+	path := dbFile + ".lock"
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开锁文件 %s 失败：%w", path, err)
+	}
+	if err = lockFile(f); err != nil {
+		pid := "未知"
+		if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) != 0 {
+			pid = strings.TrimSpace(string(data))
+		}
+		_ = f.Close()
+		return nil, fmt.Errorf("数据库 %s 正在被另一个本程序（pid：%s）使用，请不要同时运行多个本程序：%w", dbFile, pid, err)
+	}
+	// 记录pid方便排查
+	if err = f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return f, nil
+}
+
+// 释放锁文件
+func releaseLock(f *os.File) {
+	_ = unlockFile(f)
+	_ = f.Close()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dateLayout      = "2006-01-02"
+	legacyLogFile   = "log" // 旧版本使用的日志文件
+	maxLogsLines    = 200   // logs命令最多打印的行数
+	logTimePrefixes = len("2006/01/02 ")
+)
+
+// 按天保存日志的Writer，旧的日志会被压缩
+type dailyWriter struct {
+	sync.Mutex
+	dir  string
+	day  string
+	file *os.File
+}
+
+// 新建按天保存日志的Writer
+func newDailyWriter(dir string) (*dailyWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &dailyWriter{dir: dir}
+	if err := w.rotate(time.Now().Format(dateLayout)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// 日志文件路径
+func logFilePath(dir, day string) string {
+	return filepath.Join(dir, day+".log")
+}
+
+// 切换到新一天的日志文件
+func (w *dailyWriter) rotate(day string) error {
+	file, err := os.OpenFile(logFilePath(w.dir, day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+	w.file = file
+	w.day = day
+	go compressOldLogs(w.dir, day)
+	return nil
+}
+
+func (w *dailyWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if day := time.Now().Format(dateLayout); day != w.day {
+		if err := w.rotate(day); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.Write(p)
+}
+
+// 关闭日志文件
+func (w *dailyWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	return w.file.Close()
+}
+
+// 压缩today之前的日志
+func compressOldLogs(dir, today string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		day := strings.TrimSuffix(filepath.Base(file), ".log")
+		if _, err := time.Parse(dateLayout, day); err != nil || day >= today {
+			continue
+		}
+		if err := gzipFile(file); err != nil {
+			log.Printf("压缩日志文件 %s 失败：%v", file, err)
+		}
+	}
+}
+
+// 将文件压缩为.gz文件并删除原文件
+func gzipFile(file string) (e error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(file + ".gz")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dst.Close(); err != nil && e == nil {
+			e = err
+		}
+		if e != nil {
+			_ = os.Remove(file + ".gz")
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(file)
+}
+
+// 将旧版本的单个日志文件按日期拆分到日志文件夹里
+func migrateLegacyLog(legacy, dir string) error {
+	src, err := os.Open(legacy)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	day := time.Now().Format(dateLayout)
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// 日志的默认格式以"2006/01/02 "开头，没有日期的行（如多行日志）属于上一行的日期
+		if len(line) >= logTimePrefixes {
+			if t, err := time.Parse("2006/01/02", line[:logTimePrefixes-1]); err == nil {
+				day = t.Format(dateLayout)
+			}
+		}
+		f, ok := files[day]
+		if !ok {
+			f, err = os.OpenFile(logFilePath(dir, day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			files[day] = f
+		}
+		if _, err = f.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Rename(legacy, legacy+".migrated")
+}
+
+// 打印指定日期的日志里含有关键词的行，最多打印最后maxLogsLines行
+func printLogs(day, keyword string) error {
+	if _, err := time.Parse(dateLayout, day); err != nil {
+		return fmt.Errorf("日期 %s 的格式应为 %s", day, dateLayout)
+	}
+	dir := absPath(conf.LogDir)
+	if dir == "" {
+		return fmt.Errorf("没有设置日志文件夹")
+	}
+	var r io.Reader
+	file, err := os.Open(logFilePath(dir, day))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(logFilePath(dir, day) + ".gz")
+		if err != nil {
+			return fmt.Errorf("没有 %s 的日志", day)
+		}
+		defer file.Close()
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	} else if err != nil {
+		return err
+	} else {
+		defer file.Close()
+		r = file
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); keyword == "" || strings.Contains(line, keyword) {
+			lines = append(lines, line)
+			if len(lines) > maxLogsLines {
+				lines = lines[1:]
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	// 直接打印到终端，避免写回日志文件
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Printf("共 %d 行（最多显示最后 %d 行）\n", len(lines), maxLogsLines)
+	return nil
+}
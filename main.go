@@ -3,36 +3,49 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/orzogc/acfundanmu"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fastjson"
-	_ "modernc.org/sqlite"
+
+	"acfunlivedb/store"
 )
 
 const userAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36"
 
 type live struct {
-	liveID      string // 直播ID
-	uid         int    // 主播uid
-	name        string // 主播昵称
-	streamName  string // 直播源ID
-	startTime   int64  // 直播开始时间，单位为毫秒
-	title       string // 直播间标题
-	duration    int64  // 录播时长，单位为毫秒
-	playbackURL string // 录播链接
-	backupURL   string // 录播备份链接
-	liveCutNum  int    // 直播剪辑编号
+	liveID      store.LiveID // 直播ID
+	uid         store.UID    // 主播uid
+	name        string       // 主播昵称
+	streamName  string       // 直播源ID
+	startTime   int64        // 直播开始时间，单位为毫秒
+	title       string       // 直播间标题
+	duration    int64        // 录播时长，单位为毫秒
+	playbackURL string       // 录播链接
+	backupURL   string       // 录播备份链接
+	liveCutNum  int          // 直播剪辑编号
+
+	suggestedTitle string // 没有直播间标题时根据弹幕或主播签名生成的建议标题
+	access         string // 直播间的访问限制，如付费直播，多个限制用逗号分隔
+	recordFile     string // 外部录播工具保存的本地录播文件名
+	onlineCount    int    // 获取直播间列表时的在线人数，不保存到数据库
+	likeCount      int    // 获取直播间列表时的累计点赞数，不保存到数据库
+	coverURL       string // 获取直播间列表时的直播封面链接，不保存到数据库
+	avatarURL      string // 获取直播间列表时的主播头像链接，不保存到数据库
+
+	computed map[string]interface{} // 查询时计算的列，见设置里的computedColumns
 }
 
 var client = &fasthttp.Client{
@@ -46,15 +59,8 @@ var (
 	liveCutParserPool  fastjson.ParserPool
 	quit               = make(chan struct{})
 	ac                 *acfundanmu.AcFunLive
-	dbMutex            = sync.RWMutex{}
 )
 
-var livePool = &sync.Pool{
-	New: func() interface{} {
-		return new(live)
-	},
-}
-
 // 检查错误
 func checkErr(err error) {
 	if err != nil {
@@ -77,7 +83,7 @@ func runThrice(f func() error) error {
 }
 
 // 获取正在直播的直播间列表数据
-func fetchLiveList() (list map[string]*live, e error) {
+func fetchLiveList() (list map[store.LiveID]live, e error) {
 	defer func() {
 		if err := recover(); err != nil {
 			e = fmt.Errorf("fetchLiveList() error: %v", err)
@@ -126,30 +132,37 @@ func fetchLiveList() (list map[string]*live, e error) {
 	}
 
 	liveList := v.GetArray("liveList")
-	list = make(map[string]*live, len(liveList))
+	list = make(map[store.LiveID]live, len(liveList))
 	for _, liveRoom := range liveList {
-		l := livePool.Get().(*live)
-		l.liveID = string(liveRoom.GetStringBytes("liveId"))
-		l.uid = liveRoom.GetInt("authorId")
-		l.name = string(liveRoom.GetStringBytes("user", "name"))
-		l.streamName = string(liveRoom.GetStringBytes("streamName"))
-		l.startTime = liveRoom.GetInt64("createTime")
-		l.title = string(liveRoom.GetStringBytes("title"))
-		l.duration = 0
-		l.playbackURL = ""
-		l.backupURL = ""
-		l.liveCutNum = 0
+		l := live{
+			liveID:     store.LiveID(liveRoom.GetStringBytes("liveId")),
+			uid:        store.UID(liveRoom.GetInt("authorId")),
+			name:       string(liveRoom.GetStringBytes("user", "name")),
+			streamName: string(liveRoom.GetStringBytes("streamName")),
+			startTime:  liveRoom.GetInt64("createTime"),
+			title:      string(liveRoom.GetStringBytes("title")),
+			access:     parseAccess(liveRoom),
+
+			onlineCount: liveRoom.GetInt("onlineCount"),
+			likeCount:   liveRoom.GetInt("likeCount"),
+			coverURL:    string(liveRoom.GetStringBytes("coverUrls", "0")),
+			avatarURL:   string(liveRoom.GetStringBytes("user", "headUrl")),
+		}
+		if !l.liveID.Valid() || !l.uid.Valid() {
+			log.Printf("忽略直播间列表里liveID或uid无效的直播：liveID：%q uid：%d", l.liveID, l.uid)
+			continue
+		}
 		list[l.liveID] = l
 	}
 
 	return list, nil
 }
 
-// 获取直播剪辑编号
-func fetchLiveCut(uid int, liveID string) (num int, e error) {
+// 获取直播剪辑编号和直播剪辑链接
+func fetchLiveCut(uid store.UID, liveID store.LiveID) (num int, cutURL string, e error) {
 	defer func() {
 		if err := recover(); err != nil {
-			num = 0
+			num, cutURL = 0, ""
 			e = fmt.Errorf("fetchLiveCut() error: %v", err)
 		}
 	}()
@@ -185,7 +198,7 @@ func fetchLiveCut(uid int, liveID string) (num int, e error) {
 
 	status := v.GetInt("liveCutStatus")
 	if status != 1 {
-		return 0, nil
+		return 0, "", nil
 	}
 	url := string(v.GetStringBytes("liveCutUrl"))
 	re := regexp.MustCompile(`/[0-9]+`)
@@ -196,7 +209,7 @@ func fetchLiveCut(uid int, liveID string) (num int, e error) {
 	num, err = strconv.Atoi(nums[0][1:])
 	checkErr(err)
 
-	return num, nil
+	return num, url, nil
 }
 
 // 处理退出信号
@@ -218,12 +231,13 @@ func quitSignal(cancel context.CancelFunc) {
 
 // 处理输入 getplayback 646973
 func handleInput(ctx context.Context) {
-	const helpMsg = `请输入"listall 主播的uid"、"list10 主播的uid"、"getplayback liveID" fetch_j 或"quit"`
+	const helpMsg = `请输入"listall 主播的uid"、"list10 主播的uid"、"getplayback liveID" fetch_j、"export jsonl 文件路径 [--chunk 行数] [--workers 数量]"、"export csv 文件路径 [编码] [--chunk 行数] [--workers 数量]"、"export ics 主播的uid 文件路径"、"export ass liveID [文件路径]"、"export openapi 文件路径"、"import 文件路径"、"import_watch 文件路径 [--apply]"、"watch [主播的uid [danmaku] [stats] [cover]]"、"unwatch 主播的uid"、"tenant list|add|key|revoke|remove [用户名]"、"names 主播的uid"、"avatars 主播的uid"、"covers 主播的uid"、"search 昵称"、"search_danmaku 关键词... [--uid 主播的uid] [--since 日期]"、"import_ass_danmaku liveID [ASS文件]"、"titles liveID"、"sql [--csv|--json] SELECT ..."、"translate 文字"、"delete liveID"、"restore liveID"、"logs 日期 [关键词]"、"fsck [--fix]"、"archive 日期"、"recompute [stats|schedule|engagement|chat]"、"stats 主播的uid|liveID"、"top [月份]"、"schedule 主播的uid"、"fans 主播的uid"、"du [主播的uid]"、"livecuts"、"ranking liveID"、"moderation liveID"、"gifts liveID"、"income 主播的uid"、"followers 主播的uid"、"samples liveID"、"viewers liveID"、"fanclub liveID"、"streams 主播的uid"、"activity liveID"、"digest [日期]"、"queue"、"notifications"、"breakers"、"version" 或"quit"`
 	log.Println(helpMsg)
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
-		cmd := strings.Fields(scanner.Text())
+		line := scanner.Text()
+		cmd := strings.Fields(line)
 		if len(cmd) == 0 {
 			log.Println(helpMsg)
 			continue
@@ -237,9 +251,263 @@ func handleInput(ctx context.Context) {
 			//continue
 		}
 		switch cmd[0] {
+		case "listall", "list10":
+			limit := 0
+			if cmd[0] == "list10" {
+				limit = 10
+			}
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printLiveList(ctx, uid, limit)
+			}
+		case "export":
+			if err := runExport(ctx, cmd[1:]); err != nil {
+				log.Println(err)
+			}
+		case "import":
+			for _, file := range cmd[1:] {
+				log.Printf("正在导入 %s，请等待", file)
+				imported, skipped, err := importLives(ctx, file)
+				if err != nil {
+					log.Printf("导入 %s 失败：%v", file, err)
+				} else {
+					log.Printf("从 %s 导入了 %d 条直播数据，跳过了 %d 条已有的直播数据", file, imported, skipped)
+				}
+			}
+		case "tenant":
+			if err := runTenant(ctx, cmd[1:]); err != nil {
+				log.Println(err)
+			}
+		case "recompute":
+			if err := recompute(ctx, cmd[1:]); err != nil {
+				log.Println(err)
+			}
+		case "import_watch":
+			if len(cmd) < 2 {
+				log.Println(`导入关注的主播的命令为"import_watch 文件路径 [--apply]"`)
+				continue
+			}
+			apply := len(cmd) > 2 && cmd[2] == "--apply"
+			if err := importWatchList(ctx, cmd[1], apply); err != nil {
+				log.Printf("从 %s 导入关注的主播失败：%v", cmd[1], err)
+			}
+		case "watch":
+			if len(cmd) < 2 {
+				printWatchList(ctx)
+				continue
+			}
+			if err := watchCommand(cmd[1], cmd[2:]); err != nil {
+				log.Println(err)
+			}
+		case "unwatch":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				removed, err := removeWatch(uid)
+				switch {
+				case err != nil:
+					log.Println(err)
+				case !removed:
+					log.Printf("没有关注uid为 %d 的主播", uid)
+				default:
+					log.Printf("已取消关注uid为 %d 的主播", uid)
+				}
+			}
+		case "top":
+			monthStr := ""
+			if len(cmd) > 1 {
+				monthStr = cmd[1]
+			}
+			printTopStreamers(ctx, monthStr)
+		case "stats":
+			// uid是数字，liveID一般含有字母
+			for _, arg := range cmd[1:] {
+				if uid, err := store.ParseUID(arg); err == nil {
+					printMonthlyStats(ctx, uid)
+				} else if liveID, err := store.ParseLiveID(arg); err == nil {
+					printChatStats(ctx, liveID)
+				} else {
+					log.Printf("%q 不是有效的uid或liveID", arg)
+				}
+			}
+		case "schedule", "fans":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				switch cmd[0] {
+				case "schedule":
+					printSchedule(ctx, uid)
+				default:
+					printFans(ctx, uid)
+				}
+			}
+		case "names":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				names, err := db.QueryStreamerNames(ctx, uid)
+				if err != nil {
+					log.Printf("查询uid为 %d 的主播的昵称出现错误：%v", uid, err)
+					continue
+				}
+				if len(names) == 0 {
+					log.Printf("没有uid为 %d 的主播的昵称记录", uid)
+					continue
+				}
+				printStreamerNames(names)
+			}
+		case "avatars":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printAvatars(ctx, uid)
+			}
+		case "search":
+			keyword := strings.Join(cmd[1:], " ")
+			if keyword == "" {
+				log.Println(`搜索主播的命令为"search 昵称"`)
+				continue
+			}
+			names, err := db.SearchStreamers(ctx, keyword)
+			if err != nil {
+				log.Printf("搜索昵称 %s 出现错误：%v", keyword, err)
+				continue
+			}
+			if len(names) == 0 {
+				log.Printf("没有用过含有 %s 的昵称的主播", keyword)
+				continue
+			}
+			printStreamerNames(names)
+		case "ranking":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printRankings(ctx, liveID)
+			}
+		case "moderation":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printModeration(ctx, liveID)
+			}
+		case "gifts":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printGiftTotals(ctx, liveID)
+			}
+		case "income":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printIncome(ctx, uid)
+			}
+		case "samples":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printSamples(ctx, liveID)
+			}
+		case "covers":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printCovers(ctx, uid)
+			}
+		case "followers":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printFollowers(ctx, uid)
+			}
+		case "streams":
+			for _, uid := range parseUIDArgs(cmd[1:]) {
+				printLiveStreams(ctx, uid)
+			}
+		case "fanclub":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printFanClub(ctx, liveID)
+			}
+		case "viewers":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printViewerSamples(ctx, liveID)
+			}
+		case "activity":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				printActivity(ctx, liveID)
+			}
+		case "digest":
+			dateStr := ""
+			if len(cmd) > 1 {
+				dateStr = cmd[1]
+			}
+			generateDigest(ctx, dateStr)
+		case "search_danmaku":
+			searchDanmaku(ctx, cmd[1:])
+		case "import_ass_danmaku":
+			importASSDanmaku(ctx, cmd[1:])
+		case "archive":
+			if len(cmd) < 2 {
+				log.Println(`归档的命令为"archive 日期"，如"archive 2023-01-01"`)
+				continue
+			}
+			before, err := time.ParseInLocation(dateLayout, cmd[1], time.Local)
+			if err != nil {
+				log.Printf("%s 不是有效的日期，格式为 %s", cmd[1], dateLayout)
+				continue
+			}
+			archiveLives(ctx, before)
+		case "sql":
+			if err := runSQL(ctx, strings.TrimPrefix(strings.TrimSpace(line), "sql")); err != nil {
+				log.Println(err)
+			}
+		case "titles":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				titles, err := db.QueryTitles(ctx, liveID)
+				if err != nil {
+					log.Printf("查询liveID为 %s 的直播间标题记录出现错误：%v", liveID, err)
+					continue
+				}
+				if len(titles) == 0 {
+					log.Printf("没有liveID为 %s 的直播间标题记录", liveID)
+					continue
+				}
+				for _, t := range titles {
+					fmt.Printf("%s %s\n", time.UnixMilli(t.ChangeTime).Format(timeLayout), t.Title)
+				}
+			}
+		case "translate":
+			texts := []string{strings.Join(cmd[1:], " ")}
+			result, err := translateTexts(ctx, texts)
+			if err != nil {
+				log.Printf("翻译失败：%v", err)
+			} else {
+				log.Printf("语言：%s 翻译结果：%s", detectLanguage(texts[0]), result[0])
+			}
+		case "delete", "restore":
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
+				var ok bool
+				var err error
+				if cmd[0] == "delete" {
+					ok, err = deleteLive(ctx, liveID)
+				} else {
+					ok, err = restoreDeletedLive(ctx, liveID)
+				}
+				switch {
+				case err != nil:
+					log.Printf("处理liveID为 %s 的直播数据出现错误：%v", liveID, err)
+				case !ok:
+					log.Printf("没有可以处理的liveID为 %s 的直播数据", liveID)
+				case cmd[0] == "delete":
+					log.Printf("已删除liveID为 %s 的直播数据，可以用restore命令恢复", liveID)
+				default:
+					log.Printf("已恢复liveID为 %s 的直播数据", liveID)
+				}
+			}
+		case "logs":
+			if len(cmd) < 2 {
+				log.Println(`查询日志的命令为"logs 日期 [关键词]"，日期格式为2006-01-02`)
+				continue
+			}
+			if err := printLogs(cmd[1], strings.Join(cmd[2:], " ")); err != nil {
+				log.Println(err)
+			}
+		case "fsck":
+			fix := len(cmd) > 1 && cmd[1] == "--fix"
+			log.Println("正在检查数据库，请等待")
+			fsck(ctx, fix)
+		case "version":
+			log.Println(versionInfo())
+		case "livecuts":
+			printRemovedLiveCuts(ctx)
+		case "du":
+			printStorage(ctx, cmd[1:])
+		case "queue":
+			log.Println(writeQueueStatus())
+		case "notifications":
+			printNotifications(ctx)
+		case "breakers":
+			log.Printf("接口的熔断器：\n%s", breakerStatus())
 		case "getplayback":
 			log.Println("查询录播链接，请等待")
-			for _, liveID := range cmd[1:] {
+			for _, liveID := range parseLiveIDArgs(cmd[1:]) {
 				playback, err := getPlayback(liveID)
 				if err != nil {
 					log.Println(err)
@@ -263,17 +531,17 @@ func handleInput(ctx context.Context) {
 			} else {
 				if cmd[1] == "all" {
 					for _, v := range newList {
-						log.Printf("%+v", *v)
+						log.Printf("%+v", v)
 					}
 				} else {
+					uid, err := store.ParseUID(cmd[1])
+					if err != nil {
+						log.Println(err)
+						continue
+					}
 					for _, v := range newList {
-						uid, err := strconv.Atoi(cmd[1])
-						if err != nil {
-							log.Println(err)
-							continue
-						}
 						if v.uid == uid {
-							saveLiveId(v)
+							saveLiveId(&v)
 							break
 						}
 					}
@@ -286,12 +554,12 @@ func handleInput(ctx context.Context) {
 				log.Println(err)
 
 			} else {
-				uid := 646973
+				var uid store.UID = 646973
 				flag := false
 				for _, v := range newList {
 					if v.uid == uid {
 						flag = true
-						saveLiveId(v)
+						saveLiveId(&v)
 						break
 					}
 
@@ -308,6 +576,39 @@ func handleInput(ctx context.Context) {
 	checkErr(err)
 }
 
+// 打印指定主播的直播数据
+func printLiveList(ctx context.Context, uid store.UID, limit int) {
+	lives, err := queryLiveList(ctx, uid, limit)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的直播数据出现错误：%v", uid, err)
+		return
+	}
+	if len(lives) == 0 {
+		log.Printf("没有uid为 %d 的主播的直播数据", uid)
+		return
+	}
+	for _, l := range lives {
+		if l.title == "" && l.suggestedTitle != "" {
+			l.title = "（建议标题）" + l.suggestedTitle
+		}
+		fmt.Printf("开播时间：%s 主播uid：%d 昵称：%s 直播标题：%s liveID：%s streamName：%s 直播时长：%s 直播剪辑编号：%d",
+			time.UnixMilli(l.startTime).Format(timeLayout),
+			l.uid, l.name, l.title, l.liveID, l.streamName,
+			(time.Duration(l.duration) * time.Millisecond).String(), l.liveCutNum,
+		)
+		if l.access != "" {
+			fmt.Printf(" 访问限制：%s", describeAccess(l.access))
+		}
+		if l.recordFile != "" {
+			fmt.Printf(" 录播文件：%s", l.recordFile)
+		}
+		for _, c := range conf.ComputedColumns {
+			fmt.Printf(" %s：%v", c.Name, l.computed[c.Name])
+		}
+		fmt.Println()
+	}
+}
+
 func saveLiveId(v *live) {
 	log.Println("saveLiveId:", v.name)
 	fileName := v.name + ".txt"
@@ -324,16 +625,34 @@ func saveLiveId(v *live) {
 	log.Println("save success!")
 }
 
-// 获取指定liveID的playback
-func getPlayback(liveID string) (playback *acfundanmu.Playback, err error) {
-	err = runThrice(func() error {
-		playback, err = ac.GetPlayback(liveID)
+// 获取指定liveID的playback，出错时重试
+func getPlayback(liveID store.LiveID) (playback *acfundanmu.Playback, err error) {
+	err = playbackBreaker.run(func() error {
+		playback, err = ac.GetPlayback(liveID.String())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取liveID为 %s 的playback失败：%w", liveID, err)
+	}
+	distinguishPlayback(liveID, playback)
+	return playback, nil
+}
+
+// 获取指定liveID的playback，只请求一次
+func tryPlayback(liveID store.LiveID) (playback *acfundanmu.Playback, err error) {
+	err = playbackBreaker.once(func() error {
+		playback, err = ac.GetPlayback(liveID.String())
 		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("获取liveID为 %s 的playback失败：%w", liveID, err)
 	}
+	distinguishPlayback(liveID, playback)
+	return playback, nil
+}
 
+// 把录播链接分为阿里云和腾讯云的链接
+func distinguishPlayback(liveID store.LiveID, playback *acfundanmu.Playback) {
 	if playback.URL != "" {
 		aliURL, txURL := playback.Distinguish()
 		if aliURL != "" && txURL != "" {
@@ -343,16 +662,176 @@ func getPlayback(liveID string) (playback *acfundanmu.Playback, err error) {
 			log.Printf("无法获取liveID为 %s 的阿里云录播链接或腾讯云录播链接", liveID)
 		}
 	}
-
-	return playback, nil
 }
 
 func main() {
+	showVersion := flag.Bool("version", false, "打印版本信息后退出")
+	flag.StringVar(&configPath, "config", "", "设置文件路径，默认为本程序所在文件夹里的 "+configFile)
+	flag.Usage = printUsage
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(versionInfo())
+		return
+	}
+
+	name, args := "serve", flag.Args()
+	if len(args) != 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd := findSubcommand(name)
+	if cmd == nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "没有叫 %s 的子命令\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	if err := runSubcommand(cmd, args); err != nil {
+		os.Exit(1)
+	}
+}
+
+// 读取设置并打开数据库后运行子命令，出错时打印错误并返回
+func runSubcommand(cmd *subcommand, args []string) (e error) {
+	var err error
+	basePath, err = getBasePath()
+	checkErr(err)
+	if configPath == "" {
+		configPath = filepath.Join(basePath, configFile)
+	}
+	conf, err = loadConfig(configPath)
+	checkErr(err)
+
+	// 最近的日志会写到崩溃记录里
+	log.SetOutput(io.MultiWriter(os.Stderr, recentLogs))
+	if logDir := absPath(conf.LogDir); logDir != "" {
+		if err = migrateLegacyLog(absPath(legacyLogFile), logDir); err != nil {
+			log.Printf("迁移旧的日志文件失败：%v", err)
+		}
+		w, err := newDailyWriter(logDir)
+		checkErr(err)
+		defer w.Close()
+		log.SetOutput(io.MultiWriter(os.Stderr, w, recentLogs))
+	}
+	// 日志文件关闭前打印错误
+	defer func() {
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+	if cmd.name == "serve" && conf.ShowBanner {
+		printBanner()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go quitSignal(cancel)
+
+	// 只读的子命令不锁定数据库，运行中的本程序在写入时也可以使用
+	dbFile := absPath(conf.DBFile)
+	if cmd.write {
+		lock, err := acquireLock(dbFile)
+		if err != nil {
+			return err
+		}
+		defer releaseLock(lock)
+	}
+	if err = openDB(ctx, dbFile, !cmd.write); err != nil {
+		return err
+	}
+	defer closeDB()
+	go writeCycle(db)
+	defer closeWriteQueue()
+
+	return cmd.run(ctx, args)
+}
+
+// 获取直播间列表并记录直播数据，同时处理终端的输入，直到收到退出信号或输入quit
+func serve(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("serve 子命令没有参数")
+	}
 	var err error
 	ac, err = acfundanmu.NewAcFunLive()
 	checkErr(err)
-	handleInput(ctx)
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "purgeCycle", purgeCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "archiveCycle", archiveCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "invalidateCycle", invalidateCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "recorderCycle", recorderCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "digestCycle", digestCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "liveCutCycle", liveCutCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "followerCycle", followerCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "playbackCycle", playbackCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "clockCycle", clockCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "sinkCycle", sinkCycle)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "notifyCycle", notifyCycle)
+	}()
+	liveWG.Add(2)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "eventCycle", eventCycle)
+	}()
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "serveHTTP", serveHTTP)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "serveGRPC", serveGRPC)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		runRecovered(ctx, "serveDebug", serveDebug)
+	}()
+	go runRecovered(ctx, "handleInput", handleInput)
+	if conf.Mirror.Source != "" {
+		runRecovered(ctx, "mirrorCycle", mirrorCycle)
+	} else {
+		runRecovered(ctx, "cycle", cycle)
+	}
+	waitShutdown()
+	return nil
 }
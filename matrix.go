@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+// Matrix房间通知的设置
+type matrixConfig struct {
+	Homeserver  string      `json:"homeserver"`                // 服务器的地址，如https://matrix.org，为空时不发送通知
+	AccessToken string      `json:"accessToken" secret:"true"` // 机器人账号的access token
+	RoomIDs     []string    `json:"roomIDs"`                   // 接收通知的房间ID，如!abcdefg:matrix.org
+	Limit       notifyLimit `json:"limit"`                     // 安静时段和频率限制
+}
+
+// 发送Matrix消息的事务ID的序号，事务ID和通知一起保存，重试时使用相同的事务ID，服务器不会重复发送
+var matrixTxnSeq atomic.Int64
+
+// 是否需要为这个主播发送Matrix通知，只通知关注的主播
+func matrixEnabled(uid store.UID) bool {
+	c := conf.Matrix
+	return c.Homeserver != "" && c.AccessToken != "" && len(c.RoomIDs) != 0 && isWatched(uid)
+}
+
+// 发送开播通知
+func matrixLiveStart(l *live) {
+	matrixStartNotify(l, "start", defaultMatrixStartTemplate)
+}
+
+// 发送重连通知，设置了开播通知的模板时使用这个模板，模板里可以用.Event区分
+func matrixLiveReconnect(l *live) {
+	matrixStartNotify(l, "reconnect", defaultMatrixReconnectTemplate)
+}
+
+func matrixStartNotify(l *live, event, def string) {
+	if !matrixEnabled(l.uid) || !notifyRouted(routeMatrix, l.uid, l.title) || !conf.Matrix.Limit.allow("Matrix", l.uid, templateEventName(event)+"通知") {
+		return
+	}
+	sendMatrix(l, renderTemplate(conf.Templates.Matrix.Start, def, newTemplateData(event, l, 0)))
+}
+
+// 发送下播通知
+func matrixLiveEnd(l *live, duration int64) {
+	if !matrixEnabled(l.uid) || !notifyRouted(routeMatrix, l.uid, l.title) || !conf.Matrix.Limit.allow("Matrix", l.uid, "下播通知") {
+		return
+	}
+	sendMatrix(l, renderTemplate(conf.Templates.Matrix.End, defaultMatrixEndTemplate, newTemplateData("end", l, duration)))
+}
+
+// 保存到通知队列的Matrix消息
+type matrixPayload struct {
+	RoomID string `json:"roomID"`
+	TxnID  string `json:"txnID"`
+	Text   string `json:"text"`
+}
+
+// 把关于直播l的文字消息加入通知队列，发送到所有设置的房间
+func sendMatrix(l *live, text string) {
+	for _, roomID := range conf.Matrix.RoomIDs {
+		txnID := fmt.Sprintf("acfunlivedb-%d-%d", time.Now().UnixMilli(), matrixTxnSeq.Add(1))
+		queueNotification("matrix", l.uid, l.liveID, &matrixPayload{RoomID: roomID, TxnID: txnID, Text: text})
+	}
+}
+
+// 发送通知队列里的Matrix消息
+func sendMatrixPayload(payload []byte) error {
+	if conf.Matrix.Homeserver == "" || conf.Matrix.AccessToken == "" {
+		return errNotifyDisabled
+	}
+	var p matrixPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return putMatrix(p.RoomID, p.TxnID, p.Text)
+}
+
+// 调用Client-Server API发送m.room.message事件，错误信息里不含access token
+func putMatrix(roomID, txnID, text string) error {
+	body, err := json.Marshal(struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	}{"m.text", text})
+	checkErr(err)
+	c := conf.Matrix
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(c.Homeserver, "/"), url.PathEscape(roomID), url.PathEscape(txnID)))
+	req.Header.SetMethod(fasthttp.MethodPut)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	req.SetBody(body)
+	if err := client.Do(req, resp); err != nil {
+		return errors.New(strings.ReplaceAll(err.Error(), c.AccessToken, "******"))
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		var result struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal(resp.Body(), &result); err != nil || result.ErrCode == "" {
+			return fmt.Errorf("Matrix服务器返回状态码 %d：%s", code, strings.TrimSpace(string(resp.Body())))
+		}
+		return fmt.Errorf("Matrix服务器返回状态码 %d：%s %s", code, result.ErrCode, result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const defaultMirrorInterval = 60 // 默认从主实例同步的间隔，单位为秒
+
+// 作为镜像从主实例同步直播数据的设置
+type mirrorConfig struct {
+	Source   string `json:"source"`              // 主实例HTTP服务器的地址，如"http://192.168.1.2:8080"，设置后不再从AcFun获取直播数据，改为从主实例同步
+	Token    string `json:"token" secret:"true"` // 主实例的http.token
+	Interval int    `json:"interval"`            // 同步的间隔，单位为秒
+}
+
+// 请求主实例的/changes，返回since之后的变更
+func fetchChanges(source, token string, since int64) (*changesJSON, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	url := fmt.Sprintf("%s/changes?since=%d&limit=%d", strings.TrimSuffix(source, "/"), since, changesMaxLimit)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := client.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d", url, code)
+	}
+	var changes changesJSON
+	if err := json.Unmarshal(resp.Body(), &changes); err != nil {
+		return nil, fmt.Errorf("解析 %s 返回的变更失败：%w", url, err)
+	}
+	return &changes, nil
+}
+
+// 转换为保存到数据库的直播数据
+func (j *liveJSON) toStore() *store.Live {
+	return &store.Live{
+		LiveID:         j.LiveID,
+		UID:            j.UID,
+		Name:           j.Name,
+		StreamName:     j.StreamName,
+		StartTime:      j.StartTime,
+		Title:          j.Title,
+		Duration:       j.Duration,
+		PlaybackURL:    j.PlaybackURL,
+		BackupURL:      j.BackupURL,
+		LiveCutNum:     j.LiveCutNum,
+		SuggestedTitle: j.SuggestedTitle,
+		Access:         j.Access,
+		RecordFile:     j.RecordFile,
+	}
+}
+
+// 一页变更对应的写入，最后保存同步到的seq，和直播数据在同一个事务里
+func mirrorWrites(source string, page *changesJSON) []store.Write {
+	now := time.Now().UnixMilli()
+	writes := make([]store.Write, 0, 3*len(page.Changes)+1)
+	for _, c := range page.Changes {
+		if c.Live == nil {
+			writes = append(writes, store.MirrorDeleteWrite(c.LiveID, now))
+			continue
+		}
+		var deletedAt int64
+		if c.Deleted {
+			deletedAt = now
+		}
+		writes = append(writes, store.MirrorLiveWrites(c.Live.toStore(), deletedAt)...)
+		if c.Live.Name != "" {
+			writes = append(writes, store.StreamerNameWrite(c.Live.UID, c.Live.Name, c.Live.StartTime))
+		}
+	}
+	return append(writes, store.SyncSeqWrite(source, page.Next))
+}
+
+// 从主实例同步所有新的变更，返回同步的直播数量
+func syncMirror(ctx context.Context, source, token string) (int, error) {
+	seq, err := db.QuerySyncSeq(ctx, source)
+	if err != nil {
+		return 0, fmt.Errorf("查询同步进度出现错误：%w", err)
+	}
+	synced := 0
+	for {
+		page, err := fetchChanges(source, token, seq)
+		if err != nil {
+			return synced, err
+		}
+		if len(page.Changes) == 0 {
+			return synced, nil
+		}
+		if _, err = db.WriteBatch(ctx, mirrorWrites(source, page)); err != nil {
+			return synced, fmt.Errorf("保存同步的直播数据出现错误：%w", err)
+		}
+		for _, c := range page.Changes {
+			markChanged(changeUpdate, c.LiveID)
+		}
+		synced += len(page.Changes)
+		seq = page.Next
+		if !page.More {
+			return synced, nil
+		}
+		select {
+		case <-ctx.Done():
+			return synced, nil
+		default:
+		}
+	}
+}
+
+// 作为镜像定期从主实例同步直播数据，代替从AcFun获取直播间列表
+func mirrorCycle(ctx context.Context) {
+	interval := time.Duration(conf.Mirror.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultMirrorInterval * time.Second
+	}
+	log.Printf("作为镜像从 %s 同步直播数据", conf.Mirror.Source)
+	for {
+		markFetchAttempt(interval)
+		n, err := syncMirror(ctx, conf.Mirror.Source, conf.Mirror.Token)
+		if err != nil {
+			log.Printf("从 %s 同步直播数据失败：%v", conf.Mirror.Source, err)
+		} else {
+			markFetchSuccess()
+		}
+		if n != 0 {
+			log.Printf("从 %s 同步了 %d 场直播的数据", conf.Mirror.Source, n)
+		}
+		if !sleepCtx(ctx, interval) {
+			return
+		}
+	}
+}
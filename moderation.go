@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 管理事件的种类的说明
+var moderationText = map[string]string{
+	store.ModerationViolationAlert: "违规警告",
+	store.ModerationKickedOut:      "被踢出直播间",
+}
+
+// 打印直播间的管理事件
+func printModeration(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QueryModeration(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播间管理事件出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有管理事件记录", liveID)
+		return
+	}
+	for _, e := range list {
+		text := moderationText[e.Kind]
+		if text == "" {
+			text = e.Kind
+		}
+		fmt.Printf("%s %s：%s\n", time.UnixMilli(e.Time).Format(timeLayout), text, e.Content)
+	}
+}
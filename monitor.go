@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	pollInterval        = 20 * time.Second // 获取直播间列表的间隔
+	liveCutPollInterval = 5 * time.Minute  // 下播后查询直播剪辑的间隔
+	liveCutPollTries    = 12               // 下播后最多查询直播剪辑的次数
+)
+
+var liveWG sync.WaitGroup // 等待处理开播和下播的goroutine结束
+
+// 循环获取直播间列表，对比前后两次的列表来处理开播和下播
+func cycle(ctx context.Context) {
+	closeStaleDanmakuSessions(ctx)
+	oldList := loadActiveList(ctx)
+	capture := newMonitorCapture()
+	defer capture.close()
+	capture.initial(oldList)
+	guard := newDurationGuard()
+	idle := newIdleState()
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		markFetchAttempt(idle.interval())
+		var newList map[store.LiveID]live
+		fetchTime := time.Now()
+		err := liveListBreaker.run(func() error {
+			var err error
+			newList, err = fetchLiveList()
+			return err
+		})
+		if err != nil {
+			log.Println(err)
+			capture.failed(fetchTime, err)
+			if !sleepCtx(ctx, idle.interval()) {
+				return
+			}
+			continue
+		}
+		markFetchSuccess()
+		raw := capture.snapshot(newList)
+
+		// 强制结束和直播间弹幕收到下播信号的直播不在newList里，下面的对比会当作下播处理
+		guard.filter(newList)
+		if conf.VerifyLiveEnd {
+			guard.verifyEnded(oldList, newList)
+		}
+		capture.cycle(fetchTime, raw, newList)
+		idle.update(newList)
+		recordRanking(fetchTime, newList)
+		recordViewerSamples(fetchTime, newList)
+
+		if first {
+			first = false
+			resumeRoomWatchers(ctx, oldList, newList)
+			liveWG.Add(1)
+			onLive := liveIDSet(newList)
+			for liveID := range oldList {
+				// 上次运行时正在直播的直播由下面的对比处理
+				onLive[liveID] = true
+			}
+			go func() {
+				defer liveWG.Done()
+				defer recoverCrash("recoverUnfinished")
+				recoverUnfinished(ctx, onLive)
+			}()
+		}
+
+		for _, d := range diffLiveLists(oldList, newList) {
+			applyDecision(ctx, d)
+		}
+		restartRoomWatchers(ctx, newList)
+
+		oldList = newList
+		if !sleepCtx(ctx, idle.interval()) {
+			return
+		}
+	}
+}
+
+// 对比前后两次的直播间列表得到的处理
+type monitorDecision struct {
+	kind decisionKind
+	old  live // 之前的直播数据，开播时为零值
+	l    live // 新的直播数据，下播时为之前的直播数据
+}
+
+type decisionKind int
+
+const (
+	decisionStart  decisionKind = iota // 开播
+	decisionEnd                        // 下播
+	decisionTitle                      // 直播间标题改变
+	decisionAccess                     // 直播间访问限制改变
+	decisionRename                     // 主播昵称改变
+)
+
+// 对比前后两次的直播间列表，按liveID的顺序返回需要的处理，不修改两个列表，回放时也使用这个函数
+func diffLiveLists(oldList, newList map[store.LiveID]live) []monitorDecision {
+	var decisions []monitorDecision
+	for _, liveID := range sortedLiveIDs(newList) {
+		l := newList[liveID]
+		old, ok := oldList[liveID]
+		if !ok {
+			decisions = append(decisions, monitorDecision{kind: decisionStart, l: l})
+			continue
+		}
+		if old.title != l.title {
+			decisions = append(decisions, monitorDecision{kind: decisionTitle, old: old, l: l})
+		}
+		if old.access != l.access {
+			decisions = append(decisions, monitorDecision{kind: decisionAccess, old: old, l: l})
+		}
+		if old.name != l.name {
+			decisions = append(decisions, monitorDecision{kind: decisionRename, old: old, l: l})
+		}
+	}
+	for _, liveID := range sortedLiveIDs(oldList) {
+		if _, ok := newList[liveID]; !ok {
+			decisions = append(decisions, monitorDecision{kind: decisionEnd, old: oldList[liveID], l: oldList[liveID]})
+		}
+	}
+	return decisions
+}
+
+// 执行对比直播间列表得到的处理
+func applyDecision(ctx context.Context, d monitorDecision) {
+	l := d.l
+	switch d.kind {
+	case decisionStart:
+		handleLiveStart(ctx, &l)
+	case decisionTitle:
+		log.Println(d.describe())
+		insertTitleChange(l.liveID, l.title)
+	case decisionAccess:
+		log.Println(d.describe())
+		updateAccess(l.liveID, l.access)
+	case decisionRename:
+		log.Println(d.describe())
+		seeStreamerName(d.old.uid, d.old.name)
+		seeStreamerName(l.uid, l.name)
+	case decisionEnd:
+		deleteActiveLive(l.liveID)
+		liveWG.Add(1)
+		// 传值给goroutine，之后oldList被替换也不影响下播的处理
+		go func() {
+			defer liveWG.Done()
+			defer trackTask("处理下播，获取并保存直播时长", &l)()
+			defer recoverCrash("handleLiveEnd")
+			handleLiveEnd(ctx, &l)
+		}()
+	}
+}
+
+// 处理的说明，用于日志和回放
+func (d monitorDecision) describe() string {
+	l := d.l
+	switch d.kind {
+	case decisionStart:
+		return fmt.Sprintf("uid为 %d 的主播 %s 开播，liveID为 %s，标题为 %q", l.uid, l.name, l.liveID, l.title)
+	case decisionEnd:
+		return fmt.Sprintf("uid为 %d 的主播 %s 下播，liveID为 %s", l.uid, l.name, l.liveID)
+	case decisionTitle:
+		return fmt.Sprintf("uid为 %d 的主播 %s 的直播间标题从 %q 改为 %q", l.uid, l.name, d.old.title, l.title)
+	case decisionAccess:
+		return fmt.Sprintf("uid为 %d 的主播 %s 的直播间访问限制从 %q 变为 %q", l.uid, l.name, d.old.access, l.access)
+	case decisionRename:
+		return fmt.Sprintf("uid为 %d 的主播的昵称从 %s 改为 %s", l.uid, d.old.name, l.name)
+	}
+	return ""
+}
+
+// 按顺序返回列表里所有直播的liveID
+func sortedLiveIDs(list map[store.LiveID]live) []store.LiveID {
+	ids := make([]store.LiveID, 0, len(list))
+	for liveID := range list {
+		ids = append(ids, liveID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// 读取上次运行时保存的正在直播的直播，这样重启期间下播的直播也能被处理
+func loadActiveList(ctx context.Context) map[store.LiveID]live {
+	lives, err := queryActiveLives(ctx)
+	if err != nil {
+		log.Printf("读取上次运行时正在直播的直播出现错误：%v", err)
+		return make(map[store.LiveID]live)
+	}
+	list := make(map[store.LiveID]live, len(lives))
+	for _, l := range lives {
+		list[l.liveID] = l
+	}
+	if len(list) != 0 {
+		log.Printf("读取到上次运行时正在直播的 %d 场直播", len(list))
+	}
+	return list
+}
+
+// 上次运行时正在直播、重启后仍在直播的直播不会被当作开播，需要重新连接直播间，
+// 之前中断的弹幕记录会被重新打开
+func resumeRoomWatchers(ctx context.Context, oldList, newList map[store.LiveID]live) {
+	for liveID := range oldList {
+		if l, ok := newList[liveID]; ok {
+			startRoomWatcher(ctx, &l)
+		}
+	}
+}
+
+// 返回列表里所有直播的liveID
+func liveIDSet(list map[store.LiveID]live) map[store.LiveID]bool {
+	set := make(map[store.LiveID]bool, len(list))
+	for liveID := range list {
+		set[liveID] = true
+	}
+	return set
+}
+
+// 处理开播
+func handleLiveStart(ctx context.Context, l *live) {
+	prev, reconnect := notifyLiveStart(l)
+	insert(l)
+	insertActiveLive(l.liveID)
+	insertTitleChange(l.liveID, l.title)
+	seeStreamerName(l.uid, l.name)
+	if conf.SuggestTitle && strings.TrimSpace(l.title) == "" {
+		startTitleCollector(ctx, l.uid, l.liveID)
+	}
+	startRoomWatcher(ctx, l)
+	startCoverDownload(l)
+	startAvatarArchive(ctx, l)
+	uid, liveID := l.uid, l.liveID
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer recoverCrash("saveLiveCut")
+		saveLiveCut(ctx, uid, liveID)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer recoverCrash("recordFanClub")
+		recordFanClub(uid, liveID, store.FanClubStart)
+	}()
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer recoverCrash("recordStreamQualities")
+		recordStreamQualities(uid, liveID)
+	}()
+	started := *l
+	if reconnect {
+		// 下播通知没有发送，只发送一条重连通知
+		sinkLiveReconnect(prev, &started)
+		commandHookLiveReconnect(prev, &started)
+		startLiveNotifiers(&started, []liveNotifier{
+			{"hookLiveReconnect", func(l *live) { hookLiveReconnect(prev, l) }},
+			{"telegramLiveReconnect", telegramLiveReconnect},
+			{"pushLiveReconnect", pushLiveReconnect},
+			{"oneBotLiveReconnect", oneBotLiveReconnect},
+			{"matrixLiveReconnect", matrixLiveReconnect},
+			{"desktopLiveReconnect", desktopLiveReconnect},
+		})
+		return
+	}
+	sinkLiveStart(&started)
+	commandHookLiveStart(&started)
+	startLiveNotifiers(&started, []liveNotifier{
+		{"hookLiveStart", hookLiveStart},
+		{"telegramLiveStart", telegramLiveStart},
+		{"pushLiveStart", pushLiveStart},
+		{"oneBotLiveStart", oneBotLiveStart},
+		{"matrixLiveStart", matrixLiveStart},
+		{"desktopLiveStart", desktopLiveStart},
+	})
+}
+
+// 开播时发送的通知
+type liveNotifier struct {
+	name string // 出错时打印的名字
+	send func(l *live)
+}
+
+// 在后台分别发送每个通知，一个通知出错或者很慢时不影响其他通知
+func startLiveNotifiers(l *live, notifiers []liveNotifier) {
+	for _, n := range notifiers {
+		n := n
+		liveWG.Add(1)
+		go func() {
+			defer liveWG.Done()
+			defer recoverCrash(n.name)
+			n.send(l)
+		}()
+	}
+}
+
+// 获取并保存直播剪辑编号，返回是否已经有直播剪辑
+func saveLiveCut(ctx context.Context, uid store.UID, liveID store.LiveID) bool {
+	var num int
+	var cutURL string
+	err := liveCutBreaker.run(func() error {
+		var err error
+		num, cutURL, err = fetchLiveCut(uid, liveID)
+		return err
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	queueWrite(fmt.Sprintf("记录获取过liveID为 %s 的直播剪辑编号", liveID), nil, store.LiveCutLookupWrite(liveID, time.Now().UnixMilli()))
+	if num == 0 {
+		return false
+	}
+	// 开播时插入的直播数据可能还在写入队列里
+	flushWrites()
+	updateLiveCut(ctx, liveID, num)
+	telegramLiveCut(ctx, uid, liveID, cutURL)
+	return true
+}
+
+// 下播时还没有直播剪辑的关注的主播的直播，定期查询直播剪辑，生成后保存编号并发送通知，ctx结束或多次查询都没有时放弃
+func waitLiveCut(ctx context.Context, uid store.UID, liveID store.LiveID) {
+	defer forgetTelegramCut(liveID)
+	for i := 0; i < liveCutPollTries; i++ {
+		if !sleepCtx(ctx, liveCutPollInterval) {
+			return
+		}
+		if saveLiveCut(ctx, uid, liveID) {
+			return
+		}
+	}
+	log.Printf("uid为 %d 的主播的liveID为 %s 的直播下播后 %v 内没有生成直播剪辑，不再查询", uid, liveID, liveCutPollInterval*liveCutPollTries)
+}
+
+// 处理下播，获取并保存直播时长
+func handleLiveEnd(ctx context.Context, l *live) {
+	pending := notifyLiveEnd(l)
+	stop := stopRoomWatcher(ctx, l.liveID)
+	seeStreamerName(l.uid, l.name)
+	flushWrites()
+	// 直播剪辑可能在下播后才生成或重新生成
+	if saveLiveCut(ctx, l.uid, l.liveID) || !isWatched(l.uid) {
+		forgetTelegramCut(l.liveID)
+	} else {
+		uid, liveID := l.uid, l.liveID
+		liveWG.Add(1)
+		go func() {
+			defer liveWG.Done()
+			defer recoverCrash("waitLiveCut")
+			waitLiveCut(ctx, uid, liveID)
+		}()
+	}
+	if conf.SuggestTitle && strings.TrimSpace(l.title) == "" {
+		suggestTitle(ctx, l.uid, l.liveID)
+	}
+	recordFanClub(l.uid, l.liveID, store.FanClubEnd)
+	duration, err := getDuration(l.liveID)
+	if err != nil || duration == 0 {
+		duration = localDuration(l, stop)
+		if err != nil {
+			log.Printf("获取uid为 %d 的主播 %s 的liveID为 %s 的直播时长失败，使用本地计算的时长 %s：%v", l.uid, l.name, l.liveID,
+				(time.Duration(duration) * time.Millisecond).String(), err)
+		}
+	}
+	if duration != 0 {
+		updateLiveDuration(ctx, l.liveID, duration)
+	}
+	waitPlayback(l, duration)
+	// reconnectWindow内同一主播重新开播时不发送下播通知，开播时发送重连通知
+	if !pending.wait(ctx) {
+		return
+	}
+	hookLiveEnd(l, duration)
+	pushLiveEnd(l, duration)
+	matrixLiveEnd(l, duration)
+	sinkLiveEnd(l, duration)
+	commandHookLiveEnd(l, duration)
+}
+
+// 在本地计算直播时长，stop为直播间弹幕收到下播信号的时间，没有时以发现下播的时间为准，可能多出一个获取直播间列表的间隔
+func localDuration(l *live, stop int64) int64 {
+	end := stop
+	if end == 0 {
+		end = time.Now().UnixMilli()
+	}
+	if end <= l.startTime {
+		return 0
+	}
+	return end - l.startTime
+}
+
+// 获取直播时长，优先使用直播总结，失败时使用录播时长
+func getDuration(liveID store.LiveID) (duration int64, e error) {
+	err := summaryBreaker.run(func() error {
+		summary, err := ac.GetSummary(liveID.String())
+		if err != nil {
+			return err
+		}
+		duration = summary.Duration
+		return nil
+	})
+	if err == nil && duration != 0 {
+		return duration, nil
+	}
+	playback, e := getPlayback(liveID)
+	if e != nil {
+		if err != nil {
+			return 0, err
+		}
+		return 0, e
+	}
+	return playback.Duration, nil
+}
+
+// 启动时处理上次运行时没有获取到直播时长的直播，onLive为正在直播的liveID
+func recoverUnfinished(ctx context.Context, onLive map[store.LiveID]bool) {
+	const recoverDays = 7 // 只处理最近7天内开始的直播
+	since := time.Now().AddDate(0, 0, -recoverDays).UnixMilli()
+	lives, err := queryUnfinished(ctx, since)
+	if err != nil {
+		log.Printf("查询没有直播时长的直播出现错误：%v", err)
+		return
+	}
+
+	// 按liveID的顺序处理，中断后从上次处理到的直播继续
+	sort.Slice(lives, func(i, j int) bool { return lives[i].liveID < lives[j].liveID })
+	cursor := loadJobCursor(ctx, jobRecoverUnfinished)
+	var recovered, failed int
+	for _, l := range lives {
+		if onLive[l.liveID] || cursor.done(l.liveID.String()) {
+			// 还在直播的下播时会正常处理
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		duration, err := getDuration(l.liveID)
+		if err != nil || duration == 0 {
+			failed++
+			log.Printf("无法恢复uid为 %d 的主播 %s 的liveID为 %s 的直播时长：%v", l.uid, l.name, l.liveID, err)
+		} else {
+			updateLiveDuration(ctx, l.liveID, duration)
+			recovered++
+		}
+		cursor.save(l.liveID.String())
+	}
+	cursor.finish()
+	if recovered != 0 || failed != 0 {
+		log.Printf("已恢复 %d 场没有直播时长的直播，%d 场无法恢复", recovered, failed)
+	}
+}
+
+// 等待一段时间，ctx结束时返回false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
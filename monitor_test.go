@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"acfunlivedb/store"
+)
+
+func TestDiffLiveLists(t *testing.T) {
+	a := live{liveID: "a", uid: 1, name: "主播1", title: "标题", startTime: 1000}
+	b := live{liveID: "b", uid: 2, name: "主播2", title: "标题", startTime: 2000}
+	c := live{liveID: "c", uid: 3, name: "主播3", title: "标题", startTime: 3000}
+	changed := b
+	changed.title, changed.access, changed.name = "新标题", "paid", "新昵称"
+	d := live{liveID: "d", uid: 4, name: "主播4", startTime: 4000}
+
+	oldList := map[store.LiveID]live{"a": a, "b": b, "c": c}
+	newList := map[store.LiveID]live{"b": changed, "c": c, "d": d}
+	got := diffLiveLists(oldList, newList)
+	want := []monitorDecision{
+		{kind: decisionTitle, old: b, l: changed},
+		{kind: decisionAccess, old: b, l: changed},
+		{kind: decisionRename, old: b, l: changed},
+		{kind: decisionStart, l: d},
+		{kind: decisionEnd, old: a, l: a},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("处理为\n%+v\n应该为\n%+v", got, want)
+	}
+	// 两个列表不会被修改
+	if len(oldList) != 3 || len(newList) != 3 || oldList["b"].title != "标题" {
+		t.Errorf("对比时修改了列表：%v %v", oldList, newList)
+	}
+
+	// 启动时没有之前的列表，所有直播都是开播
+	got = diffLiveLists(nil, map[store.LiveID]live{"c": c, "a": a})
+	want = []monitorDecision{{kind: decisionStart, l: a}, {kind: decisionStart, l: c}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("处理为 %+v，应该为 %+v", got, want)
+	}
+
+	if got = diffLiveLists(oldList, oldList); len(got) != 0 {
+		t.Errorf("列表没有变化时不应该有处理：%+v", got)
+	}
+}
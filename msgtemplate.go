@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 默认的通知模板，和设置里的模板为空时使用
+const (
+	defaultTelegramStartTemplate    = `<b>{{html .Name}}</b> 开播了：{{html .Title}}` + "\n" + `<a href="{{html .RoomURL}}">进入直播间</a>`
+	defaultTelegramLiveCutTemplate  = `<b>{{html .Name}}</b> 的直播「{{html .Title}}」有直播剪辑了` + "\n" + `<a href="{{html .LiveCutURL}}">查看直播剪辑</a>`
+	defaultTelegramPlaybackTemplate = `<b>{{html .Name}}</b> 的直播「{{html .Title}}」的录播已经生成，直播时长 {{.Duration}}` + "\n" +
+		`<a href="{{html .PlaybackURL}}">录播</a>{{if .BackupURL}} <a href="{{html .BackupURL}}">录播备份</a>{{end}}`
+	defaultPushStartTitleTemplate   = `{{.Name}} 开播了`
+	defaultPushStartMessageTemplate = `{{.Title}}`
+	defaultPushEndTitleTemplate     = `{{.Name}} 下播了`
+	defaultPushEndMessageTemplate   = `{{.Title}}{{if .Duration}}` + "\n" + `直播时长 {{.Duration}}{{end}}`
+	defaultLiveHookStartTemplate    = `{{.Name}} 开播了`
+	defaultLiveHookEndTemplate      = `{{.Name}} 下播了`
+	defaultLiveHookPlaybackTemplate = `{{.Name}} 的录播已经生成`
+	defaultPushPlaybackTitle        = `{{.Name}} 的录播已经生成`
+	defaultPushPlaybackMessage      = `{{.Title}}` + "\n" + `直播时长 {{.Duration}}`
+	defaultOneBotStartTemplate      = `{{.Name}} 开播了：{{.Title}}` + "\n" + `{{.RoomURL}}`
+	defaultMatrixStartTemplate      = `{{.Name}} 开播了：{{.Title}}` + "\n" + `{{.RoomURL}}`
+	defaultMatrixEndTemplate        = `{{.Name}} 下播了：{{.Title}}{{if .Duration}}，直播时长 {{.Duration}}{{end}}`
+
+	// 重连通知默认的模板，设置了开播通知的模板时使用开播通知的模板
+	defaultTelegramReconnectTemplate  = `<b>{{html .Name}}</b> 断线后重新开播了：{{html .Title}}` + "\n" + `<a href="{{html .RoomURL}}">进入直播间</a>`
+	defaultPushReconnectTitleTemplate = `{{.Name}} 重新开播了`
+	defaultLiveHookReconnectTemplate  = `{{.Name}} 重新开播了`
+	defaultOneBotReconnectTemplate    = `{{.Name}} 断线后重新开播了：{{.Title}}` + "\n" + `{{.RoomURL}}`
+	defaultMatrixReconnectTemplate    = `{{.Name}} 断线后重新开播了：{{.Title}}` + "\n" + `{{.RoomURL}}`
+)
+
+// 各个通知的消息模板，使用Go的text/template语法，为空时使用默认的消息
+type templateConfig struct {
+	Telegram telegramTemplates `json:"telegram"` // Telegram通知的模板，生成的是HTML
+	Push     pushTemplates     `json:"push"`     // ntfy和Gotify推送的模板
+	LiveHook liveHookTemplates `json:"liveHook"` // discord和slack格式的webhook通知的标题的模板
+	OneBot   oneBotTemplates   `json:"oneBot"`   // QQ群通知的模板，生成的是纯文字
+	Matrix   matrixTemplates   `json:"matrix"`   // Matrix房间通知的模板，生成的是纯文字
+}
+
+// Telegram通知的模板
+type telegramTemplates struct {
+	Start    string `json:"start"`    // 开播通知
+	LiveCut  string `json:"liveCut"`  // 直播剪辑通知
+	Playback string `json:"playback"` // 录播通知
+}
+
+// ntfy和Gotify推送的模板
+type pushTemplates struct {
+	StartTitle   string `json:"startTitle"`   // 开播推送的标题
+	StartMessage string `json:"startMessage"` // 开播推送的内容
+	EndTitle     string `json:"endTitle"`     // 下播推送的标题
+	EndMessage   string `json:"endMessage"`   // 下播推送的内容
+
+	PlaybackTitle   string `json:"playbackTitle"`   // 录播生成推送的标题
+	PlaybackMessage string `json:"playbackMessage"` // 录播生成推送的内容
+}
+
+// discord和slack格式的webhook通知的标题的模板
+type liveHookTemplates struct {
+	Start    string `json:"start"`    // 开播通知的标题
+	End      string `json:"end"`      // 下播通知的标题
+	Playback string `json:"playback"` // 录播生成通知的标题
+}
+
+// QQ群通知的模板
+type oneBotTemplates struct {
+	Start string `json:"start"` // 开播通知
+}
+
+// Matrix房间通知的模板
+type matrixTemplates struct {
+	Start string `json:"start"` // 开播通知
+	End   string `json:"end"`   // 下播通知
+}
+
+// 模板可以使用的数据
+type templateData struct {
+	Event       string        // start、reconnect、end、liveCut或playback
+	LiveID      store.LiveID  // 直播ID
+	UID         store.UID     // 主播uid
+	Name        string        // 主播昵称
+	Title       string        // 直播间标题，没有时为建议标题或"无标题"
+	StartTime   time.Time     // 直播开始时间
+	Duration    time.Duration // 直播时长，开播时为0
+	RoomURL     string        // 直播间链接
+	LiveCutURL  string        // 直播剪辑链接，只在直播剪辑通知里有
+	PlaybackURL string        // 录播链接，只在录播通知和下播的webhook里有
+	BackupURL   string        // 录播备份链接，只在录播通知和下播的webhook里有
+}
+
+// 通知类型的中文名
+func templateEventName(event string) string {
+	return liveHookName(changeKind(event))
+}
+
+// 根据直播数据生成模板数据
+func newTemplateData(event string, l *live, duration int64) *templateData {
+	return &templateData{
+		Event:     event,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     liveTitle(l),
+		StartTime: time.UnixMilli(l.startTime),
+		Duration:  time.Duration(duration) * time.Millisecond,
+		RoomURL:   liveRoomURL(l.uid),
+	}
+}
+
+// 用模板生成消息，模板为空时使用默认模板，出错时打印错误并使用默认模板
+func renderTemplate(text, def string, data *templateData) string {
+	if text != "" {
+		s, err := executeTemplate(text, data)
+		if err == nil {
+			return s
+		}
+		log.Printf("使用通知模板出现错误，改为使用默认模板：%v", err)
+	}
+	// 默认模板不会出错
+	s, _ := executeTemplate(def, data)
+	return s
+}
+
+func executeTemplate(text string, data *templateData) (string, error) {
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err = t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// 检查设置里的模板能否正常使用，模板使用了不存在的字段时也会返回错误
+func (c *templateConfig) check() error {
+	data := &templateData{
+		Event:       "playback",
+		LiveID:      "liveID",
+		UID:         1,
+		Name:        "主播",
+		Title:       "标题",
+		StartTime:   time.Now(),
+		Duration:    time.Hour,
+		RoomURL:     liveRoomURL(1),
+		LiveCutURL:  "https://example.com/livecut",
+		PlaybackURL: "https://example.com/playback",
+		BackupURL:   "https://example.com/backup",
+	}
+	templates := []struct {
+		name, text string
+	}{
+		{"telegram.start", c.Telegram.Start},
+		{"telegram.liveCut", c.Telegram.LiveCut},
+		{"telegram.playback", c.Telegram.Playback},
+		{"push.startTitle", c.Push.StartTitle},
+		{"push.startMessage", c.Push.StartMessage},
+		{"push.endTitle", c.Push.EndTitle},
+		{"push.endMessage", c.Push.EndMessage},
+		{"push.playbackTitle", c.Push.PlaybackTitle},
+		{"push.playbackMessage", c.Push.PlaybackMessage},
+		{"liveHook.start", c.LiveHook.Start},
+		{"liveHook.end", c.LiveHook.End},
+		{"liveHook.playback", c.LiveHook.Playback},
+		{"oneBot.start", c.OneBot.Start},
+		{"matrix.start", c.Matrix.Start},
+		{"matrix.end", c.Matrix.End},
+	}
+	for _, t := range templates {
+		if t.text == "" {
+			continue
+		}
+		if _, err := executeTemplate(t.text, data); err != nil {
+			return fmt.Errorf("模板 templates.%s 有错误：%w", t.name, err)
+		}
+	}
+	return nil
+}
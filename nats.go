@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNATSPort = "4222"           // NATS的默认端口
+	natsTimeout     = 10 * time.Second // 等待NATS服务器响应的时间
+)
+
+// 只支持发布消息和等待JetStream确认的NATS客户端，协议见https://docs.nats.io/reference/reference-protocols/nats-protocol
+type natsConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string // 接收JetStream确认的主题前缀
+	seq   int    // 下一条消息的确认主题的序号
+}
+
+// NATS服务器连接后发送的INFO
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// JetStream的发布确认
+type natsPubAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// 连接NATS服务器并订阅接收确认的主题
+func dialNATS(ctx context.Context, c *natsSinkConfig) (*natsConn, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	useTLS := u.Scheme == "tls"
+	if u.Scheme != "nats" && !useTLS {
+		return nil, fmt.Errorf("不支持的地址 %s，需要以nats://或tls://开头", c.URL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultNATSPort)
+	}
+	dialer := &net.Dialer{Timeout: natsTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	nc := &natsConn{conn: conn, r: bufio.NewReader(conn)}
+	if err = nc.handshake(c, u, useTLS); err != nil {
+		nc.close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+func (nc *natsConn) handshake(c *natsSinkConfig, u *url.URL, useTLS bool) error {
+	nc.conn.SetDeadline(time.Now().Add(natsTimeout))
+	line, err := nc.readLine()
+	if err != nil {
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("服务器没有发送INFO：%s", line)
+	}
+	var info natsInfo
+	if err = json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("解析INFO失败：%w", err)
+	}
+	if useTLS || info.TLSRequired {
+		tc := tls.Client(nc.conn, &tls.Config{ServerName: u.Hostname()})
+		if err = tc.Handshake(); err != nil {
+			return err
+		}
+		nc.conn = tc
+		nc.r = bufio.NewReader(tc)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "acfunlivedb",
+		"lang":     "go",
+		"version":  version,
+		"protocol": 1,
+	}
+	if c.Token != "" {
+		connect["auth_token"] = c.Token
+	}
+	if c.User != "" {
+		connect["user"] = c.User
+		connect["pass"] = c.Password
+	}
+	data, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	nc.inbox = "_INBOX." + hex.EncodeToString(b)
+	if _, err = fmt.Fprintf(nc.conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", data, nc.inbox); err != nil {
+		return err
+	}
+	// 认证失败时服务器在PONG之前返回-ERR
+	for {
+		if line, err = nc.readLine(); err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// 发布消息并等待JetStream的确认，没有stream包含subject时返回错误
+func (nc *natsConn) publish(subject string, payload []byte) error {
+	nc.seq++
+	reply := nc.inbox + "." + strconv.Itoa(nc.seq)
+	nc.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := fmt.Fprintf(nc.conn, "PUB %s %s %d\r\n%s\r\n", subject, reply, len(payload), payload); err != nil {
+		return err
+	}
+	for {
+		line, err := nc.readLine()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return fmt.Errorf("主题 %s 没有收到JetStream的确认，需要有stream包含这个主题", subject)
+			}
+			return err
+		}
+		switch {
+		case line == "PING":
+			if _, err = io.WriteString(nc.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				return fmt.Errorf("无法解析的消息：%s", line)
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("无法解析的消息：%s", line)
+			}
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(nc.r, data); err != nil {
+				return err
+			}
+			// 忽略之前超时的消息的确认
+			if fields[1] != reply {
+				continue
+			}
+			var ack natsPubAck
+			if err = json.Unmarshal(data[:size], &ack); err != nil {
+				return fmt.Errorf("解析JetStream的确认失败：%w", err)
+			}
+			if ack.Error != nil {
+				return fmt.Errorf("JetStream返回错误 %d：%s", ack.Error.Code, ack.Error.Description)
+			}
+			return nil
+		}
+	}
+}
+
+// 读取一行，去掉结尾的\r\n
+func (nc *natsConn) readLine() (string, error) {
+	line, err := nc.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (nc *natsConn) close() {
+	nc.conn.Close()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const defaultReconnectWindow = 180 // 默认合并重连通知的时间，单位为秒
+
+// 等待发送的下播通知
+type pendingEnd struct {
+	live        live
+	timer       *time.Timer
+	decided     chan struct{} // 超过reconnectWindow或者同一主播重新开播时关闭
+	reconnected bool          // 是否在reconnectWindow内重新开播，decided关闭后才能读取
+}
+
+// 等待发送的下播通知，key为主播uid
+var pendingEnds = struct {
+	sync.Mutex
+	m map[store.UID]*pendingEnd
+}{m: make(map[store.UID]*pendingEnd)}
+
+// 发送开播事件，同一主播在reconnectWindow内下播又开播时改为发送一条重连事件，
+// 返回是否为重连和下播的直播的liveID，重连时只发送重连通知，不发送开播通知
+func notifyLiveStart(l *live) (prev store.LiveID, reconnect bool) {
+	// l可能是循环变量，订阅者处理时已经改变
+	started := *l
+	l = &started
+	pendingEnds.Lock()
+	p, ok := pendingEnds.m[l.uid]
+	if ok {
+		delete(pendingEnds.m, l.uid)
+	}
+	pendingEnds.Unlock()
+	// Stop返回false时下播通知已经发送
+	if ok && p.timer.Stop() {
+		p.reconnected = true
+		close(p.decided)
+		log.Printf("uid为 %d 的主播 %s 下播后很快重新开播，liveID从 %s 变为 %s", l.uid, l.name, p.live.liveID, l.liveID)
+		broadcastEvent(liveEvent{Type: changeReconnect, Live: l})
+		return p.live.liveID, true
+	}
+	broadcastEvent(liveEvent{Type: changeStart, Live: l})
+	return "", false
+}
+
+// 发送下播事件，reconnectWindow大于0时等待这段时间，期间同一主播没有重新开播才发送。
+// 对外的下播通知在wait返回true后发送
+func notifyLiveEnd(l *live) *pendingEnd {
+	p := &pendingEnd{live: *l, decided: make(chan struct{})}
+	if conf.ReconnectWindow <= 0 {
+		close(p.decided)
+		broadcastEvent(liveEvent{Type: changeEnd, Live: &p.live})
+		return p
+	}
+	pendingEnds.Lock()
+	defer pendingEnds.Unlock()
+	if old, ok := pendingEnds.m[l.uid]; ok && old.timer.Stop() {
+		// 同一主播同时有多场直播下播时不合并
+		close(old.decided)
+		broadcastEvent(liveEvent{Type: changeEnd, Live: &old.live})
+	}
+	p.timer = time.AfterFunc(time.Duration(conf.ReconnectWindow)*time.Second, func() {
+		pendingEnds.Lock()
+		if pendingEnds.m[p.live.uid] == p {
+			delete(pendingEnds.m, p.live.uid)
+		}
+		pendingEnds.Unlock()
+		close(p.decided)
+		broadcastEvent(liveEvent{Type: changeEnd, Live: &p.live})
+	})
+	pendingEnds.m[l.uid] = p
+	return p
+}
+
+// 等待reconnectWindow结束，返回是否需要发送下播通知，同一主播重新开播时为false。
+// 本程序退出时不再等待，直接发送
+func (p *pendingEnd) wait(ctx context.Context) bool {
+	select {
+	case <-p.decided:
+		return !p.reconnected
+	case <-ctx.Done():
+		return true
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 设置reconnectWindow，测试结束时恢复
+func setReconnectWindow(t *testing.T, window int) {
+	t.Helper()
+	old := conf.ReconnectWindow
+	conf.ReconnectWindow = window
+	t.Cleanup(func() { conf.ReconnectWindow = old })
+}
+
+// 等待的结果，超时时失败
+func waitPendingEnd(t *testing.T, ctx context.Context, p *pendingEnd) bool {
+	t.Helper()
+	result := make(chan bool, 1)
+	go func() { result <- p.wait(ctx) }()
+	select {
+	case ok := <-result:
+		return ok
+	case <-time.After(time.Second):
+		t.Fatal("等待下播通知没有返回")
+		return false
+	}
+}
+
+func TestReconnectSuppressesEnd(t *testing.T) {
+	setReconnectWindow(t, 60)
+	ctx := context.Background()
+
+	// 同一主播很快重新开播时不发送下播和开播通知
+	a := live{liveID: "a", uid: 1, name: "主播1"}
+	b := live{liveID: "b", uid: 1, name: "主播1"}
+	p := notifyLiveEnd(&a)
+	prev, reconnect := notifyLiveStart(&b)
+	if !reconnect || prev != "a" {
+		t.Errorf("重新开播时是否重连为 %v，下播的直播为 %q", reconnect, prev)
+	}
+	if waitPendingEnd(t, ctx, p) {
+		t.Error("重连时发送了下播通知")
+	}
+
+	// 其他主播开播时不影响
+	c := live{liveID: "c", uid: 2}
+	d := live{liveID: "d", uid: 3}
+	p = notifyLiveEnd(&c)
+	if _, reconnect = notifyLiveStart(&d); reconnect {
+		t.Error("其他主播开播时当作重连")
+	}
+	// 同一主播同时有多场直播下播时，之前的下播通知马上发送
+	e := live{liveID: "e", uid: 2}
+	pe := notifyLiveEnd(&e)
+	if !waitPendingEnd(t, ctx, p) {
+		t.Error("同一主播的另一场直播下播时没有发送之前的下播通知")
+	}
+	// 本程序退出时不再等待
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if !waitPendingEnd(t, cancelled, pe) {
+		t.Error("退出时没有发送下播通知")
+	}
+	pendingEnds.Lock()
+	if q, ok := pendingEnds.m[2]; ok {
+		q.timer.Stop()
+		delete(pendingEnds.m, 2)
+	}
+	pendingEnds.Unlock()
+
+	// 不合并时马上发送
+	setReconnectWindow(t, 0)
+	p = notifyLiveEnd(&a)
+	if !waitPendingEnd(t, ctx, p) {
+		t.Error("不合并时没有发送下播通知")
+	}
+	if _, reconnect = notifyLiveStart(&b); reconnect {
+		t.Error("不合并时当作重连")
+	}
+}
+
+func TestReconnectHookEvent(t *testing.T) {
+	l := &live{liveID: "b", uid: 1, name: "主播", title: "标题", startTime: 1000}
+	hook := &liveHookJSON{Event: changeReconnect, LiveID: l.liveID, UID: l.uid, Name: l.name, Title: l.title, StartTime: l.startTime, PreviousLiveID: store.LiveID("a")}
+	if got := commandHookCommand(changeReconnect); got != conf.CommandHook.OnLiveStart {
+		t.Errorf("重连时运行 %q，应该运行开播时的命令", got)
+	}
+	env := commandHookEnv(hook)
+	var prev, duration bool
+	for _, s := range env {
+		prev = prev || s == "ACFUNLIVEDB_PREVIOUS_LIVE_ID=a"
+		duration = duration || strings.HasPrefix(s, "ACFUNLIVEDB_DURATION=")
+	}
+	if !prev || duration {
+		t.Errorf("重连时命令的环境变量为 %v", env)
+	}
+	if got, want := liveHookTitle(hook), "主播 重新开播了"; got != want {
+		t.Errorf("重连通知的标题为 %q，应该为 %q", got, want)
+	}
+}
+
+func TestCommandHookMaxAge(t *testing.T) {
+	ctx := context.Background()
+	s := useTestDB(t)
+	old := conf.CommandHook
+	conf.CommandHook = commandHookConfig{OnLiveStart: "/不存在的命令", MaxAge: 600}
+	t.Cleanup(func() { conf.CommandHook = old })
+
+	payload := `{"event":"start","liveID":"a","uid":1}`
+	now := time.Now().UnixMilli()
+	if _, err := s.WriteBatch(ctx, []store.Write{
+		store.NotifyWrite("commandHook", 1, "a", payload, now-time.Hour.Milliseconds()),
+		store.NotifyWrite("commandHook", 1, "b", payload, now),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deliverNotifications(ctx)
+
+	// 过期的事件不运行直接删除，没有过期的事件运行失败后等待重试
+	list, err := s.QueryNotifications(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].LiveID != "b" || list[0].Attempts != 1 {
+		t.Errorf("剩下的通知为 %+v，应该只剩下没有过期的通知", list)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 通知的安静时段和频率限制，每个通知目标分别设置
+type notifyLimit struct {
+	QuietHours  string `json:"quietHours"`  // 不发送通知的时间段，本地时间，格式为"23:00-07:00"，可以跨过午夜，为空时不限制
+	MinInterval int    `json:"minInterval"` // 同一主播的两次通知之间的最短间隔，单位为分钟，间隔内的通知不发送，小于等于0时不限制
+}
+
+// 每个通知目标最后一次给每个主播发送通知的时间，key为目标和主播uid
+var notifySent = struct {
+	sync.Mutex
+	m map[notifyKey]time.Time
+}{m: make(map[notifyKey]time.Time)}
+
+type notifyKey struct {
+	target string
+	uid    store.UID
+}
+
+// 解析quietHours，返回开始和结束时间在一天里的分钟数
+func parseQuietHours(s string) (start, end int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("quietHours %s 的格式不是\"23:00-07:00\"", s)
+	}
+	if start, err = parseClock(strings.TrimSpace(from)); err != nil {
+		return 0, 0, fmt.Errorf("quietHours %s 的格式不是\"23:00-07:00\"", s)
+	}
+	if end, err = parseClock(strings.TrimSpace(to)); err != nil {
+		return 0, 0, fmt.Errorf("quietHours %s 的格式不是\"23:00-07:00\"", s)
+	}
+	return start, end, nil
+}
+
+// 解析15:04格式的时间，返回在一天里的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// now是否在安静时段里
+func (n *notifyLimit) quiet(now time.Time) bool {
+	if n.QuietHours == "" {
+		return false
+	}
+	start, end, err := parseQuietHours(n.QuietHours)
+	if err != nil {
+		// 读取设置时已经检查过
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// 是否可以给target发送主播的通知，可以发送时记录发送时间。name为打印日志时的通知名
+func (n *notifyLimit) allow(target string, uid store.UID, name string) bool {
+	now := time.Now()
+	if n.quiet(now) {
+		log.Printf("%s 在安静时段 %s 内，不发送uid为 %d 的主播的%s", target, n.QuietHours, uid, name)
+		return false
+	}
+	if n.MinInterval <= 0 {
+		return true
+	}
+	key := notifyKey{target: target, uid: uid}
+	notifySent.Lock()
+	defer notifySent.Unlock()
+	if last, ok := notifySent.m[key]; ok && now.Sub(last) < time.Duration(n.MinInterval)*time.Minute {
+		log.Printf("%s 在 %d 分钟内已经发送过uid为 %d 的主播的通知，不发送%s", target, n.MinInterval, uid, name)
+		return false
+	}
+	notifySent.m[key] = now
+	return true
+}
+
+// 检查所有通知目标的quietHours
+func (c *config) checkNotifyLimits() error {
+	limits := map[string]notifyLimit{
+		"telegram":    c.Telegram.Limit,
+		"push.ntfy":   c.Push.Ntfy.Limit,
+		"push.gotify": c.Push.Gotify.Limit,
+		"desktop":     c.Desktop.Limit,
+		"oneBot":      c.OneBot.Limit,
+		"matrix":      c.Matrix.Limit,
+	}
+	for i, t := range c.LiveHook.Targets {
+		limits[fmt.Sprintf("liveHook.targets[%d]", i)] = t.Limit
+	}
+	for name, l := range limits {
+		if l.QuietHours == "" {
+			continue
+		}
+		if _, _, err := parseQuietHours(l.QuietHours); err != nil {
+			return fmt.Errorf("%s.limit的%w", name, err)
+		}
+	}
+	return nil
+}
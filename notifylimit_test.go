@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	for _, tt := range []struct {
+		s          string
+		start, end int
+	}{
+		{"23:00-07:00", 23 * 60, 7 * 60},
+		{"08:30-12:15", 8*60 + 30, 12*60 + 15},
+		{" 00:00 - 23:59 ", 0, 23*60 + 59},
+	} {
+		start, end, err := parseQuietHours(tt.s)
+		if err != nil || start != tt.start || end != tt.end {
+			t.Errorf("parseQuietHours(%q) = %d, %d, %v，应该为 %d, %d", tt.s, start, end, err, tt.start, tt.end)
+		}
+	}
+	for _, s := range []string{"", "23:00", "23:00-", "24:00-07:00", "23:00-7", "晚上-早上"} {
+		if _, _, err := parseQuietHours(s); err == nil {
+			t.Errorf("parseQuietHours(%q) 应该返回错误", s)
+		}
+	}
+}
+
+func TestNotifyLimitQuiet(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.Local)
+	}
+	for _, tt := range []struct {
+		quietHours string
+		now        time.Time
+		want       bool
+	}{
+		{"", at(3, 0), false},
+		// 跨过午夜
+		{"23:00-07:00", at(23, 0), true},
+		{"23:00-07:00", at(3, 0), true},
+		{"23:00-07:00", at(7, 0), false},
+		{"23:00-07:00", at(12, 0), false},
+		// 同一天里
+		{"12:00-14:00", at(12, 30), true},
+		{"12:00-14:00", at(11, 59), false},
+		{"12:00-14:00", at(14, 0), false},
+	} {
+		n := notifyLimit{QuietHours: tt.quietHours}
+		if got := n.quiet(tt.now); got != tt.want {
+			t.Errorf("quietHours为 %q 时 %s 是否安静为 %v，应该为 %v", tt.quietHours, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	notifyBatchSize    = 50               // 每次发送的通知数量
+	notifyPollInterval = 5 * time.Second  // 没有被唤醒时检查等待发送的通知的间隔
+	notifyFirstRetry   = 10 * time.Second // 第一次发送失败后重试的间隔，之后每次翻倍
+	notifyMaxBackoff   = 30 * time.Minute // 发送失败后重试的最长间隔
+	notifyMaxAttempts  = 10               // 最多发送的次数，都失败时放弃
+)
+
+// 通知目标的设置已经关闭，不再发送
+var errNotifyDisabled = errors.New("通知目标的设置已经关闭")
+
+// 各个通知目标的发送函数，payload为保存通知时的JSON
+var notifySenders = map[string]func(payload []byte) error{
+	"telegram":    sendTelegramPayload,
+	"ntfy":        sendNtfyPayload,
+	"gotify":      sendGotifyPayload,
+	"oneBot":      sendOneBotPayload,
+	"matrix":      sendMatrixPayload,
+	"liveHook":    sendLiveHookPayload,
+	"tenantHook":  sendTenantHookPayload,
+	"commandHook": sendCommandHookPayload,
+}
+
+// 通知目标的通知过期的时间，过期的通知不再发送，返回值小于等于0时不限制，没有的通知目标不会过期
+var notifyMaxAges = map[string]func() time.Duration{
+	"commandHook": commandHookMaxAge,
+}
+
+// 通知保存到数据库后唤醒notifyCycle，不用等到下一次检查
+var notifyWake = make(chan struct{}, 1)
+
+// 把发送到target的通知保存到数据库，由notifyCycle发送，网络暂时不可用时不会丢失通知
+func queueNotification(target string, uid store.UID, liveID store.LiveID, payload interface{}) {
+	data, err := json.Marshal(payload)
+	checkErr(err)
+	queueWrite(fmt.Sprintf("保存发送到%s的通知", target), func([]int64) {
+		select {
+		case notifyWake <- struct{}{}:
+		default:
+		}
+	}, store.NotifyWrite(target, uid, liveID, string(data), time.Now().UnixMilli()))
+}
+
+// 发送数据库里等待发送的通知，失败时按指数退避重试，本程序重启后继续发送
+func notifyCycle(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-notifyWake:
+		case <-timer.C:
+		}
+		for deliverNotifications(ctx) == notifyBatchSize && ctx.Err() == nil {
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(notifyPollInterval)
+	}
+}
+
+// 发送一批到了发送时间的通知，返回查询到的通知数量
+func deliverNotifications(ctx context.Context) int {
+	list, err := db.QueryDueNotifications(ctx, time.Now().UnixMilli(), notifyBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("查询等待发送的通知出现错误：%v", err)
+		}
+		return 0
+	}
+	for _, n := range list {
+		if ctx.Err() != nil {
+			return 0
+		}
+		deliverNotification(ctx, &n)
+	}
+	return len(list)
+}
+
+// 发送一个通知，成功、放弃或过期时删除，失败时记录下次重试的时间
+func deliverNotification(ctx context.Context, n *store.Notification) {
+	if maxAge, ok := notifyMaxAges[n.Target]; ok {
+		if d := maxAge(); d > 0 && time.Since(time.UnixMilli(n.CreateTime)) > d {
+			log.Printf("发送到%s的liveID为 %s 的通知已经产生超过 %v，不再发送", n.Target, n.LiveID, d)
+			if err := db.DeleteNotification(ctx, n.ID); err != nil {
+				log.Printf("删除过期的通知出现错误：%v", err)
+			}
+			return
+		}
+	}
+	send, ok := notifySenders[n.Target]
+	err := errNotifyDisabled
+	if ok {
+		err = send([]byte(n.Payload))
+	}
+	attempts := n.Attempts + 1
+	switch {
+	case err == nil:
+		if attempts > 1 {
+			log.Printf("第 %d 次发送到%s的liveID为 %s 的通知成功", attempts, n.Target, n.LiveID)
+		}
+	case errors.Is(err, errNotifyDisabled):
+		log.Printf("%s的通知已经关闭，不再发送liveID为 %s 的通知", n.Target, n.LiveID)
+	case attempts >= notifyMaxAttempts:
+		log.Printf("发送到%s的liveID为 %s 的通知失败 %d 次，放弃发送：%v", n.Target, n.LiveID, attempts, err)
+	default:
+		backoff := notifyFirstRetry << (attempts - 1)
+		if backoff > notifyMaxBackoff {
+			backoff = notifyMaxBackoff
+		}
+		log.Printf("发送到%s的liveID为 %s 的通知失败，%v 后重试：%v", n.Target, n.LiveID, backoff, err)
+		if err = db.DelayNotification(ctx, n.ID, time.Now().Add(backoff).UnixMilli(), err.Error()); err != nil {
+			log.Printf("记录通知发送失败出现错误：%v", err)
+		}
+		return
+	}
+	if err := db.DeleteNotification(ctx, n.ID); err != nil {
+		log.Printf("删除已经发送的通知出现错误：%v", err)
+	}
+}
+
+// 打印等待发送的通知
+func printNotifications(ctx context.Context) {
+	list, err := db.QueryNotifications(ctx)
+	if err != nil {
+		log.Printf("查询等待发送的通知出现错误：%v", err)
+		return
+	}
+	if len(list) == 0 {
+		log.Println("没有等待发送的通知")
+		return
+	}
+	for _, n := range list {
+		fmt.Printf("目标：%s 主播uid：%d liveID：%s 产生时间：%s 失败次数：%d 下次发送：%s",
+			n.Target, n.UID, n.LiveID, time.UnixMilli(n.CreateTime).Format(timeLayout), n.Attempts, time.UnixMilli(n.NextTime).Format(timeLayout))
+		if n.LastError != "" {
+			fmt.Printf(" 上次的错误：%s", n.LastError)
+		}
+		fmt.Println()
+	}
+}
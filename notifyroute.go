@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"acfunlivedb/store"
+)
+
+// 通知路由的通知目标名
+const (
+	routeTelegram = "telegram"
+	routeNtfy     = "ntfy"
+	routeGotify   = "gotify"
+	routeOneBot   = "oneBot"
+	routeMatrix   = "matrix"
+	routeDesktop  = "desktop"
+	routeLiveHook = "liveHook" // 所有liveHook的webhook，"liveHook:名字"为liveHook.targets里指定名字的webhook
+)
+
+// 按主播把通知发送到指定的通知目标的设置，rules为空时通知发送到所有设置的通知目标
+type notifyRouteConfig struct {
+	Rules   []notifyRule `json:"rules"`   // 按顺序匹配的规则，使用第一条匹配的规则的通知目标
+	Default []string     `json:"default"` // 没有规则匹配时的通知目标，为空时不发送通知
+}
+
+// 通知路由的规则，uids和titleRegex都设置时需要同时匹配
+type notifyRule struct {
+	UIDs       []store.UID `json:"uids"`       // 匹配的主播uid，为空时匹配所有主播
+	TitleRegex string      `json:"titleRegex"` // 匹配直播间标题的正则表达式，为空时匹配所有标题
+	Targets    []string    `json:"targets"`    // 匹配时的通知目标，为空时不发送通知
+}
+
+// 规则是否匹配主播uid和直播间标题
+func (r *notifyRule) match(uid store.UID, title string) bool {
+	if len(r.UIDs) != 0 {
+		found := false
+		for _, u := range r.UIDs {
+			if u == uid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.TitleRegex == "" {
+		return true
+	}
+	re, err := regexp.Compile(r.TitleRegex)
+	if err != nil {
+		// 读取设置时已经检查过
+		return false
+	}
+	return re.MatchString(title)
+}
+
+// 主播uid和直播间标题对应的通知目标，没有设置规则时返回nil和false
+func (c *notifyRouteConfig) targets(uid store.UID, title string) ([]string, bool) {
+	if len(c.Rules) == 0 {
+		return nil, false
+	}
+	for i := range c.Rules {
+		if c.Rules[i].match(uid, title) {
+			return c.Rules[i].Targets, true
+		}
+	}
+	return c.Default, true
+}
+
+// 是否把主播的通知发送到target
+func notifyRouted(target string, uid store.UID, title string) bool {
+	targets, ok := conf.NotifyRoutes.targets(uid, title)
+	if !ok {
+		return true
+	}
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否把主播的通知发送到liveHook的webhook t
+func liveHookRouted(t *liveHookTarget, uid store.UID, title string) bool {
+	return notifyRouted(routeLiveHook, uid, title) || (t.Name != "" && notifyRouted(routeLiveHook+":"+t.Name, uid, title))
+}
+
+// 检查通知路由的正则表达式和通知目标
+func (c *config) checkNotifyRoutes() error {
+	names := map[string]bool{
+		routeTelegram: true,
+		routeNtfy:     true,
+		routeGotify:   true,
+		routeOneBot:   true,
+		routeMatrix:   true,
+		routeDesktop:  true,
+		routeLiveHook: true,
+	}
+	for i, t := range c.LiveHook.Targets {
+		if t.Name == "" {
+			continue
+		}
+		name := routeLiveHook + ":" + t.Name
+		if names[name] {
+			return fmt.Errorf("liveHook.targets[%d]的名字 %s 重复", i, t.Name)
+		}
+		names[name] = true
+	}
+	check := func(field string, targets []string) error {
+		for _, t := range targets {
+			if !names[t] {
+				return fmt.Errorf("%s的通知目标 %s 不存在，可以是 %s，或者 %s: 加上liveHook.targets里的名字",
+					field, t, strings.Join([]string{routeTelegram, routeNtfy, routeGotify, routeOneBot, routeMatrix, routeDesktop, routeLiveHook}, "、"), routeLiveHook)
+			}
+		}
+		return nil
+	}
+	for i, r := range c.NotifyRoutes.Rules {
+		field := fmt.Sprintf("notifyRoutes.rules[%d]", i)
+		if r.TitleRegex != "" {
+			if _, err := regexp.Compile(r.TitleRegex); err != nil {
+				return fmt.Errorf("%s的titleRegex有错误：%w", field, err)
+			}
+		}
+		if err := check(field, r.Targets); err != nil {
+			return err
+		}
+	}
+	return check("notifyRoutes.default", c.NotifyRoutes.Default)
+}
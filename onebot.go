@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// OneBot v11协议的QQ机器人（如go-cqhttp、NapCat、LLOneBot）通知的设置
+type oneBotConfig struct {
+	API      string      `json:"api"`                 // OneBot的HTTP API地址，为空时不发送通知
+	Token    string      `json:"token" secret:"true"` // OneBot设置的access token，为空时不鉴权
+	GroupIDs []int64     `json:"groupIDs"`            // 接收通知的QQ群号
+	AtAll    bool        `json:"atAll"`               // 通知时是否@全体成员，机器人需要是管理员
+	Limit    notifyLimit `json:"limit"`               // 安静时段和频率限制
+}
+
+// OneBot的消息段
+type oneBotSegment struct {
+	Type string            `json:"type"`
+	Data map[string]string `json:"data"`
+}
+
+// 发送开播通知到设置的所有QQ群，只通知关注的主播
+func oneBotLiveStart(l *live) {
+	oneBotStartNotify(l, "start", defaultOneBotStartTemplate)
+}
+
+// 发送重连通知，设置了开播通知的模板时使用这个模板，模板里可以用.Event区分
+func oneBotLiveReconnect(l *live) {
+	oneBotStartNotify(l, "reconnect", defaultOneBotReconnectTemplate)
+}
+
+func oneBotStartNotify(l *live, event, def string) {
+	c := conf.OneBot
+	if c.API == "" || len(c.GroupIDs) == 0 || !isWatched(l.uid) || !notifyRouted(routeOneBot, l.uid, l.title) {
+		return
+	}
+	if !c.Limit.allow("QQ", l.uid, templateEventName(event)+"通知") {
+		return
+	}
+	text := renderTemplate(conf.Templates.OneBot.Start, def, newTemplateData(event, l, 0))
+	// 使用消息段发送，文字里的[和]不会被当作CQ码
+	message := []oneBotSegment{{Type: "text", Data: map[string]string{"text": text}}}
+	if c.AtAll {
+		message = append([]oneBotSegment{
+			{Type: "at", Data: map[string]string{"qq": "all"}},
+			{Type: "text", Data: map[string]string{"text": " "}},
+		}, message...)
+	}
+	for _, groupID := range c.GroupIDs {
+		queueNotification("oneBot", l.uid, l.liveID, &oneBotPayload{GroupID: groupID, Message: message})
+	}
+}
+
+// 保存到通知队列的QQ群消息
+type oneBotPayload struct {
+	GroupID int64           `json:"groupID"`
+	Message []oneBotSegment `json:"message"`
+}
+
+// 发送通知队列里的QQ群消息
+func sendOneBotPayload(payload []byte) error {
+	if conf.OneBot.API == "" {
+		return errNotifyDisabled
+	}
+	var p oneBotPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return postOneBot(p.GroupID, p.Message)
+}
+
+// 调用OneBot的send_group_msg
+func postOneBot(groupID int64, message []oneBotSegment) error {
+	body, err := json.Marshal(struct {
+		GroupID int64           `json:"group_id"`
+		Message []oneBotSegment `json:"message"`
+	}{groupID, message})
+	checkErr(err)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(strings.TrimSuffix(conf.OneBot.API, "/") + "/send_group_msg")
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	if conf.OneBot.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.OneBot.Token)
+	}
+	req.SetBody(body)
+	if err := client.Do(req, resp); err != nil {
+		return err
+	}
+	var result struct {
+		Status  string `json:"status"`
+		RetCode int    `json:"retcode"`
+		Message string `json:"message"`
+		Wording string `json:"wording"`
+	}
+	// retcode为1表示已经加入异步发送的队列
+	if err := json.Unmarshal(resp.Body(), &result); err != nil || result.Status == "failed" || (result.RetCode != 0 && result.RetCode != 1) {
+		msg := result.Wording
+		if msg == "" {
+			msg = result.Message
+		}
+		if msg == "" {
+			msg = strings.TrimSpace(string(resp.Body()))
+		}
+		return fmt.Errorf("OneBot返回状态码 %d，retcode为 %d：%s", resp.StatusCode(), result.RetCode, msg)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// OpenAPI文档里的JSON对象
+type jsonObject = map[string]interface{}
+
+// API出错时返回的JSON，和writeError返回的一致
+type errorJSON struct {
+	Error string `json:"error"` // 错误信息
+}
+
+// 根据Go类型生成JSON Schema，结构体的字段名使用json标签，有omitempty或为指针的字段不是必需的
+func jsonSchema(t reflect.Type) jsonObject {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int64:
+		return jsonObject{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return jsonObject{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := jsonObject{}
+		var required []string
+		addStructFields(t, props, &required)
+		schema := jsonObject{"type": "object", "properties": props}
+		if len(required) != 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interface{}可以是任何值
+		return jsonObject{}
+	}
+}
+
+// 把结构体的字段加到properties里，嵌入的结构体的字段会展开
+func addStructFields(t reflect.Type, props jsonObject, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if field.Anonymous && tag[0] == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			addStructFields(ft, props, required)
+			continue
+		}
+		if !field.IsExported() || tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		props[name] = jsonSchema(field.Type)
+		omitempty := false
+		for _, opt := range tag[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// 引用components里的schema
+func schemaRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+// 返回JSON的响应
+func jsonResponse(desc string, schema jsonObject) jsonObject {
+	return jsonObject{"description": desc, "content": jsonObject{"application/json": jsonObject{"schema": schema}}}
+}
+
+// 出错时的响应
+func errorResponse(desc string) jsonObject {
+	return jsonResponse(desc, schemaRef("Error"))
+}
+
+// 查询参数或路径参数
+func openAPIParam(in, name, desc string, schema jsonObject) jsonObject {
+	return jsonObject{"name": name, "in": in, "description": desc, "required": in == "path", "schema": schema}
+}
+
+// 生成REST API、RSS和日历的OpenAPI 3.0文档
+func openAPIDoc() jsonObject {
+	str := jsonObject{"type": "string"}
+	integer := jsonObject{"type": "integer"}
+	uidPath := openAPIParam("path", "uid", "主播uid", integer)
+	arrayOf := func(name string) jsonObject {
+		return jsonObject{"type": "array", "items": schemaRef(name)}
+	}
+	sessionParams := []jsonObject{
+		openAPIParam("query", "uid", "主播uid", integer),
+		openAPIParam("query", "from", "开播时间不早于这个时间，可以是毫秒时间戳或日期（格式为2006-01-02）", str),
+		openAPIParam("query", "to", "开播时间早于这个时间，可以是毫秒时间戳或日期（包括当天）", str),
+		openAPIParam("query", "title", "直播间标题含有的关键词", str),
+		openAPIParam("query", "sort", "排序的列", jsonObject{"type": "string", "enum": []string{"startTime", "duration"}, "default": "startTime"}),
+		openAPIParam("query", "order", "排列顺序", jsonObject{"type": "string", "enum": []string{"desc", "asc"}, "default": "desc"}),
+		openAPIParam("query", "limit", "最多返回的数量", jsonObject{"type": "integer", "minimum": 1, "maximum": apiMaxLimit, "default": apiDefaultLimit}),
+		openAPIParam("query", "offset", "跳过前面的数量，用于分页", jsonObject{"type": "integer", "minimum": 0, "default": 0}),
+	}
+
+	paths := jsonObject{
+		"/api/sessions": jsonObject{"get": jsonObject{
+			"operationId": "listSessions",
+			"summary":     "查询直播列表，默认按开播时间降序排列",
+			"parameters":  sessionParams,
+			"responses": jsonObject{
+				"200": jsonResponse("直播列表", arrayOf("Session")),
+				"400": errorResponse("参数不正确"),
+			},
+		}},
+		"/api/sessions/{liveID}": jsonObject{"get": jsonObject{
+			"operationId": "getSession",
+			"summary":     "查询单场直播和直播间标题的变更记录",
+			"parameters":  []jsonObject{openAPIParam("path", "liveID", "直播ID", str)},
+			"responses": jsonObject{
+				"200": jsonResponse("直播数据", schemaRef("SessionDetail")),
+				"404": errorResponse("直播不存在"),
+			},
+		}},
+		"/api/streamers": jsonObject{"get": jsonObject{
+			"operationId": "listStreamers",
+			"summary":     "查询所有主播最近使用的昵称，有q参数时查询用过含有q的昵称的主播",
+			"parameters":  []jsonObject{openAPIParam("query", "q", "昵称的关键词", str)},
+			"responses":   jsonObject{"200": jsonResponse("主播昵称", arrayOf("Streamer"))},
+		}},
+		"/api/live": jsonObject{"get": jsonObject{
+			"operationId": "listLive",
+			"summary":     "按开播时间降序查询关注的主播正在进行的直播，没有关注的主播时查询所有正在进行的直播，用用户的API key访问时查询用户关注的主播",
+			"responses":   jsonObject{"200": jsonResponse("正在进行的直播", arrayOf("Session"))},
+		}},
+		"/api/playbacks": jsonObject{"get": jsonObject{
+			"operationId": "listPlaybacks",
+			"summary":     "查询主播已经结束的直播的录播链接，没有录播链接的直播会重新获取，需要uid参数，其他参数和/api/sessions相同",
+			"parameters":  sessionParams,
+			"responses": jsonObject{
+				"200": jsonResponse("录播链接", arrayOf("Playback")),
+				"400": errorResponse("参数不正确"),
+			},
+		}},
+		"/api/watch": jsonObject{
+			"get": jsonObject{
+				"operationId": "listWatch",
+				"summary":     "查询关注的主播和开启的记录功能，用用户的API key访问时查询用户关注的主播",
+				"responses":   jsonObject{"200": jsonResponse("关注的主播", arrayOf("Watch"))},
+			},
+			"post": jsonObject{
+				"operationId": "setWatch",
+				"summary":     "关注主播或修改对主播开启的记录功能，没有的记录功能保持不变，需要设置鉴权。用用户的API key访问时关注到用户自己的列表，忽略记录功能",
+				"requestBody": jsonObject{
+					"required": true,
+					"content":  jsonObject{"application/json": jsonObject{"schema": schemaRef("WatchRequest")}},
+				},
+				"responses": jsonObject{
+					"200": jsonResponse("已修改记录功能", schemaRef("Watch")),
+					"201": jsonResponse("已关注主播", schemaRef("Watch")),
+					"400": errorResponse("请求不正确"),
+					"403": errorResponse("没有设置鉴权"),
+				},
+			},
+		},
+		"/api/watch/{uid}": jsonObject{"delete": jsonObject{
+			"operationId": "deleteWatch",
+			"summary":     "取消关注主播，需要设置鉴权，用用户的API key访问时从用户自己的列表取消关注",
+			"parameters":  []jsonObject{uidPath},
+			"responses": jsonObject{
+				"204": jsonObject{"description": "已取消关注"},
+				"403": errorResponse("没有设置鉴权"),
+				"404": errorResponse("没有关注这个主播"),
+			},
+		}},
+		"/api/tenant": jsonObject{
+			"get": jsonObject{
+				"operationId": "getTenant",
+				"summary":     "查询用户的设置，只能用用户的API key访问",
+				"responses": jsonObject{
+					"200": jsonResponse("用户的设置", schemaRef("Tenant")),
+					"403": errorResponse("不是用用户的API key访问"),
+				},
+			},
+			"put": jsonObject{
+				"operationId": "setTenant",
+				"summary":     "修改用户关注的主播开播和下播时通知的webhook，没有的设置保持不变，只能用用户的API key访问",
+				"requestBody": jsonObject{
+					"required": true,
+					"content":  jsonObject{"application/json": jsonObject{"schema": schemaRef("TenantRequest")}},
+				},
+				"responses": jsonObject{
+					"200": jsonResponse("已修改设置", schemaRef("Tenant")),
+					"400": errorResponse("请求不正确"),
+					"403": errorResponse("不是用用户的API key访问"),
+				},
+			},
+		},
+		"/feed/{uid}.xml": jsonObject{"get": jsonObject{
+			"operationId": "getFeed",
+			"summary":     "主播最近已经结束的直播的RSS 2.0",
+			"parameters":  []jsonObject{uidPath},
+			"responses": jsonObject{"200": jsonObject{
+				"description": "RSS",
+				"content":     jsonObject{"application/rss+xml": jsonObject{"schema": str}},
+			}},
+		}},
+		"/calendar/{uid}.ics": jsonObject{"get": jsonObject{
+			"operationId": "getCalendar",
+			"summary":     "主播所有直播的iCalendar日历",
+			"parameters":  []jsonObject{uidPath},
+			"responses": jsonObject{"200": jsonObject{
+				"description": "iCalendar",
+				"content":     jsonObject{"text/calendar": jsonObject{"schema": str}},
+			}},
+		}},
+	}
+
+	doc := jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":       "acfunlivedb",
+			"description": "查询AcFun直播数据的API，时间单位为毫秒，出错时返回 {\"error\": \"错误信息\"}",
+			"version":     version,
+		},
+		"paths": paths,
+		"components": jsonObject{"schemas": jsonObject{
+			"Session":       jsonSchema(reflect.TypeOf(liveJSON{})),
+			"SessionDetail": jsonSchema(reflect.TypeOf(sessionJSON{})),
+			"Streamer":      jsonSchema(reflect.TypeOf(streamerJSON{})),
+			"Playback":      jsonSchema(reflect.TypeOf(playbackJSON{})),
+			"Watch":         jsonSchema(reflect.TypeOf(watchJSON{})),
+			"WatchRequest":  jsonSchema(reflect.TypeOf(watchRequest{})),
+			"Tenant":        jsonSchema(reflect.TypeOf(tenantJSON{})),
+			"TenantRequest": jsonSchema(reflect.TypeOf(tenantRequest{})),
+			"Error":         jsonSchema(reflect.TypeOf(errorJSON{})),
+		}},
+	}
+
+	// 按设置写鉴权方式，两种方式都设置时任选一种
+	schemes := jsonObject{}
+	var security []jsonObject
+	if conf.HTTP.APIToken != "" {
+		schemes["bearerAuth"] = jsonObject{"type": "http", "scheme": "bearer"}
+		security = append(security, jsonObject{"bearerAuth": []string{}})
+	}
+	if conf.HTTP.Username != "" {
+		schemes["basicAuth"] = jsonObject{"type": "http", "scheme": "basic"}
+		security = append(security, jsonObject{"basicAuth": []string{}})
+	}
+	if len(security) != 0 {
+		doc["components"].(jsonObject)["securitySchemes"] = schemes
+		doc["security"] = security
+	}
+	return doc
+}
+
+// GET /api/openapi.json 返回API的OpenAPI文档，不需要鉴权
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, openAPIDoc())
+}
+
+// 把OpenAPI文档写入文件
+func exportOpenAPI(file string) error {
+	data, err := json.MarshalIndent(openAPIDoc(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	changePlayback        changeKind = "playback"      // 录播已经生成，用于webhook和外部命令
+	playbackCheckInterval            = 5 * time.Minute // 查询等待中的录播是否生成的间隔
+	playbackWaitTime                 = 3 * time.Hour   // 下播后等待录播生成的最长时间，超过后不再查询
+)
+
+// 下播后等待录播生成的直播，key为liveID
+var pendingPlaybacks = struct {
+	sync.Mutex
+	m map[store.LiveID]*pendingPlayback
+}{m: make(map[store.LiveID]*pendingPlayback)}
+
+// 等待录播生成的直播
+type pendingPlayback struct {
+	l        live      // 直播数据
+	duration int64     // 直播时长，单位为毫秒
+	endTime  time.Time // 处理下播的时间
+}
+
+// 关注的主播下播后开始等待录播生成，由playbackCycle定期查询
+func waitPlayback(l *live, duration int64) {
+	if !isWatched(l.uid) {
+		return
+	}
+	pendingPlaybacks.Lock()
+	defer pendingPlaybacks.Unlock()
+	pendingPlaybacks.m[l.liveID] = &pendingPlayback{l: *l, duration: duration, endTime: time.Now()}
+}
+
+// 定期查询等待中的录播，录播链接第一次查询到时保存并通知
+func playbackCycle(ctx context.Context) {
+	if conf.Mirror.Source != "" {
+		return
+	}
+	for {
+		if !sleepCtx(ctx, playbackCheckInterval) {
+			return
+		}
+		checkPlaybacks(ctx)
+	}
+}
+
+// 查询一次所有等待中的录播，先下播的先查询
+func checkPlaybacks(ctx context.Context) {
+	pendingPlaybacks.Lock()
+	list := make([]*pendingPlayback, 0, len(pendingPlaybacks.m))
+	for _, p := range pendingPlaybacks.m {
+		list = append(list, p)
+	}
+	pendingPlaybacks.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].endTime.Before(list[j].endTime) })
+
+	for _, p := range list {
+		if ctx.Err() != nil {
+			return
+		}
+		playback, err := tryPlayback(p.l.liveID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if playback.URL == "" && playback.BackupURL == "" {
+			if time.Since(p.endTime) > playbackWaitTime {
+				forgetPlayback(p.l.liveID)
+				log.Printf("uid为 %d 的主播的liveID为 %s 的直播下播后 %v 内没有生成录播，不再查询", p.l.uid, p.l.liveID, playbackWaitTime)
+			}
+			continue
+		}
+		forgetPlayback(p.l.liveID)
+		updatePlayback(ctx, p.l.liveID, playback.URL, playback.BackupURL)
+		notifyPlaybackReady(p, playback.URL, playback.BackupURL)
+	}
+}
+
+func forgetPlayback(liveID store.LiveID) {
+	pendingPlaybacks.Lock()
+	delete(pendingPlaybacks.m, liveID)
+	pendingPlaybacks.Unlock()
+}
+
+// 发送录播生成的通知到设置的所有通知目标
+func notifyPlaybackReady(p *pendingPlayback, url, backupURL string) {
+	l := &p.l
+	log.Printf("uid为 %d 的主播 %s 的liveID为 %s 的直播的录播已经生成", l.uid, l.name, l.liveID)
+	hook := &liveHookJSON{
+		Event:       changePlayback,
+		LiveID:      l.liveID,
+		UID:         l.uid,
+		Name:        l.name,
+		Title:       l.title,
+		StartTime:   l.startTime,
+		Duration:    p.duration,
+		PlaybackURL: url,
+		BackupURL:   backupURL,
+	}
+	telegramPlayback(l, p.duration, url, backupURL)
+	pushPlayback(l, p.duration, url, backupURL)
+	sendLiveHook(hook)
+	sendTenantHooks(watchingTenants(l.uid), hook)
+	commandHookPlaybackReady(hook)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const (
+	defaultNtfyServer     = "https://ntfy.sh" // 默认的ntfy服务器
+	defaultNtfyPriority   = 3                 // ntfy的默认优先级，范围为1到5
+	defaultGotifyPriority = 5                 // Gotify的默认优先级，范围为1到10
+)
+
+// 自建推送服务的设置，只通知关注的主播
+type pushConfig struct {
+	Ntfy   ntfyConfig   `json:"ntfy"`   // ntfy的设置
+	Gotify gotifyConfig `json:"gotify"` // Gotify的设置
+}
+
+// ntfy推送的设置
+type ntfyConfig struct {
+	Server   string      `json:"server"`              // ntfy服务器的地址
+	Topic    string      `json:"topic"`               // 推送的主题，为空时不推送
+	Priority int         `json:"priority"`            // 推送的优先级，范围为1到5
+	Token    string      `json:"token" secret:"true"` // 访问令牌，主题需要鉴权时设置
+	Limit    notifyLimit `json:"limit"`               // 安静时段和频率限制
+}
+
+// Gotify推送的设置
+type gotifyConfig struct {
+	Server   string      `json:"server"`              // Gotify服务器的地址，为空时不推送
+	Token    string      `json:"token" secret:"true"` // 应用的令牌
+	Priority int         `json:"priority"`            // 推送的优先级，范围为1到10
+	Limit    notifyLimit `json:"limit"`               // 安静时段和频率限制
+}
+
+// 一条推送
+type pushMessage struct {
+	uid       store.UID    // 主播uid
+	liveID    store.LiveID // 直播ID
+	liveTitle string       // 直播间标题，用于notifyRoutes
+	name      string       // 打印日志时的推送名
+	title     string       // 标题
+	message   string       // 内容
+	click     string       // 点击推送时打开的链接
+}
+
+// 发送开播推送
+func pushLiveStart(l *live) {
+	pushStartNotify(l, "start", defaultPushStartTitleTemplate)
+}
+
+// 推送重连通知，设置了开播推送的模板时使用这个模板，模板里可以用.Event区分
+func pushLiveReconnect(l *live) {
+	pushStartNotify(l, "reconnect", defaultPushReconnectTitleTemplate)
+}
+
+func pushStartNotify(l *live, event, defTitle string) {
+	if !isWatched(l.uid) {
+		return
+	}
+	data := newTemplateData(event, l, 0)
+	sendPush(&pushMessage{
+		uid:       l.uid,
+		liveID:    l.liveID,
+		liveTitle: l.title,
+		name:      templateEventName(event) + "推送",
+		title:     renderTemplate(conf.Templates.Push.StartTitle, defTitle, data),
+		message:   renderTemplate(conf.Templates.Push.StartMessage, defaultPushStartMessageTemplate, data),
+		click:     data.RoomURL,
+	})
+}
+
+// 发送下播推送
+func pushLiveEnd(l *live, duration int64) {
+	if !isWatched(l.uid) {
+		return
+	}
+	data := newTemplateData("end", l, duration)
+	sendPush(&pushMessage{
+		uid:       l.uid,
+		liveID:    l.liveID,
+		liveTitle: l.title,
+		name:      "下播推送",
+		title:     renderTemplate(conf.Templates.Push.EndTitle, defaultPushEndTitleTemplate, data),
+		message:   renderTemplate(conf.Templates.Push.EndMessage, defaultPushEndMessageTemplate, data),
+		click:     data.RoomURL,
+	})
+}
+
+// 发送录播生成的推送
+func pushPlayback(l *live, duration int64, url, backupURL string) {
+	if !isWatched(l.uid) {
+		return
+	}
+	data := newTemplateData("playback", l, duration)
+	data.PlaybackURL = url
+	data.BackupURL = backupURL
+	sendPush(&pushMessage{
+		uid:       l.uid,
+		liveID:    l.liveID,
+		liveTitle: l.title,
+		name:      "录播推送",
+		title:     renderTemplate(conf.Templates.Push.PlaybackTitle, defaultPushPlaybackTitle, data),
+		message:   renderTemplate(conf.Templates.Push.PlaybackMessage, defaultPushPlaybackMessage, data),
+		click:     url,
+	})
+}
+
+// 保存到通知队列的推送内容
+type pushPayload struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Click   string `json:"click"`
+}
+
+// 加入通知队列，发送到所有设置的推送服务
+func sendPush(m *pushMessage) {
+	p := &pushPayload{Title: m.title, Message: m.message, Click: m.click}
+	if conf.Push.Ntfy.Topic != "" && notifyRouted(routeNtfy, m.uid, m.liveTitle) && conf.Push.Ntfy.Limit.allow("ntfy", m.uid, m.name) {
+		queueNotification("ntfy", m.uid, m.liveID, p)
+	}
+	if conf.Push.Gotify.Server != "" && notifyRouted(routeGotify, m.uid, m.liveTitle) && conf.Push.Gotify.Limit.allow("Gotify", m.uid, m.name) {
+		queueNotification("gotify", m.uid, m.liveID, p)
+	}
+}
+
+// 发送通知队列里的ntfy推送
+func sendNtfyPayload(payload []byte) error {
+	if conf.Push.Ntfy.Topic == "" {
+		return errNotifyDisabled
+	}
+	var p pushPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return postNtfy(&p)
+}
+
+// 发送通知队列里的Gotify推送
+func sendGotifyPayload(payload []byte) error {
+	if conf.Push.Gotify.Server == "" {
+		return errNotifyDisabled
+	}
+	var p pushPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return postGotify(&p)
+}
+
+// 以JSON发布到ntfy服务器
+func postNtfy(m *pushPayload) error {
+	c := conf.Push.Ntfy
+	server := c.Server
+	if server == "" {
+		server = defaultNtfyServer
+	}
+	priority := c.Priority
+	if priority <= 0 {
+		priority = defaultNtfyPriority
+	}
+	body, err := json.Marshal(struct {
+		Topic    string `json:"topic"`
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+		Click    string `json:"click,omitempty"`
+	}{c.Topic, m.Title, m.Message, priority, m.Click})
+	checkErr(err)
+	var auth string
+	if c.Token != "" {
+		auth = "Bearer " + c.Token
+	}
+	return postPush(strings.TrimSuffix(server, "/"), body, "Authorization", auth)
+}
+
+// 调用Gotify的发送消息接口，令牌放在请求头里，不会出现在错误信息中
+func postGotify(m *pushPayload) error {
+	c := conf.Push.Gotify
+	priority := c.Priority
+	if priority <= 0 {
+		priority = defaultGotifyPriority
+	}
+	type click struct {
+		URL string `json:"url"`
+	}
+	type notification struct {
+		Click click `json:"click"`
+	}
+	body, err := json.Marshal(struct {
+		Title    string                  `json:"title"`
+		Message  string                  `json:"message"`
+		Priority int                     `json:"priority"`
+		Extras   map[string]notification `json:"extras"`
+	}{m.Title, m.Message, priority, map[string]notification{"client::notification": {Click: click{URL: m.Click}}}})
+	checkErr(err)
+	return postPush(strings.TrimSuffix(c.Server, "/")+"/message", body, "X-Gotify-Key", c.Token)
+}
+
+// 以POST方式发送JSON，value不为空时带上请求头key
+func postPush(url string, body []byte, key, value string) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	if value != "" {
+		req.Header.Set(key, value)
+	}
+	req.SetBody(body)
+	if err := client.Do(req, resp); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d：%s", url, code, strings.TrimSpace(string(resp.Body())))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 按在线人数从多到少排名，保存前conf.RankingTop名的直播间
+func recordRanking(t time.Time, list map[store.LiveID]live) {
+	if conf.RankingTop <= 0 || len(list) == 0 {
+		return
+	}
+	lives := make([]live, 0, len(list))
+	for _, l := range list {
+		lives = append(lives, l)
+	}
+	sort.Slice(lives, func(i, j int) bool {
+		if lives[i].onlineCount != lives[j].onlineCount {
+			return lives[i].onlineCount > lives[j].onlineCount
+		}
+		return lives[i].liveID < lives[j].liveID
+	})
+	if len(lives) > conf.RankingTop {
+		lives = lives[:conf.RankingTop]
+	}
+	entries := make([]store.RankEntry, len(lives))
+	for i, l := range lives {
+		entries[i] = store.RankEntry{
+			Rank:        i + 1,
+			LiveID:      l.liveID,
+			UID:         l.uid,
+			OnlineCount: l.onlineCount,
+		}
+	}
+	queueWrite("保存直播间人气排名", nil, store.RankingWrites(t.UnixMilli(), entries)...)
+}
+
+// 打印直播进入人气排名的记录
+func printRankings(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QueryRankings(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播的人气排名出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有进入过人气排名", liveID)
+		return
+	}
+	best := list[0]
+	for _, r := range list {
+		fmt.Printf("%s 排名：%d 在线人数：%d\n", time.UnixMilli(r.Time).Format(timeLayout), r.Rank, r.OnlineCount)
+		if r.Rank < best.Rank {
+			best = r
+		}
+	}
+	fmt.Printf("最高排名：%d（%s，在线人数：%d），共 %d 条记录\n",
+		best.Rank, time.UnixMilli(best.Time).Format(timeLayout), best.OnlineCount, len(list),
+	)
+}
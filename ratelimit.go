@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateLimitIdle = 10 * time.Minute // 超过这个时间没有请求的IP的限流状态会被清除
+
+// 按IP限制请求频率的令牌桶，每个IP每分钟最多limit个请求，可以短时间内连续请求limit次
+type rateLimiter struct {
+	sync.Mutex
+	limit   float64
+	buckets map[string]*tokenBucket // key为客户端IP
+	cleaned time.Time               // 上次清除空闲IP的时间
+}
+
+type tokenBucket struct {
+	tokens float64   // 剩余的请求次数
+	last   time.Time // 上次更新tokens的时间
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{limit: float64(limit), buckets: make(map[string]*tokenBucket), cleaned: time.Now()}
+}
+
+// 是否允许ip的请求，不允许时返回需要等待的时间
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.cleaned) >= rateLimitIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= rateLimitIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.cleaned = now
+	}
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.limit, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.limit, b.tokens+now.Sub(b.last).Minutes()*l.limit)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit * float64(time.Minute))
+	return false, wait
+}
+
+// 限制每个IP的请求频率，/healthz不限制
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.allow(clientIP(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, errors.New("请求太频繁，请稍后再试"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 请求的客户端IP，设置了http.trustProxy时使用反向代理传来的IP。
+// X-Forwarded-For的左边部分可以由客户端伪造，只有最右边的一项是反向代理自己添加的
+func clientIP(r *http.Request) string {
+	if conf.HTTP.TrustProxy {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) != 0 {
+			list := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(list[len(list)-1]); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
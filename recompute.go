@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	monthLayout      = "2006-01" // 月份的格式
+	topStreamerCount = 20        // top命令列出的主播数量
+	fanCount         = 50        // fans命令列出的观众数量
+)
+
+// 可以重新计算的统计数据
+var recomputeTargets = []struct {
+	name string
+	desc string
+	run  func(ctx context.Context) (int64, error)
+}{
+	{"stats", "每月直播统计", func(ctx context.Context) (int64, error) { return db.RecomputeStats(ctx) }},
+	{"schedule", "开播时间分布", func(ctx context.Context) (int64, error) { return db.RecomputeSchedule(ctx) }},
+	{"engagement", "弹幕互动统计", func(ctx context.Context) (int64, error) { return db.RecomputeFans(ctx) }},
+	{"chat", "每场直播的弹幕统计", func(ctx context.Context) (int64, error) { return db.RecomputeChatStats(ctx) }},
+}
+
+// 根据所有直播数据重新计算统计数据，names为空时重新计算全部
+func recompute(ctx context.Context, names []string) error {
+	for _, name := range names {
+		found := false
+		for _, t := range recomputeTargets {
+			if t.name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("没有叫 %s 的统计数据，可以是 stats、schedule、engagement 或 chat", name)
+		}
+	}
+	for _, t := range recomputeTargets {
+		if len(names) != 0 && !contains(names, t.name) {
+			continue
+		}
+		start := time.Now()
+		n, err := t.run(ctx)
+		if err != nil {
+			return fmt.Errorf("重新计算%s出现错误：%w", t.desc, err)
+		}
+		log.Printf("已重新计算%s，共 %d 行，用时 %s", t.desc, n, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdayText = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// 打印主播每个月的直播统计
+func printMonthlyStats(ctx context.Context, uid store.UID) {
+	list, err := db.QueryMonthlyStats(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的直播统计出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的直播统计", uid)
+		return
+	}
+	for _, m := range list {
+		fmt.Printf("%s 直播次数：%d 直播总时长：%s%s\n", m.Month, m.LiveCount,
+			(time.Duration(m.TotalDuration) * time.Millisecond).String(), maxViewersText(m.MaxViewers),
+		)
+	}
+}
+
+// 最高在线人数的文字，没有进入人气排名时为空
+func maxViewersText(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" 最高在线人数：%d", n)
+}
+
+// 打印一个月里直播总时长最长的主播，monthStr为空时为本月
+func printTopStreamers(ctx context.Context, monthStr string) {
+	month := time.Now()
+	if monthStr != "" {
+		var err error
+		if month, err = time.ParseInLocation(monthLayout, monthStr, time.Local); err != nil {
+			log.Printf("%s 不是有效的月份，格式为 %s", monthStr, monthLayout)
+			return
+		}
+	}
+	list, err := db.QueryTopStreamers(ctx, month.Format(monthLayout), topStreamerCount)
+	if err != nil {
+		log.Printf("查询 %s 的主播排行出现错误：%v", month.Format(monthLayout), err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("%s 没有直播统计", month.Format(monthLayout))
+		return
+	}
+	for i, t := range list {
+		name := t.Name
+		if name == "" {
+			name = "未知昵称"
+		}
+		fmt.Printf("%d. %s（%d） 直播次数：%d 直播总时长：%s%s\n", i+1, name, t.UID, t.LiveCount,
+			(time.Duration(t.TotalDuration) * time.Millisecond).String(), maxViewersText(t.MaxViewers),
+		)
+	}
+}
+
+// 打印主播的开播时间分布
+func printSchedule(ctx context.Context, uid store.UID) {
+	list, err := db.QuerySchedule(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的开播时间分布出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的开播时间分布，可以用 recompute schedule 生成", uid)
+		return
+	}
+	for _, slot := range list {
+		fmt.Printf("%s %02d:00-%02d:59 开播次数：%d\n", weekdayText[slot.Weekday], slot.Hour, slot.Hour, slot.LiveCount)
+	}
+}
+
+// 打印主播直播间里发送弹幕最多的观众
+func printFans(ctx context.Context, uid store.UID) {
+	list, err := db.QueryFans(ctx, uid, fanCount)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的观众统计出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的观众统计，需要在 watch 里开启 danmaku 记录弹幕和礼物", uid)
+		return
+	}
+	for i, f := range list {
+		fmt.Printf("%d. %s（%d） 弹幕数：%d 礼物数：%d 花费AC币：%d 第一次出现：%s 最后一次出现：%s\n", i+1, f.Nickname, f.UID,
+			f.MessageCount, f.GiftCount, f.ACCoin,
+			time.UnixMilli(f.FirstSeen).Format(timeLayout), time.UnixMilli(f.LastSeen).Format(timeLayout),
+		)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fastjson"
+
+	"acfunlivedb/store"
+)
+
+const defaultRecorderInterval = 30 // 默认查询录播状态的间隔，单位为秒
+
+// 录播状态里表示录播文件名的键，不区分大小写
+var recordFileKeys = []string{"recordFile", "fileName", "file", "filePath", "path"}
+
+// 和orzogc/acfunlive录播工具集成的设置
+type recorderConfig struct {
+	API      string `json:"api"`      // 返回正在录制的录播列表的web API链接，如"http://127.0.0.1:51880/listrecord"，为空时不集成
+	Interval int    `json:"interval"` // 查询录播状态的间隔，单位为秒
+}
+
+// 查询录播工具正在录制的录播，返回liveID对应的录播文件名
+func fetchRecordings(api string) (map[string]string, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(api)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.SetUserAgent(userAgent)
+	if err := client.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d", api, code)
+	}
+
+	var p fastjson.Parser
+	v, err := p.ParseBytes(resp.Body())
+	if err != nil {
+		return nil, fmt.Errorf("解析录播状态失败：%w", err)
+	}
+	list, err := v.Array()
+	if err != nil {
+		return nil, fmt.Errorf("录播状态不是列表：%w", err)
+	}
+	recordings := make(map[string]string, len(list))
+	for _, item := range list {
+		obj, err := item.Object()
+		if err != nil {
+			continue
+		}
+		var liveID, file string
+		obj.Visit(func(key []byte, v *fastjson.Value) {
+			if v.Type() != fastjson.TypeString {
+				return
+			}
+			k := string(key)
+			switch {
+			case strings.EqualFold(k, "liveID"):
+				liveID = string(v.GetStringBytes())
+			case file == "":
+				for _, fk := range recordFileKeys {
+					if strings.EqualFold(k, fk) {
+						file = string(v.GetStringBytes())
+						break
+					}
+				}
+			}
+		})
+		if liveID != "" {
+			recordings[liveID] = file
+		}
+	}
+	return recordings, nil
+}
+
+// 定期查询录播工具的录播状态，录播从正在录制的列表里消失时认为录制完成，保存录播文件名
+func recorderCycle(ctx context.Context) {
+	if conf.Recorder.API == "" {
+		return
+	}
+	interval := time.Duration(conf.Recorder.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultRecorderInterval * time.Second
+	}
+	log.Printf("开始查询录播工具 %s 的录播状态", conf.Recorder.API)
+
+	recording := make(map[string]string) // 正在录制的录播
+	available := true
+	for sleepCtx(ctx, interval) {
+		current, err := fetchRecordings(conf.Recorder.API)
+		if err != nil {
+			// 只在录播工具从可用变为不可用时打印日志，查询失败时不判断录制是否完成
+			if available {
+				log.Printf("查询录播工具的录播状态失败：%v", err)
+				available = false
+			}
+			continue
+		}
+		if !available {
+			log.Println("录播工具恢复可用")
+			available = true
+		}
+
+		for liveID, file := range recording {
+			if _, ok := current[liveID]; ok {
+				continue
+			}
+			if file == "" {
+				log.Printf("liveID为 %s 的直播录制完成，但录播工具没有返回录播文件名", liveID)
+				continue
+			}
+			log.Printf("liveID为 %s 的直播录制完成，录播文件为 %s", liveID, file)
+			updateRecordFile(ctx, store.LiveID(liveID), file)
+		}
+		for liveID, file := range current {
+			// 文件名可能在录制开始一段时间后才出现
+			if file == "" {
+				file = recording[liveID]
+			}
+			current[liveID] = file
+		}
+		recording = current
+	}
+}
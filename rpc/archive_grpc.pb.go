@@ -0,0 +1,217 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: archive.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Archive_QuerySessions_FullMethodName = "/acfunlivedb.Archive/QuerySessions"
+	Archive_GetPlayback_FullMethodName   = "/acfunlivedb.Archive/GetPlayback"
+	Archive_StreamEvents_FullMethodName  = "/acfunlivedb.Archive/StreamEvents"
+)
+
+// ArchiveClient is the client API for Archive service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ArchiveClient interface {
+	// QuerySessions 按开播时间降序查询没有删除的直播
+	QuerySessions(ctx context.Context, in *QuerySessionsRequest, opts ...grpc.CallOption) (*QuerySessionsResponse, error)
+	// GetPlayback 查询AcFun官方的录播链接
+	GetPlayback(ctx context.Context, in *GetPlaybackRequest, opts ...grpc.CallOption) (*Playback, error)
+	// StreamEvents 推送直播数据的变动，直到客户端断开连接
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (Archive_StreamEventsClient, error)
+}
+
+type archiveClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewArchiveClient(cc grpc.ClientConnInterface) ArchiveClient {
+	return &archiveClient{cc}
+}
+
+func (c *archiveClient) QuerySessions(ctx context.Context, in *QuerySessionsRequest, opts ...grpc.CallOption) (*QuerySessionsResponse, error) {
+	out := new(QuerySessionsResponse)
+	err := c.cc.Invoke(ctx, Archive_QuerySessions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *archiveClient) GetPlayback(ctx context.Context, in *GetPlaybackRequest, opts ...grpc.CallOption) (*Playback, error) {
+	out := new(Playback)
+	err := c.cc.Invoke(ctx, Archive_GetPlayback_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *archiveClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (Archive_StreamEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Archive_ServiceDesc.Streams[0], Archive_StreamEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &archiveStreamEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Archive_StreamEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type archiveStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *archiveStreamEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ArchiveServer is the server API for Archive service.
+// All implementations must embed UnimplementedArchiveServer
+// for forward compatibility
+type ArchiveServer interface {
+	// QuerySessions 按开播时间降序查询没有删除的直播
+	QuerySessions(context.Context, *QuerySessionsRequest) (*QuerySessionsResponse, error)
+	// GetPlayback 查询AcFun官方的录播链接
+	GetPlayback(context.Context, *GetPlaybackRequest) (*Playback, error)
+	// StreamEvents 推送直播数据的变动，直到客户端断开连接
+	StreamEvents(*StreamEventsRequest, Archive_StreamEventsServer) error
+	mustEmbedUnimplementedArchiveServer()
+}
+
+// UnimplementedArchiveServer must be embedded to have forward compatible implementations.
+type UnimplementedArchiveServer struct {
+}
+
+func (UnimplementedArchiveServer) QuerySessions(context.Context, *QuerySessionsRequest) (*QuerySessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QuerySessions not implemented")
+}
+func (UnimplementedArchiveServer) GetPlayback(context.Context, *GetPlaybackRequest) (*Playback, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlayback not implemented")
+}
+func (UnimplementedArchiveServer) StreamEvents(*StreamEventsRequest, Archive_StreamEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedArchiveServer) mustEmbedUnimplementedArchiveServer() {}
+
+// UnsafeArchiveServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ArchiveServer will
+// result in compilation errors.
+type UnsafeArchiveServer interface {
+	mustEmbedUnimplementedArchiveServer()
+}
+
+func RegisterArchiveServer(s grpc.ServiceRegistrar, srv ArchiveServer) {
+	s.RegisterService(&Archive_ServiceDesc, srv)
+}
+
+func _Archive_QuerySessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuerySessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ArchiveServer).QuerySessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Archive_QuerySessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ArchiveServer).QuerySessions(ctx, req.(*QuerySessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Archive_GetPlayback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlaybackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ArchiveServer).GetPlayback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Archive_GetPlayback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ArchiveServer).GetPlayback(ctx, req.(*GetPlaybackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Archive_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ArchiveServer).StreamEvents(m, &archiveStreamEventsServer{stream})
+}
+
+type Archive_StreamEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type archiveStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *archiveStreamEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Archive_ServiceDesc is the grpc.ServiceDesc for Archive service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Archive_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "acfunlivedb.Archive",
+	HandlerType: (*ArchiveServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QuerySessions",
+			Handler:    _Archive_QuerySessions_Handler,
+		},
+		{
+			MethodName: "GetPlayback",
+			Handler:    _Archive_GetPlayback_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _Archive_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "archive.proto",
+}
@@ -0,0 +1,4 @@
+// Package rpc 是直播数据的gRPC服务定义，修改archive.proto后需要重新生成代码
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative archive.proto
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	sseHeartbeat = 30 * time.Second // SSE心跳间隔
+	sseRetry     = 5000             // 断开后浏览器重新连接的等待时间，单位为毫秒
+)
+
+// HTTP服务器的设置
+type httpConfig struct {
+	Listen    string `json:"listen"`              // 监听地址，如"127.0.0.1:8080"，为空时不启动HTTP服务器
+	API       bool   `json:"api"`                 // 是否提供查询直播数据的REST API
+	Dashboard bool   `json:"dashboard"`           // 是否在/提供浏览直播数据的网页，开启时也会提供REST API
+	Token     string `json:"token" secret:"true"` // 下载数据库快照需要的bearer token，为空时不提供下载
+
+	AllowOrigin  string `json:"allowOrigin"`  // 允许跨域访问/events的网站，如"https://example.com"或"*"，为空时不允许
+	StaleSeconds int    `json:"staleSeconds"` // 超过这个秒数没有成功获取直播间列表时/healthz返回503，小于等于0时根据获取间隔计算
+
+	APIToken string `json:"apiToken" secret:"true"` // 访问/events和REST API需要的bearer token，和username都为空时不鉴权
+	Username string `json:"username"`               // 访问/events和REST API的basic auth用户名
+	Password string `json:"password" secret:"true"` // 访问/events和REST API的basic auth密码
+	TLSCert  string `json:"tlsCert"`                // TLS证书文件路径，和tlsKey都设置时使用HTTPS
+	TLSKey   string `json:"tlsKey"`                 // TLS私钥文件路径
+
+	RateLimit    int    `json:"rateLimit"`    // 每个IP每分钟最多的请求数，小于等于0时不限制
+	TrustProxy   bool   `json:"trustProxy"`   // 是否使用反向代理传来的X-Forwarded-For或X-Real-IP作为客户端IP
+	AccessLogDir string `json:"accessLogDir"` // 按天保存访问日志的文件夹，相对路径以本程序所在文件夹为准，为空时不保存
+}
+
+// 启动HTTP服务器，ctx结束时关闭
+func serveHTTP(ctx context.Context) {
+	if conf.HTTP.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", requireAuth(handleEvents))
+	mux.HandleFunc("/healthz", handleHealth)
+	if conf.HTTP.API || conf.HTTP.Dashboard {
+		registerAPI(mux)
+	}
+	if conf.HTTP.Dashboard {
+		registerDashboard(mux)
+	}
+	certFile, keyFile := absPath(conf.HTTP.TLSCert), absPath(conf.HTTP.TLSKey)
+	if (certFile == "") != (keyFile == "") {
+		log.Println("http.tlsCert和http.tlsKey需要同时设置，不启动HTTP服务器")
+		return
+	}
+	if conf.HTTP.Token != "" {
+		mux.HandleFunc("/snapshot", requireToken(handleSnapshot))
+		mux.HandleFunc("/changes", requireToken(handleChanges))
+	}
+
+	var handler http.Handler = mux
+	if conf.HTTP.RateLimit > 0 {
+		handler = newRateLimiter(conf.HTTP.RateLimit).middleware(handler)
+	}
+	if dir := absPath(conf.HTTP.AccessLogDir); dir != "" {
+		accessLog, err := newDailyWriter(dir)
+		if err != nil {
+			log.Printf("打开访问日志文件夹 %s 失败：%v", dir, err)
+		} else {
+			defer accessLog.Close()
+			// 被限流的请求也会记录
+			handler = accessLogMiddleware(accessLog, handler)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              conf.HTTP.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(_ net.Listener) context.Context { return ctx },
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if certFile != "" {
+		log.Printf("HTTPS服务器监听 %s", conf.HTTP.Listen)
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		log.Printf("HTTP服务器监听 %s", conf.HTTP.Listen)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("HTTP服务器出现错误：%v", err)
+	}
+}
+
+// 设置了http.apiToken或http.username时检查请求的bearer token或basic auth，通过后才调用next。
+// bearer token是用户的API key时总是通过，请求的context里带上用户
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	token, username := conf.HTTP.APIToken, conf.HTTP.Username
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if hasBearer {
+			if t := lookupTenant(r.Context(), bearer); t != nil {
+				next(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t)))
+				return
+			}
+		}
+		if token == "" && username == "" {
+			next(w, r)
+			return
+		}
+		if token != "" {
+			if hasBearer && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+		if username != "" {
+			// 用户名和密码都要比较，避免从响应时间推测用户名
+			u, p, ok := r.BasicAuth()
+			userOK := subtle.ConstantTimeCompare([]byte(u), []byte(username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(p), []byte(conf.HTTP.Password)) == 1
+			if ok && userOK && passOK {
+				next(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="acfunlivedb", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		writeError(w, http.StatusUnauthorized, errors.New("需要登录或token不正确"))
+	}
+}
+
+// 推送给SSE客户端的条件，为零值的条件不限制
+type eventFilter struct {
+	types  map[changeKind]bool // 推送的变动类型
+	uid    store.UID           // 只推送这个主播的直播的变动
+	tenant *store.Tenant       // 只推送这个用户关注的主播的直播的变动
+}
+
+// 解析/events的types和uid参数
+func parseEventFilter(r *http.Request) (*eventFilter, error) {
+	f := new(eventFilter)
+	params := r.URL.Query()
+	if s := params.Get("types"); s != "" {
+		f.types = make(map[changeKind]bool)
+		for _, t := range strings.Split(s, ",") {
+			kind := changeKind(strings.TrimSpace(t))
+			found := false
+			for _, k := range changeKinds {
+				if k == kind {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("types 参数里的 %s 不是有效的变动类型", t)
+			}
+			f.types[kind] = true
+		}
+	}
+	if s := params.Get("uid"); s != "" {
+		uid, err := store.ParseUID(s)
+		if err != nil {
+			return nil, fmt.Errorf("uid 参数：%w", err)
+		}
+		f.uid = uid
+	}
+	f.tenant = requestTenant(r)
+	return f, nil
+}
+
+// 是否推送e
+func (f *eventFilter) match(ctx context.Context, e liveEvent) bool {
+	if f.types != nil && !f.types[e.Type] {
+		return false
+	}
+	if f.uid != 0 && e.Live.uid != f.uid {
+		return false
+	}
+	if f.tenant != nil {
+		// 用户可能在连接期间修改关注的主播
+		watched, err := tenantWatchSet(ctx, f.tenant)
+		if err != nil {
+			log.Printf("查询用户 %s 关注的主播出现错误：%v", f.tenant.Name, err)
+			return false
+		}
+		return watched[e.Live.uid]
+	}
+	return true
+}
+
+// 以Server-Sent Events推送直播数据的变动和开播下播通知
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if conf.HTTP.AllowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", conf.HTTP.AllowOrigin)
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持SSE", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if _, err = fmt.Fprintf(w, "retry: %d\n\n", sseRetry); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ch := subscribeEvents()
+	defer unsubscribeEvents(ch)
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e := <-ch:
+			if !filter.match(r.Context(), e) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			checkErr(err)
+			if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	defaultShutdownTimeout = 60               // 退出时等待未完成的任务的默认秒数
+	shutdownFlushTimeout   = 10 * time.Second // 强制退出前等待已经加入队列的写入完成的最长时间
+)
+
+// 退出前需要完成的任务，如下播后获取并保存直播时长，key为任务的序号
+var shutdownTasks = struct {
+	sync.Mutex
+	seq int
+	m   map[int]*shutdownTask
+}{m: make(map[int]*shutdownTask)}
+
+// 退出前需要完成的任务
+type shutdownTask struct {
+	Name      string       `json:"name"`             // 任务名
+	LiveID    store.LiveID `json:"liveID,omitempty"` // 任务处理的直播
+	UID       store.UID    `json:"uid,omitempty"`    // 直播的主播uid
+	StartTime string       `json:"startTime"`        // 任务开始的时间
+}
+
+// 退出报告，记录退出时放弃的任务，保存在数据库所在的文件夹
+type shutdownReport struct {
+	Time             string                 `json:"time"`             // 退出的时间
+	Timeout          int                    `json:"timeout"`          // 等待任务完成的秒数
+	TimedOut         bool                   `json:"timedOut"`         // 是否因为超时强制退出
+	Tasks            []*shutdownTask        `json:"tasks"`            // 没有完成的任务
+	PendingPlaybacks []shutdownPlaybackInfo `json:"pendingPlaybacks"` // 还在等待生成的录播，重启后不会继续查询
+	QueuedWrites     int                    `json:"queuedWrites"`     // 写入队列里还没有写入的请求数
+}
+
+// 退出时还在等待生成的录播
+type shutdownPlaybackInfo struct {
+	LiveID  store.LiveID `json:"liveID"`
+	UID     store.UID    `json:"uid"`
+	Name    string       `json:"name"`
+	EndTime string       `json:"endTime"` // 处理下播的时间
+}
+
+// 记录一个退出前需要完成的任务，返回任务完成时调用的函数
+func trackTask(name string, l *live) func() {
+	t := &shutdownTask{Name: name, LiveID: l.liveID, UID: l.uid, StartTime: time.Now().Format(time.RFC3339)}
+	shutdownTasks.Lock()
+	shutdownTasks.seq++
+	id := shutdownTasks.seq
+	shutdownTasks.m[id] = t
+	shutdownTasks.Unlock()
+	return func() {
+		shutdownTasks.Lock()
+		delete(shutdownTasks.m, id)
+		shutdownTasks.Unlock()
+	}
+}
+
+// 收到退出信号后等待所有goroutine结束，超过shutdownTimeout秒时写入退出报告，等待已经加入队列的写入完成后强制退出
+func waitShutdown() {
+	done := make(chan struct{})
+	go func() {
+		liveWG.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if conf.ShutdownTimeout > 0 {
+		timer := time.NewTimer(time.Duration(conf.ShutdownTimeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+		writeShutdownReport(false)
+		return
+	case <-timeout:
+	}
+
+	log.Printf("等待 %d 秒后还有任务没有完成，强制退出本程序", conf.ShutdownTimeout)
+	writeShutdownReport(true)
+	// 还在运行的goroutine可能继续加入写入，不能关闭写入队列，只等待已经加入的写入完成
+	flushed := make(chan struct{})
+	go func() {
+		flushWrites()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(shutdownFlushTimeout):
+		log.Printf("等待 %v 后写入队列里的写入还没有完成，放弃这些写入", shutdownFlushTimeout)
+	}
+	os.Exit(1)
+}
+
+// 有放弃的任务或录播时写入退出报告，没有时不写入
+func writeShutdownReport(timedOut bool) {
+	report := &shutdownReport{
+		Time:             time.Now().Format(time.RFC3339),
+		Timeout:          conf.ShutdownTimeout,
+		TimedOut:         timedOut,
+		Tasks:            []*shutdownTask{},
+		PendingPlaybacks: []shutdownPlaybackInfo{},
+		QueuedWrites:     len(writeQueue.ch),
+	}
+	shutdownTasks.Lock()
+	for _, t := range shutdownTasks.m {
+		report.Tasks = append(report.Tasks, t)
+	}
+	shutdownTasks.Unlock()
+	sort.Slice(report.Tasks, func(i, j int) bool { return report.Tasks[i].StartTime < report.Tasks[j].StartTime })
+	pendingPlaybacks.Lock()
+	for _, p := range pendingPlaybacks.m {
+		report.PendingPlaybacks = append(report.PendingPlaybacks, shutdownPlaybackInfo{
+			LiveID:  p.l.liveID,
+			UID:     p.l.uid,
+			Name:    p.l.name,
+			EndTime: p.endTime.Format(time.RFC3339),
+		})
+	}
+	pendingPlaybacks.Unlock()
+	sort.Slice(report.PendingPlaybacks, func(i, j int) bool {
+		return report.PendingPlaybacks[i].EndTime < report.PendingPlaybacks[j].EndTime
+	})
+	if !timedOut && len(report.Tasks) == 0 && len(report.PendingPlaybacks) == 0 {
+		return
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	checkErr(err)
+	file := filepath.Join(filepath.Dir(absPath(conf.DBFile)), fmt.Sprintf("shutdown-%s.json", time.Now().Format("20060102-150405")))
+	if err = os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		log.Printf("写入退出报告 %s 失败：%v", file, err)
+		return
+	}
+	log.Printf("有 %d 个任务没有完成，%d 场直播的录播不再查询，已写入退出报告 %s", len(report.Tasks), len(report.PendingPlaybacks), file)
+}
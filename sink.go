@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const (
+	defaultKafkaTopic  = "acfunlivedb-live" // Kafka的默认主题
+	defaultNATSSubject = "acfunlivedb.live" // NATS的默认主题前缀
+	sinkBatchSize      = 100                // 每次发送的事件数量
+	sinkPollInterval   = 5 * time.Second    // 没有事件时检查outbox的间隔
+	sinkMaxBackoff     = 5 * time.Minute    // 发送失败后重试的最长间隔
+)
+
+// 把开播和下播事件发送到数据管道的设置，事件先保存到数据库里的outbox，确认发送成功后才删除，保证至少发送一次
+type sinkConfig struct {
+	Kafka kafkaSinkConfig `json:"kafka"` // 通过Kafka REST Proxy发送到Kafka的设置
+	NATS  natsSinkConfig  `json:"nats"`  // 发送到NATS JetStream的设置
+}
+
+// 发送到Kafka的设置，需要Confluent REST Proxy（API v2）
+type kafkaSinkConfig struct {
+	RESTProxy string `json:"restProxy"`              // REST Proxy的地址，如http://127.0.0.1:8082，为空时不发送
+	Topic     string `json:"topic"`                  // 主题，消息的key为liveID
+	Username  string `json:"username"`               // HTTP Basic认证的用户名，为空时不认证
+	Password  string `json:"password" secret:"true"` // HTTP Basic认证的密码
+}
+
+// 发送到NATS JetStream的设置，需要有stream包含发送的主题
+type natsSinkConfig struct {
+	URL      string `json:"url"`                    // 服务器地址，如nats://127.0.0.1:4222，tls://开头时使用TLS，为空时不发送
+	Subject  string `json:"subject"`                // 主题前缀，事件发送到"前缀.start"、"前缀.end"和"前缀.reconnect"
+	Token    string `json:"token" secret:"true"`    // 认证的令牌
+	User     string `json:"user"`                   // 认证的用户名
+	Password string `json:"password" secret:"true"` // 认证的密码
+}
+
+// 是否设置了发送事件
+func (c *sinkConfig) enabled() bool {
+	return c.Kafka.RESTProxy != "" || c.NATS.URL != ""
+}
+
+// 把开播事件保存到outbox
+func sinkLiveStart(l *live) {
+	queueSinkEvent(&liveHookJSON{
+		Event:     changeStart,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+	})
+}
+
+// 把重连事件保存到outbox，代替下播和开播事件
+func sinkLiveReconnect(prev store.LiveID, l *live) {
+	queueSinkEvent(&liveHookJSON{
+		Event:          changeReconnect,
+		LiveID:         l.liveID,
+		UID:            l.uid,
+		Name:           l.name,
+		Title:          l.title,
+		StartTime:      l.startTime,
+		PreviousLiveID: prev,
+	})
+}
+
+// 把下播事件保存到outbox
+func sinkLiveEnd(l *live, duration int64) {
+	queueSinkEvent(&liveHookJSON{
+		Event:     changeEnd,
+		LiveID:    l.liveID,
+		UID:       l.uid,
+		Name:      l.name,
+		Title:     l.title,
+		StartTime: l.startTime,
+		Duration:  duration,
+	})
+}
+
+func queueSinkEvent(e *liveHookJSON) {
+	if !conf.Sink.enabled() {
+		return
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("生成liveID为 %s 的%s事件失败：%v", e.LiveID, liveHookName(e.Event), err)
+		return
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的%s事件", e.LiveID, liveHookName(e.Event)), nil,
+		store.OutboxWrite(string(e.Event), e.LiveID, string(payload), time.Now().UnixMilli()))
+}
+
+// 按顺序发送outbox里的事件，发送失败时按指数退避重试，之前没有发送成功的事件会在重启后继续发送
+func sinkCycle(ctx context.Context) {
+	if !conf.Sink.enabled() {
+		return
+	}
+	var nc *natsConn
+	defer func() {
+		if nc != nil {
+			nc.close()
+		}
+	}()
+	backoff := sinkPollInterval
+	var lastErr string
+	for {
+		n, err := deliverOutbox(ctx, &nc)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			if err.Error() != lastErr {
+				log.Printf("发送事件失败，%s 后重试：%v", backoff, err)
+				lastErr = err.Error()
+			}
+			if nc != nil {
+				nc.close()
+				nc = nil
+			}
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			if backoff *= 2; backoff > sinkMaxBackoff {
+				backoff = sinkMaxBackoff
+			}
+			continue
+		case lastErr != "":
+			log.Println("发送事件恢复正常")
+			lastErr = ""
+		}
+		backoff = sinkPollInterval
+		if n < sinkBatchSize && !sleepCtx(ctx, sinkPollInterval) {
+			return
+		}
+	}
+}
+
+// 发送一批事件到所有设置的目标，全部成功后从outbox删除，返回发送的数量
+func deliverOutbox(ctx context.Context, nc **natsConn) (int, error) {
+	events, err := db.QueryOutbox(ctx, sinkBatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if conf.Sink.Kafka.RESTProxy != "" {
+		if err = sendKafka(&conf.Sink.Kafka, events); err != nil {
+			return 0, fmt.Errorf("发送到Kafka失败：%w", err)
+		}
+	}
+	if conf.Sink.NATS.URL != "" {
+		if *nc == nil {
+			if *nc, err = dialNATS(ctx, &conf.Sink.NATS); err != nil {
+				return 0, fmt.Errorf("连接NATS失败：%w", err)
+			}
+		}
+		subject := conf.Sink.NATS.Subject
+		if subject == "" {
+			subject = defaultNATSSubject
+		}
+		for _, e := range events {
+			if err = (*nc).publish(subject+"."+e.Event, []byte(e.Payload)); err != nil {
+				return 0, fmt.Errorf("发送到NATS失败：%w", err)
+			}
+		}
+	}
+	if _, err = db.AckOutbox(ctx, events[len(events)-1].ID); err != nil {
+		return 0, fmt.Errorf("删除已经发送的事件失败：%w", err)
+	}
+	return len(events), nil
+}
+
+// Kafka REST Proxy返回的每条消息的结果
+type kafkaOffset struct {
+	Partition int     `json:"partition"`
+	Offset    int64   `json:"offset"`
+	ErrorCode *int    `json:"error_code"`
+	Error     *string `json:"error"`
+}
+
+// 通过Kafka REST Proxy发送事件，liveID作为消息的key
+func sendKafka(c *kafkaSinkConfig, events []store.OutboxEvent) error {
+	type record struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	records := make([]record, len(events))
+	for i, e := range events {
+		records[i] = record{Key: e.LiveID.String(), Value: json.RawMessage(e.Payload)}
+	}
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{records})
+	if err != nil {
+		return err
+	}
+	topic := c.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(strings.TrimSuffix(c.RESTProxy, "/") + "/topics/" + url.PathEscape(topic))
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if c.Username != "" {
+		req.URI().SetUsername(c.Username)
+		req.URI().SetPassword(c.Password)
+	}
+	req.SetBody(body)
+	if err = client.DoTimeout(req, resp, 30*time.Second); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		return fmt.Errorf("REST Proxy返回状态码 %d：%s", code, strings.TrimSpace(string(resp.Body())))
+	}
+	var result struct {
+		Offsets []kafkaOffset `json:"offsets"`
+	}
+	if err = json.Unmarshal(resp.Body(), &result); err != nil {
+		return fmt.Errorf("解析REST Proxy的响应失败：%w", err)
+	}
+	if len(result.Offsets) != len(events) {
+		return fmt.Errorf("REST Proxy返回了 %d 个结果，发送了 %d 条消息", len(result.Offsets), len(events))
+	}
+	for i, o := range result.Offsets {
+		if o.ErrorCode != nil || o.Error != nil {
+			var msg string
+			if o.Error != nil {
+				msg = *o.Error
+			}
+			return fmt.Errorf("发送liveID为 %s 的事件失败：%s", events[i].LiveID, msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 检查请求的bearer token，和设置的http.token相同时才调用next
+func requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(conf.HTTP.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("token不正确"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GET /snapshot?year= 下载数据库的一致快照，有year参数时下载该年份的归档数据库
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	year := 0
+	if s := r.URL.Query().Get("year"); s != "" {
+		var err error
+		if year, err = strconv.Atoi(s); err != nil || year <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("year 参数 %s 不是有效的年份", s))
+			return
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "acfunlivedb-snapshot-")
+	if err != nil {
+		log.Printf("创建数据库快照的临时文件夹出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("生成数据库快照出现错误"))
+		return
+	}
+	defer os.RemoveAll(dir)
+	name := strings.TrimSuffix(filepath.Base(conf.DBFile), filepath.Ext(conf.DBFile))
+	if year != 0 {
+		name = fmt.Sprintf("%s-%d", name, year)
+	}
+	name = fmt.Sprintf("%s-%s.db", name, time.Now().Format("20060102-150405"))
+	file := filepath.Join(dir, name)
+
+	start := time.Now()
+	if err = db.Snapshot(r.Context(), year, file); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("没有 %d 年的归档数据库", year))
+			return
+		}
+		log.Printf("生成数据库快照出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("生成数据库快照出现错误"))
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		log.Printf("打开数据库快照出现错误：%v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("生成数据库快照出现错误"))
+		return
+	}
+	defer f.Close()
+	log.Printf("已为 %s 生成数据库快照 %s，用时 %s", r.RemoteAddr, name, time.Since(start).Round(time.Millisecond))
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, start, f)
+}
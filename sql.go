@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"acfunlivedb/store"
+)
+
+// 运行"sql [--csv|--json] SELECT ..."命令，line为去掉命令名的输入
+func runSQL(ctx context.Context, line string) error {
+	format := "table"
+	line = strings.TrimSpace(line)
+	for _, f := range []string{"--csv", "--json"} {
+		if strings.HasPrefix(line, f+" ") {
+			format = f[2:]
+			line = strings.TrimSpace(line[len(f):])
+		}
+	}
+	if line == "" {
+		return errors.New(`只读查询的命令为"sql [--csv|--json] SELECT ..."`)
+	}
+	result, err := db.ReadQuery(ctx, line)
+	if err != nil {
+		return fmt.Errorf("执行查询出现错误：%w", err)
+	}
+	switch format {
+	case "csv":
+		err = printCSV(result)
+	case "json":
+		err = printJSON(result)
+	default:
+		err = printTable(result)
+	}
+	if err != nil {
+		return fmt.Errorf("打印查询结果出现错误：%w", err)
+	}
+	if result.Truncated {
+		log.Printf("查询结果太多，只打印了前 %d 行，请用LIMIT或WHERE缩小范围，或者用query子命令查询", len(result.Rows))
+		return nil
+	}
+	log.Printf("查询结果共 %d 行", len(result.Rows))
+	return nil
+}
+
+// 转换为打印的文字，NULL打印为NULL
+func sqlText(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	return fmt.Sprint(v)
+}
+
+// 按列对齐打印查询结果
+func printTable(result *store.QueryResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(result.Columns, "\t"))
+	for _, row := range result.Rows {
+		texts := make([]string, len(row))
+		for i, v := range row {
+			// 制表符和换行会打乱对齐
+			texts[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(sqlText(v))
+		}
+		fmt.Fprintln(w, strings.Join(texts, "\t"))
+	}
+	return w.Flush()
+}
+
+// 以CSV格式打印查询结果，第一行为列名
+func printCSV(result *store.QueryResult) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(result.Columns); err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// 以JSON Lines格式打印查询结果，每行一个以列名为键的对象
+func printJSON(result *store.QueryResult) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	for _, row := range result.Rows {
+		obj := make(map[string]interface{}, len(row))
+		for i, v := range row {
+			obj[result.Columns[i]] = v
+		}
+		if err := enc.Encode(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
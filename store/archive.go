@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 归档数据库的直播数据列，包括deletedAt
+const archiveLiveColumns = liveColumns + `, deletedAt`
+
+const (
+	// 归档条件，参数为before和年份
+	archiveWhere = `startTime < ? AND deletedAt = 0 AND liveID NOT IN (SELECT liveID FROM main.activeLive)
+		AND CAST(strftime('%Y', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER) = ?`
+	// 复制到归档数据库，{schema}为归档数据库的名字
+	archiveLive = `INSERT OR IGNORE INTO {schema}.acfunlive (` + archiveLiveColumns + `)
+		SELECT ` + archiveLiveColumns + ` FROM main.acfunlive WHERE ` + archiveWhere + `;`
+	archiveLiveCut = `INSERT OR IGNORE INTO {schema}.liveCutHistory (liveID, liveCutNum, fetchTime)
+		SELECT liveID, liveCutNum, fetchTime FROM main.liveCutHistory
+		WHERE liveID IN (SELECT liveID FROM main.acfunlive WHERE ` + archiveWhere + `);`
+	archiveTitle = `INSERT INTO {schema}.titleHistory (liveID, title, changeTime)
+		SELECT liveID, title, changeTime FROM main.titleHistory
+		WHERE liveID IN (SELECT liveID FROM main.acfunlive WHERE ` + archiveWhere + `);`
+	deleteArchivedLiveCut = `DELETE FROM main.liveCutHistory WHERE liveID IN (SELECT liveID FROM main.acfunlive WHERE ` + archiveWhere + `);`
+	deleteArchivedTitle   = `DELETE FROM main.titleHistory WHERE liveID IN (SELECT liveID FROM main.acfunlive WHERE ` + archiveWhere + `);`
+	deleteArchivedLive    = `DELETE FROM main.acfunlive WHERE ` + archiveWhere + `;`
+)
+
+// 附加的归档数据库
+type archive struct {
+	year   int    // 归档的直播的开播年份
+	schema string // ATTACH时使用的名字
+}
+
+// 归档数据库的文件路径
+func (s *SQLite) archivePath(year int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%d.db", s.base, year))
+}
+
+// 附加数据库文件旁边所有的归档数据库
+func (s *SQLite) attachArchives(ctx context.Context) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, s.base+"-[0-9][0-9][0-9][0-9].db"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".db")
+		year, err := strconv.Atoi(name[len(name)-4:])
+		if err != nil {
+			continue
+		}
+		if err = s.attachArchive(ctx, year); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 附加指定年份的归档数据库，文件不存在时会创建
+func (s *SQLite) attachArchive(ctx context.Context, year int) error {
+	for _, a := range s.archives {
+		if a.year == year {
+			return nil
+		}
+	}
+	schema := fmt.Sprintf("archive%d", year)
+	if _, err := s.db.ExecContext(ctx, `ATTACH DATABASE ? AS `+schema+`;`, s.archivePath(year)); err != nil {
+		return fmt.Errorf("附加归档数据库 %s 失败：%w", s.archivePath(year), err)
+	}
+	// 只读打开时不更新归档数据库的表
+	if !s.readOnly {
+		for _, query := range []string{createTable, createUIDIndex, createStartTimeIndex, createDurationIndex, createLiveCutTable, createTitleTable, createTitleIndex} {
+			query = strings.Replace(query, "IF NOT EXISTS ", "IF NOT EXISTS "+schema+".", 1)
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		if err := s.addLiveColumns(ctx, schema); err != nil {
+			return err
+		}
+	}
+	s.archives = append(s.archives, archive{year: year, schema: schema})
+	sort.Slice(s.archives, func(i, j int) bool {
+		return s.archives[i].year < s.archives[j].year
+	})
+	return nil
+}
+
+// 把查询里的{acfunlive}和{titleHistory}替换为包括归档数据库的合并查询
+func (s *SQLite) federate(query string) string {
+	union := func(table, columns string) string {
+		if len(s.archives) == 0 {
+			return table
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "(SELECT %s FROM main.%s", columns, table)
+		for _, a := range s.archives {
+			fmt.Fprintf(&b, " UNION ALL SELECT %s FROM %s.%s", columns, a.schema, table)
+		}
+		b.WriteString(")")
+		return b.String()
+	}
+	return strings.NewReplacer(
+		"{acfunlive}", union("acfunlive", archiveLiveColumns),
+		"{titleHistory}", union("titleHistory", "liveID, title, changeTime"),
+		"{liveColumns}", s.selectColumns,
+	).Replace(query)
+}
+
+// Archive 把在before（毫秒）之前开播的直播按开播年份移到归档数据库，返回每年归档的直播数量
+func (s *SQLite) Archive(ctx context.Context, before int64) (map[int]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	years, err := s.q().selectArchiveYears(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]int64, len(years))
+	for _, year := range years {
+		// ATTACH不能在事务里执行
+		if err = s.attachArchive(ctx, year); err != nil {
+			return result, err
+		}
+		n, err := s.archiveYear(ctx, before, year)
+		if err != nil {
+			return result, fmt.Errorf("归档 %d 年的直播数据失败：%w", year, err)
+		}
+		result[year] = n
+	}
+	return result, nil
+}
+
+// 在一个事务里把指定年份的直播移到归档数据库
+func (s *SQLite) archiveYear(ctx context.Context, before int64, year int) (int64, error) {
+	schema := fmt.Sprintf("archive%d", year)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		strings.ReplaceAll(archiveLiveCut, "{schema}", schema),
+		strings.ReplaceAll(archiveTitle, "{schema}", schema),
+		strings.ReplaceAll(archiveLive, "{schema}", schema),
+		deleteArchivedLiveCut,
+		deleteArchivedTitle,
+	} {
+		if _, err = tx.ExecContext(ctx, query, before, year); err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.ExecContext(ctx, deleteArchivedLive, before, year)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,37 @@
+package store
+
+import "context"
+
+const (
+	// 主播用过的头像，file为下载的头像文件
+	createAvatarTable = `CREATE TABLE IF NOT EXISTS streamerAvatar (
+		uid INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		firstSeen INTEGER NOT NULL,
+		lastSeen INTEGER NOT NULL,
+		file TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (uid, url)
+	);
+	`
+)
+
+// Avatar 是主播用过的头像
+type Avatar struct {
+	UID       UID    // 主播uid
+	URL       string // 头像链接
+	FirstSeen int64  // 第一次看到该头像的时间，单位为毫秒
+	LastSeen  int64  // 最后一次看到该头像的时间，单位为毫秒
+	File      string // 下载的头像文件，没有下载时为空
+}
+
+// AvatarWrite 记录在t（毫秒）看到主播使用的头像，file不为空时保存下载的头像文件
+func AvatarWrite(uid UID, url string, t int64, file string) Write {
+	return upsertAvatarWrite(uid, url, t, t, file)
+}
+
+// QueryAvatars 按第一次看到的时间查询主播用过的头像
+func (s *SQLite) QueryAvatars(ctx context.Context, uid UID) ([]Avatar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectAvatars(ctx, uid)
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+)
+
+// Write 是一条写入操作，用WriteBatch在一个事务里执行多条写入
+type Write struct {
+	query string
+	args  []interface{}
+	live  *Live // 插入直播时需要在执行前加密录播链接，args为直播数据之后的参数
+
+	encrypt []int // 设置了数据库密钥时需要在执行前加密的参数的位置
+}
+
+// InsertLiveWrite 插入直播数据，liveID已存在时修改的行数为0
+func InsertLiveWrite(l *Live) Write {
+	return insertLiveWrite(l)
+}
+
+// InsertActiveWrite 记录正在直播的liveID
+func InsertActiveWrite(liveID LiveID) Write {
+	return insertActiveWrite(liveID)
+}
+
+// DeleteActiveWrite 删除已经下播的liveID
+func DeleteActiveWrite(liveID LiveID) Write {
+	return deleteActiveWrite(liveID)
+}
+
+// InsertTitleWrite 记录在t（毫秒）看到的直播间标题
+func InsertTitleWrite(liveID LiveID, title string, t int64) Write {
+	return insertTitleWrite(liveID, title, t)
+}
+
+// StreamerNameWrite 记录在t（毫秒）看到主播使用的昵称
+func StreamerNameWrite(uid UID, name string, t int64) Write {
+	return upsertStreamerWrite(uid, name, t, t)
+}
+
+// UpdateAccessWrite 更新直播间的访问限制
+func UpdateAccessWrite(liveID LiveID, access string) Write {
+	return updateAccessWrite(access, liveID)
+}
+
+// RankingWrites 保存时间为t（毫秒）的直播间人气排名快照
+func RankingWrites(t int64, list []RankEntry) []Write {
+	writes := make([]Write, len(list))
+	for i, e := range list {
+		writes[i] = insertRankingWrite(t, e.Rank, e.LiveID, e.UID, e.OnlineCount)
+	}
+	return writes
+}
+
+// 返回执行写入的参数，插入直播时先检查并加密直播数据，其他写入加密需要加密的参数
+func (s *SQLite) writeArgs(w Write) ([]interface{}, error) {
+	if w.live == nil {
+		return s.encryptArgs(w.args, w.encrypt)
+	}
+	if err := w.live.Validate(); err != nil {
+		return nil, err
+	}
+	l, err := s.encryptLive(w.live)
+	if err != nil {
+		return nil, err
+	}
+	// 直播数据之后是其他参数
+	return append([]interface{}{
+		l.LiveID, l.UID, l.Name, l.StreamName, l.StartTime, l.Title, l.Duration, l.PlaybackURL, l.BackupURL, l.LiveCutNum, l.Access,
+	}, w.args...), nil
+}
+
+// 加密args里位置在indexes里的字符串参数，返回加密后的副本
+func (s *SQLite) encryptArgs(args []interface{}, indexes []int) ([]interface{}, error) {
+	if s.cipher == nil || len(indexes) == 0 {
+		return args, nil
+	}
+	enc := append([]interface{}(nil), args...)
+	for _, i := range indexes {
+		text, err := s.cipher.encrypt(enc[i].(string))
+		if err != nil {
+			return nil, err
+		}
+		enc[i] = text
+	}
+	return enc, nil
+}
+
+// 在事务外执行一条写入，返回修改的行数
+func (s *SQLite) execWrite(ctx context.Context, w Write) (int64, error) {
+	args, err := s.writeArgs(w)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, err := s.db.ExecContext(ctx, w.query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// WriteBatch 在一个事务里按顺序执行多条写入，返回每条写入修改的行数，有写入失败时整个事务回滚
+func (s *SQLite) WriteBatch(ctx context.Context, writes []Write) ([]int64, error) {
+	args := make([][]interface{}, len(writes))
+	for i, w := range writes {
+		var err error
+		if args[i], err = s.writeArgs(w); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	affected := make([]int64, len(writes))
+	for i, w := range writes {
+		result, err := tx.ExecContext(ctx, w.query, args[i]...)
+		if err != nil {
+			return nil, err
+		}
+		if affected[i], err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return affected, nil
+}
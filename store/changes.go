@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// 当前时间的毫秒时间戳
+const sqlNowMilli = `CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)`
+
+const (
+	// 直播数据的变更记录，每场直播只保留最后一次变更，seq只增不减，用作增量同步的游标
+	createChangeTable = `CREATE TABLE IF NOT EXISTS liveChange (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		liveID TEXT NOT NULL UNIQUE,
+		changeTime INTEGER NOT NULL
+	);
+	`
+	createChangeTimeIndex = `CREATE INDEX IF NOT EXISTS liveChangeTimeIndex ON liveChange (changeTime);`
+	selectChangeTrigger   = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'liveChangeInsert');`
+	// 先删除旧的记录再插入，不使用INSERT OR REPLACE，因为外层语句的冲突处理会覆盖触发器里的
+	createChangeInsertTrigger = `CREATE TRIGGER IF NOT EXISTS liveChangeInsert AFTER INSERT ON acfunlive BEGIN
+		DELETE FROM liveChange WHERE liveID = new.liveID;
+		INSERT INTO liveChange (liveID, changeTime) VALUES (new.liveID, ` + sqlNowMilli + `);
+	END;
+	`
+	createChangeUpdateTrigger = `CREATE TRIGGER IF NOT EXISTS liveChangeUpdate AFTER UPDATE ON acfunlive BEGIN
+		DELETE FROM liveChange WHERE liveID = new.liveID;
+		INSERT INTO liveChange (liveID, changeTime) VALUES (new.liveID, ` + sqlNowMilli + `);
+	END;
+	`
+	// 彻底删除的直播留下变更记录，让下游知道直播已经不存在。归档直播时也会记录一次变更，直播数据不变
+	createChangeDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS liveChangeDelete AFTER DELETE ON acfunlive BEGIN
+		DELETE FROM liveChange WHERE liveID = old.liveID;
+		INSERT INTO liveChange (liveID, changeTime) VALUES (old.liveID, ` + sqlNowMilli + `);
+	END;
+	`
+	// 第一次创建触发器时按开播时间为已有的直播生成变更记录
+	backfillChanges = `INSERT OR IGNORE INTO liveChange (liveID, changeTime)
+		SELECT liveID, startTime FROM {acfunlive} ORDER BY startTime, liveID;
+	`
+
+	// 从主实例同步直播数据的进度，seq为已经同步的最后一次变更
+	createSyncTable = `CREATE TABLE IF NOT EXISTS syncState (
+		source TEXT PRIMARY KEY,
+		seq INTEGER NOT NULL
+	);
+	`
+)
+
+// ChangeQuery 是查询直播数据变更的条件
+type ChangeQuery struct {
+	After int64 // 只查询seq大于After的变更
+	Since int64 // 只查询变更时间不早于Since的变更，单位为毫秒
+	Limit int   // 最多返回的数量
+}
+
+// LiveChange 是一场直播最后一次变更的记录
+type LiveChange struct {
+	Seq        int64  // 变更的序号，越晚的变更越大
+	LiveID     LiveID // 直播ID
+	ChangeTime int64  // 变更时间，单位为毫秒
+	Deleted    bool   // 直播是否已经被删除
+	Live       *Live  // 直播数据，直播被彻底删除时为nil
+}
+
+// MirrorLiveWrites 保存从主实例同步的直播数据，deletedAt不为0时直播为已删除
+func MirrorLiveWrites(l *Live, deletedAt int64) []Write {
+	return []Write{
+		updateMirrorLiveWrite(l, l.SuggestedTitle, l.RecordFile, deletedAt),
+		insertMirrorLiveWrite(l, l.SuggestedTitle, l.RecordFile, deletedAt),
+	}
+}
+
+// MirrorDeleteWrite 软删除在主实例已经被彻底删除的直播
+func MirrorDeleteWrite(liveID LiveID, deletedAt int64) Write {
+	return softDeleteMirrorLiveWrite(deletedAt, liveID)
+}
+
+// SyncSeqWrite 保存从source同步到的seq
+func SyncSeqWrite(source string, seq int64) Write {
+	return upsertSyncSeqWrite(source, seq)
+}
+
+// QuerySyncSeq 查询从source同步到的seq，还没有同步时返回0
+func (s *SQLite) QuerySyncSeq(ctx context.Context, source string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seq, err := s.q().selectSyncSeq(ctx, source)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// 创建记录直播数据变更的触发器，第一次创建时为已有的直播生成变更记录，需要在附加归档数据库后调用
+func (s *SQLite) setupChangeTriggers(ctx context.Context) error {
+	var hasTrigger bool
+	if err := s.db.QueryRowContext(ctx, selectChangeTrigger).Scan(&hasTrigger); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		createChangeInsertTrigger,
+		createChangeUpdateTrigger,
+		createChangeDeleteTrigger,
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	if !hasTrigger {
+		if _, err = tx.ExecContext(ctx, s.federate(backfillChanges)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QueryChanges 按seq从小到大查询直播数据的变更，每场直播只返回最后一次变更
+func (s *SQLite) QueryChanges(ctx context.Context, q ChangeQuery) ([]LiveChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes, err := s.q().selectChanges(ctx, q.After, q.Since, q.Limit)
+	if err != nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	// 在同一个读锁里查询直播数据，和变更记录一致
+	rows, err := s.q().selectChangedLives(ctx, q.After, q.Since, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	lives := make(map[LiveID]*Live, len(rows))
+	deleted := make(map[LiveID]bool)
+	for i := range rows {
+		r := &rows[i]
+		lives[r.Live.LiveID] = &r.Live
+		deleted[r.Live.LiveID] = r.DeletedAt != 0
+	}
+	for i := range changes {
+		c := &changes[i]
+		if c.Live = lives[c.LiveID]; c.Live == nil {
+			c.Deleted = true
+		} else {
+			c.Deleted = deleted[c.LiveID]
+		}
+	}
+	return changes, nil
+}
+
+// LastChangeSeq 返回最后一次变更的seq，没有变更时返回0
+func (s *SQLite) LastChangeSeq(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectLastChange(ctx)
+}
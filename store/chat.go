@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 每场直播的弹幕统计，只统计直播开始后的弹幕。histogram为"分钟:弹幕数"用逗号连接，没有弹幕的分钟不保存。
+	// 弹幕记录结束时生成，归档直播时弹幕统计不会移到归档数据库
+	createChatStatsTable = `CREATE TABLE IF NOT EXISTS chatStats (
+		liveID TEXT PRIMARY KEY,
+		messageCount INTEGER NOT NULL,
+		chatterCount INTEGER NOT NULL,
+		peakMinute INTEGER NOT NULL,
+		peakCount INTEGER NOT NULL,
+		histogram TEXT NOT NULL
+	);
+	`
+)
+
+// ChatStats 是一场直播的弹幕统计
+type ChatStats struct {
+	LiveID       LiveID // 直播ID
+	StartTime    int64  // 直播开始的时间，单位为毫秒
+	MessageCount int    // 弹幕总数
+	ChatterCount int    // 发送弹幕的观众数量
+	PeakMinute   int    // 弹幕最多的一分钟，为直播开始后的分钟数
+	PeakCount    int    // 弹幕最多的一分钟的弹幕数
+	Histogram    string // 每分钟的弹幕数，用Minutes解析
+}
+
+// Minutes 返回直播开始后每分钟的弹幕数，没有弹幕的分钟为0
+func (c *ChatStats) Minutes() []int {
+	counts := make(map[int]int)
+	last := -1
+	for _, pair := range strings.Split(c.Histogram, ",") {
+		m, n, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		minute, err1 := strconv.Atoi(m)
+		count, err2 := strconv.Atoi(n)
+		if err1 != nil || err2 != nil || minute < 0 {
+			continue
+		}
+		counts[minute] = count
+		if minute > last {
+			last = minute
+		}
+	}
+	minutes := make([]int, last+1)
+	for m, n := range counts {
+		minutes[m] = n
+	}
+	return minutes
+}
+
+// ChatStatsWrite 根据已经保存的弹幕生成直播的弹幕统计，需要在弹幕写入后执行
+func ChatStatsWrite(liveID LiveID) Write {
+	return upsertChatStatsWrite(liveID)
+}
+
+// QueryChatStats 查询直播的弹幕统计，没有统计时返回nil
+func (s *SQLite) QueryChatStats(ctx context.Context, liveID LiveID) (*ChatStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, err := s.q().selectChatStats(ctx, liveID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// RecomputeChatStats 根据所有弹幕重新生成每场直播的弹幕统计，返回统计的行数
+func (s *SQLite) RecomputeChatStats(ctx context.Context) (int64, error) {
+	return s.rebuild(ctx, queries.deleteChatStats, queries.rebuildChatStats)
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ComputedColumn 是查询直播数据时用sqlite表达式计算的列，不会保存到数据库
+type ComputedColumn struct {
+	Name string // 列名，只能含有字母、数字和下划线
+	Expr string // sqlite表达式，可以使用acfunlive表的列，如duration / 3600000.0
+}
+
+var columnNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 检查计算列并生成查询直播数据时使用的列
+func (s *SQLite) setComputed(ctx context.Context, cols []ComputedColumn) error {
+	names := make(map[string]bool)
+	for _, c := range strings.Split(archiveLiveColumns, ",") {
+		names[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	var b strings.Builder
+	b.WriteString(liveColumns)
+	for _, c := range cols {
+		if !columnNameRegexp.MatchString(c.Name) {
+			return fmt.Errorf("计算列的名字 %q 只能含有字母、数字和下划线，并且不能以数字开头", c.Name)
+		}
+		if names[strings.ToLower(c.Name)] {
+			return fmt.Errorf("计算列的名字 %s 和其他列重复", c.Name)
+		}
+		names[strings.ToLower(c.Name)] = true
+		if strings.TrimSpace(c.Expr) == "" {
+			return fmt.Errorf("计算列 %s 的表达式为空", c.Name)
+		}
+		// 表达式只能是单条只读语句里的一部分
+		if _, err := checkReadOnly("SELECT (" + c.Expr + ") FROM acfunlive"); err != nil {
+			return fmt.Errorf("计算列 %s 的表达式无效：%w", c.Name, err)
+		}
+		fmt.Fprintf(&b, `, (%s) AS "%s"`, c.Expr, c.Name)
+	}
+	s.computed = cols
+	s.selectColumns = b.String()
+	if len(cols) == 0 {
+		return nil
+	}
+
+	// sqlite在准备语句时会检查表达式里的列和函数
+	rows, err := s.db.QueryContext(ctx, s.federate(`SELECT {liveColumns} FROM {acfunlive} LIMIT 0;`))
+	if err != nil {
+		return fmt.Errorf("计算列的表达式无效：%w", err)
+	}
+	return rows.Close()
+}
+
+// 计算列的值的扫描目标
+func (s *SQLite) computedDest() []interface{} {
+	if len(s.computed) == 0 {
+		return nil
+	}
+	dest := make([]interface{}, len(s.computed))
+	for i := range dest {
+		dest[i] = new(interface{})
+	}
+	return dest
+}
+
+// 保存扫描得到的计算列的值，sqlite的文本值会被扫描为[]byte，转换为字符串
+func (s *SQLite) setComputedValues(l *Live, dest []interface{}) {
+	if len(dest) == 0 {
+		return
+	}
+	l.Computed = make(map[string]interface{}, len(dest))
+	for i, d := range dest {
+		v := *d.(*interface{})
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		l.Computed[s.computed[i].Name] = v
+	}
+}
@@ -0,0 +1,35 @@
+package store
+
+import "context"
+
+const (
+	// 下载的直播封面，url为直播间列表里的封面链接，file为保存的封面文件。归档直播时封面记录不会移到归档数据库
+	createCoverTable = `CREATE TABLE IF NOT EXISTS liveCover (
+		liveID TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		file TEXT NOT NULL,
+		downloadTime INTEGER NOT NULL
+	);
+	`
+)
+
+// LiveCover 是下载的直播封面
+type LiveCover struct {
+	LiveID    LiveID // 直播ID
+	StartTime int64  // 直播开始的时间，单位为毫秒
+	URL       string // 下载时的封面链接
+	File      string // 保存的封面文件
+	Time      int64  // 下载的时间，单位为毫秒
+}
+
+// CoverWrite 保存在t（毫秒）下载的直播封面文件
+func CoverWrite(liveID LiveID, url, file string, t int64) Write {
+	return insertCoverWrite(liveID, url, file, t)
+}
+
+// QueryCovers 按开始时间从旧到新查询主播下载过的直播封面
+func (s *SQLite) QueryCovers(ctx context.Context, uid UID) ([]LiveCover, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectCovers(ctx, uid)
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// 加密后的数据的前缀，密钥由scrypt生成，没有前缀的是明文
+	encryptedPrefix = "enc2:"
+	// 旧版本加密的数据的前缀，密钥为SHA-256，打开数据库时重新加密
+	legacyEncryptedPrefix = "enc:"
+)
+
+// scrypt的参数，打开数据库时计算一次密钥
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	cryptSaltSize = 16
+)
+
+const (
+	// 生成密钥的随机盐（base64），只有一行，第一次设置密钥时生成，归档数据库也用这个盐
+	createCryptSaltTable = `CREATE TABLE IF NOT EXISTS cryptSalt (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		salt TEXT NOT NULL
+	);
+	`
+	selectCryptSaltTable = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'cryptSalt');`
+
+	// 需要加密的明文和旧版本加密的录播链接，{schema}为数据库的名字
+	selectPlainURLs = `SELECT liveID, playbackURL, backupURL FROM {schema}.acfunlive
+		WHERE (playbackURL != '' AND playbackURL NOT LIKE 'enc2:%') OR (backupURL != '' AND backupURL NOT LIKE 'enc2:%');
+	`
+	updateURLs = `UPDATE {schema}.acfunlive SET playbackURL = ?, backupURL = ? WHERE liveID = ?;`
+)
+
+// 用AES-GCM加密录播链接和等待发送的通知、事件
+type urlCipher struct {
+	aead   cipher.AEAD // 用scrypt生成的密钥，没有盐时为nil
+	legacy cipher.AEAD // 用旧版本的SHA-256密钥，只用来解密
+}
+
+// 用密钥和盐通过scrypt生成AES-256的密钥，key为空时不加密，salt为空时只能解密旧版本加密的数据
+func newURLCipher(key string, salt []byte) (*urlCipher, error) {
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	legacy, err := newGCM(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	c := &urlCipher{legacy: legacy}
+	if len(salt) == 0 {
+		return c, nil
+	}
+	derived, err := scrypt.Key([]byte(key), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	if c.aead, err = newGCM(derived); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 读取生成密钥的盐，没有盐时create为true就生成，否则返回nil
+func (s *SQLite) cryptSalt(ctx context.Context, create bool) ([]byte, error) {
+	// 只读打开旧版本的数据库时没有盐的表
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, selectCryptSaltTable).Scan(&exists); err != nil || !exists {
+		return nil, err
+	}
+	salt, err := s.q().selectCryptSalt(ctx)
+	switch {
+	case err == nil:
+		return base64.StdEncoding.DecodeString(salt)
+	case !errors.Is(err, sql.ErrNoRows) || !create:
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		return nil, err
+	}
+	b := make([]byte, cryptSaltSize)
+	if _, err = rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, s.q().insertCryptSalt(ctx, base64.StdEncoding.EncodeToString(b))
+}
+
+// 加密，没有设置密钥时返回原文
+func (c *urlCipher) encrypt(text string) (string, error) {
+	if c == nil || text == "" || strings.HasPrefix(text, encryptedPrefix) {
+		return text, nil
+	}
+	if c.aead == nil {
+		return "", errors.New("没有生成密钥的盐，不能加密")
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := c.aead.Seal(nonce, nonce, []byte(text), nil)
+	return encryptedPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// 解密，明文直接返回
+func (c *urlCipher) decrypt(text string) (string, error) {
+	var prefix string
+	switch {
+	case strings.HasPrefix(text, encryptedPrefix):
+		prefix = encryptedPrefix
+	case strings.HasPrefix(text, legacyEncryptedPrefix):
+		prefix = legacyEncryptedPrefix
+	default:
+		return text, nil
+	}
+	if c == nil {
+		return "", errors.New("数据已加密，需要设置数据库密钥")
+	}
+	aead := c.aead
+	if prefix == legacyEncryptedPrefix {
+		aead = c.legacy
+	}
+	if aead == nil {
+		return "", errors.New("解密失败：数据库里没有生成密钥的盐")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(text[len(prefix):])
+	if err != nil {
+		return "", fmt.Errorf("解密失败：%w", err)
+	}
+	size := aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("解密失败：数据太短")
+	}
+	plain, err := aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", errors.New("解密失败，数据库密钥可能不正确")
+	}
+	return string(plain), nil
+}
+
+// 重新加密旧版本加密的数据，密钥错误不能解密时返回原来的数据
+func (c *urlCipher) reencrypt(text string) (string, error) {
+	plain, err := c.decrypt(text)
+	if err != nil {
+		return text, nil
+	}
+	return c.encrypt(plain)
+}
+
+// 加密直播数据里的录播链接，返回加密后的副本
+func (s *SQLite) encryptLive(l *Live) (*Live, error) {
+	if s.cipher == nil {
+		return l, nil
+	}
+	enc := *l
+	var err error
+	if enc.PlaybackURL, err = s.cipher.encrypt(l.PlaybackURL); err != nil {
+		return nil, err
+	}
+	if enc.BackupURL, err = s.cipher.encrypt(l.BackupURL); err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+// 解密直播数据里的录播链接
+func (s *SQLite) decryptLive(l *Live) error {
+	var err error
+	if l.PlaybackURL, err = s.cipher.decrypt(l.PlaybackURL); err != nil {
+		return err
+	}
+	l.BackupURL, err = s.cipher.decrypt(l.BackupURL)
+	return err
+}
+
+// 加密数据库里的明文录播链接，旧版本加密的录播链接用新的密钥重新加密，返回加密的直播数量
+func (s *SQLite) encryptPlainURLs(ctx context.Context, schema string) (int64, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	rows, err := s.db.QueryContext(ctx, strings.ReplaceAll(selectPlainURLs, "{schema}", schema))
+	if err != nil {
+		return 0, err
+	}
+	var plain []Live
+	for rows.Next() {
+		var l Live
+		if err = rows.Scan(&l.LiveID, &l.PlaybackURL, &l.BackupURL); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain = append(plain, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(plain) == 0 {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	query := strings.ReplaceAll(updateURLs, "{schema}", schema)
+	var n int64
+	for _, l := range plain {
+		playback, err := s.cipher.reencrypt(l.PlaybackURL)
+		if err != nil {
+			return 0, err
+		}
+		backup, err := s.cipher.reencrypt(l.BackupURL)
+		if err != nil {
+			return 0, err
+		}
+		if playback == l.PlaybackURL && backup == l.BackupURL {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, query, playback, backup, l.LiveID); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
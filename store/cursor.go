@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	// 批处理任务的进度，cursor为最后处理完的liveID或uid，任务完成后删除
+	createJobCursorTable = `CREATE TABLE IF NOT EXISTS jobCursor (
+		job TEXT PRIMARY KEY,
+		cursor TEXT NOT NULL,
+		updateTime INTEGER NOT NULL
+	);
+	`
+)
+
+// JobCursorWrite 保存批处理任务在updateTime（毫秒）时处理到的位置，cursor为空时删除进度
+func JobCursorWrite(job, cursor string, updateTime int64) Write {
+	if cursor == "" {
+		return deleteJobCursorWrite(job)
+	}
+	return upsertJobCursorWrite(job, cursor, updateTime)
+}
+
+// QueryJobCursor 查询批处理任务上次中断时处理到的位置，没有中断过时返回空字符串
+func (s *SQLite) QueryJobCursor(ctx context.Context, job string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cursor, err := s.q().selectJobCursor(ctx, job)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return cursor, err
+}
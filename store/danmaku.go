@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// 直播的弹幕，sendTime为发送时间，单位为毫秒，medal开头的列为发送者佩戴的守护徽章，没有佩戴时medalUID为0。归档直播时弹幕不会移到归档数据库
+	createDanmakuTable = `CREATE TABLE IF NOT EXISTS danmaku (
+		id INTEGER PRIMARY KEY,
+		liveID TEXT NOT NULL,
+		sendTime INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		nickname TEXT NOT NULL,
+		content TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT 'live',
+		medalUID INTEGER NOT NULL DEFAULT 0,
+		medalName TEXT NOT NULL DEFAULT '',
+		medalLevel INTEGER NOT NULL DEFAULT 0
+	);
+	`
+	createDanmakuIndex = `CREATE INDEX IF NOT EXISTS danmakuLiveIDIndex ON danmaku (liveID, sendTime);`
+	// 弹幕内容的全文索引，trigram分词支持中文的子串搜索
+	createDanmakuFTS = `CREATE VIRTUAL TABLE IF NOT EXISTS danmakuFTS USING fts5(
+		content, content = 'danmaku', content_rowid = 'id', tokenize = 'trigram'
+	);
+	`
+	createDanmakuInsertTrigger = `CREATE TRIGGER IF NOT EXISTS danmakuInsert AFTER INSERT ON danmaku BEGIN
+		INSERT INTO danmakuFTS (rowid, content) VALUES (new.id, new.content);
+	END;
+	`
+	createDanmakuDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS danmakuDelete AFTER DELETE ON danmaku BEGIN
+		INSERT INTO danmakuFTS (danmakuFTS, rowid, content) VALUES ('delete', old.id, old.content);
+	END;
+	`
+	// 每场直播的弹幕记录，startTime为直播开始时间，弹幕在直播里的时间以此为准。closeTime为0时还在记录
+	createDanmakuSessionTable = `CREATE TABLE IF NOT EXISTS danmakuSession (
+		liveID TEXT PRIMARY KEY,
+		uid INTEGER NOT NULL,
+		startTime INTEGER NOT NULL,
+		openTime INTEGER NOT NULL,
+		closeTime INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'open',
+		danmakuCount INTEGER NOT NULL DEFAULT 0
+	);
+	`
+	searchDanmakuFTS = `SELECT d.liveID, l.uid, l.name, d.sendTime - l.startTime, d.sendTime, d.uid, d.nickname, d.content, d.source
+		FROM danmakuFTS f
+		JOIN danmaku d ON d.id = f.rowid
+		JOIN {acfunlive} l ON l.liveID = d.liveID
+		WHERE danmakuFTS MATCH ?`
+	searchDanmakuLike = `SELECT d.liveID, l.uid, l.name, d.sendTime - l.startTime, d.sendTime, d.uid, d.nickname, d.content, d.source
+		FROM danmaku d
+		JOIN {acfunlive} l ON l.liveID = d.liveID
+		WHERE 1`
+)
+
+// trigram分词最少需要3个字才能使用全文索引
+const minTrigramLength = 3
+
+// 弹幕的来源
+const (
+	DanmakuLive   = "live"   // 直播时连接直播间记录的弹幕
+	DanmakuReplay = "replay" // 直播结束后从录播的ASS弹幕文件导入的弹幕，发送时间是估算的
+)
+
+// 弹幕记录的状态
+const (
+	SessionOpen        = "open"        // 正在记录
+	SessionFinished    = "finished"    // 下播时正常结束
+	SessionInterrupted = "interrupted" // 本程序退出或崩溃时还没有结束，可能缺少之后的弹幕
+)
+
+// Danmaku 是直播的一条弹幕
+type Danmaku struct {
+	LiveID   LiveID // 直播ID
+	SendTime int64  // 发送时间，单位为毫秒
+	UID      int64  // 发送者的uid
+	Nickname string // 发送者的昵称
+	Content  string // 弹幕内容
+	Source   string // 弹幕的来源，为空时为DanmakuLive
+	Medal           // 发送者佩戴的守护徽章
+}
+
+// Medal 是观众佩戴的守护徽章
+type Medal struct {
+	MedalUID   int64  // 守护徽章所属主播的uid，没有佩戴时为0
+	MedalName  string // 守护徽章的名字
+	MedalLevel int    // 守护徽章的等级
+}
+
+// DanmakuSession 是一场直播的弹幕记录
+type DanmakuSession struct {
+	LiveID       LiveID // 直播ID
+	UID          UID    // 主播uid
+	StartTime    int64  // 直播开始时间，单位为毫秒
+	OpenTime     int64  // 开始记录的时间，单位为毫秒
+	CloseTime    int64  // 结束记录的时间，单位为毫秒，还在记录时为0
+	Status       string // 记录的状态，为Session开头的常量
+	DanmakuCount int    // 结束时记录到的弹幕数量
+}
+
+// 弹幕的来源，没有设置时为直播时记录的弹幕
+func (d *Danmaku) source() string {
+	if d.Source == "" {
+		return DanmakuLive
+	}
+	return d.Source
+}
+
+// DanmakuQuery 是搜索弹幕的条件
+type DanmakuQuery struct {
+	Keywords []string // 弹幕需要包含所有关键词
+	UID      UID      // 只搜索这个主播的直播，为0时搜索全部
+	Since    int64    // 只搜索这个时间（毫秒）之后发送的弹幕，为0时不限制
+	Limit    int      // 最多返回的数量，小于等于0时不限制
+}
+
+// DanmakuMatch 是搜索到的弹幕
+type DanmakuMatch struct {
+	Danmaku
+	LiverUID  UID    // 主播uid
+	LiverName string // 主播昵称
+	Offset    int64  // 弹幕在直播里的时间，单位为毫秒
+}
+
+// TimedDanmaku 是带有在直播里的时间的弹幕
+type TimedDanmaku struct {
+	Offset   int64  // 弹幕在直播里的时间，单位为毫秒，直播开始前发送的弹幕为负数
+	UID      int64  // 发送者的uid
+	Nickname string // 发送者的昵称
+	Content  string // 弹幕内容
+}
+
+// DanmakuPeak 是直播里弹幕较多的时间段
+type DanmakuPeak struct {
+	Offset int64 // 时间段在直播里的开始时间，单位为毫秒
+	Count  int   // 时间段里的弹幕数量
+}
+
+// DanmakuWrite 保存一条弹幕
+func DanmakuWrite(d *Danmaku) Write {
+	return insertDanmakuWrite(d.LiveID, d.SendTime, d.UID, d.Nickname, d.Content, d.source(), d.MedalUID, d.MedalName, d.MedalLevel)
+}
+
+// DanmakuSessionOpenWrite 开始记录直播的弹幕，同一场直播之前的记录会被重新打开
+func DanmakuSessionOpenWrite(sess *DanmakuSession) Write {
+	return openDanmakuSessionWrite(sess.LiveID, sess.UID, sess.StartTime, sess.OpenTime)
+}
+
+// DanmakuSessionCloseWrite 在closeTime（毫秒）结束记录直播的弹幕，并保存记录到的弹幕数量
+func DanmakuSessionCloseWrite(liveID LiveID, closeTime int64) Write {
+	return closeDanmakuSessionWrite(closeTime, SessionFinished, liveID)
+}
+
+// InsertDanmaku 在一个事务里保存弹幕
+func (s *SQLite) InsertDanmaku(ctx context.Context, list []Danmaku) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertDanmaku)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := range list {
+		d := &list[i]
+		if _, err = stmt.ExecContext(ctx, DanmakuWrite(d).args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchDanmaku 按发送时间搜索含有所有关键词的弹幕，关键词都有3个字以上时使用全文索引
+func (s *SQLite) SearchDanmaku(ctx context.Context, q DanmakuQuery) ([]DanmakuMatch, error) {
+	useFTS := len(q.Keywords) != 0
+	for _, kw := range q.Keywords {
+		if utf8.RuneCountInString(kw) < minTrigramLength {
+			useFTS = false
+		}
+	}
+
+	var b strings.Builder
+	var args []interface{}
+	if useFTS {
+		b.WriteString(searchDanmakuFTS)
+		phrases := make([]string, len(q.Keywords))
+		for i, kw := range q.Keywords {
+			phrases[i] = `"` + strings.ReplaceAll(kw, `"`, `""`) + `"`
+		}
+		args = append(args, strings.Join(phrases, " AND "))
+	} else {
+		b.WriteString(searchDanmakuLike)
+		for _, kw := range q.Keywords {
+			b.WriteString(` AND d.content LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+likeEscaper.Replace(kw)+"%")
+		}
+	}
+	if q.UID != 0 {
+		b.WriteString(" AND l.uid = ?")
+		args = append(args, q.UID)
+	}
+	if q.Since != 0 {
+		b.WriteString(" AND d.sendTime >= ?")
+		args = append(args, q.Since)
+	}
+	b.WriteString(" ORDER BY d.sendTime")
+	if q.Limit > 0 {
+		b.WriteString(" LIMIT ?")
+		args = append(args, q.Limit)
+	}
+	b.WriteString(";")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rows, err := s.db.QueryContext(ctx, s.federate(b.String()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []DanmakuMatch
+	for rows.Next() {
+		var m DanmakuMatch
+		err = rows.Scan(&m.LiveID, &m.LiverUID, &m.LiverName, &m.Offset, &m.SendTime, &m.UID, &m.Nickname, &m.Content, &m.Source)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// QueryDanmakuPeaks 把直播的弹幕按bucket（毫秒）分段，返回弹幕最多的n个时间段，按时间从早到晚排列，n小于0时返回所有时间段
+func (s *SQLite) QueryDanmakuPeaks(ctx context.Context, liveID LiveID, bucket int64, n int) ([]DanmakuPeak, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, err := s.q().selectDanmakuPeaks(ctx, bucket, liveID, n)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Offset < list[j].Offset })
+	return list, nil
+}
+
+// QueryTimedDanmaku 按发送时间查询直播的所有弹幕和弹幕在直播里的时间
+func (s *SQLite) QueryTimedDanmaku(ctx context.Context, liveID LiveID) ([]TimedDanmaku, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectTimedDanmaku(ctx, liveID)
+}
+
+// CountDanmaku 查询直播来源为source的弹幕数量
+func (s *SQLite) CountDanmaku(ctx context.Context, liveID LiveID, source string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().countDanmaku(ctx, liveID, source)
+}
+
+// QueryDanmakuSession 查询直播的弹幕记录，没有记录时返回nil
+func (s *SQLite) QueryDanmakuSession(ctx context.Context, liveID LiveID) (*DanmakuSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, err := s.q().selectDanmakuSession(ctx, liveID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// CloseStaleDanmakuSessions 把上次运行时没有结束的弹幕记录标记为中断并合计礼物，返回标记的数量
+func (s *SQLite) CloseStaleDanmakuSessions(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := s.qtx(tx)
+	if err = q.upsertStaleGiftTotal(ctx); err != nil {
+		return 0, err
+	}
+	if err = q.upsertStaleChatStats(ctx); err != nil {
+		return 0, err
+	}
+	n, err := q.closeStaleDanmakuSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
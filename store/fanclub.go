@@ -0,0 +1,43 @@
+package store
+
+import "context"
+
+const (
+	// 直播开始和结束时主播的守护团信息，没有守护团时clubName为空。归档直播时守护团信息不会移到归档数据库
+	createFanClubTable = `CREATE TABLE IF NOT EXISTS fanClub (
+		liveID TEXT NOT NULL,
+		phase TEXT NOT NULL,
+		sampleTime INTEGER NOT NULL,
+		clubName TEXT NOT NULL,
+		memberCount INTEGER NOT NULL,
+		PRIMARY KEY (liveID, phase)
+	);
+	`
+)
+
+// 获取守护团信息的时机
+const (
+	FanClubStart = "start" // 直播开始时
+	FanClubEnd   = "end"   // 直播结束时
+)
+
+// FanClub 是直播开始或结束时主播的守护团信息
+type FanClub struct {
+	LiveID      LiveID // 直播ID
+	Phase       string // 获取的时机，为FanClubStart或FanClubEnd
+	Time        int64  // 获取的时间，单位为毫秒
+	ClubName    string // 守护徽章的名字，主播没有守护团时为空
+	MemberCount int    // 拥有主播守护徽章的用户数量
+}
+
+// FanClubWrite 保存直播开始或结束时主播的守护团信息
+func FanClubWrite(f *FanClub) Write {
+	return insertFanClubWrite(f.LiveID, f.Phase, f.Time, f.ClubName, f.MemberCount)
+}
+
+// QueryFanClub 按时间从旧到新查询直播开始和结束时主播的守护团信息
+func (s *SQLite) QueryFanClub(ctx context.Context, liveID LiveID) ([]FanClub, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectFanClub(ctx, liveID)
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 直播间收到的礼物，acCoin为付费礼物花费的AC币，免费礼物为0。归档直播时礼物不会移到归档数据库
+	createGiftTable = `CREATE TABLE IF NOT EXISTS gift (
+		id INTEGER PRIMARY KEY,
+		liveID TEXT NOT NULL,
+		sendTime INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		nickname TEXT NOT NULL,
+		giftID INTEGER NOT NULL,
+		giftName TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		acCoin INTEGER NOT NULL
+	);
+	`
+	createGiftIndex = `CREATE INDEX IF NOT EXISTS giftLiveIDIndex ON gift (liveID, sendTime);`
+	// 每场直播每种礼物的合计，senders为赠送这种礼物的观众数量，弹幕记录结束时由gift表生成
+	createGiftTotalTable = `CREATE TABLE IF NOT EXISTS giftTotal (
+		liveID TEXT NOT NULL,
+		giftID INTEGER NOT NULL,
+		giftName TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		acCoin INTEGER NOT NULL,
+		senders INTEGER NOT NULL,
+		PRIMARY KEY (liveID, giftID)
+	);
+	`
+	// 观众在每个主播的直播间里的弹幕和礼物统计，由触发器在保存弹幕和礼物时增量更新
+	createFanTable = `CREATE TABLE IF NOT EXISTS fanStats (
+		liverUID INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		nickname TEXT NOT NULL,
+		messageCount INTEGER NOT NULL,
+		giftCount INTEGER NOT NULL,
+		acCoin INTEGER NOT NULL,
+		firstSeen INTEGER NOT NULL,
+		lastSeen INTEGER NOT NULL,
+		PRIMARY KEY (liverUID, uid)
+	);
+	`
+	createFanIndex    = `CREATE INDEX IF NOT EXISTS fanStatsMessageIndex ON fanStats (liverUID, messageCount);`
+	selectFanTrigger  = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'fanStatsDanmaku');`
+	upsertFanConflict = ` ON CONFLICT (liverUID, uid) DO UPDATE SET
+			nickname = CASE WHEN excluded.lastSeen >= lastSeen THEN excluded.nickname ELSE nickname END,
+			messageCount = messageCount + excluded.messageCount,
+			giftCount = giftCount + excluded.giftCount,
+			acCoin = acCoin + excluded.acCoin,
+			firstSeen = MIN(firstSeen, excluded.firstSeen),
+			lastSeen = MAX(lastSeen, excluded.lastSeen)`
+	// 直播在保存弹幕和礼物时还没有归档，只需要查询main里的acfunlive表
+	createFanDanmakuTrigger = `CREATE TRIGGER IF NOT EXISTS fanStatsDanmaku AFTER INSERT ON danmaku BEGIN
+		INSERT INTO fanStats (liverUID, uid, nickname, messageCount, giftCount, acCoin, firstSeen, lastSeen)
+			SELECT uid, new.uid, new.nickname, 1, 0, 0, new.sendTime, new.sendTime FROM acfunlive WHERE liveID = new.liveID
+		` + upsertFanConflict + `;
+	END;
+	`
+	createFanGiftTrigger = `CREATE TRIGGER IF NOT EXISTS fanStatsGift AFTER INSERT ON gift BEGIN
+		INSERT INTO fanStats (liverUID, uid, nickname, messageCount, giftCount, acCoin, firstSeen, lastSeen)
+			SELECT uid, new.uid, new.nickname, 0, new.count, new.acCoin, new.sendTime, new.sendTime FROM acfunlive WHERE liveID = new.liveID
+		` + upsertFanConflict + `;
+	END;
+	`
+)
+
+// Gift 是直播间收到的一次礼物
+type Gift struct {
+	LiveID   LiveID // 直播ID
+	SendTime int64  // 赠送时间，单位为毫秒
+	UID      int64  // 赠送者的uid
+	Nickname string // 赠送者的昵称
+	GiftID   int64  // 礼物ID
+	GiftName string // 礼物名字
+	Count    int    // 礼物数量
+	ACCoin   int64  // 付费礼物花费的AC币，免费礼物为0
+}
+
+// GiftTotal 是一场直播里一种礼物的合计
+type GiftTotal struct {
+	GiftID   int64  // 礼物ID
+	GiftName string // 礼物名字
+	Count    int    // 礼物数量
+	ACCoin   int64  // 花费的AC币，免费礼物（香蕉）为0
+	Senders  int    // 赠送这种礼物的观众数量
+}
+
+// Income 是一场直播收到的礼物的合计
+type Income struct {
+	LiveID    LiveID // 直播ID
+	StartTime int64  // 直播开始时间，单位为毫秒
+	Title     string // 直播间标题
+	ACCoin    int64  // 付费礼物花费的AC币
+	PaidCount int    // 付费礼物的数量
+	Bananas   int    // 免费礼物（香蕉）的数量
+}
+
+// Fan 是观众在一个主播的直播间里的弹幕和礼物统计
+type Fan struct {
+	UID          int64  // 观众的uid
+	Nickname     string // 观众最近使用的昵称
+	MessageCount int    // 发送的弹幕数量
+	GiftCount    int    // 赠送的礼物数量
+	ACCoin       int64  // 赠送的付费礼物花费的AC币
+	FirstSeen    int64  // 第一次发送弹幕或礼物的时间，单位为毫秒
+	LastSeen     int64  // 最后一次发送弹幕或礼物的时间，单位为毫秒
+}
+
+// GiftWrite 保存一次礼物
+func GiftWrite(g *Gift) Write {
+	return insertGiftWrite(g.LiveID, g.SendTime, g.UID, g.Nickname, g.GiftID, g.GiftName, g.Count, g.ACCoin)
+}
+
+// GiftTotalWrite 根据gift表重新合计直播每种礼物的数量和AC币
+func GiftTotalWrite(liveID LiveID) Write {
+	return upsertGiftTotalWrite(liveID)
+}
+
+// QueryGiftTotals 按花费的AC币从多到少查询直播每种礼物的合计
+func (s *SQLite) QueryGiftTotals(ctx context.Context, liveID LiveID) ([]GiftTotal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectGiftTotals(ctx, liveID)
+}
+
+// QueryIncome 按开始时间从旧到新查询主播每场直播收到的礼物的合计，没有礼物合计的直播不会返回
+func (s *SQLite) QueryIncome(ctx context.Context, uid UID) ([]Income, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectIncome(ctx, uid)
+}
+
+// 创建增量更新观众统计的触发器，第一次创建时根据已有的弹幕和礼物生成统计，需要在附加归档数据库后调用
+func (s *SQLite) setupFanTriggers(ctx context.Context) error {
+	var hasTrigger bool
+	if err := s.db.QueryRowContext(ctx, selectFanTrigger).Scan(&hasTrigger); err != nil {
+		return err
+	}
+	for _, query := range []string{createFanDanmakuTrigger, createFanGiftTrigger} {
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	if !hasTrigger {
+		if _, err := s.RecomputeFans(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecomputeFans 根据所有弹幕和礼物重新生成观众统计，返回统计的行数
+func (s *SQLite) RecomputeFans(ctx context.Context) (int64, error) {
+	// 合并到同一个观众的行也算作修改的行，所以重新查询行数
+	if _, err := s.rebuild(ctx, queries.deleteFans, queries.rebuildFans); err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectFanCount(ctx)
+}
+
+// QueryFans 按弹幕数量从多到少查询主播直播间里的前n个观众
+func (s *SQLite) QueryFans(ctx context.Context, uid UID, n int) ([]Fan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectFans(ctx, uid, n)
+}
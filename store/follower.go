@@ -0,0 +1,35 @@
+package store
+
+import "context"
+
+const (
+	// 定期获取的主播的粉丝数和关注数，按uid保存，删除直播时不会删除
+	createFollowerTable = `CREATE TABLE IF NOT EXISTS followerSnapshot (
+		uid INTEGER NOT NULL,
+		snapshotTime INTEGER NOT NULL,
+		fansCount INTEGER NOT NULL,
+		followingCount INTEGER NOT NULL,
+		PRIMARY KEY (uid, snapshotTime)
+	);
+	`
+)
+
+// Follower 是某一时间主播的粉丝数和关注数
+type Follower struct {
+	UID            UID   // 主播uid
+	Time           int64 // 获取的时间，单位为毫秒
+	FansCount      int   // 粉丝数
+	FollowingCount int   // 关注数
+}
+
+// FollowerWrite 保存一次获取的主播的粉丝数和关注数
+func FollowerWrite(f *Follower) Write {
+	return insertFollowerWrite(f.UID, f.Time, f.FansCount, f.FollowingCount)
+}
+
+// QueryFollowers 按时间从旧到新查询主播的粉丝数和关注数
+func (s *SQLite) QueryFollowers(ctx context.Context, uid UID) ([]Follower, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectFollowers(ctx, uid)
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLiveIDLen = 64            // liveID的最大长度，AcFun的liveID一般为11个字符
+	maxUID       = math.MaxInt32 // uid的最大值，AcFun的uid目前不超过9位数
+)
+
+// LiveID 是AcFun直播的ID，由字母、数字、-和_组成
+type LiveID string
+
+// ParseLiveID 解析并检查liveID，会去掉两边的空白
+func ParseLiveID(s string) (LiveID, error) {
+	id := LiveID(strings.TrimSpace(s))
+	if !id.Valid() {
+		return "", fmt.Errorf("%q 不是有效的liveID，liveID只能由字母、数字、-和_组成", s)
+	}
+	return id, nil
+}
+
+// Valid 返回liveID是否有效
+func (id LiveID) Valid() bool {
+	if id == "" || len(id) > maxLiveIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (id LiveID) String() string {
+	return string(id)
+}
+
+// UID 是AcFun用户的uid
+type UID int
+
+// ParseUID 解析并检查uid，会去掉两边的空白
+func ParseUID(s string) (UID, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 || n > maxUID {
+		return 0, fmt.Errorf("%q 不是有效的uid，uid应该是1到%d之间的整数", s, maxUID)
+	}
+	return UID(n), nil
+}
+
+// Valid 返回uid是否有效
+func (uid UID) Valid() bool {
+	return uid > 0 && uid <= maxUID
+}
+
+func (uid UID) String() string {
+	return strconv.Itoa(int(uid))
+}
+
+// Validate 检查直播的liveID和uid，写入数据库前调用，避免保存格式错误的数据
+func (l *Live) Validate() error {
+	if !l.LiveID.Valid() {
+		return fmt.Errorf("%q 不是有效的liveID", l.LiveID)
+	}
+	if !l.UID.Valid() {
+		return fmt.Errorf("liveID为 %s 的直播的uid %d 不是有效的uid", l.LiveID, l.UID)
+	}
+	return nil
+}
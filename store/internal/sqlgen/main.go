@@ -0,0 +1,638 @@
+// sqlgen 根据store/queries.sql生成类型化的查询函数，在store文件夹里用go generate运行。
+//
+// 生成时会在内存数据库里执行store包里所有create开头的常量来建立表结构，再逐条执行queries.sql里的查询，
+// 表结构改变后查询出错时生成失败，结果列改名后生成的代码无法编译，不会等到运行时才出现扫描错误。
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	queriesFile = "queries.sql"    // 查询的文件
+	outputFile  = "queries_gen.go" // 生成的文件
+)
+
+// 查询的种类，:write以外和sqlc相同
+const (
+	kindOne      = ":one"      // 返回一行，没有结果时返回sql.ErrNoRows
+	kindMany     = ":many"     // 返回所有行
+	kindExec     = ":exec"     // 只返回错误
+	kindExecRows = ":execrows" // 返回修改的行数
+	kindWrite    = ":write"    // 生成名字加Write的函数，返回在WriteBatch的事务里执行的Write
+)
+
+const (
+	liveParam     = "*Live" // :write的第一个参数可以是直播数据，占用liveParamN个参数，执行时加密录播链接
+	liveParamN    = 11      // 和WriteBatch里直播数据的参数数量一致
+	liveRow       = "Live"  // 含有{liveColumns}的:many查询的row，用scanLive扫描
+	liveColsConst = "liveColumns"
+)
+
+// 查询需要替换的占位符，生成时替换为main里的表
+var placeholders = strings.NewReplacer("{acfunlive}", "acfunlive", "{titleHistory}", "titleHistory")
+
+// 声明的列类型对应的Go类型
+var declTypes = map[string]string{
+	"INTEGER": "int64",
+	"TEXT":    "string",
+	"REAL":    "float64",
+	"BLOB":    "[]byte",
+}
+
+var identRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// queries.sql里的一条查询
+type query struct {
+	name   string   // 生成的常量和方法的名字
+	kind   string   // 查询的种类
+	doc    []string // 注释
+	params []param  // 参数
+	row    string   // 扫描到的已有结构体，为空时按列生成
+	live   bool     // 结果的前面是{liveColumns}，用scanLive扫描，columns只有之后的列
+	types  map[string]string
+	sql    string
+	line   int // 在queries.sql里的行号
+
+	columns []column // 生成时查询得到的结果列
+}
+
+type param struct {
+	name, typ string
+}
+
+type column struct {
+	name  string // 列名
+	field string // 结构体里的字段名
+	typ   string // Go类型，扫描到已有结构体时为空
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("sqlgen: ")
+	check := flag.Bool("check", false, "只检查生成的文件是否需要更新，需要更新时返回1")
+	flag.Parse()
+
+	queries, err := parseQueries(queriesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema, liveCols, err := loadSchema(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = resolve(schema, liveCols, queries); err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	old, _ := os.ReadFile(outputFile)
+	if bytes.Equal(old, src) {
+		return
+	}
+	if *check {
+		log.Fatalf("%s 需要重新生成，请在store文件夹里运行 go generate", outputFile)
+	}
+	if err = os.WriteFile(outputFile, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 解析queries.sql，每条查询以"-- name: 名字 :种类"开头，之后可以有注释和params、row、types
+func parseQueries(path string) ([]*query, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*query
+	var q *query
+	names := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(trimmed, "-- name:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) != 2 || !identRegexp.MatchString(fields[0]) {
+				return nil, fmt.Errorf("%s:%d：格式应为\"-- name: 名字 :种类\"", path, i+1)
+			}
+			switch fields[1] {
+			case kindOne, kindMany, kindExec, kindExecRows, kindWrite:
+			default:
+				return nil, fmt.Errorf("%s:%d：不支持的种类 %s", path, i+1, fields[1])
+			}
+			if names[fields[0]] {
+				return nil, fmt.Errorf("%s:%d：重复的名字 %s", path, i+1, fields[0])
+			}
+			names[fields[0]] = true
+			q = &query{name: fields[0], kind: fields[1], types: make(map[string]string), line: i + 1}
+			list = append(list, q)
+			continue
+		}
+		if q == nil {
+			continue
+		}
+		if q.sql == "" && strings.HasPrefix(trimmed, "--") {
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "--"))
+			switch {
+			case strings.HasPrefix(comment, "params:"):
+				for _, p := range splitList(strings.TrimPrefix(comment, "params:")) {
+					f := strings.Fields(p)
+					if len(f) != 2 || !identRegexp.MatchString(f[0]) {
+						return nil, fmt.Errorf("%s:%d：参数的格式应为\"名字 类型\"", path, i+1)
+					}
+					q.params = append(q.params, param{f[0], f[1]})
+				}
+			case strings.HasPrefix(comment, "row:"):
+				q.row = strings.TrimSpace(strings.TrimPrefix(comment, "row:"))
+			case strings.HasPrefix(comment, "types:"):
+				for _, t := range splitList(strings.TrimPrefix(comment, "types:")) {
+					f := strings.Fields(t)
+					if len(f) != 2 {
+						return nil, fmt.Errorf("%s:%d：列类型的格式应为\"列名 类型\"", path, i+1)
+					}
+					q.types[f[0]] = f[1]
+				}
+			case comment != "":
+				q.doc = append(q.doc, comment)
+			}
+			continue
+		}
+		if trimmed == "" && q.sql == "" {
+			continue
+		}
+		q.sql += strings.TrimRight(line, " \t\r") + "\n"
+	}
+	for _, q := range list {
+		q.sql = strings.TrimSpace(q.sql)
+		if q.sql == "" {
+			return nil, fmt.Errorf("%s:%d：查询 %s 没有语句", path, q.line, q.name)
+		}
+		if strings.Contains(q.sql, "`") {
+			return nil, fmt.Errorf("%s:%d：查询 %s 不能含有反引号", path, q.line, q.name)
+		}
+	}
+	return list, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// 读取dir里的Go文件，返回所有create开头的字符串常量（按名字排序）和liveColumns常量
+func loadSchema(dir string) ([]string, string, error) {
+	fset := token.NewFileSet()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, "", err
+	}
+	consts := make(map[string]ast.Expr)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || filepath.Base(file) == outputFile {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if i < len(vs.Values) {
+						consts[name.Name] = vs.Values[i]
+					}
+				}
+			}
+		}
+	}
+
+	var names []string
+	for name := range consts {
+		if strings.HasPrefix(name, "create") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	schema := make([]string, 0, len(names))
+	for _, name := range names {
+		s, err := evalString(consts, name, make(map[string]bool))
+		if err != nil {
+			return nil, "", fmt.Errorf("无法计算常量 %s：%w", name, err)
+		}
+		schema = append(schema, s)
+	}
+	liveCols, err := evalString(consts, liveColsConst, make(map[string]bool))
+	if err != nil {
+		return nil, "", fmt.Errorf("无法计算常量 %s：%w", liveColsConst, err)
+	}
+	return schema, liveCols, nil
+}
+
+// 计算由字符串和其他常量拼接而成的常量
+func evalString(consts map[string]ast.Expr, name string, seen map[string]bool) (string, error) {
+	if seen[name] {
+		return "", fmt.Errorf("常量 %s 循环引用", name)
+	}
+	expr, ok := consts[name]
+	if !ok {
+		return "", fmt.Errorf("找不到常量 %s", name)
+	}
+	seen[name] = true
+	defer delete(seen, name)
+	var eval func(ast.Expr) (string, error)
+	eval = func(e ast.Expr) (string, error) {
+		switch e := e.(type) {
+		case *ast.BasicLit:
+			if e.Kind != token.STRING {
+				return "", errors.New("不是字符串")
+			}
+			return strconv.Unquote(e.Value)
+		case *ast.Ident:
+			return evalString(consts, e.Name, seen)
+		case *ast.ParenExpr:
+			return eval(e.X)
+		case *ast.BinaryExpr:
+			if e.Op != token.ADD {
+				return "", fmt.Errorf("不支持的运算 %s", e.Op)
+			}
+			x, err := eval(e.X)
+			if err != nil {
+				return "", err
+			}
+			y, err := eval(e.Y)
+			return x + y, err
+		default:
+			return "", fmt.Errorf("不支持的表达式 %T", e)
+		}
+	}
+	return eval(expr)
+}
+
+// 在内存数据库里建立表结构，执行每条查询，得到结果列
+func resolve(schema []string, liveCols string, queries []*query) error {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// 内存数据库只在一个连接里存在
+	db.SetMaxOpenConns(1)
+
+	// 触发器和索引依赖的表可能在后面，重复执行直到全部成功
+	pending := schema
+	for len(pending) != 0 {
+		var failed []string
+		var lastErr error
+		for _, s := range pending {
+			if _, err := db.ExecContext(ctx, s); err != nil {
+				failed = append(failed, s)
+				lastErr = err
+			}
+		}
+		if len(failed) == len(pending) {
+			return fmt.Errorf("建立表结构失败：%w\n%s", lastErr, failed[0])
+		}
+		pending = failed
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// 执行写入语句只是为了检查，最后回滚
+	defer tx.Rollback()
+	for _, q := range queries {
+		if err := resolveQuery(ctx, tx, liveCols, q); err != nil {
+			return fmt.Errorf("%s:%d：查询 %s：%w", queriesFile, q.line, q.name, err)
+		}
+	}
+	return nil
+}
+
+func resolveQuery(ctx context.Context, tx *sql.Tx, liveCols string, q *query) error {
+	if strings.Contains(q.sql, "{liveColumns}") {
+		if q.kind != kindMany || q.row != liveRow {
+			return fmt.Errorf("含有{liveColumns}的查询只能是%s，row为%s", kindMany, liveRow)
+		}
+		q.live = true
+	}
+	n, err := countParams(q.sql)
+	if err != nil {
+		return err
+	}
+	var args []interface{}
+	for i, p := range q.params {
+		if p.typ == liveParam {
+			if q.kind != kindWrite || i != 0 {
+				return fmt.Errorf("%s只能是%s的第一个参数", liveParam, kindWrite)
+			}
+			for j := 0; j < liveParamN; j++ {
+				args = append(args, 0)
+			}
+			continue
+		}
+		v, err := zeroValue(p.typ)
+		if err != nil {
+			return err
+		}
+		args = append(args, v)
+	}
+	if n != len(args) {
+		return fmt.Errorf("语句有 %d 个参数，但声明了 %d 个", n, len(args))
+	}
+	stmt := placeholders.Replace(strings.ReplaceAll(q.sql, "{liveColumns}", liveCols))
+	if q.kind == kindExec || q.kind == kindExecRows || q.kind == kindWrite {
+		if len(q.types) != 0 || q.row != "" {
+			return errors.New("写入语句不能有row和types")
+		}
+		// Write在WriteBatch里执行，不会替换占位符
+		if q.kind == kindWrite && strings.Contains(q.sql, "{") {
+			return fmt.Errorf("%s不能含有{acfunlive}等占位符", kindWrite)
+		}
+		_, err = tx.ExecContext(ctx, stmt, args...)
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	if len(colTypes) == 0 {
+		return errors.New("查询没有结果列")
+	}
+	if q.live {
+		// 直播数据的列由scanLive扫描，只生成之后的列
+		for _, name := range splitList(liveCols) {
+			if len(colTypes) == 0 || colTypes[0].Name() != name {
+				return fmt.Errorf("结果的前面需要是{liveColumns}")
+			}
+			colTypes = colTypes[1:]
+		}
+	}
+	used := make(map[string]bool)
+	for _, ct := range colTypes {
+		name := ct.Name()
+		if !identRegexp.MatchString(name) {
+			return fmt.Errorf("结果列 %s 需要用AS起一个名字", name)
+		}
+		c := column{name: name, field: fieldName(name)}
+		if used[c.field] {
+			return fmt.Errorf("结果列 %s 重复", name)
+		}
+		used[c.field] = true
+		if q.row == "" || q.live {
+			if c.typ = q.types[name]; c.typ == "" {
+				c.typ = declTypes[strings.ToUpper(ct.DatabaseTypeName())]
+			}
+			if c.typ == "" {
+				return fmt.Errorf("无法确定结果列 %s 的类型，需要在types里声明", name)
+			}
+		}
+		q.columns = append(q.columns, c)
+	}
+	for name := range q.types {
+		if !used[fieldName(name)] {
+			return fmt.Errorf("types里的列 %s 不在结果里", name)
+		}
+	}
+	return rows.Err()
+}
+
+// 统计语句里的参数数量，跳过字符串、引号里的名字和注释，不能混用?和?N
+func countParams(s string) (int, error) {
+	var plain, numbered int
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'' || s[i] == '"':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return 0, errors.New("引号没有结束")
+			}
+			i += end + 1
+		case strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return plain + numbered, nil
+			}
+			i += end
+		case s[i] == '?':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			if j == i+1 {
+				plain++
+				continue
+			}
+			n, _ := strconv.Atoi(s[i+1 : j])
+			if n > numbered {
+				numbered = n
+			}
+			i = j - 1
+		}
+	}
+	if plain != 0 && numbered != 0 {
+		return 0, errors.New("不能同时使用?和?N")
+	}
+	return plain + numbered, nil
+}
+
+// 参数类型的零值，用于生成时执行查询
+func zeroValue(typ string) (interface{}, error) {
+	switch typ {
+	case "string", "LiveID":
+		return "", nil
+	case "[]byte":
+		return []byte{}, nil
+	case "bool":
+		return false, nil
+	case "int", "int64", "int32", "UID":
+		return 0, nil
+	case "float64":
+		return 0.0, nil
+	default:
+		return nil, fmt.Errorf("不支持的参数类型 %s", typ)
+	}
+}
+
+// 列名对应的字段名，uid和id为全大写，其他的首字母大写
+func fieldName(col string) string {
+	switch col {
+	case "uid":
+		return "UID"
+	case "id":
+		return "ID"
+	}
+	r, size := utf8.DecodeRuneInString(col)
+	return string(unicode.ToUpper(r)) + col[size:]
+}
+
+// 生成queries_gen.go
+func generate(queries []*query) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by sqlgen from %s. DO NOT EDIT.\n\npackage store\n\nimport (\n\t\"context\"\n)\n\n", queriesFile)
+	fmt.Fprintf(&b, "const (\n")
+	for _, q := range queries {
+		for _, d := range q.doc {
+			fmt.Fprintf(&b, "\t// %s\n", d)
+		}
+		fmt.Fprintf(&b, "\t%s = `%s`\n", q.name, q.sql)
+	}
+	fmt.Fprintf(&b, ")\n")
+	for _, q := range queries {
+		generateQuery(&b, q)
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("格式化生成的代码失败：%w\n%s", err, b.String())
+	}
+	return src, nil
+}
+
+func generateQuery(b *bytes.Buffer, q *query) {
+	if q.kind == kindWrite {
+		generateWrite(b, q)
+		return
+	}
+	// 没有指定结构体的多列结果生成一个结构体，单列结果直接返回值，
+	// 直播数据之后还有其他列时生成含有直播数据和其他列的结构体
+	result := q.row
+	scalar := q.row == "" && len(q.columns) == 1
+	if q.kind == kindOne || q.kind == kindMany {
+		switch {
+		case q.live && len(q.columns) != 0:
+			result = q.name + "Row"
+			fmt.Fprintf(b, "\n// %s是%s的一行结果\ntype %s struct {\n\tLive Live\n", result, q.name, result)
+			for _, c := range q.columns {
+				fmt.Fprintf(b, "\t%s %s\n", c.field, c.typ)
+			}
+			fmt.Fprintf(b, "}\n")
+		case q.live:
+		case scalar:
+			result = q.columns[0].typ
+		case result == "":
+			result = q.name + "Row"
+			fmt.Fprintf(b, "\n// %s是%s的一行结果\ntype %s struct {\n", result, q.name, result)
+			for _, c := range q.columns {
+				fmt.Fprintf(b, "\t%s %s\n", c.field, c.typ)
+			}
+			fmt.Fprintf(b, "}\n")
+		}
+	}
+
+	params := []string{"ctx context.Context"}
+	args := []string{"ctx", q.name}
+	if strings.Contains(q.sql, "{") {
+		args[1] = "q.federate(" + q.name + ")"
+	}
+	for _, p := range q.params {
+		params = append(params, p.name+" "+p.typ)
+		args = append(args, p.name)
+	}
+	dest := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		dest[i] = "&r." + c.field
+	}
+	if scalar {
+		dest = []string{"&r"}
+	}
+	scan := "rows.Scan(" + strings.Join(dest, ", ") + ")"
+	if q.live {
+		live := "&r"
+		if len(q.columns) != 0 {
+			live = "&r.Live"
+		}
+		scan = "q.scanLive(" + strings.Join(append([]string{"rows", live}, dest...), ", ") + ")"
+	}
+
+	fmt.Fprintf(b, "\n")
+	for i, d := range q.doc {
+		if i == 0 {
+			d = q.name + " " + d
+		}
+		fmt.Fprintf(b, "// %s\n", d)
+	}
+	sig := fmt.Sprintf("func (q queries) %s(%s)", q.name, strings.Join(params, ", "))
+	call := strings.Join(args, ", ")
+	switch q.kind {
+	case kindOne:
+		fmt.Fprintf(b, "%s (%s, error) {\n\tvar r %s\n\terr := q.db.QueryRowContext(%s).Scan(%s)\n\treturn r, err\n}\n",
+			sig, result, result, call, strings.Join(dest, ", "))
+	case kindMany:
+		fmt.Fprintf(b, "%s ([]%s, error) {\n\trows, err := q.db.QueryContext(%s)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tdefer rows.Close()\n", sig, result, call)
+		fmt.Fprintf(b, "\tvar list []%s\n\tfor rows.Next() {\n\t\tvar r %s\n\t\tif err = %s; err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tlist = append(list, r)\n\t}\n\treturn list, rows.Err()\n}\n",
+			result, result, scan)
+	case kindExec:
+		fmt.Fprintf(b, "%s error {\n\t_, err := q.db.ExecContext(%s)\n\treturn err\n}\n", sig, call)
+	case kindExecRows:
+		fmt.Fprintf(b, "%s (int64, error) {\n\tresult, err := q.db.ExecContext(%s)\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\treturn result.RowsAffected()\n}\n", sig, call)
+	}
+}
+
+// 生成返回Write的函数，直播数据放在Write.live里，在WriteBatch里加密后作为前面的参数
+func generateWrite(b *bytes.Buffer, q *query) {
+	fn := q.name + "Write"
+	var params, args []string
+	live := ""
+	for _, p := range q.params {
+		params = append(params, p.name+" "+p.typ)
+		if p.typ == liveParam {
+			live = p.name
+			continue
+		}
+		args = append(args, p.name)
+	}
+	fields := []string{"query: " + q.name}
+	if len(args) != 0 {
+		fields = append(fields, "args: []interface{}{"+strings.Join(args, ", ")+"}")
+	}
+	if live != "" {
+		fields = append(fields, "live: "+live)
+	}
+
+	fmt.Fprintf(b, "\n")
+	for i, d := range q.doc {
+		if i == 0 {
+			d = fn + " " + d
+		}
+		fmt.Fprintf(b, "// %s\n", d)
+	}
+	fmt.Fprintf(b, "func %s(%s) Write {\n\treturn Write{%s}\n}\n", fn, strings.Join(params, ", "), strings.Join(fields, ", "))
+}
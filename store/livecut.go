@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// 定期确认直播剪辑是否还存在的结果，removedAt为发现直播剪辑被删除的时间，downloadFile为下载的直播剪辑文件
+	createLiveCutStatusTable = `CREATE TABLE IF NOT EXISTS liveCutStatus (
+		liveID TEXT PRIMARY KEY,
+		liveCutNum INTEGER NOT NULL,
+		checkTime INTEGER NOT NULL,
+		removedAt INTEGER NOT NULL DEFAULT 0,
+		downloadFile TEXT NOT NULL DEFAULT ''
+	);
+	`
+	// 获取过直播剪辑编号的直播，没有直播剪辑的直播也会记录，fsck只检查没有获取过的直播
+	createLiveCutLookupTable = `CREATE TABLE IF NOT EXISTS liveCutLookup (
+		liveID TEXT PRIMARY KEY,
+		lookupTime INTEGER NOT NULL
+	);
+	`
+	// {uids}会被替换为uid的占位符
+	selectLiveCutChecks = `SELECT l.liveID, l.uid, l.liveCutNum, COALESCE(c.checkTime, 0), COALESCE(c.removedAt, 0), COALESCE(c.downloadFile, '')
+		FROM {acfunlive} l LEFT JOIN liveCutStatus c ON c.liveID = l.liveID AND c.liveCutNum = l.liveCutNum
+		WHERE l.liveCutNum != 0 AND l.deletedAt = 0 AND l.uid IN ({uids})
+			AND COALESCE(c.removedAt, 0) = 0 AND COALESCE(c.checkTime, 0) < ?
+		ORDER BY COALESCE(c.checkTime, 0), l.startTime DESC
+		LIMIT ?;
+	`
+)
+
+// LiveCutStatus 是确认直播剪辑是否还存在的结果
+type LiveCutStatus struct {
+	LiveID       LiveID // 直播ID
+	UID          UID    // 主播uid
+	LiveCutNum   int    // 直播剪辑编号
+	CheckTime    int64  // 最后一次确认的时间，单位为毫秒，还没有确认过时为0
+	RemovedAt    int64  // 发现直播剪辑被删除的时间，单位为毫秒，还存在时为0
+	DownloadFile string // 下载的直播剪辑文件，没有下载时为空
+}
+
+// LiveCutStatusWrite 保存确认直播剪辑的结果，removed为直播剪辑是否已经被删除
+func LiveCutStatusWrite(liveID LiveID, num int, checkTime int64, removed bool) Write {
+	var removedAt int64
+	if removed {
+		removedAt = checkTime
+	}
+	return upsertLiveCutStatusWrite(liveID, num, checkTime, removedAt)
+}
+
+// LiveCutLookupWrite 记录在lookupTime（毫秒）获取过直播的直播剪辑编号，不管有没有直播剪辑
+func LiveCutLookupWrite(liveID LiveID, lookupTime int64) Write {
+	return upsertLiveCutLookupWrite(liveID, lookupTime)
+}
+
+// LiveCutDownloadWrite 保存下载的直播剪辑文件，需要先用LiveCutStatusWrite保存确认结果
+func LiveCutDownloadWrite(liveID LiveID, num int, file string) Write {
+	return updateLiveCutDownloadWrite(file, liveID, num)
+}
+
+// QueryLiveCutChecks 查询uids里的主播在before（毫秒）之前没有确认过的直播剪辑，最久没有确认的在前面，最多返回limit个
+func (s *SQLite) QueryLiveCutChecks(ctx context.Context, uids []UID, before int64, limit int) ([]LiveCutStatus, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(uids)+2)
+	for _, uid := range uids {
+		args = append(args, uid)
+	}
+	args = append(args, before, limit)
+	query := strings.Replace(selectLiveCutChecks, "{uids}", strings.TrimSuffix(strings.Repeat("?, ", len(uids)), ", "), 1)
+	return s.queryLiveCutStatus(ctx, s.federate(query), args...)
+}
+
+// QueryRemovedLiveCuts 查询已经被删除的直播剪辑，最近发现的在前面
+func (s *SQLite) QueryRemovedLiveCuts(ctx context.Context) ([]LiveCutStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectRemovedLiveCuts(ctx)
+}
+
+func (s *SQLite) queryLiveCutStatus(ctx context.Context, query string, args ...interface{}) ([]LiveCutStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveCutStatus
+	for rows.Next() {
+		var c LiveCutStatus
+		if err = rows.Scan(&c.LiveID, &c.UID, &c.LiveCutNum, &c.CheckTime, &c.RemovedAt, &c.DownloadFile); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 直播间弹幕里的管理事件，如违规警告。归档直播时管理事件不会移到归档数据库
+	createModerationTable = `CREATE TABLE IF NOT EXISTS moderationEvent (
+		liveID TEXT NOT NULL,
+		eventTime INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		content TEXT NOT NULL
+	);
+	`
+	createModerationIndex = `CREATE INDEX IF NOT EXISTS moderationLiveIDIndex ON moderationEvent (liveID, eventTime);`
+)
+
+// 管理事件的种类
+const (
+	ModerationViolationAlert = "violationAlert" // 直播间收到违规警告
+	ModerationKickedOut      = "kickedOut"      // 弹幕连接被踢出直播间
+)
+
+// ModerationEvent 是直播间的管理事件
+type ModerationEvent struct {
+	LiveID  LiveID // 直播ID
+	Time    int64  // 事件发生的时间，单位为毫秒
+	Kind    string // 事件的种类
+	Content string // 违规警告的内容或被踢出的理由
+}
+
+// ModerationWrite 保存直播间的管理事件
+func ModerationWrite(e *ModerationEvent) Write {
+	return insertModerationWrite(e.LiveID, e.Time, e.Kind, e.Content)
+}
+
+// QueryModeration 按时间从旧到新查询直播间的管理事件
+func (s *SQLite) QueryModeration(ctx context.Context, liveID LiveID) ([]ModerationEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectModeration(ctx, liveID)
+}
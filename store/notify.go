@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// 等待发送的通知，每个通知目标一行，发送成功后删除，失败时在nextTime之后重试
+	createNotifyTable = `CREATE TABLE IF NOT EXISTS notifyOutbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target TEXT NOT NULL,
+		uid INTEGER NOT NULL,
+		liveID TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		nextTime INTEGER NOT NULL,
+		lastError TEXT NOT NULL DEFAULT '',
+		createTime INTEGER NOT NULL
+	);
+	`
+	createNotifyIndex = `CREATE INDEX IF NOT EXISTS notifyOutboxNextTimeIndex ON notifyOutbox (nextTime);`
+)
+
+// Notification 是等待发送的通知
+type Notification struct {
+	ID         int64  // 通知的序号
+	Target     string // 通知目标，如telegram、ntfy
+	UID        UID    // 主播uid
+	LiveID     LiveID // 直播ID
+	Payload    string // 发送的内容，格式由通知目标决定，设置了数据库密钥时加密保存
+	Attempts   int    // 已经发送失败的次数
+	NextTime   int64  // 下次发送的时间，单位为毫秒
+	LastError  string // 上次发送失败的原因
+	CreateTime int64  // 通知产生的时间，单位为毫秒
+}
+
+// NotifyWrite 保存等待发送到target的通知，t（毫秒）为通知产生的时间，发送成功后用DeleteNotification删除。
+// 通知里可能有录播链接和webhook链接，设置了数据库密钥时payload加密保存
+func NotifyWrite(target string, uid UID, liveID LiveID, payload string, t int64) Write {
+	w := insertNotifyWrite(target, uid, liveID, payload, t, t)
+	w.encrypt = []int{3}
+	return w
+}
+
+// QueryDueNotifications 按顺序查询下次发送时间不晚于now（毫秒）的最早的limit个通知
+func (s *SQLite) QueryDueNotifications(ctx context.Context, now int64, limit int) ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, err := s.q().selectDueNotifications(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return list, s.decryptNotifications(list)
+}
+
+// QueryNotifications 按顺序查询所有等待发送的通知
+func (s *SQLite) QueryNotifications(ctx context.Context) ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, err := s.q().selectNotifications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return list, s.decryptNotifications(list)
+}
+
+// 解密通知的内容
+func (s *SQLite) decryptNotifications(list []Notification) error {
+	for i := range list {
+		var err error
+		if list[i].Payload, err = s.cipher.decrypt(list[i].Payload); err != nil {
+			return fmt.Errorf("解密发送到%s的通知失败：%w", list[i].Target, err)
+		}
+	}
+	return nil
+}
+
+// DeleteNotification 删除已经发送或放弃发送的通知
+func (s *SQLite) DeleteNotification(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().deleteNotification(ctx, id)
+}
+
+// DelayNotification 记录通知发送失败，在nextTime（毫秒）之后重试
+func (s *SQLite) DelayNotification(ctx context.Context, id int64, nextTime int64, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().delayNotification(ctx, nextTime, lastError, id)
+}
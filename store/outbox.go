@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// 等待发送到Kafka或NATS的事件，发送成功后删除，id为发送的顺序
+	createOutboxTable = `CREATE TABLE IF NOT EXISTS eventOutbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event TEXT NOT NULL,
+		liveID TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		createTime INTEGER NOT NULL
+	);
+	`
+)
+
+// OutboxEvent 是等待发送的事件
+type OutboxEvent struct {
+	ID         int64  // 事件的序号，越晚的事件越大
+	Event      string // 事件的种类
+	LiveID     LiveID // 直播ID
+	Payload    string // 事件的JSON数据，设置了数据库密钥时加密保存
+	CreateTime int64  // 事件产生的时间，单位为毫秒
+}
+
+// OutboxWrite 保存等待发送的事件，发送成功后用AckOutbox删除
+func OutboxWrite(event string, liveID LiveID, payload string, createTime int64) Write {
+	w := insertOutboxWrite(event, liveID, payload, createTime)
+	w.encrypt = []int{2}
+	return w
+}
+
+// QueryOutbox 按顺序查询最早的limit个等待发送的事件
+func (s *SQLite) QueryOutbox(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, err := s.q().selectOutbox(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Payload, err = s.cipher.decrypt(list[i].Payload); err != nil {
+			return nil, fmt.Errorf("解密序号为 %d 的事件失败：%w", list[i].ID, err)
+		}
+	}
+	return list, nil
+}
+
+// AckOutbox 删除序号不大于id的事件，返回删除的数量
+func (s *SQLite) AckOutbox(ctx context.Context, id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().deleteOutbox(ctx, id)
+}
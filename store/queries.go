@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+//go:generate go run ./internal/sqlgen
+
+// queries_gen.go里生成的查询可以在数据库连接或事务上执行
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queries 的方法由sqlgen根据queries.sql生成，结果直接扫描到类型化的结构体
+type queries struct {
+	db       dbtx
+	federate func(string) string                                       // 替换查询里的{acfunlive}等占位符
+	scanLive func(rows *sql.Rows, l *Live, extra ...interface{}) error // 扫描{liveColumns}的直播数据和之后的列
+}
+
+// 返回在数据库连接上执行的查询，调用者需要持有s.mu
+func (s *SQLite) q() queries {
+	return s.qtx(s.db)
+}
+
+// 返回在db上执行的查询，db可以是数据库连接或事务
+func (s *SQLite) qtx(db dbtx) queries {
+	return queries{db: db, federate: s.federate, scanLive: s.scanLive}
+}
@@ -0,0 +1,923 @@
+-- 类型化的查询，修改后在store文件夹里运行 go generate 重新生成queries_gen.go。
+--
+-- 每条查询以"-- name: 名字 :种类"开头，种类为:one、:many、:exec、:execrows或:write，之后的注释为生成的方法的注释。
+-- params为方法的参数，按占位符的顺序排列；row为扫描结果的结构体，字段名为列名或AS后的别名首字母大写（uid和id为全大写）；
+-- 没有row时单列结果直接返回值，多列结果生成结构体，表达式列的类型需要在types里声明。
+-- :write生成名字加Write的函数，返回在WriteBatch的事务里执行的Write，第一个参数可以是"l *Live"，按插入直播的顺序占用11个参数。
+-- 以{liveColumns}开头的:many查询的row为Live，用scanLive扫描直播数据（包括计算列）并解密录播链接，之后的列和直播数据一起返回。
+-- 生成时会在内存数据库里建立store包里的表结构并执行每条查询，列改名后生成失败或生成的代码无法编译。
+
+-- name: insertLive :write
+-- 插入直播数据，liveID已存在时修改的行数为0
+-- params: l *Live
+INSERT OR IGNORE INTO acfunlive
+	(liveID, uid, name, streamName, startTime, title, duration, playbackURL, backupURL, liveCutNum, access)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: updateDuration :exec
+-- 保存下播后获取到的直播时长
+-- params: duration int64, liveID LiveID
+UPDATE acfunlive SET duration = ? WHERE liveID = ?;
+
+-- name: selectLiveCutNum :one
+-- 查询直播剪辑编号
+-- params: liveID LiveID
+-- types: liveCutNum int
+SELECT liveCutNum FROM acfunlive WHERE liveID = ?;
+
+-- name: updateLiveCutNum :exec
+-- 保存直播剪辑编号
+-- params: num int, liveID LiveID
+UPDATE acfunlive SET liveCutNum = ? WHERE liveID = ?;
+
+-- name: insertLiveCut :exec
+-- 记录在fetchTime（毫秒）获取到的直播剪辑编号，直播剪辑可能会重新生成
+-- params: liveID LiveID, num int, fetchTime int64
+INSERT OR IGNORE INTO liveCutHistory (liveID, liveCutNum, fetchTime) VALUES (?, ?, ?);
+
+-- name: insertTitle :write
+-- 记录在changeTime（毫秒）看到的直播间标题
+-- params: liveID LiveID, title string, changeTime int64
+INSERT INTO titleHistory (liveID, title, changeTime) VALUES (?, ?, ?);
+
+-- name: updateSuggested :exec
+-- 保存没有标题的直播的建议标题
+-- params: title string, liveID LiveID
+UPDATE acfunlive SET suggestedTitle = ? WHERE liveID = ?;
+
+-- name: updateAccess :write
+-- 更新直播间的访问限制
+-- params: access string, liveID LiveID
+UPDATE acfunlive SET access = ? WHERE liveID = ?;
+
+-- name: updateRecordFile :execrows
+-- 保存直播的本地录播文件名
+-- params: file string, liveID LiveID
+UPDATE acfunlive SET recordFile = ? WHERE liveID = ?;
+
+-- name: updatePlayback :execrows
+-- 保存直播的录播链接，链接需要先加密
+-- params: url string, backupURL string, liveID LiveID
+UPDATE acfunlive SET playbackURL = ?, backupURL = ? WHERE liveID = ?;
+
+-- name: clearPlayback :exec
+-- 清除直播的录播链接
+-- params: liveID LiveID
+UPDATE acfunlive SET playbackURL = '', backupURL = '' WHERE liveID = ?;
+
+-- name: selectLive :many
+-- 查询指定liveID的直播，包括已删除的直播
+-- params: liveID LiveID
+-- row: Live
+SELECT {liveColumns} FROM {acfunlive} WHERE liveID = ?;
+
+-- name: selectUID :many
+-- 按开始时间从新到旧查询主播没有删除的直播
+-- params: uid UID
+-- row: Live
+SELECT {liveColumns}
+FROM {acfunlive}
+WHERE uid = ? AND deletedAt = 0
+ORDER BY startTime DESC;
+
+-- name: selectUIDLimit :many
+-- 按开始时间从新到旧查询主播最近limit场没有删除的直播
+-- params: uid UID, limit int
+-- row: Live
+SELECT {liveColumns}
+FROM {acfunlive}
+WHERE uid = ? AND deletedAt = 0
+ORDER BY startTime DESC
+LIMIT ?;
+
+-- name: selectAll :many
+-- 按开始时间和liveID查询(startTime, liveID)之后的limit场没有删除的直播
+-- params: startTime int64, sameStartTime int64, liveID LiveID, limit int
+-- row: Live
+SELECT {liveColumns}
+FROM {acfunlive}
+WHERE deletedAt = 0 AND (startTime > ? OR (startTime = ? AND liveID > ?))
+ORDER BY startTime, liveID
+LIMIT ?;
+
+-- name: insertActive :write
+-- 记录正在直播的liveID
+-- params: liveID LiveID
+INSERT OR IGNORE INTO activeLive (liveID) VALUES (?);
+
+-- name: deleteActive :write
+-- 删除已经下播的liveID
+-- params: liveID LiveID
+DELETE FROM activeLive WHERE liveID = ?;
+
+-- name: selectActive :many
+-- 查询记录为正在直播的直播
+-- row: Live
+SELECT {liveColumns}
+FROM acfunlive
+WHERE liveID IN (SELECT liveID FROM activeLive);
+
+-- name: selectUnfinished :many
+-- 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+-- params: since int64
+-- row: Live
+SELECT {liveColumns}
+FROM acfunlive
+WHERE duration = 0 AND startTime >= ? AND deletedAt = 0
+ORDER BY startTime;
+
+-- name: upsertStreamer :write
+-- 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的昵称
+-- params: uid UID, name string, firstSeen int64, lastSeen int64
+INSERT INTO streamerName (uid, name, firstSeen, lastSeen) VALUES (?, ?, ?, ?)
+ON CONFLICT (uid, name) DO UPDATE SET lastSeen = MAX(lastSeen, excluded.lastSeen);
+
+-- name: softDeleteLive :execrows
+-- 在deletedAt（毫秒）软删除直播数据
+-- params: deletedAt int64, liveID LiveID
+UPDATE acfunlive SET deletedAt = ? WHERE liveID = ? AND deletedAt = 0;
+
+-- name: restoreLive :execrows
+-- 恢复软删除的直播数据
+-- params: liveID LiveID
+UPDATE acfunlive SET deletedAt = 0 WHERE liveID = ? AND deletedAt != 0;
+
+-- name: purgeLive :execrows
+-- 彻底删除在before（毫秒）之前软删除的直播数据
+-- params: before int64
+DELETE FROM acfunlive WHERE deletedAt != 0 AND deletedAt < ?;
+
+-- name: deleteOrphanActive :exec
+-- 删除没有对应直播的正在直播的记录
+DELETE FROM activeLive WHERE liveID NOT IN (SELECT liveID FROM acfunlive);
+
+-- name: deleteOrphanLiveCut :exec
+-- 删除没有对应直播的直播剪辑编号的历史记录
+DELETE FROM liveCutHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);
+
+-- name: deleteOrphanTitle :exec
+-- 删除没有对应直播的标题的变更记录
+DELETE FROM titleHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);
+
+-- name: deleteOrphanDanmaku :exec
+-- 删除没有对应直播的弹幕，弹幕的直播可能已经归档
+DELETE FROM danmaku WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanDanmakuSession :exec
+-- 删除没有对应直播的弹幕记录
+DELETE FROM danmakuSession WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanChatStats :exec
+-- 删除没有对应直播的弹幕统计
+DELETE FROM chatStats WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanModeration :exec
+-- 删除没有对应直播的管理事件
+DELETE FROM moderationEvent WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanSample :exec
+-- 删除没有对应直播的在线人数、点赞数和弹幕数的采样
+DELETE FROM liveSample WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanViewerSample :exec
+-- 删除没有对应直播的直播间列表里的在线人数采样
+DELETE FROM viewerSample WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanFanClub :exec
+-- 删除没有对应直播的守护团信息
+DELETE FROM fanClub WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanStream :exec
+-- 删除没有对应直播的直播源
+DELETE FROM streamQuality WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanCover :exec
+-- 删除没有对应直播的直播封面
+DELETE FROM liveCover WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanGift :exec
+-- 删除没有对应直播的礼物
+DELETE FROM gift WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanGiftTotal :exec
+-- 删除没有对应直播的礼物合计
+DELETE FROM giftTotal WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanLiveCutStatus :exec
+-- 删除没有对应直播的直播剪辑的检查结果
+DELETE FROM liveCutStatus WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanLiveCutLookup :exec
+-- 删除没有对应直播的获取直播剪辑编号的记录
+DELETE FROM liveCutLookup WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: deleteOrphanLiveStorage :exec
+-- 删除没有对应直播的占用空间统计
+DELETE FROM liveStorage WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});
+
+-- name: selectDuplicateLiveIDs :many
+-- 查询在主数据库和归档数据库里都有数据的liveID，主数据库里liveID是主键，重复只会出现在数据库之间
+-- types: liveID LiveID
+SELECT liveID FROM {acfunlive} GROUP BY liveID HAVING COUNT(*) > 1;
+
+-- name: selectBadDurations :many
+-- 查询直播时长超过maxDuration（毫秒）或为负数、开始时间晚于now（毫秒）的直播
+-- params: maxDuration int64, now int64
+-- types: liveID LiveID
+SELECT liveID FROM acfunlive WHERE duration < 0 OR duration > ? OR startTime > ?;
+
+-- name: selectMissingLiveCut :many
+-- 查询已结束但从来没有获取过直播剪辑编号的直播，很多直播本来就没有直播剪辑
+-- row: Live
+SELECT {liveColumns} FROM acfunlive
+WHERE duration > 0 AND liveCutNum = 0 AND liveID NOT IN (SELECT liveID FROM liveCutLookup);
+
+-- name: selectOrphanPlayback :many
+-- 查询录播链接不完整或者还没有结束的直播
+-- types: liveID LiveID
+SELECT liveID FROM acfunlive WHERE (duration = 0 AND playbackURL != '') OR (playbackURL = '' AND backupURL != '');
+
+-- name: selectOrphanActive :many
+-- 查询activeLive表里没有对应直播的liveID
+-- types: liveID LiveID
+SELECT liveID FROM activeLive WHERE liveID NOT IN (SELECT liveID FROM acfunlive);
+
+-- name: selectOrphanLiveCut :many
+-- 查询liveCutHistory表里没有对应直播的liveID
+-- types: liveID LiveID
+SELECT DISTINCT liveID FROM liveCutHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);
+
+-- name: selectChangedLives :many
+-- 查询seq大于after、变更时间不早于since（毫秒）的最多limit场直播的数据和删除时间
+-- params: after int64, since int64, limit int
+-- row: Live
+SELECT {liveColumns}, deletedAt FROM {acfunlive}
+WHERE liveID IN (SELECT liveID FROM liveChange WHERE seq > ? AND changeTime >= ? ORDER BY seq LIMIT ?);
+
+-- name: upsertSyncSeq :write
+-- 保存从source同步到的seq
+-- params: source string, seq int64
+INSERT INTO syncState (source, seq) VALUES (?, ?)
+ON CONFLICT (source) DO UPDATE SET seq = excluded.seq;
+
+-- name: updateMirrorLive :write
+-- 更新从主实例同步的已有的直播，和insertMirrorLive使用相同的参数。不使用UPSERT，
+-- 因为UPSERT会让统计触发器里的INSERT OR IGNORE在冲突时出错。已删除时保留本地的删除时间
+-- params: l *Live, suggestedTitle string, recordFile string, deletedAt int64
+UPDATE acfunlive SET
+	uid = ?2, name = ?3, streamName = ?4, startTime = ?5, title = ?6, duration = ?7, playbackURL = ?8, backupURL = ?9,
+	liveCutNum = ?10, access = ?11, suggestedTitle = ?12, recordFile = ?13,
+	deletedAt = CASE WHEN ?14 = 0 THEN 0 WHEN deletedAt != 0 THEN deletedAt ELSE ?14 END
+WHERE liveID = ?1;
+
+-- name: insertMirrorLive :write
+-- 插入从主实例同步的新的直播，已经存在时由updateMirrorLive更新
+-- params: l *Live, suggestedTitle string, recordFile string, deletedAt int64
+INSERT OR IGNORE INTO acfunlive
+	(liveID, uid, name, streamName, startTime, title, duration, playbackURL, backupURL, liveCutNum, access, suggestedTitle, recordFile, deletedAt)
+VALUES
+	(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14);
+
+-- name: softDeleteMirrorLive :write
+-- 在deletedAt（毫秒）软删除在主实例已经被彻底删除的直播
+-- params: deletedAt int64, liveID LiveID
+UPDATE acfunlive SET deletedAt = ? WHERE liveID = ? AND deletedAt = 0;
+
+-- name: selectLiveID :one
+-- 查询直播是否存在
+-- params: liveID LiveID
+-- types: exist bool
+SELECT EXISTS (SELECT 1 FROM {acfunlive} WHERE liveID = ?) AS exist;
+
+-- name: selectTitles :many
+-- 按时间顺序查询直播间标题的变更记录
+-- params: liveID LiveID
+-- row: TitleChange
+SELECT title, changeTime FROM {titleHistory} WHERE liveID = ? ORDER BY changeTime;
+
+-- name: selectStreamerNames :many
+-- 查询主播用过的昵称
+-- params: uid UID
+-- row: StreamerName
+SELECT uid, name, firstSeen, lastSeen FROM streamerName WHERE uid = ? ORDER BY firstSeen;
+
+-- name: searchStreamerNames :many
+-- 查询用过匹配pattern的昵称的主播，pattern为转义后的LIKE模式
+-- params: pattern string
+-- row: StreamerName
+SELECT uid, name, firstSeen, lastSeen FROM streamerName WHERE name LIKE ? ESCAPE '\' ORDER BY uid, firstSeen;
+
+-- name: selectLatestStreamerNames :many
+-- 查询所有主播最近使用的昵称
+-- row: StreamerName
+SELECT uid, name, firstSeen, lastSeen FROM (
+	SELECT uid, name, firstSeen, lastSeen,
+		ROW_NUMBER() OVER (PARTITION BY uid ORDER BY lastSeen DESC, firstSeen DESC) AS n
+	FROM streamerName
+)
+WHERE n = 1
+ORDER BY uid;
+
+-- name: selectChanges :many
+-- 按seq从小到大查询直播数据的变更
+-- params: after int64, since int64, limit int
+-- row: LiveChange
+SELECT seq, liveID, changeTime FROM liveChange
+WHERE seq > ? AND changeTime >= ?
+ORDER BY seq
+LIMIT ?;
+
+-- name: selectLastChange :one
+-- 查询最后一次变更的seq，没有变更时为0
+-- types: seq int64
+SELECT COALESCE(MAX(seq), 0) AS seq FROM liveChange;
+
+-- name: selectSyncSeq :one
+-- 查询从source同步到的seq
+-- params: source string
+SELECT seq FROM syncState WHERE source = ?;
+
+-- name: selectDanmakuPeaks :many
+-- 把直播的弹幕按bucket（毫秒）分段统计数量，返回弹幕最多的n段
+-- params: bucket int64, liveID LiveID, n int
+-- row: DanmakuPeak
+SELECT (d.sendTime - l.startTime) / ?1 * ?1 AS offset, COUNT(*) AS count
+FROM danmaku d
+JOIN {acfunlive} l ON l.liveID = d.liveID
+WHERE d.liveID = ?2 AND d.sendTime >= l.startTime
+GROUP BY offset
+ORDER BY count DESC, offset
+LIMIT ?3;
+
+-- name: selectTimedDanmaku :many
+-- 按发送时间查询直播的弹幕和弹幕在直播里的时间
+-- params: liveID LiveID
+-- row: TimedDanmaku
+SELECT d.sendTime - l.startTime AS offset, d.uid, d.nickname, d.content
+FROM danmaku d
+JOIN {acfunlive} l ON l.liveID = d.liveID
+WHERE d.liveID = ?
+ORDER BY d.sendTime, d.id;
+
+-- name: selectFanCount :one
+-- 查询观众统计的行数
+-- types: n int64
+SELECT COUNT(*) AS n FROM fanStats;
+
+-- name: selectFans :many
+-- 按弹幕数量从多到少查询主播直播间里的前n个观众
+-- params: uid UID, n int
+-- row: Fan
+SELECT uid, nickname, messageCount, giftCount, acCoin AS ACCoin, firstSeen, lastSeen
+FROM fanStats
+WHERE liverUID = ?
+ORDER BY messageCount DESC, giftCount DESC, uid
+LIMIT ?;
+
+-- name: selectGiftTotals :many
+-- 按花费的AC币从多到少查询直播每种礼物的合计
+-- params: liveID LiveID
+-- row: GiftTotal
+SELECT giftID, giftName, count, acCoin AS ACCoin, senders
+FROM giftTotal
+WHERE liveID = ?
+ORDER BY acCoin DESC, count DESC, giftID;
+
+-- name: selectIncome :many
+-- 按开始时间从旧到新查询主播每场直播收到的礼物的合计
+-- params: uid UID
+-- row: Income
+SELECT t.liveID, l.startTime, l.title,
+	SUM(t.acCoin) AS ACCoin,
+	SUM(CASE WHEN t.acCoin > 0 THEN t.count ELSE 0 END) AS paidCount,
+	SUM(CASE WHEN t.acCoin = 0 THEN t.count ELSE 0 END) AS bananas
+FROM giftTotal t
+JOIN {acfunlive} l ON l.liveID = t.liveID
+WHERE l.uid = ?
+GROUP BY t.liveID
+ORDER BY l.startTime;
+
+-- name: selectRemovedLiveCuts :many
+-- 查询已经被删除的直播剪辑，最近发现的在前面
+-- row: LiveCutStatus
+SELECT l.liveID, l.uid, c.liveCutNum, c.checkTime, c.removedAt, c.downloadFile
+FROM liveCutStatus c JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE c.removedAt != 0 AND l.deletedAt = 0
+ORDER BY c.removedAt DESC;
+
+-- name: selectModeration :many
+-- 按时间从旧到新查询直播间的管理事件
+-- params: liveID LiveID
+-- row: ModerationEvent
+SELECT liveID, eventTime AS time, kind, content FROM moderationEvent WHERE liveID = ? ORDER BY eventTime;
+
+-- name: selectRankings :many
+-- 按时间从旧到新查询直播进入排名的记录
+-- params: liveID LiveID
+-- row: Ranking
+SELECT time, rank, liveID, uid, onlineCount FROM ranking WHERE liveID = ? ORDER BY time;
+
+-- name: selectSamples :many
+-- 按时间从旧到新查询直播每分钟的采样
+-- params: liveID LiveID
+-- row: Sample
+SELECT liveID, sampleTime AS time, watchingCount, likeCount, danmakuCount FROM liveSample WHERE liveID = ? ORDER BY sampleTime;
+
+-- name: selectFanClub :many
+-- 按时间从旧到新查询直播开始和结束时主播的守护团信息
+-- params: liveID LiveID
+-- row: FanClub
+SELECT liveID, phase, sampleTime AS time, clubName, memberCount FROM fanClub WHERE liveID = ? ORDER BY sampleTime;
+
+-- name: selectLiveStreams :many
+-- 按开始时间从旧到新查询主播每场直播的直播源，同一场直播按码率从低到高排列
+-- params: uid UID
+-- row: LiveStream
+SELECT s.liveID, l.startTime, s.qualityName, s.bitrate, s.host
+FROM streamQuality s
+JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.uid = ?
+ORDER BY l.startTime, s.liveID, s.bitrate;
+
+-- name: selectViewerSamples :many
+-- 按时间从旧到新查询直播每次获取直播间列表时的在线人数和点赞数
+-- params: liveID LiveID
+-- row: ViewerSample
+SELECT liveID, sampleTime AS time, onlineCount, likeCount FROM viewerSample WHERE liveID = ? ORDER BY sampleTime;
+
+-- name: selectMonthlyStats :many
+-- 查询主播每个月的直播统计
+-- params: uid UID
+-- row: MonthlyStats
+SELECT uid, month, liveCount, totalDuration, maxViewers FROM monthlyStats WHERE uid = ? ORDER BY month;
+
+-- name: selectSchedule :many
+-- 查询主播的开播时间分布，按开播次数从多到少排列
+-- params: uid UID
+-- row: ScheduleSlot
+SELECT weekday, hour, liveCount FROM liveSchedule WHERE uid = ? ORDER BY liveCount DESC, weekday, hour;
+
+-- name: selectTopStreamers :many
+-- 查询一个月里直播总时长最长的n个主播
+-- params: month string, n int
+-- row: TopStreamer
+SELECT m.uid, m.month, m.liveCount, m.totalDuration, m.maxViewers,
+	COALESCE((SELECT name FROM streamerName WHERE uid = m.uid ORDER BY lastSeen DESC LIMIT 1), '') AS name
+FROM monthlyStats m
+WHERE m.month = ?
+ORDER BY m.totalDuration DESC, m.uid
+LIMIT ?;
+
+-- name: selectDanmakuBytes :one
+-- 估算直播的弹幕占用的字节数，三个整数列按每个8字节计算
+-- params: liveID LiveID
+-- types: bytes int64
+SELECT COALESCE(SUM(LENGTH(CAST(liveID AS BLOB)) + LENGTH(CAST(nickname AS BLOB)) + LENGTH(CAST(content AS BLOB)) + 24), 0) AS bytes
+FROM danmaku WHERE liveID = ?;
+
+-- name: selectStorageSources :many
+-- 按开始时间从新到旧查询主播没有删除的直播保存在本地的文件
+-- params: uid UID
+-- row: StorageSource
+SELECT l.liveID, l.recordFile, COALESCE(c.downloadFile, '') AS liveCutFile
+FROM {acfunlive} l LEFT JOIN liveCutStatus c ON c.liveID = l.liveID
+WHERE l.uid = ? AND l.deletedAt = 0
+ORDER BY l.startTime DESC;
+
+-- name: selectLiveStorage :many
+-- 按开始时间从新到旧查询主播每场直播占用的空间
+-- params: uid UID
+-- row: LiveStorage
+SELECT l.liveID, l.startTime, s.kind, s.bytes
+FROM liveStorage s JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.uid = ? AND l.deletedAt = 0
+ORDER BY l.startTime DESC, s.kind;
+
+-- name: selectStreamerStorage :many
+-- 查询每个主播的每种数据占用的空间
+-- row: StreamerStorage
+SELECT l.uid, s.kind, SUM(s.bytes) AS bytes
+FROM liveStorage s JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.deletedAt = 0
+GROUP BY l.uid, s.kind
+ORDER BY l.uid, s.kind;
+
+-- name: selectArchiveYears :many
+-- 查询需要归档的直播的开播年份（本地时间），正在直播和已删除的直播不归档
+-- params: before int64
+-- types: year int
+SELECT DISTINCT CAST(strftime('%Y', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER) AS year
+FROM main.acfunlive
+WHERE startTime < ? AND deletedAt = 0 AND liveID NOT IN (SELECT liveID FROM main.activeLive);
+
+-- name: selectOutbox :many
+-- 按顺序查询最早的limit个等待发送的事件
+-- params: limit int
+-- row: OutboxEvent
+SELECT id, event, liveID, payload, createTime FROM eventOutbox ORDER BY id LIMIT ?;
+
+-- name: deleteOutbox :execrows
+-- 删除序号不大于id的事件
+-- params: id int64
+DELETE FROM eventOutbox WHERE id <= ?;
+
+-- name: selectDueNotifications :many
+-- 按顺序查询下次发送时间不晚于now的最早的limit个通知
+-- params: now int64, limit int
+-- row: Notification
+SELECT id, target, uid, liveID, payload, attempts, nextTime, lastError, createTime
+FROM notifyOutbox WHERE nextTime <= ? ORDER BY id LIMIT ?;
+
+-- name: selectNotifications :many
+-- 按顺序查询所有等待发送的通知
+-- row: Notification
+SELECT id, target, uid, liveID, payload, attempts, nextTime, lastError, createTime FROM notifyOutbox ORDER BY id;
+
+-- name: deleteNotification :exec
+-- 删除通知
+-- params: id int64
+DELETE FROM notifyOutbox WHERE id = ?;
+
+-- name: delayNotification :exec
+-- 记录通知发送失败，增加失败次数
+-- params: nextTime int64, lastError string, id int64
+UPDATE notifyOutbox SET attempts = attempts + 1, nextTime = ?, lastError = ? WHERE id = ?;
+
+-- name: selectCryptSalt :one
+-- 查询生成密钥的盐
+SELECT salt FROM cryptSalt WHERE id = 1;
+
+-- name: insertCryptSalt :exec
+-- 保存生成密钥的盐
+-- params: salt string
+INSERT INTO cryptSalt (id, salt) VALUES (1, ?);
+
+-- name: selectJobCursor :one
+-- 查询批处理任务处理到的位置
+-- params: job string
+SELECT cursor FROM jobCursor WHERE job = ?;
+
+-- name: countDanmaku :one
+-- 查询直播来源为source的弹幕数量
+-- params: liveID LiveID, source string
+-- types: n int64
+SELECT COUNT(*) AS n FROM danmaku WHERE liveID = ? AND source = ?;
+
+-- name: selectDanmakuSession :one
+-- 查询直播的弹幕记录
+-- params: liveID LiveID
+-- row: DanmakuSession
+SELECT liveID, uid, startTime, openTime, closeTime, status, danmakuCount FROM danmakuSession WHERE liveID = ?;
+
+-- name: selectChatStats :one
+-- 查询直播的弹幕统计
+-- params: liveID LiveID
+-- row: ChatStats
+SELECT c.liveID, l.startTime, c.messageCount, c.chatterCount, c.peakMinute, c.peakCount, c.histogram
+FROM chatStats c
+JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE c.liveID = ?;
+
+-- name: insertTenant :one
+-- 添加用户，返回用户ID
+-- params: name string, createTime int64
+-- types: id int64
+INSERT INTO tenant (name, createTime) VALUES (?, ?) RETURNING id;
+
+-- name: deleteTenant :execrows
+-- 删除用户
+-- params: id int64
+DELETE FROM tenant WHERE id = ?;
+
+-- name: deleteTenantKeys :exec
+-- 删除用户的API key
+-- params: tenantID int64
+DELETE FROM tenantKey WHERE tenantID = ?;
+
+-- name: deleteTenantWatches :exec
+-- 删除用户关注的主播
+-- params: tenantID int64
+DELETE FROM tenantWatch WHERE tenantID = ?;
+
+-- name: selectTenants :many
+-- 按用户ID查询所有用户
+-- row: Tenant
+SELECT id, name, hookURL, hookFormat, createTime FROM tenant ORDER BY id;
+
+-- name: selectTenantByName :one
+-- 按用户名查询用户
+-- params: name string
+-- row: Tenant
+SELECT id, name, hookURL, hookFormat, createTime FROM tenant WHERE name = ?;
+
+-- name: selectTenantByKey :one
+-- 查询API key的SHA-256为keyHash的用户
+-- params: keyHash string
+-- row: Tenant
+SELECT t.id, t.name, t.hookURL, t.hookFormat, t.createTime
+FROM tenant t JOIN tenantKey k ON k.tenantID = t.id
+WHERE k.keyHash = ?;
+
+-- name: insertTenantKey :exec
+-- 添加用户的API key
+-- params: keyHash string, tenantID int64, createTime int64
+INSERT INTO tenantKey (keyHash, tenantID, createTime) VALUES (?, ?, ?);
+
+-- name: revokeTenantKeys :execrows
+-- 删除用户所有的API key
+-- params: tenantID int64
+DELETE FROM tenantKey WHERE tenantID = ?;
+
+-- name: updateTenantHook :exec
+-- 修改用户的webhook
+-- params: hookURL string, hookFormat string, id int64
+UPDATE tenant SET hookURL = ?, hookFormat = ? WHERE id = ?;
+
+-- name: selectTenantWatch :many
+-- 按uid查询用户关注的主播
+-- params: tenantID int64
+-- types: uid UID
+SELECT uid FROM tenantWatch WHERE tenantID = ? ORDER BY uid;
+
+-- name: insertTenantWatch :execrows
+-- 让用户关注主播，已经关注时不修改
+-- params: tenantID int64, uid UID
+INSERT OR IGNORE INTO tenantWatch (tenantID, uid) VALUES (?, ?);
+
+-- name: deleteTenantWatch :execrows
+-- 让用户取消关注主播
+-- params: tenantID int64, uid UID
+DELETE FROM tenantWatch WHERE tenantID = ? AND uid = ?;
+
+-- name: selectWatchingTenants :many
+-- 查询关注了主播的用户
+-- params: uid UID
+-- row: Tenant
+SELECT t.id, t.name, t.hookURL, t.hookFormat, t.createTime
+FROM tenant t JOIN tenantWatch w ON w.tenantID = t.id
+WHERE w.uid = ?
+ORDER BY t.id;
+
+-- name: selectAvatars :many
+-- 按第一次看到的时间查询主播用过的头像
+-- params: uid UID
+-- row: Avatar
+SELECT uid, url AS URL, firstSeen, lastSeen, file FROM streamerAvatar WHERE uid = ? ORDER BY firstSeen;
+
+-- name: selectCovers :many
+-- 按开始时间从旧到新查询主播下载过的直播封面
+-- params: uid UID
+-- row: LiveCover
+SELECT c.liveID, l.startTime, c.url AS URL, c.file, c.downloadTime AS time
+FROM liveCover c
+JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE l.uid = ?
+ORDER BY l.startTime;
+
+-- name: selectFollowers :many
+-- 按时间从旧到新查询主播的粉丝数和关注数
+-- params: uid UID
+-- row: Follower
+SELECT uid, snapshotTime AS time, fansCount, followingCount FROM followerSnapshot WHERE uid = ? ORDER BY snapshotTime;
+
+-- name: insertRanking :write
+-- 保存时间为t（毫秒）的直播间人气排名
+-- params: t int64, rank int, liveID LiveID, uid UID, onlineCount int
+INSERT OR REPLACE INTO ranking (time, rank, liveID, uid, onlineCount) VALUES (?, ?, ?, ?, ?);
+
+-- name: insertDanmaku :write
+-- 保存一条弹幕
+-- params: liveID LiveID, sendTime int64, uid int64, nickname string, content string, source string, medalUID int64, medalName string, medalLevel int
+INSERT INTO danmaku (liveID, sendTime, uid, nickname, content, source, medalUID, medalName, medalLevel)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: openDanmakuSession :write
+-- 开始记录直播的弹幕，同一场直播重新连接弹幕时继续使用原来的记录
+-- params: liveID LiveID, uid UID, startTime int64, openTime int64
+INSERT INTO danmakuSession (liveID, uid, startTime, openTime) VALUES (?, ?, ?, ?)
+ON CONFLICT (liveID) DO UPDATE SET closeTime = 0, status = 'open';
+
+-- name: closeDanmakuSession :write
+-- 在closeTime（毫秒）结束记录直播的弹幕，并保存记录到的弹幕数量
+-- params: closeTime int64, status string, liveID LiveID
+UPDATE danmakuSession SET closeTime = ?1, status = ?2,
+	danmakuCount = (SELECT COUNT(*) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live')
+WHERE liveID = ?3 AND status = 'open';
+
+-- name: closeStaleDanmakuSessions :execrows
+-- 把上次运行时没有结束的弹幕记录标记为中断，结束时间为最后一条弹幕的时间
+UPDATE danmakuSession SET status = 'interrupted',
+	closeTime = COALESCE((SELECT MAX(sendTime) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live'), openTime),
+	danmakuCount = (SELECT COUNT(*) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live')
+WHERE status = 'open';
+
+-- name: upsertChatStats :write
+-- 根据已经保存的弹幕生成直播的弹幕统计。先按直播和分钟统计弹幕数，再合计到每场直播，peakMinute取弹幕数最多的一分钟
+-- params: liveID LiveID
+INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN acfunlive l ON l.liveID = d.liveID WHERE d.sendTime >= l.startTime AND d.liveID = ?
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;
+
+-- name: upsertStaleChatStats :exec
+-- 为上次运行时没有结束的弹幕记录生成弹幕统计，和upsertChatStats的统计方法相同
+INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN acfunlive l ON l.liveID = d.liveID
+	WHERE d.sendTime >= l.startTime AND d.liveID IN (SELECT liveID FROM danmakuSession WHERE status = 'open')
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;
+
+-- name: deleteChatStats :exec
+-- 删除所有弹幕统计
+DELETE FROM chatStats;
+
+-- name: rebuildChatStats :execrows
+-- 根据所有弹幕（包括归档的直播）生成弹幕统计，和upsertChatStats的统计方法相同
+INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN {acfunlive} l ON l.liveID = d.liveID WHERE d.sendTime >= l.startTime
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;
+
+-- name: insertGift :write
+-- 保存一次礼物
+-- params: liveID LiveID, sendTime int64, uid int64, nickname string, giftID int64, giftName string, count int, acCoin int64
+INSERT INTO gift (liveID, sendTime, uid, nickname, giftID, giftName, count, acCoin) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: upsertGiftTotal :write
+-- 根据gift表重新合计直播每种礼物的数量和AC币，礼物只会增加，重新合计时直接覆盖
+-- params: liveID LiveID
+INSERT INTO giftTotal (liveID, giftID, giftName, count, acCoin, senders)
+SELECT liveID, giftID, MAX(giftName), SUM(count), SUM(acCoin), COUNT(DISTINCT uid) FROM gift
+WHERE liveID = ?
+GROUP BY liveID, giftID
+ON CONFLICT (liveID, giftID) DO UPDATE SET
+	giftName = excluded.giftName, count = excluded.count, acCoin = excluded.acCoin, senders = excluded.senders;
+
+-- name: upsertStaleGiftTotal :exec
+-- 为上次运行时没有结束的弹幕记录合计礼物，和upsertGiftTotal的合计方法相同
+INSERT INTO giftTotal (liveID, giftID, giftName, count, acCoin, senders)
+SELECT liveID, giftID, MAX(giftName), SUM(count), SUM(acCoin), COUNT(DISTINCT uid) FROM gift
+WHERE liveID IN (SELECT liveID FROM danmakuSession WHERE status = 'open')
+GROUP BY liveID, giftID
+ON CONFLICT (liveID, giftID) DO UPDATE SET
+	giftName = excluded.giftName, count = excluded.count, acCoin = excluded.acCoin, senders = excluded.senders;
+
+-- name: deleteFans :exec
+-- 删除所有观众统计
+DELETE FROM fanStats;
+
+-- name: rebuildFans :execrows
+-- 根据所有弹幕和礼物生成观众统计，按时间顺序合并，昵称为最后一次看到的昵称。冲突的处理和fans.go里的触发器相同
+INSERT INTO fanStats (liverUID, uid, nickname, messageCount, giftCount, acCoin, firstSeen, lastSeen)
+SELECT liverUID, uid, nickname, messageCount, giftCount, acCoin, sendTime, sendTime FROM (
+	SELECT l.uid AS liverUID, d.uid AS uid, d.nickname AS nickname, 1 AS messageCount, 0 AS giftCount, 0 AS acCoin, d.sendTime AS sendTime
+	FROM danmaku d JOIN {acfunlive} l ON l.liveID = d.liveID
+	UNION ALL
+	SELECT l.uid, g.uid, g.nickname, 0, g.count, g.acCoin, g.sendTime
+	FROM gift g JOIN {acfunlive} l ON l.liveID = g.liveID
+)
+WHERE true
+ORDER BY sendTime
+ON CONFLICT (liverUID, uid) DO UPDATE SET
+	nickname = CASE WHEN excluded.lastSeen >= lastSeen THEN excluded.nickname ELSE nickname END,
+	messageCount = messageCount + excluded.messageCount,
+	giftCount = giftCount + excluded.giftCount,
+	acCoin = acCoin + excluded.acCoin,
+	firstSeen = MIN(firstSeen, excluded.firstSeen),
+	lastSeen = MAX(lastSeen, excluded.lastSeen);
+
+-- name: deleteMonthlyStats :exec
+-- 删除所有每月统计
+DELETE FROM monthlyStats;
+
+-- name: rebuildMonthlyStats :execrows
+-- 根据所有直播数据（包括归档的直播）和人气排名生成每月统计
+INSERT INTO monthlyStats (uid, month, liveCount, totalDuration, maxViewers)
+SELECT l.uid, strftime('%Y-%m', l.startTime / 1000, 'unixepoch', 'localtime'), COUNT(*), SUM(l.duration), COALESCE(MAX(r.onlineCount), 0)
+FROM {acfunlive} l
+LEFT JOIN (SELECT liveID, MAX(onlineCount) AS onlineCount FROM ranking GROUP BY liveID) r ON r.liveID = l.liveID
+WHERE l.deletedAt = 0
+GROUP BY 1, 2;
+
+-- name: deleteSchedule :exec
+-- 删除所有开播时间分布
+DELETE FROM liveSchedule;
+
+-- name: rebuildSchedule :execrows
+-- 根据所有直播数据（包括归档的直播）生成开播时间分布
+INSERT INTO liveSchedule (uid, weekday, hour, liveCount)
+SELECT uid,
+	CAST(strftime('%w', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER),
+	CAST(strftime('%H', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER),
+	COUNT(*)
+FROM {acfunlive}
+WHERE deletedAt = 0
+GROUP BY 1, 2, 3;
+
+-- name: insertModeration :write
+-- 保存直播间的管理事件
+-- params: liveID LiveID, eventTime int64, kind string, content string
+INSERT INTO moderationEvent (liveID, eventTime, kind, content) VALUES (?, ?, ?, ?);
+
+-- name: insertSample :write
+-- 保存直播的一次采样
+-- params: liveID LiveID, sampleTime int64, watchingCount int, likeCount int, danmakuCount int
+INSERT OR REPLACE INTO liveSample (liveID, sampleTime, watchingCount, likeCount, danmakuCount) VALUES (?, ?, ?, ?, ?);
+
+-- name: insertViewerSample :write
+-- 保存获取直播间列表时直播间的在线人数和点赞数
+-- params: liveID LiveID, sampleTime int64, onlineCount int, likeCount int
+INSERT OR REPLACE INTO viewerSample (liveID, sampleTime, onlineCount, likeCount) VALUES (?, ?, ?, ?);
+
+-- name: insertFanClub :write
+-- 保存直播开始或结束时主播的守护团信息
+-- params: liveID LiveID, phase string, sampleTime int64, clubName string, memberCount int
+INSERT OR REPLACE INTO fanClub (liveID, phase, sampleTime, clubName, memberCount) VALUES (?, ?, ?, ?, ?);
+
+-- name: insertStream :write
+-- 保存直播开始时一个画质的直播源
+-- params: liveID LiveID, qualityType string, qualityName string, bitrate int, host string, sampleTime int64
+INSERT OR REPLACE INTO streamQuality (liveID, qualityType, qualityName, bitrate, host, sampleTime) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: upsertLiveCutStatus :write
+-- 保存确认直播剪辑的结果，直播剪辑编号改变时重新开始确认，已经发现被删除的不会因为之后确认存在而恢复
+-- params: liveID LiveID, num int, checkTime int64, removedAt int64
+INSERT INTO liveCutStatus (liveID, liveCutNum, checkTime, removedAt) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (liveID) DO UPDATE SET
+	removedAt = CASE WHEN liveCutNum != excluded.liveCutNum OR removedAt = 0 THEN excluded.removedAt ELSE removedAt END,
+	downloadFile = CASE WHEN liveCutNum != excluded.liveCutNum THEN '' ELSE downloadFile END,
+	liveCutNum = excluded.liveCutNum,
+	checkTime = excluded.checkTime;
+
+-- name: upsertLiveCutLookup :write
+-- 记录在lookupTime（毫秒）获取过直播的直播剪辑编号
+-- params: liveID LiveID, lookupTime int64
+INSERT INTO liveCutLookup (liveID, lookupTime) VALUES (?, ?)
+ON CONFLICT (liveID) DO UPDATE SET lookupTime = excluded.lookupTime;
+
+-- name: updateLiveCutDownload :write
+-- 保存下载的直播剪辑文件
+-- params: file string, liveID LiveID, num int
+UPDATE liveCutStatus SET downloadFile = ? WHERE liveID = ? AND liveCutNum = ?;
+
+-- name: upsertLiveStorage :write
+-- 保存直播的一种数据在updateTime（毫秒）时占用的空间
+-- params: liveID LiveID, kind string, bytes int64, updateTime int64
+INSERT INTO liveStorage (liveID, kind, bytes, updateTime) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (liveID, kind) DO UPDATE SET bytes = excluded.bytes, updateTime = excluded.updateTime;
+
+-- name: deleteLiveStorage :write
+-- 删除直播的一种数据占用的空间
+-- params: liveID LiveID, kind string
+DELETE FROM liveStorage WHERE liveID = ? AND kind = ?;
+
+-- name: insertOutbox :write
+-- 保存等待发送到Kafka或NATS的事件
+-- params: event string, liveID LiveID, payload string, createTime int64
+INSERT INTO eventOutbox (event, liveID, payload, createTime) VALUES (?, ?, ?, ?);
+
+-- name: insertNotify :write
+-- 保存等待发送的通知，第一次发送的时间为通知产生的时间
+-- params: target string, uid UID, liveID LiveID, payload string, nextTime int64, createTime int64
+INSERT INTO notifyOutbox (target, uid, liveID, payload, nextTime, createTime) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: upsertJobCursor :write
+-- 保存批处理任务在updateTime（毫秒）时处理到的位置
+-- params: job string, cursor string, updateTime int64
+INSERT INTO jobCursor (job, cursor, updateTime) VALUES (?1, ?2, ?3)
+ON CONFLICT (job) DO UPDATE SET cursor = excluded.cursor, updateTime = excluded.updateTime;
+
+-- name: deleteJobCursor :write
+-- 删除批处理任务的进度
+-- params: job string
+DELETE FROM jobCursor WHERE job = ?;
+
+-- name: upsertAvatar :write
+-- 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的头像，file不为空时保存下载的头像文件
+-- params: uid UID, url string, firstSeen int64, lastSeen int64, file string
+INSERT INTO streamerAvatar (uid, url, firstSeen, lastSeen, file) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (uid, url) DO UPDATE SET lastSeen = MAX(lastSeen, excluded.lastSeen),
+	file = CASE WHEN excluded.file != '' THEN excluded.file ELSE file END;
+
+-- name: insertCover :write
+-- 保存在downloadTime（毫秒）下载的直播封面文件
+-- params: liveID LiveID, url string, file string, downloadTime int64
+INSERT OR REPLACE INTO liveCover (liveID, url, file, downloadTime) VALUES (?, ?, ?, ?);
+
+-- name: insertFollower :write
+-- 保存一次获取的主播的粉丝数和关注数
+-- params: uid UID, snapshotTime int64, fansCount int, followingCount int
+INSERT OR REPLACE INTO followerSnapshot (uid, snapshotTime, fansCount, followingCount) VALUES (?, ?, ?, ?);
@@ -0,0 +1,1926 @@
+// Code generated by sqlgen from queries.sql. DO NOT EDIT.
+
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 插入直播数据，liveID已存在时修改的行数为0
+	insertLive = `INSERT OR IGNORE INTO acfunlive
+	(liveID, uid, name, streamName, startTime, title, duration, playbackURL, backupURL, liveCutNum, access)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	// 保存下播后获取到的直播时长
+	updateDuration = `UPDATE acfunlive SET duration = ? WHERE liveID = ?;`
+	// 查询直播剪辑编号
+	selectLiveCutNum = `SELECT liveCutNum FROM acfunlive WHERE liveID = ?;`
+	// 保存直播剪辑编号
+	updateLiveCutNum = `UPDATE acfunlive SET liveCutNum = ? WHERE liveID = ?;`
+	// 记录在fetchTime（毫秒）获取到的直播剪辑编号，直播剪辑可能会重新生成
+	insertLiveCut = `INSERT OR IGNORE INTO liveCutHistory (liveID, liveCutNum, fetchTime) VALUES (?, ?, ?);`
+	// 记录在changeTime（毫秒）看到的直播间标题
+	insertTitle = `INSERT INTO titleHistory (liveID, title, changeTime) VALUES (?, ?, ?);`
+	// 保存没有标题的直播的建议标题
+	updateSuggested = `UPDATE acfunlive SET suggestedTitle = ? WHERE liveID = ?;`
+	// 更新直播间的访问限制
+	updateAccess = `UPDATE acfunlive SET access = ? WHERE liveID = ?;`
+	// 保存直播的本地录播文件名
+	updateRecordFile = `UPDATE acfunlive SET recordFile = ? WHERE liveID = ?;`
+	// 保存直播的录播链接，链接需要先加密
+	updatePlayback = `UPDATE acfunlive SET playbackURL = ?, backupURL = ? WHERE liveID = ?;`
+	// 清除直播的录播链接
+	clearPlayback = `UPDATE acfunlive SET playbackURL = '', backupURL = '' WHERE liveID = ?;`
+	// 查询指定liveID的直播，包括已删除的直播
+	selectLive = `SELECT {liveColumns} FROM {acfunlive} WHERE liveID = ?;`
+	// 按开始时间从新到旧查询主播没有删除的直播
+	selectUID = `SELECT {liveColumns}
+FROM {acfunlive}
+WHERE uid = ? AND deletedAt = 0
+ORDER BY startTime DESC;`
+	// 按开始时间从新到旧查询主播最近limit场没有删除的直播
+	selectUIDLimit = `SELECT {liveColumns}
+FROM {acfunlive}
+WHERE uid = ? AND deletedAt = 0
+ORDER BY startTime DESC
+LIMIT ?;`
+	// 按开始时间和liveID查询(startTime, liveID)之后的limit场没有删除的直播
+	selectAll = `SELECT {liveColumns}
+FROM {acfunlive}
+WHERE deletedAt = 0 AND (startTime > ? OR (startTime = ? AND liveID > ?))
+ORDER BY startTime, liveID
+LIMIT ?;`
+	// 记录正在直播的liveID
+	insertActive = `INSERT OR IGNORE INTO activeLive (liveID) VALUES (?);`
+	// 删除已经下播的liveID
+	deleteActive = `DELETE FROM activeLive WHERE liveID = ?;`
+	// 查询记录为正在直播的直播
+	selectActive = `SELECT {liveColumns}
+FROM acfunlive
+WHERE liveID IN (SELECT liveID FROM activeLive);`
+	// 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+	selectUnfinished = `SELECT {liveColumns}
+FROM acfunlive
+WHERE duration = 0 AND startTime >= ? AND deletedAt = 0
+ORDER BY startTime;`
+	// 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的昵称
+	upsertStreamer = `INSERT INTO streamerName (uid, name, firstSeen, lastSeen) VALUES (?, ?, ?, ?)
+ON CONFLICT (uid, name) DO UPDATE SET lastSeen = MAX(lastSeen, excluded.lastSeen);`
+	// 在deletedAt（毫秒）软删除直播数据
+	softDeleteLive = `UPDATE acfunlive SET deletedAt = ? WHERE liveID = ? AND deletedAt = 0;`
+	// 恢复软删除的直播数据
+	restoreLive = `UPDATE acfunlive SET deletedAt = 0 WHERE liveID = ? AND deletedAt != 0;`
+	// 彻底删除在before（毫秒）之前软删除的直播数据
+	purgeLive = `DELETE FROM acfunlive WHERE deletedAt != 0 AND deletedAt < ?;`
+	// 删除没有对应直播的正在直播的记录
+	deleteOrphanActive = `DELETE FROM activeLive WHERE liveID NOT IN (SELECT liveID FROM acfunlive);`
+	// 删除没有对应直播的直播剪辑编号的历史记录
+	deleteOrphanLiveCut = `DELETE FROM liveCutHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);`
+	// 删除没有对应直播的标题的变更记录
+	deleteOrphanTitle = `DELETE FROM titleHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);`
+	// 删除没有对应直播的弹幕，弹幕的直播可能已经归档
+	deleteOrphanDanmaku = `DELETE FROM danmaku WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的弹幕记录
+	deleteOrphanDanmakuSession = `DELETE FROM danmakuSession WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的弹幕统计
+	deleteOrphanChatStats = `DELETE FROM chatStats WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的管理事件
+	deleteOrphanModeration = `DELETE FROM moderationEvent WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的在线人数、点赞数和弹幕数的采样
+	deleteOrphanSample = `DELETE FROM liveSample WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的直播间列表里的在线人数采样
+	deleteOrphanViewerSample = `DELETE FROM viewerSample WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的守护团信息
+	deleteOrphanFanClub = `DELETE FROM fanClub WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的直播源
+	deleteOrphanStream = `DELETE FROM streamQuality WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的直播封面
+	deleteOrphanCover = `DELETE FROM liveCover WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的礼物
+	deleteOrphanGift = `DELETE FROM gift WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的礼物合计
+	deleteOrphanGiftTotal = `DELETE FROM giftTotal WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的直播剪辑的检查结果
+	deleteOrphanLiveCutStatus = `DELETE FROM liveCutStatus WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的获取直播剪辑编号的记录
+	deleteOrphanLiveCutLookup = `DELETE FROM liveCutLookup WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 删除没有对应直播的占用空间统计
+	deleteOrphanLiveStorage = `DELETE FROM liveStorage WHERE liveID NOT IN (SELECT liveID FROM {acfunlive});`
+	// 查询在主数据库和归档数据库里都有数据的liveID，主数据库里liveID是主键，重复只会出现在数据库之间
+	selectDuplicateLiveIDs = `SELECT liveID FROM {acfunlive} GROUP BY liveID HAVING COUNT(*) > 1;`
+	// 查询直播时长超过maxDuration（毫秒）或为负数、开始时间晚于now（毫秒）的直播
+	selectBadDurations = `SELECT liveID FROM acfunlive WHERE duration < 0 OR duration > ? OR startTime > ?;`
+	// 查询已结束但从来没有获取过直播剪辑编号的直播，很多直播本来就没有直播剪辑
+	selectMissingLiveCut = `SELECT {liveColumns} FROM acfunlive
+WHERE duration > 0 AND liveCutNum = 0 AND liveID NOT IN (SELECT liveID FROM liveCutLookup);`
+	// 查询录播链接不完整或者还没有结束的直播
+	selectOrphanPlayback = `SELECT liveID FROM acfunlive WHERE (duration = 0 AND playbackURL != '') OR (playbackURL = '' AND backupURL != '');`
+	// 查询activeLive表里没有对应直播的liveID
+	selectOrphanActive = `SELECT liveID FROM activeLive WHERE liveID NOT IN (SELECT liveID FROM acfunlive);`
+	// 查询liveCutHistory表里没有对应直播的liveID
+	selectOrphanLiveCut = `SELECT DISTINCT liveID FROM liveCutHistory WHERE liveID NOT IN (SELECT liveID FROM acfunlive);`
+	// 查询seq大于after、变更时间不早于since（毫秒）的最多limit场直播的数据和删除时间
+	selectChangedLives = `SELECT {liveColumns}, deletedAt FROM {acfunlive}
+WHERE liveID IN (SELECT liveID FROM liveChange WHERE seq > ? AND changeTime >= ? ORDER BY seq LIMIT ?);`
+	// 保存从source同步到的seq
+	upsertSyncSeq = `INSERT INTO syncState (source, seq) VALUES (?, ?)
+ON CONFLICT (source) DO UPDATE SET seq = excluded.seq;`
+	// 更新从主实例同步的已有的直播，和insertMirrorLive使用相同的参数。不使用UPSERT，
+	// 因为UPSERT会让统计触发器里的INSERT OR IGNORE在冲突时出错。已删除时保留本地的删除时间
+	updateMirrorLive = `UPDATE acfunlive SET
+	uid = ?2, name = ?3, streamName = ?4, startTime = ?5, title = ?6, duration = ?7, playbackURL = ?8, backupURL = ?9,
+	liveCutNum = ?10, access = ?11, suggestedTitle = ?12, recordFile = ?13,
+	deletedAt = CASE WHEN ?14 = 0 THEN 0 WHEN deletedAt != 0 THEN deletedAt ELSE ?14 END
+WHERE liveID = ?1;`
+	// 插入从主实例同步的新的直播，已经存在时由updateMirrorLive更新
+	insertMirrorLive = `INSERT OR IGNORE INTO acfunlive
+	(liveID, uid, name, streamName, startTime, title, duration, playbackURL, backupURL, liveCutNum, access, suggestedTitle, recordFile, deletedAt)
+VALUES
+	(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14);`
+	// 在deletedAt（毫秒）软删除在主实例已经被彻底删除的直播
+	softDeleteMirrorLive = `UPDATE acfunlive SET deletedAt = ? WHERE liveID = ? AND deletedAt = 0;`
+	// 查询直播是否存在
+	selectLiveID = `SELECT EXISTS (SELECT 1 FROM {acfunlive} WHERE liveID = ?) AS exist;`
+	// 按时间顺序查询直播间标题的变更记录
+	selectTitles = `SELECT title, changeTime FROM {titleHistory} WHERE liveID = ? ORDER BY changeTime;`
+	// 查询主播用过的昵称
+	selectStreamerNames = `SELECT uid, name, firstSeen, lastSeen FROM streamerName WHERE uid = ? ORDER BY firstSeen;`
+	// 查询用过匹配pattern的昵称的主播，pattern为转义后的LIKE模式
+	searchStreamerNames = `SELECT uid, name, firstSeen, lastSeen FROM streamerName WHERE name LIKE ? ESCAPE '\' ORDER BY uid, firstSeen;`
+	// 查询所有主播最近使用的昵称
+	selectLatestStreamerNames = `SELECT uid, name, firstSeen, lastSeen FROM (
+	SELECT uid, name, firstSeen, lastSeen,
+		ROW_NUMBER() OVER (PARTITION BY uid ORDER BY lastSeen DESC, firstSeen DESC) AS n
+	FROM streamerName
+)
+WHERE n = 1
+ORDER BY uid;`
+	// 按seq从小到大查询直播数据的变更
+	selectChanges = `SELECT seq, liveID, changeTime FROM liveChange
+WHERE seq > ? AND changeTime >= ?
+ORDER BY seq
+LIMIT ?;`
+	// 查询最后一次变更的seq，没有变更时为0
+	selectLastChange = `SELECT COALESCE(MAX(seq), 0) AS seq FROM liveChange;`
+	// 查询从source同步到的seq
+	selectSyncSeq = `SELECT seq FROM syncState WHERE source = ?;`
+	// 把直播的弹幕按bucket（毫秒）分段统计数量，返回弹幕最多的n段
+	selectDanmakuPeaks = `SELECT (d.sendTime - l.startTime) / ?1 * ?1 AS offset, COUNT(*) AS count
+FROM danmaku d
+JOIN {acfunlive} l ON l.liveID = d.liveID
+WHERE d.liveID = ?2 AND d.sendTime >= l.startTime
+GROUP BY offset
+ORDER BY count DESC, offset
+LIMIT ?3;`
+	// 按发送时间查询直播的弹幕和弹幕在直播里的时间
+	selectTimedDanmaku = `SELECT d.sendTime - l.startTime AS offset, d.uid, d.nickname, d.content
+FROM danmaku d
+JOIN {acfunlive} l ON l.liveID = d.liveID
+WHERE d.liveID = ?
+ORDER BY d.sendTime, d.id;`
+	// 查询观众统计的行数
+	selectFanCount = `SELECT COUNT(*) AS n FROM fanStats;`
+	// 按弹幕数量从多到少查询主播直播间里的前n个观众
+	selectFans = `SELECT uid, nickname, messageCount, giftCount, acCoin AS ACCoin, firstSeen, lastSeen
+FROM fanStats
+WHERE liverUID = ?
+ORDER BY messageCount DESC, giftCount DESC, uid
+LIMIT ?;`
+	// 按花费的AC币从多到少查询直播每种礼物的合计
+	selectGiftTotals = `SELECT giftID, giftName, count, acCoin AS ACCoin, senders
+FROM giftTotal
+WHERE liveID = ?
+ORDER BY acCoin DESC, count DESC, giftID;`
+	// 按开始时间从旧到新查询主播每场直播收到的礼物的合计
+	selectIncome = `SELECT t.liveID, l.startTime, l.title,
+	SUM(t.acCoin) AS ACCoin,
+	SUM(CASE WHEN t.acCoin > 0 THEN t.count ELSE 0 END) AS paidCount,
+	SUM(CASE WHEN t.acCoin = 0 THEN t.count ELSE 0 END) AS bananas
+FROM giftTotal t
+JOIN {acfunlive} l ON l.liveID = t.liveID
+WHERE l.uid = ?
+GROUP BY t.liveID
+ORDER BY l.startTime;`
+	// 查询已经被删除的直播剪辑，最近发现的在前面
+	selectRemovedLiveCuts = `SELECT l.liveID, l.uid, c.liveCutNum, c.checkTime, c.removedAt, c.downloadFile
+FROM liveCutStatus c JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE c.removedAt != 0 AND l.deletedAt = 0
+ORDER BY c.removedAt DESC;`
+	// 按时间从旧到新查询直播间的管理事件
+	selectModeration = `SELECT liveID, eventTime AS time, kind, content FROM moderationEvent WHERE liveID = ? ORDER BY eventTime;`
+	// 按时间从旧到新查询直播进入排名的记录
+	selectRankings = `SELECT time, rank, liveID, uid, onlineCount FROM ranking WHERE liveID = ? ORDER BY time;`
+	// 按时间从旧到新查询直播每分钟的采样
+	selectSamples = `SELECT liveID, sampleTime AS time, watchingCount, likeCount, danmakuCount FROM liveSample WHERE liveID = ? ORDER BY sampleTime;`
+	// 按时间从旧到新查询直播开始和结束时主播的守护团信息
+	selectFanClub = `SELECT liveID, phase, sampleTime AS time, clubName, memberCount FROM fanClub WHERE liveID = ? ORDER BY sampleTime;`
+	// 按开始时间从旧到新查询主播每场直播的直播源，同一场直播按码率从低到高排列
+	selectLiveStreams = `SELECT s.liveID, l.startTime, s.qualityName, s.bitrate, s.host
+FROM streamQuality s
+JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.uid = ?
+ORDER BY l.startTime, s.liveID, s.bitrate;`
+	// 按时间从旧到新查询直播每次获取直播间列表时的在线人数和点赞数
+	selectViewerSamples = `SELECT liveID, sampleTime AS time, onlineCount, likeCount FROM viewerSample WHERE liveID = ? ORDER BY sampleTime;`
+	// 查询主播每个月的直播统计
+	selectMonthlyStats = `SELECT uid, month, liveCount, totalDuration, maxViewers FROM monthlyStats WHERE uid = ? ORDER BY month;`
+	// 查询主播的开播时间分布，按开播次数从多到少排列
+	selectSchedule = `SELECT weekday, hour, liveCount FROM liveSchedule WHERE uid = ? ORDER BY liveCount DESC, weekday, hour;`
+	// 查询一个月里直播总时长最长的n个主播
+	selectTopStreamers = `SELECT m.uid, m.month, m.liveCount, m.totalDuration, m.maxViewers,
+	COALESCE((SELECT name FROM streamerName WHERE uid = m.uid ORDER BY lastSeen DESC LIMIT 1), '') AS name
+FROM monthlyStats m
+WHERE m.month = ?
+ORDER BY m.totalDuration DESC, m.uid
+LIMIT ?;`
+	// 估算直播的弹幕占用的字节数，三个整数列按每个8字节计算
+	selectDanmakuBytes = `SELECT COALESCE(SUM(LENGTH(CAST(liveID AS BLOB)) + LENGTH(CAST(nickname AS BLOB)) + LENGTH(CAST(content AS BLOB)) + 24), 0) AS bytes
+FROM danmaku WHERE liveID = ?;`
+	// 按开始时间从新到旧查询主播没有删除的直播保存在本地的文件
+	selectStorageSources = `SELECT l.liveID, l.recordFile, COALESCE(c.downloadFile, '') AS liveCutFile
+FROM {acfunlive} l LEFT JOIN liveCutStatus c ON c.liveID = l.liveID
+WHERE l.uid = ? AND l.deletedAt = 0
+ORDER BY l.startTime DESC;`
+	// 按开始时间从新到旧查询主播每场直播占用的空间
+	selectLiveStorage = `SELECT l.liveID, l.startTime, s.kind, s.bytes
+FROM liveStorage s JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.uid = ? AND l.deletedAt = 0
+ORDER BY l.startTime DESC, s.kind;`
+	// 查询每个主播的每种数据占用的空间
+	selectStreamerStorage = `SELECT l.uid, s.kind, SUM(s.bytes) AS bytes
+FROM liveStorage s JOIN {acfunlive} l ON l.liveID = s.liveID
+WHERE l.deletedAt = 0
+GROUP BY l.uid, s.kind
+ORDER BY l.uid, s.kind;`
+	// 查询需要归档的直播的开播年份（本地时间），正在直播和已删除的直播不归档
+	selectArchiveYears = `SELECT DISTINCT CAST(strftime('%Y', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER) AS year
+FROM main.acfunlive
+WHERE startTime < ? AND deletedAt = 0 AND liveID NOT IN (SELECT liveID FROM main.activeLive);`
+	// 按顺序查询最早的limit个等待发送的事件
+	selectOutbox = `SELECT id, event, liveID, payload, createTime FROM eventOutbox ORDER BY id LIMIT ?;`
+	// 删除序号不大于id的事件
+	deleteOutbox = `DELETE FROM eventOutbox WHERE id <= ?;`
+	// 按顺序查询下次发送时间不晚于now的最早的limit个通知
+	selectDueNotifications = `SELECT id, target, uid, liveID, payload, attempts, nextTime, lastError, createTime
+FROM notifyOutbox WHERE nextTime <= ? ORDER BY id LIMIT ?;`
+	// 按顺序查询所有等待发送的通知
+	selectNotifications = `SELECT id, target, uid, liveID, payload, attempts, nextTime, lastError, createTime FROM notifyOutbox ORDER BY id;`
+	// 删除通知
+	deleteNotification = `DELETE FROM notifyOutbox WHERE id = ?;`
+	// 记录通知发送失败，增加失败次数
+	delayNotification = `UPDATE notifyOutbox SET attempts = attempts + 1, nextTime = ?, lastError = ? WHERE id = ?;`
+	// 查询生成密钥的盐
+	selectCryptSalt = `SELECT salt FROM cryptSalt WHERE id = 1;`
+	// 保存生成密钥的盐
+	insertCryptSalt = `INSERT INTO cryptSalt (id, salt) VALUES (1, ?);`
+	// 查询批处理任务处理到的位置
+	selectJobCursor = `SELECT cursor FROM jobCursor WHERE job = ?;`
+	// 查询直播来源为source的弹幕数量
+	countDanmaku = `SELECT COUNT(*) AS n FROM danmaku WHERE liveID = ? AND source = ?;`
+	// 查询直播的弹幕记录
+	selectDanmakuSession = `SELECT liveID, uid, startTime, openTime, closeTime, status, danmakuCount FROM danmakuSession WHERE liveID = ?;`
+	// 查询直播的弹幕统计
+	selectChatStats = `SELECT c.liveID, l.startTime, c.messageCount, c.chatterCount, c.peakMinute, c.peakCount, c.histogram
+FROM chatStats c
+JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE c.liveID = ?;`
+	// 添加用户，返回用户ID
+	insertTenant = `INSERT INTO tenant (name, createTime) VALUES (?, ?) RETURNING id;`
+	// 删除用户
+	deleteTenant = `DELETE FROM tenant WHERE id = ?;`
+	// 删除用户的API key
+	deleteTenantKeys = `DELETE FROM tenantKey WHERE tenantID = ?;`
+	// 删除用户关注的主播
+	deleteTenantWatches = `DELETE FROM tenantWatch WHERE tenantID = ?;`
+	// 按用户ID查询所有用户
+	selectTenants = `SELECT id, name, hookURL, hookFormat, createTime FROM tenant ORDER BY id;`
+	// 按用户名查询用户
+	selectTenantByName = `SELECT id, name, hookURL, hookFormat, createTime FROM tenant WHERE name = ?;`
+	// 查询API key的SHA-256为keyHash的用户
+	selectTenantByKey = `SELECT t.id, t.name, t.hookURL, t.hookFormat, t.createTime
+FROM tenant t JOIN tenantKey k ON k.tenantID = t.id
+WHERE k.keyHash = ?;`
+	// 添加用户的API key
+	insertTenantKey = `INSERT INTO tenantKey (keyHash, tenantID, createTime) VALUES (?, ?, ?);`
+	// 删除用户所有的API key
+	revokeTenantKeys = `DELETE FROM tenantKey WHERE tenantID = ?;`
+	// 修改用户的webhook
+	updateTenantHook = `UPDATE tenant SET hookURL = ?, hookFormat = ? WHERE id = ?;`
+	// 按uid查询用户关注的主播
+	selectTenantWatch = `SELECT uid FROM tenantWatch WHERE tenantID = ? ORDER BY uid;`
+	// 让用户关注主播，已经关注时不修改
+	insertTenantWatch = `INSERT OR IGNORE INTO tenantWatch (tenantID, uid) VALUES (?, ?);`
+	// 让用户取消关注主播
+	deleteTenantWatch = `DELETE FROM tenantWatch WHERE tenantID = ? AND uid = ?;`
+	// 查询关注了主播的用户
+	selectWatchingTenants = `SELECT t.id, t.name, t.hookURL, t.hookFormat, t.createTime
+FROM tenant t JOIN tenantWatch w ON w.tenantID = t.id
+WHERE w.uid = ?
+ORDER BY t.id;`
+	// 按第一次看到的时间查询主播用过的头像
+	selectAvatars = `SELECT uid, url AS URL, firstSeen, lastSeen, file FROM streamerAvatar WHERE uid = ? ORDER BY firstSeen;`
+	// 按开始时间从旧到新查询主播下载过的直播封面
+	selectCovers = `SELECT c.liveID, l.startTime, c.url AS URL, c.file, c.downloadTime AS time
+FROM liveCover c
+JOIN {acfunlive} l ON l.liveID = c.liveID
+WHERE l.uid = ?
+ORDER BY l.startTime;`
+	// 按时间从旧到新查询主播的粉丝数和关注数
+	selectFollowers = `SELECT uid, snapshotTime AS time, fansCount, followingCount FROM followerSnapshot WHERE uid = ? ORDER BY snapshotTime;`
+	// 保存时间为t（毫秒）的直播间人气排名
+	insertRanking = `INSERT OR REPLACE INTO ranking (time, rank, liveID, uid, onlineCount) VALUES (?, ?, ?, ?, ?);`
+	// 保存一条弹幕
+	insertDanmaku = `INSERT INTO danmaku (liveID, sendTime, uid, nickname, content, source, medalUID, medalName, medalLevel)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	// 开始记录直播的弹幕，同一场直播重新连接弹幕时继续使用原来的记录
+	openDanmakuSession = `INSERT INTO danmakuSession (liveID, uid, startTime, openTime) VALUES (?, ?, ?, ?)
+ON CONFLICT (liveID) DO UPDATE SET closeTime = 0, status = 'open';`
+	// 在closeTime（毫秒）结束记录直播的弹幕，并保存记录到的弹幕数量
+	closeDanmakuSession = `UPDATE danmakuSession SET closeTime = ?1, status = ?2,
+	danmakuCount = (SELECT COUNT(*) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live')
+WHERE liveID = ?3 AND status = 'open';`
+	// 把上次运行时没有结束的弹幕记录标记为中断，结束时间为最后一条弹幕的时间
+	closeStaleDanmakuSessions = `UPDATE danmakuSession SET status = 'interrupted',
+	closeTime = COALESCE((SELECT MAX(sendTime) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live'), openTime),
+	danmakuCount = (SELECT COUNT(*) FROM danmaku WHERE liveID = danmakuSession.liveID AND source = 'live')
+WHERE status = 'open';`
+	// 根据已经保存的弹幕生成直播的弹幕统计。先按直播和分钟统计弹幕数，再合计到每场直播，peakMinute取弹幕数最多的一分钟
+	upsertChatStats = `INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN acfunlive l ON l.liveID = d.liveID WHERE d.sendTime >= l.startTime AND d.liveID = ?
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;`
+	// 为上次运行时没有结束的弹幕记录生成弹幕统计，和upsertChatStats的统计方法相同
+	upsertStaleChatStats = `INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN acfunlive l ON l.liveID = d.liveID
+	WHERE d.sendTime >= l.startTime AND d.liveID IN (SELECT liveID FROM danmakuSession WHERE status = 'open')
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;`
+	// 删除所有弹幕统计
+	deleteChatStats = `DELETE FROM chatStats;`
+	// 根据所有弹幕（包括归档的直播）生成弹幕统计，和upsertChatStats的统计方法相同
+	rebuildChatStats = `INSERT OR REPLACE INTO chatStats (liveID, messageCount, chatterCount, peakMinute, peakCount, histogram)
+SELECT liveID, SUM(n),
+	(SELECT COUNT(DISTINCT c.uid) FROM danmaku c WHERE c.liveID = m.liveID AND c.sendTime >= m.startTime),
+	minute, MAX(n), group_concat(minute || ':' || n, ',')
+FROM (SELECT d.liveID, l.startTime, (d.sendTime - l.startTime) / 60000 AS minute, COUNT(*) AS n
+	FROM danmaku d JOIN {acfunlive} l ON l.liveID = d.liveID WHERE d.sendTime >= l.startTime
+	GROUP BY d.liveID, minute ORDER BY d.liveID, minute) m
+GROUP BY liveID;`
+	// 保存一次礼物
+	insertGift = `INSERT INTO gift (liveID, sendTime, uid, nickname, giftID, giftName, count, acCoin) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	// 根据gift表重新合计直播每种礼物的数量和AC币，礼物只会增加，重新合计时直接覆盖
+	upsertGiftTotal = `INSERT INTO giftTotal (liveID, giftID, giftName, count, acCoin, senders)
+SELECT liveID, giftID, MAX(giftName), SUM(count), SUM(acCoin), COUNT(DISTINCT uid) FROM gift
+WHERE liveID = ?
+GROUP BY liveID, giftID
+ON CONFLICT (liveID, giftID) DO UPDATE SET
+	giftName = excluded.giftName, count = excluded.count, acCoin = excluded.acCoin, senders = excluded.senders;`
+	// 为上次运行时没有结束的弹幕记录合计礼物，和upsertGiftTotal的合计方法相同
+	upsertStaleGiftTotal = `INSERT INTO giftTotal (liveID, giftID, giftName, count, acCoin, senders)
+SELECT liveID, giftID, MAX(giftName), SUM(count), SUM(acCoin), COUNT(DISTINCT uid) FROM gift
+WHERE liveID IN (SELECT liveID FROM danmakuSession WHERE status = 'open')
+GROUP BY liveID, giftID
+ON CONFLICT (liveID, giftID) DO UPDATE SET
+	giftName = excluded.giftName, count = excluded.count, acCoin = excluded.acCoin, senders = excluded.senders;`
+	// 删除所有观众统计
+	deleteFans = `DELETE FROM fanStats;`
+	// 根据所有弹幕和礼物生成观众统计，按时间顺序合并，昵称为最后一次看到的昵称。冲突的处理和fans.go里的触发器相同
+	rebuildFans = `INSERT INTO fanStats (liverUID, uid, nickname, messageCount, giftCount, acCoin, firstSeen, lastSeen)
+SELECT liverUID, uid, nickname, messageCount, giftCount, acCoin, sendTime, sendTime FROM (
+	SELECT l.uid AS liverUID, d.uid AS uid, d.nickname AS nickname, 1 AS messageCount, 0 AS giftCount, 0 AS acCoin, d.sendTime AS sendTime
+	FROM danmaku d JOIN {acfunlive} l ON l.liveID = d.liveID
+	UNION ALL
+	SELECT l.uid, g.uid, g.nickname, 0, g.count, g.acCoin, g.sendTime
+	FROM gift g JOIN {acfunlive} l ON l.liveID = g.liveID
+)
+WHERE true
+ORDER BY sendTime
+ON CONFLICT (liverUID, uid) DO UPDATE SET
+	nickname = CASE WHEN excluded.lastSeen >= lastSeen THEN excluded.nickname ELSE nickname END,
+	messageCount = messageCount + excluded.messageCount,
+	giftCount = giftCount + excluded.giftCount,
+	acCoin = acCoin + excluded.acCoin,
+	firstSeen = MIN(firstSeen, excluded.firstSeen),
+	lastSeen = MAX(lastSeen, excluded.lastSeen);`
+	// 删除所有每月统计
+	deleteMonthlyStats = `DELETE FROM monthlyStats;`
+	// 根据所有直播数据（包括归档的直播）和人气排名生成每月统计
+	rebuildMonthlyStats = `INSERT INTO monthlyStats (uid, month, liveCount, totalDuration, maxViewers)
+SELECT l.uid, strftime('%Y-%m', l.startTime / 1000, 'unixepoch', 'localtime'), COUNT(*), SUM(l.duration), COALESCE(MAX(r.onlineCount), 0)
+FROM {acfunlive} l
+LEFT JOIN (SELECT liveID, MAX(onlineCount) AS onlineCount FROM ranking GROUP BY liveID) r ON r.liveID = l.liveID
+WHERE l.deletedAt = 0
+GROUP BY 1, 2;`
+	// 删除所有开播时间分布
+	deleteSchedule = `DELETE FROM liveSchedule;`
+	// 根据所有直播数据（包括归档的直播）生成开播时间分布
+	rebuildSchedule = `INSERT INTO liveSchedule (uid, weekday, hour, liveCount)
+SELECT uid,
+	CAST(strftime('%w', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER),
+	CAST(strftime('%H', startTime / 1000, 'unixepoch', 'localtime') AS INTEGER),
+	COUNT(*)
+FROM {acfunlive}
+WHERE deletedAt = 0
+GROUP BY 1, 2, 3;`
+	// 保存直播间的管理事件
+	insertModeration = `INSERT INTO moderationEvent (liveID, eventTime, kind, content) VALUES (?, ?, ?, ?);`
+	// 保存直播的一次采样
+	insertSample = `INSERT OR REPLACE INTO liveSample (liveID, sampleTime, watchingCount, likeCount, danmakuCount) VALUES (?, ?, ?, ?, ?);`
+	// 保存获取直播间列表时直播间的在线人数和点赞数
+	insertViewerSample = `INSERT OR REPLACE INTO viewerSample (liveID, sampleTime, onlineCount, likeCount) VALUES (?, ?, ?, ?);`
+	// 保存直播开始或结束时主播的守护团信息
+	insertFanClub = `INSERT OR REPLACE INTO fanClub (liveID, phase, sampleTime, clubName, memberCount) VALUES (?, ?, ?, ?, ?);`
+	// 保存直播开始时一个画质的直播源
+	insertStream = `INSERT OR REPLACE INTO streamQuality (liveID, qualityType, qualityName, bitrate, host, sampleTime) VALUES (?, ?, ?, ?, ?, ?);`
+	// 保存确认直播剪辑的结果，直播剪辑编号改变时重新开始确认，已经发现被删除的不会因为之后确认存在而恢复
+	upsertLiveCutStatus = `INSERT INTO liveCutStatus (liveID, liveCutNum, checkTime, removedAt) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (liveID) DO UPDATE SET
+	removedAt = CASE WHEN liveCutNum != excluded.liveCutNum OR removedAt = 0 THEN excluded.removedAt ELSE removedAt END,
+	downloadFile = CASE WHEN liveCutNum != excluded.liveCutNum THEN '' ELSE downloadFile END,
+	liveCutNum = excluded.liveCutNum,
+	checkTime = excluded.checkTime;`
+	// 记录在lookupTime（毫秒）获取过直播的直播剪辑编号
+	upsertLiveCutLookup = `INSERT INTO liveCutLookup (liveID, lookupTime) VALUES (?, ?)
+ON CONFLICT (liveID) DO UPDATE SET lookupTime = excluded.lookupTime;`
+	// 保存下载的直播剪辑文件
+	updateLiveCutDownload = `UPDATE liveCutStatus SET downloadFile = ? WHERE liveID = ? AND liveCutNum = ?;`
+	// 保存直播的一种数据在updateTime（毫秒）时占用的空间
+	upsertLiveStorage = `INSERT INTO liveStorage (liveID, kind, bytes, updateTime) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (liveID, kind) DO UPDATE SET bytes = excluded.bytes, updateTime = excluded.updateTime;`
+	// 删除直播的一种数据占用的空间
+	deleteLiveStorage = `DELETE FROM liveStorage WHERE liveID = ? AND kind = ?;`
+	// 保存等待发送到Kafka或NATS的事件
+	insertOutbox = `INSERT INTO eventOutbox (event, liveID, payload, createTime) VALUES (?, ?, ?, ?);`
+	// 保存等待发送的通知，第一次发送的时间为通知产生的时间
+	insertNotify = `INSERT INTO notifyOutbox (target, uid, liveID, payload, nextTime, createTime) VALUES (?, ?, ?, ?, ?, ?);`
+	// 保存批处理任务在updateTime（毫秒）时处理到的位置
+	upsertJobCursor = `INSERT INTO jobCursor (job, cursor, updateTime) VALUES (?1, ?2, ?3)
+ON CONFLICT (job) DO UPDATE SET cursor = excluded.cursor, updateTime = excluded.updateTime;`
+	// 删除批处理任务的进度
+	deleteJobCursor = `DELETE FROM jobCursor WHERE job = ?;`
+	// 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的头像，file不为空时保存下载的头像文件
+	upsertAvatar = `INSERT INTO streamerAvatar (uid, url, firstSeen, lastSeen, file) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (uid, url) DO UPDATE SET lastSeen = MAX(lastSeen, excluded.lastSeen),
+	file = CASE WHEN excluded.file != '' THEN excluded.file ELSE file END;`
+	// 保存在downloadTime（毫秒）下载的直播封面文件
+	insertCover = `INSERT OR REPLACE INTO liveCover (liveID, url, file, downloadTime) VALUES (?, ?, ?, ?);`
+	// 保存一次获取的主播的粉丝数和关注数
+	insertFollower = `INSERT OR REPLACE INTO followerSnapshot (uid, snapshotTime, fansCount, followingCount) VALUES (?, ?, ?, ?);`
+)
+
+// insertLiveWrite 插入直播数据，liveID已存在时修改的行数为0
+func insertLiveWrite(l *Live) Write {
+	return Write{query: insertLive, live: l}
+}
+
+// updateDuration 保存下播后获取到的直播时长
+func (q queries) updateDuration(ctx context.Context, duration int64, liveID LiveID) error {
+	_, err := q.db.ExecContext(ctx, updateDuration, duration, liveID)
+	return err
+}
+
+// selectLiveCutNum 查询直播剪辑编号
+func (q queries) selectLiveCutNum(ctx context.Context, liveID LiveID) (int, error) {
+	var r int
+	err := q.db.QueryRowContext(ctx, selectLiveCutNum, liveID).Scan(&r)
+	return r, err
+}
+
+// updateLiveCutNum 保存直播剪辑编号
+func (q queries) updateLiveCutNum(ctx context.Context, num int, liveID LiveID) error {
+	_, err := q.db.ExecContext(ctx, updateLiveCutNum, num, liveID)
+	return err
+}
+
+// insertLiveCut 记录在fetchTime（毫秒）获取到的直播剪辑编号，直播剪辑可能会重新生成
+func (q queries) insertLiveCut(ctx context.Context, liveID LiveID, num int, fetchTime int64) error {
+	_, err := q.db.ExecContext(ctx, insertLiveCut, liveID, num, fetchTime)
+	return err
+}
+
+// insertTitleWrite 记录在changeTime（毫秒）看到的直播间标题
+func insertTitleWrite(liveID LiveID, title string, changeTime int64) Write {
+	return Write{query: insertTitle, args: []interface{}{liveID, title, changeTime}}
+}
+
+// updateSuggested 保存没有标题的直播的建议标题
+func (q queries) updateSuggested(ctx context.Context, title string, liveID LiveID) error {
+	_, err := q.db.ExecContext(ctx, updateSuggested, title, liveID)
+	return err
+}
+
+// updateAccessWrite 更新直播间的访问限制
+func updateAccessWrite(access string, liveID LiveID) Write {
+	return Write{query: updateAccess, args: []interface{}{access, liveID}}
+}
+
+// updateRecordFile 保存直播的本地录播文件名
+func (q queries) updateRecordFile(ctx context.Context, file string, liveID LiveID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRecordFile, file, liveID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// updatePlayback 保存直播的录播链接，链接需要先加密
+func (q queries) updatePlayback(ctx context.Context, url string, backupURL string, liveID LiveID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updatePlayback, url, backupURL, liveID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// clearPlayback 清除直播的录播链接
+func (q queries) clearPlayback(ctx context.Context, liveID LiveID) error {
+	_, err := q.db.ExecContext(ctx, clearPlayback, liveID)
+	return err
+}
+
+// selectLive 查询指定liveID的直播，包括已删除的直播
+func (q queries) selectLive(ctx context.Context, liveID LiveID) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectLive), liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectUID 按开始时间从新到旧查询主播没有删除的直播
+func (q queries) selectUID(ctx context.Context, uid UID) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectUID), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectUIDLimit 按开始时间从新到旧查询主播最近limit场没有删除的直播
+func (q queries) selectUIDLimit(ctx context.Context, uid UID, limit int) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectUIDLimit), uid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectAll 按开始时间和liveID查询(startTime, liveID)之后的limit场没有删除的直播
+func (q queries) selectAll(ctx context.Context, startTime int64, sameStartTime int64, liveID LiveID, limit int) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectAll), startTime, sameStartTime, liveID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// insertActiveWrite 记录正在直播的liveID
+func insertActiveWrite(liveID LiveID) Write {
+	return Write{query: insertActive, args: []interface{}{liveID}}
+}
+
+// deleteActiveWrite 删除已经下播的liveID
+func deleteActiveWrite(liveID LiveID) Write {
+	return Write{query: deleteActive, args: []interface{}{liveID}}
+}
+
+// selectActive 查询记录为正在直播的直播
+func (q queries) selectActive(ctx context.Context) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectActive))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectUnfinished 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+func (q queries) selectUnfinished(ctx context.Context, since int64) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectUnfinished), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// upsertStreamerWrite 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的昵称
+func upsertStreamerWrite(uid UID, name string, firstSeen int64, lastSeen int64) Write {
+	return Write{query: upsertStreamer, args: []interface{}{uid, name, firstSeen, lastSeen}}
+}
+
+// softDeleteLive 在deletedAt（毫秒）软删除直播数据
+func (q queries) softDeleteLive(ctx context.Context, deletedAt int64, liveID LiveID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteLive, deletedAt, liveID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// restoreLive 恢复软删除的直播数据
+func (q queries) restoreLive(ctx context.Context, liveID LiveID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreLive, liveID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// purgeLive 彻底删除在before（毫秒）之前软删除的直播数据
+func (q queries) purgeLive(ctx context.Context, before int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeLive, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteOrphanActive 删除没有对应直播的正在直播的记录
+func (q queries) deleteOrphanActive(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteOrphanActive)
+	return err
+}
+
+// deleteOrphanLiveCut 删除没有对应直播的直播剪辑编号的历史记录
+func (q queries) deleteOrphanLiveCut(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteOrphanLiveCut)
+	return err
+}
+
+// deleteOrphanTitle 删除没有对应直播的标题的变更记录
+func (q queries) deleteOrphanTitle(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteOrphanTitle)
+	return err
+}
+
+// deleteOrphanDanmaku 删除没有对应直播的弹幕，弹幕的直播可能已经归档
+func (q queries) deleteOrphanDanmaku(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanDanmaku))
+	return err
+}
+
+// deleteOrphanDanmakuSession 删除没有对应直播的弹幕记录
+func (q queries) deleteOrphanDanmakuSession(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanDanmakuSession))
+	return err
+}
+
+// deleteOrphanChatStats 删除没有对应直播的弹幕统计
+func (q queries) deleteOrphanChatStats(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanChatStats))
+	return err
+}
+
+// deleteOrphanModeration 删除没有对应直播的管理事件
+func (q queries) deleteOrphanModeration(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanModeration))
+	return err
+}
+
+// deleteOrphanSample 删除没有对应直播的在线人数、点赞数和弹幕数的采样
+func (q queries) deleteOrphanSample(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanSample))
+	return err
+}
+
+// deleteOrphanViewerSample 删除没有对应直播的直播间列表里的在线人数采样
+func (q queries) deleteOrphanViewerSample(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanViewerSample))
+	return err
+}
+
+// deleteOrphanFanClub 删除没有对应直播的守护团信息
+func (q queries) deleteOrphanFanClub(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanFanClub))
+	return err
+}
+
+// deleteOrphanStream 删除没有对应直播的直播源
+func (q queries) deleteOrphanStream(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanStream))
+	return err
+}
+
+// deleteOrphanCover 删除没有对应直播的直播封面
+func (q queries) deleteOrphanCover(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanCover))
+	return err
+}
+
+// deleteOrphanGift 删除没有对应直播的礼物
+func (q queries) deleteOrphanGift(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanGift))
+	return err
+}
+
+// deleteOrphanGiftTotal 删除没有对应直播的礼物合计
+func (q queries) deleteOrphanGiftTotal(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanGiftTotal))
+	return err
+}
+
+// deleteOrphanLiveCutStatus 删除没有对应直播的直播剪辑的检查结果
+func (q queries) deleteOrphanLiveCutStatus(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanLiveCutStatus))
+	return err
+}
+
+// deleteOrphanLiveCutLookup 删除没有对应直播的获取直播剪辑编号的记录
+func (q queries) deleteOrphanLiveCutLookup(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanLiveCutLookup))
+	return err
+}
+
+// deleteOrphanLiveStorage 删除没有对应直播的占用空间统计
+func (q queries) deleteOrphanLiveStorage(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.federate(deleteOrphanLiveStorage))
+	return err
+}
+
+// selectDuplicateLiveIDs 查询在主数据库和归档数据库里都有数据的liveID，主数据库里liveID是主键，重复只会出现在数据库之间
+func (q queries) selectDuplicateLiveIDs(ctx context.Context) ([]LiveID, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectDuplicateLiveIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveID
+	for rows.Next() {
+		var r LiveID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectBadDurations 查询直播时长超过maxDuration（毫秒）或为负数、开始时间晚于now（毫秒）的直播
+func (q queries) selectBadDurations(ctx context.Context, maxDuration int64, now int64) ([]LiveID, error) {
+	rows, err := q.db.QueryContext(ctx, selectBadDurations, maxDuration, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveID
+	for rows.Next() {
+		var r LiveID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectMissingLiveCut 查询已结束但从来没有获取过直播剪辑编号的直播，很多直播本来就没有直播剪辑
+func (q queries) selectMissingLiveCut(ctx context.Context) ([]Live, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectMissingLiveCut))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Live
+	for rows.Next() {
+		var r Live
+		if err = q.scanLive(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectOrphanPlayback 查询录播链接不完整或者还没有结束的直播
+func (q queries) selectOrphanPlayback(ctx context.Context) ([]LiveID, error) {
+	rows, err := q.db.QueryContext(ctx, selectOrphanPlayback)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveID
+	for rows.Next() {
+		var r LiveID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectOrphanActive 查询activeLive表里没有对应直播的liveID
+func (q queries) selectOrphanActive(ctx context.Context) ([]LiveID, error) {
+	rows, err := q.db.QueryContext(ctx, selectOrphanActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveID
+	for rows.Next() {
+		var r LiveID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectOrphanLiveCut 查询liveCutHistory表里没有对应直播的liveID
+func (q queries) selectOrphanLiveCut(ctx context.Context) ([]LiveID, error) {
+	rows, err := q.db.QueryContext(ctx, selectOrphanLiveCut)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveID
+	for rows.Next() {
+		var r LiveID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectChangedLivesRow是selectChangedLives的一行结果
+type selectChangedLivesRow struct {
+	Live      Live
+	DeletedAt int64
+}
+
+// selectChangedLives 查询seq大于after、变更时间不早于since（毫秒）的最多limit场直播的数据和删除时间
+func (q queries) selectChangedLives(ctx context.Context, after int64, since int64, limit int) ([]selectChangedLivesRow, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectChangedLives), after, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []selectChangedLivesRow
+	for rows.Next() {
+		var r selectChangedLivesRow
+		if err = q.scanLive(rows, &r.Live, &r.DeletedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// upsertSyncSeqWrite 保存从source同步到的seq
+func upsertSyncSeqWrite(source string, seq int64) Write {
+	return Write{query: upsertSyncSeq, args: []interface{}{source, seq}}
+}
+
+// updateMirrorLiveWrite 更新从主实例同步的已有的直播，和insertMirrorLive使用相同的参数。不使用UPSERT，
+// 因为UPSERT会让统计触发器里的INSERT OR IGNORE在冲突时出错。已删除时保留本地的删除时间
+func updateMirrorLiveWrite(l *Live, suggestedTitle string, recordFile string, deletedAt int64) Write {
+	return Write{query: updateMirrorLive, args: []interface{}{suggestedTitle, recordFile, deletedAt}, live: l}
+}
+
+// insertMirrorLiveWrite 插入从主实例同步的新的直播，已经存在时由updateMirrorLive更新
+func insertMirrorLiveWrite(l *Live, suggestedTitle string, recordFile string, deletedAt int64) Write {
+	return Write{query: insertMirrorLive, args: []interface{}{suggestedTitle, recordFile, deletedAt}, live: l}
+}
+
+// softDeleteMirrorLiveWrite 在deletedAt（毫秒）软删除在主实例已经被彻底删除的直播
+func softDeleteMirrorLiveWrite(deletedAt int64, liveID LiveID) Write {
+	return Write{query: softDeleteMirrorLive, args: []interface{}{deletedAt, liveID}}
+}
+
+// selectLiveID 查询直播是否存在
+func (q queries) selectLiveID(ctx context.Context, liveID LiveID) (bool, error) {
+	var r bool
+	err := q.db.QueryRowContext(ctx, q.federate(selectLiveID), liveID).Scan(&r)
+	return r, err
+}
+
+// selectTitles 按时间顺序查询直播间标题的变更记录
+func (q queries) selectTitles(ctx context.Context, liveID LiveID) ([]TitleChange, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectTitles), liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []TitleChange
+	for rows.Next() {
+		var r TitleChange
+		if err = rows.Scan(&r.Title, &r.ChangeTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectStreamerNames 查询主播用过的昵称
+func (q queries) selectStreamerNames(ctx context.Context, uid UID) ([]StreamerName, error) {
+	rows, err := q.db.QueryContext(ctx, selectStreamerNames, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StreamerName
+	for rows.Next() {
+		var r StreamerName
+		if err = rows.Scan(&r.UID, &r.Name, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// searchStreamerNames 查询用过匹配pattern的昵称的主播，pattern为转义后的LIKE模式
+func (q queries) searchStreamerNames(ctx context.Context, pattern string) ([]StreamerName, error) {
+	rows, err := q.db.QueryContext(ctx, searchStreamerNames, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StreamerName
+	for rows.Next() {
+		var r StreamerName
+		if err = rows.Scan(&r.UID, &r.Name, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectLatestStreamerNames 查询所有主播最近使用的昵称
+func (q queries) selectLatestStreamerNames(ctx context.Context) ([]StreamerName, error) {
+	rows, err := q.db.QueryContext(ctx, selectLatestStreamerNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StreamerName
+	for rows.Next() {
+		var r StreamerName
+		if err = rows.Scan(&r.UID, &r.Name, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectChanges 按seq从小到大查询直播数据的变更
+func (q queries) selectChanges(ctx context.Context, after int64, since int64, limit int) ([]LiveChange, error) {
+	rows, err := q.db.QueryContext(ctx, selectChanges, after, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveChange
+	for rows.Next() {
+		var r LiveChange
+		if err = rows.Scan(&r.Seq, &r.LiveID, &r.ChangeTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectLastChange 查询最后一次变更的seq，没有变更时为0
+func (q queries) selectLastChange(ctx context.Context) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, selectLastChange).Scan(&r)
+	return r, err
+}
+
+// selectSyncSeq 查询从source同步到的seq
+func (q queries) selectSyncSeq(ctx context.Context, source string) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, selectSyncSeq, source).Scan(&r)
+	return r, err
+}
+
+// selectDanmakuPeaks 把直播的弹幕按bucket（毫秒）分段统计数量，返回弹幕最多的n段
+func (q queries) selectDanmakuPeaks(ctx context.Context, bucket int64, liveID LiveID, n int) ([]DanmakuPeak, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectDanmakuPeaks), bucket, liveID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []DanmakuPeak
+	for rows.Next() {
+		var r DanmakuPeak
+		if err = rows.Scan(&r.Offset, &r.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectTimedDanmaku 按发送时间查询直播的弹幕和弹幕在直播里的时间
+func (q queries) selectTimedDanmaku(ctx context.Context, liveID LiveID) ([]TimedDanmaku, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectTimedDanmaku), liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []TimedDanmaku
+	for rows.Next() {
+		var r TimedDanmaku
+		if err = rows.Scan(&r.Offset, &r.UID, &r.Nickname, &r.Content); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectFanCount 查询观众统计的行数
+func (q queries) selectFanCount(ctx context.Context) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, selectFanCount).Scan(&r)
+	return r, err
+}
+
+// selectFans 按弹幕数量从多到少查询主播直播间里的前n个观众
+func (q queries) selectFans(ctx context.Context, uid UID, n int) ([]Fan, error) {
+	rows, err := q.db.QueryContext(ctx, selectFans, uid, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Fan
+	for rows.Next() {
+		var r Fan
+		if err = rows.Scan(&r.UID, &r.Nickname, &r.MessageCount, &r.GiftCount, &r.ACCoin, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectGiftTotals 按花费的AC币从多到少查询直播每种礼物的合计
+func (q queries) selectGiftTotals(ctx context.Context, liveID LiveID) ([]GiftTotal, error) {
+	rows, err := q.db.QueryContext(ctx, selectGiftTotals, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []GiftTotal
+	for rows.Next() {
+		var r GiftTotal
+		if err = rows.Scan(&r.GiftID, &r.GiftName, &r.Count, &r.ACCoin, &r.Senders); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectIncome 按开始时间从旧到新查询主播每场直播收到的礼物的合计
+func (q queries) selectIncome(ctx context.Context, uid UID) ([]Income, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectIncome), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Income
+	for rows.Next() {
+		var r Income
+		if err = rows.Scan(&r.LiveID, &r.StartTime, &r.Title, &r.ACCoin, &r.PaidCount, &r.Bananas); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectRemovedLiveCuts 查询已经被删除的直播剪辑，最近发现的在前面
+func (q queries) selectRemovedLiveCuts(ctx context.Context) ([]LiveCutStatus, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectRemovedLiveCuts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveCutStatus
+	for rows.Next() {
+		var r LiveCutStatus
+		if err = rows.Scan(&r.LiveID, &r.UID, &r.LiveCutNum, &r.CheckTime, &r.RemovedAt, &r.DownloadFile); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectModeration 按时间从旧到新查询直播间的管理事件
+func (q queries) selectModeration(ctx context.Context, liveID LiveID) ([]ModerationEvent, error) {
+	rows, err := q.db.QueryContext(ctx, selectModeration, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ModerationEvent
+	for rows.Next() {
+		var r ModerationEvent
+		if err = rows.Scan(&r.LiveID, &r.Time, &r.Kind, &r.Content); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectRankings 按时间从旧到新查询直播进入排名的记录
+func (q queries) selectRankings(ctx context.Context, liveID LiveID) ([]Ranking, error) {
+	rows, err := q.db.QueryContext(ctx, selectRankings, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Ranking
+	for rows.Next() {
+		var r Ranking
+		if err = rows.Scan(&r.Time, &r.Rank, &r.LiveID, &r.UID, &r.OnlineCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectSamples 按时间从旧到新查询直播每分钟的采样
+func (q queries) selectSamples(ctx context.Context, liveID LiveID) ([]Sample, error) {
+	rows, err := q.db.QueryContext(ctx, selectSamples, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Sample
+	for rows.Next() {
+		var r Sample
+		if err = rows.Scan(&r.LiveID, &r.Time, &r.WatchingCount, &r.LikeCount, &r.DanmakuCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectFanClub 按时间从旧到新查询直播开始和结束时主播的守护团信息
+func (q queries) selectFanClub(ctx context.Context, liveID LiveID) ([]FanClub, error) {
+	rows, err := q.db.QueryContext(ctx, selectFanClub, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []FanClub
+	for rows.Next() {
+		var r FanClub
+		if err = rows.Scan(&r.LiveID, &r.Phase, &r.Time, &r.ClubName, &r.MemberCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectLiveStreams 按开始时间从旧到新查询主播每场直播的直播源，同一场直播按码率从低到高排列
+func (q queries) selectLiveStreams(ctx context.Context, uid UID) ([]LiveStream, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectLiveStreams), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveStream
+	for rows.Next() {
+		var r LiveStream
+		if err = rows.Scan(&r.LiveID, &r.StartTime, &r.QualityName, &r.Bitrate, &r.Host); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectViewerSamples 按时间从旧到新查询直播每次获取直播间列表时的在线人数和点赞数
+func (q queries) selectViewerSamples(ctx context.Context, liveID LiveID) ([]ViewerSample, error) {
+	rows, err := q.db.QueryContext(ctx, selectViewerSamples, liveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ViewerSample
+	for rows.Next() {
+		var r ViewerSample
+		if err = rows.Scan(&r.LiveID, &r.Time, &r.OnlineCount, &r.LikeCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectMonthlyStats 查询主播每个月的直播统计
+func (q queries) selectMonthlyStats(ctx context.Context, uid UID) ([]MonthlyStats, error) {
+	rows, err := q.db.QueryContext(ctx, selectMonthlyStats, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []MonthlyStats
+	for rows.Next() {
+		var r MonthlyStats
+		if err = rows.Scan(&r.UID, &r.Month, &r.LiveCount, &r.TotalDuration, &r.MaxViewers); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectSchedule 查询主播的开播时间分布，按开播次数从多到少排列
+func (q queries) selectSchedule(ctx context.Context, uid UID) ([]ScheduleSlot, error) {
+	rows, err := q.db.QueryContext(ctx, selectSchedule, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ScheduleSlot
+	for rows.Next() {
+		var r ScheduleSlot
+		if err = rows.Scan(&r.Weekday, &r.Hour, &r.LiveCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectTopStreamers 查询一个月里直播总时长最长的n个主播
+func (q queries) selectTopStreamers(ctx context.Context, month string, n int) ([]TopStreamer, error) {
+	rows, err := q.db.QueryContext(ctx, selectTopStreamers, month, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []TopStreamer
+	for rows.Next() {
+		var r TopStreamer
+		if err = rows.Scan(&r.UID, &r.Month, &r.LiveCount, &r.TotalDuration, &r.MaxViewers, &r.Name); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectDanmakuBytes 估算直播的弹幕占用的字节数，三个整数列按每个8字节计算
+func (q queries) selectDanmakuBytes(ctx context.Context, liveID LiveID) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, selectDanmakuBytes, liveID).Scan(&r)
+	return r, err
+}
+
+// selectStorageSources 按开始时间从新到旧查询主播没有删除的直播保存在本地的文件
+func (q queries) selectStorageSources(ctx context.Context, uid UID) ([]StorageSource, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectStorageSources), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StorageSource
+	for rows.Next() {
+		var r StorageSource
+		if err = rows.Scan(&r.LiveID, &r.RecordFile, &r.LiveCutFile); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectLiveStorage 按开始时间从新到旧查询主播每场直播占用的空间
+func (q queries) selectLiveStorage(ctx context.Context, uid UID) ([]LiveStorage, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectLiveStorage), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveStorage
+	for rows.Next() {
+		var r LiveStorage
+		if err = rows.Scan(&r.LiveID, &r.StartTime, &r.Kind, &r.Bytes); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectStreamerStorage 查询每个主播的每种数据占用的空间
+func (q queries) selectStreamerStorage(ctx context.Context) ([]StreamerStorage, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectStreamerStorage))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StreamerStorage
+	for rows.Next() {
+		var r StreamerStorage
+		if err = rows.Scan(&r.UID, &r.Kind, &r.Bytes); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectArchiveYears 查询需要归档的直播的开播年份（本地时间），正在直播和已删除的直播不归档
+func (q queries) selectArchiveYears(ctx context.Context, before int64) ([]int, error) {
+	rows, err := q.db.QueryContext(ctx, selectArchiveYears, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []int
+	for rows.Next() {
+		var r int
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectOutbox 按顺序查询最早的limit个等待发送的事件
+func (q queries) selectOutbox(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := q.db.QueryContext(ctx, selectOutbox, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []OutboxEvent
+	for rows.Next() {
+		var r OutboxEvent
+		if err = rows.Scan(&r.ID, &r.Event, &r.LiveID, &r.Payload, &r.CreateTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// deleteOutbox 删除序号不大于id的事件
+func (q queries) deleteOutbox(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOutbox, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// selectDueNotifications 按顺序查询下次发送时间不晚于now的最早的limit个通知
+func (q queries) selectDueNotifications(ctx context.Context, now int64, limit int) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, selectDueNotifications, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Notification
+	for rows.Next() {
+		var r Notification
+		if err = rows.Scan(&r.ID, &r.Target, &r.UID, &r.LiveID, &r.Payload, &r.Attempts, &r.NextTime, &r.LastError, &r.CreateTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectNotifications 按顺序查询所有等待发送的通知
+func (q queries) selectNotifications(ctx context.Context) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, selectNotifications)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Notification
+	for rows.Next() {
+		var r Notification
+		if err = rows.Scan(&r.ID, &r.Target, &r.UID, &r.LiveID, &r.Payload, &r.Attempts, &r.NextTime, &r.LastError, &r.CreateTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// deleteNotification 删除通知
+func (q queries) deleteNotification(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteNotification, id)
+	return err
+}
+
+// delayNotification 记录通知发送失败，增加失败次数
+func (q queries) delayNotification(ctx context.Context, nextTime int64, lastError string, id int64) error {
+	_, err := q.db.ExecContext(ctx, delayNotification, nextTime, lastError, id)
+	return err
+}
+
+// selectCryptSalt 查询生成密钥的盐
+func (q queries) selectCryptSalt(ctx context.Context) (string, error) {
+	var r string
+	err := q.db.QueryRowContext(ctx, selectCryptSalt).Scan(&r)
+	return r, err
+}
+
+// insertCryptSalt 保存生成密钥的盐
+func (q queries) insertCryptSalt(ctx context.Context, salt string) error {
+	_, err := q.db.ExecContext(ctx, insertCryptSalt, salt)
+	return err
+}
+
+// selectJobCursor 查询批处理任务处理到的位置
+func (q queries) selectJobCursor(ctx context.Context, job string) (string, error) {
+	var r string
+	err := q.db.QueryRowContext(ctx, selectJobCursor, job).Scan(&r)
+	return r, err
+}
+
+// countDanmaku 查询直播来源为source的弹幕数量
+func (q queries) countDanmaku(ctx context.Context, liveID LiveID, source string) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, countDanmaku, liveID, source).Scan(&r)
+	return r, err
+}
+
+// selectDanmakuSession 查询直播的弹幕记录
+func (q queries) selectDanmakuSession(ctx context.Context, liveID LiveID) (DanmakuSession, error) {
+	var r DanmakuSession
+	err := q.db.QueryRowContext(ctx, selectDanmakuSession, liveID).Scan(&r.LiveID, &r.UID, &r.StartTime, &r.OpenTime, &r.CloseTime, &r.Status, &r.DanmakuCount)
+	return r, err
+}
+
+// selectChatStats 查询直播的弹幕统计
+func (q queries) selectChatStats(ctx context.Context, liveID LiveID) (ChatStats, error) {
+	var r ChatStats
+	err := q.db.QueryRowContext(ctx, q.federate(selectChatStats), liveID).Scan(&r.LiveID, &r.StartTime, &r.MessageCount, &r.ChatterCount, &r.PeakMinute, &r.PeakCount, &r.Histogram)
+	return r, err
+}
+
+// insertTenant 添加用户，返回用户ID
+func (q queries) insertTenant(ctx context.Context, name string, createTime int64) (int64, error) {
+	var r int64
+	err := q.db.QueryRowContext(ctx, insertTenant, name, createTime).Scan(&r)
+	return r, err
+}
+
+// deleteTenant 删除用户
+func (q queries) deleteTenant(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTenant, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteTenantKeys 删除用户的API key
+func (q queries) deleteTenantKeys(ctx context.Context, tenantID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTenantKeys, tenantID)
+	return err
+}
+
+// deleteTenantWatches 删除用户关注的主播
+func (q queries) deleteTenantWatches(ctx context.Context, tenantID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTenantWatches, tenantID)
+	return err
+}
+
+// selectTenants 按用户ID查询所有用户
+func (q queries) selectTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := q.db.QueryContext(ctx, selectTenants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Tenant
+	for rows.Next() {
+		var r Tenant
+		if err = rows.Scan(&r.ID, &r.Name, &r.HookURL, &r.HookFormat, &r.CreateTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectTenantByName 按用户名查询用户
+func (q queries) selectTenantByName(ctx context.Context, name string) (Tenant, error) {
+	var r Tenant
+	err := q.db.QueryRowContext(ctx, selectTenantByName, name).Scan(&r.ID, &r.Name, &r.HookURL, &r.HookFormat, &r.CreateTime)
+	return r, err
+}
+
+// selectTenantByKey 查询API key的SHA-256为keyHash的用户
+func (q queries) selectTenantByKey(ctx context.Context, keyHash string) (Tenant, error) {
+	var r Tenant
+	err := q.db.QueryRowContext(ctx, selectTenantByKey, keyHash).Scan(&r.ID, &r.Name, &r.HookURL, &r.HookFormat, &r.CreateTime)
+	return r, err
+}
+
+// insertTenantKey 添加用户的API key
+func (q queries) insertTenantKey(ctx context.Context, keyHash string, tenantID int64, createTime int64) error {
+	_, err := q.db.ExecContext(ctx, insertTenantKey, keyHash, tenantID, createTime)
+	return err
+}
+
+// revokeTenantKeys 删除用户所有的API key
+func (q queries) revokeTenantKeys(ctx context.Context, tenantID int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeTenantKeys, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// updateTenantHook 修改用户的webhook
+func (q queries) updateTenantHook(ctx context.Context, hookURL string, hookFormat string, id int64) error {
+	_, err := q.db.ExecContext(ctx, updateTenantHook, hookURL, hookFormat, id)
+	return err
+}
+
+// selectTenantWatch 按uid查询用户关注的主播
+func (q queries) selectTenantWatch(ctx context.Context, tenantID int64) ([]UID, error) {
+	rows, err := q.db.QueryContext(ctx, selectTenantWatch, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []UID
+	for rows.Next() {
+		var r UID
+		if err = rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// insertTenantWatch 让用户关注主播，已经关注时不修改
+func (q queries) insertTenantWatch(ctx context.Context, tenantID int64, uid UID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertTenantWatch, tenantID, uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteTenantWatch 让用户取消关注主播
+func (q queries) deleteTenantWatch(ctx context.Context, tenantID int64, uid UID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTenantWatch, tenantID, uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// selectWatchingTenants 查询关注了主播的用户
+func (q queries) selectWatchingTenants(ctx context.Context, uid UID) ([]Tenant, error) {
+	rows, err := q.db.QueryContext(ctx, selectWatchingTenants, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Tenant
+	for rows.Next() {
+		var r Tenant
+		if err = rows.Scan(&r.ID, &r.Name, &r.HookURL, &r.HookFormat, &r.CreateTime); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectAvatars 按第一次看到的时间查询主播用过的头像
+func (q queries) selectAvatars(ctx context.Context, uid UID) ([]Avatar, error) {
+	rows, err := q.db.QueryContext(ctx, selectAvatars, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Avatar
+	for rows.Next() {
+		var r Avatar
+		if err = rows.Scan(&r.UID, &r.URL, &r.FirstSeen, &r.LastSeen, &r.File); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectCovers 按开始时间从旧到新查询主播下载过的直播封面
+func (q queries) selectCovers(ctx context.Context, uid UID) ([]LiveCover, error) {
+	rows, err := q.db.QueryContext(ctx, q.federate(selectCovers), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LiveCover
+	for rows.Next() {
+		var r LiveCover
+		if err = rows.Scan(&r.LiveID, &r.StartTime, &r.URL, &r.File, &r.Time); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// selectFollowers 按时间从旧到新查询主播的粉丝数和关注数
+func (q queries) selectFollowers(ctx context.Context, uid UID) ([]Follower, error) {
+	rows, err := q.db.QueryContext(ctx, selectFollowers, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Follower
+	for rows.Next() {
+		var r Follower
+		if err = rows.Scan(&r.UID, &r.Time, &r.FansCount, &r.FollowingCount); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// insertRankingWrite 保存时间为t（毫秒）的直播间人气排名
+func insertRankingWrite(t int64, rank int, liveID LiveID, uid UID, onlineCount int) Write {
+	return Write{query: insertRanking, args: []interface{}{t, rank, liveID, uid, onlineCount}}
+}
+
+// insertDanmakuWrite 保存一条弹幕
+func insertDanmakuWrite(liveID LiveID, sendTime int64, uid int64, nickname string, content string, source string, medalUID int64, medalName string, medalLevel int) Write {
+	return Write{query: insertDanmaku, args: []interface{}{liveID, sendTime, uid, nickname, content, source, medalUID, medalName, medalLevel}}
+}
+
+// openDanmakuSessionWrite 开始记录直播的弹幕，同一场直播重新连接弹幕时继续使用原来的记录
+func openDanmakuSessionWrite(liveID LiveID, uid UID, startTime int64, openTime int64) Write {
+	return Write{query: openDanmakuSession, args: []interface{}{liveID, uid, startTime, openTime}}
+}
+
+// closeDanmakuSessionWrite 在closeTime（毫秒）结束记录直播的弹幕，并保存记录到的弹幕数量
+func closeDanmakuSessionWrite(closeTime int64, status string, liveID LiveID) Write {
+	return Write{query: closeDanmakuSession, args: []interface{}{closeTime, status, liveID}}
+}
+
+// closeStaleDanmakuSessions 把上次运行时没有结束的弹幕记录标记为中断，结束时间为最后一条弹幕的时间
+func (q queries) closeStaleDanmakuSessions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, closeStaleDanmakuSessions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// upsertChatStatsWrite 根据已经保存的弹幕生成直播的弹幕统计。先按直播和分钟统计弹幕数，再合计到每场直播，peakMinute取弹幕数最多的一分钟
+func upsertChatStatsWrite(liveID LiveID) Write {
+	return Write{query: upsertChatStats, args: []interface{}{liveID}}
+}
+
+// upsertStaleChatStats 为上次运行时没有结束的弹幕记录生成弹幕统计，和upsertChatStats的统计方法相同
+func (q queries) upsertStaleChatStats(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, upsertStaleChatStats)
+	return err
+}
+
+// deleteChatStats 删除所有弹幕统计
+func (q queries) deleteChatStats(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteChatStats)
+	return err
+}
+
+// rebuildChatStats 根据所有弹幕（包括归档的直播）生成弹幕统计，和upsertChatStats的统计方法相同
+func (q queries) rebuildChatStats(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, q.federate(rebuildChatStats))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertGiftWrite 保存一次礼物
+func insertGiftWrite(liveID LiveID, sendTime int64, uid int64, nickname string, giftID int64, giftName string, count int, acCoin int64) Write {
+	return Write{query: insertGift, args: []interface{}{liveID, sendTime, uid, nickname, giftID, giftName, count, acCoin}}
+}
+
+// upsertGiftTotalWrite 根据gift表重新合计直播每种礼物的数量和AC币，礼物只会增加，重新合计时直接覆盖
+func upsertGiftTotalWrite(liveID LiveID) Write {
+	return Write{query: upsertGiftTotal, args: []interface{}{liveID}}
+}
+
+// upsertStaleGiftTotal 为上次运行时没有结束的弹幕记录合计礼物，和upsertGiftTotal的合计方法相同
+func (q queries) upsertStaleGiftTotal(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, upsertStaleGiftTotal)
+	return err
+}
+
+// deleteFans 删除所有观众统计
+func (q queries) deleteFans(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteFans)
+	return err
+}
+
+// rebuildFans 根据所有弹幕和礼物生成观众统计，按时间顺序合并，昵称为最后一次看到的昵称。冲突的处理和fans.go里的触发器相同
+func (q queries) rebuildFans(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, q.federate(rebuildFans))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteMonthlyStats 删除所有每月统计
+func (q queries) deleteMonthlyStats(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteMonthlyStats)
+	return err
+}
+
+// rebuildMonthlyStats 根据所有直播数据（包括归档的直播）和人气排名生成每月统计
+func (q queries) rebuildMonthlyStats(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, q.federate(rebuildMonthlyStats))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteSchedule 删除所有开播时间分布
+func (q queries) deleteSchedule(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteSchedule)
+	return err
+}
+
+// rebuildSchedule 根据所有直播数据（包括归档的直播）生成开播时间分布
+func (q queries) rebuildSchedule(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, q.federate(rebuildSchedule))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertModerationWrite 保存直播间的管理事件
+func insertModerationWrite(liveID LiveID, eventTime int64, kind string, content string) Write {
+	return Write{query: insertModeration, args: []interface{}{liveID, eventTime, kind, content}}
+}
+
+// insertSampleWrite 保存直播的一次采样
+func insertSampleWrite(liveID LiveID, sampleTime int64, watchingCount int, likeCount int, danmakuCount int) Write {
+	return Write{query: insertSample, args: []interface{}{liveID, sampleTime, watchingCount, likeCount, danmakuCount}}
+}
+
+// insertViewerSampleWrite 保存获取直播间列表时直播间的在线人数和点赞数
+func insertViewerSampleWrite(liveID LiveID, sampleTime int64, onlineCount int, likeCount int) Write {
+	return Write{query: insertViewerSample, args: []interface{}{liveID, sampleTime, onlineCount, likeCount}}
+}
+
+// insertFanClubWrite 保存直播开始或结束时主播的守护团信息
+func insertFanClubWrite(liveID LiveID, phase string, sampleTime int64, clubName string, memberCount int) Write {
+	return Write{query: insertFanClub, args: []interface{}{liveID, phase, sampleTime, clubName, memberCount}}
+}
+
+// insertStreamWrite 保存直播开始时一个画质的直播源
+func insertStreamWrite(liveID LiveID, qualityType string, qualityName string, bitrate int, host string, sampleTime int64) Write {
+	return Write{query: insertStream, args: []interface{}{liveID, qualityType, qualityName, bitrate, host, sampleTime}}
+}
+
+// upsertLiveCutStatusWrite 保存确认直播剪辑的结果，直播剪辑编号改变时重新开始确认，已经发现被删除的不会因为之后确认存在而恢复
+func upsertLiveCutStatusWrite(liveID LiveID, num int, checkTime int64, removedAt int64) Write {
+	return Write{query: upsertLiveCutStatus, args: []interface{}{liveID, num, checkTime, removedAt}}
+}
+
+// upsertLiveCutLookupWrite 记录在lookupTime（毫秒）获取过直播的直播剪辑编号
+func upsertLiveCutLookupWrite(liveID LiveID, lookupTime int64) Write {
+	return Write{query: upsertLiveCutLookup, args: []interface{}{liveID, lookupTime}}
+}
+
+// updateLiveCutDownloadWrite 保存下载的直播剪辑文件
+func updateLiveCutDownloadWrite(file string, liveID LiveID, num int) Write {
+	return Write{query: updateLiveCutDownload, args: []interface{}{file, liveID, num}}
+}
+
+// upsertLiveStorageWrite 保存直播的一种数据在updateTime（毫秒）时占用的空间
+func upsertLiveStorageWrite(liveID LiveID, kind string, bytes int64, updateTime int64) Write {
+	return Write{query: upsertLiveStorage, args: []interface{}{liveID, kind, bytes, updateTime}}
+}
+
+// deleteLiveStorageWrite 删除直播的一种数据占用的空间
+func deleteLiveStorageWrite(liveID LiveID, kind string) Write {
+	return Write{query: deleteLiveStorage, args: []interface{}{liveID, kind}}
+}
+
+// insertOutboxWrite 保存等待发送到Kafka或NATS的事件
+func insertOutboxWrite(event string, liveID LiveID, payload string, createTime int64) Write {
+	return Write{query: insertOutbox, args: []interface{}{event, liveID, payload, createTime}}
+}
+
+// insertNotifyWrite 保存等待发送的通知，第一次发送的时间为通知产生的时间
+func insertNotifyWrite(target string, uid UID, liveID LiveID, payload string, nextTime int64, createTime int64) Write {
+	return Write{query: insertNotify, args: []interface{}{target, uid, liveID, payload, nextTime, createTime}}
+}
+
+// upsertJobCursorWrite 保存批处理任务在updateTime（毫秒）时处理到的位置
+func upsertJobCursorWrite(job string, cursor string, updateTime int64) Write {
+	return Write{query: upsertJobCursor, args: []interface{}{job, cursor, updateTime}}
+}
+
+// deleteJobCursorWrite 删除批处理任务的进度
+func deleteJobCursorWrite(job string) Write {
+	return Write{query: deleteJobCursor, args: []interface{}{job}}
+}
+
+// upsertAvatarWrite 记录在firstSeen到lastSeen（毫秒）之间看到主播使用的头像，file不为空时保存下载的头像文件
+func upsertAvatarWrite(uid UID, url string, firstSeen int64, lastSeen int64, file string) Write {
+	return Write{query: upsertAvatar, args: []interface{}{uid, url, firstSeen, lastSeen, file}}
+}
+
+// insertCoverWrite 保存在downloadTime（毫秒）下载的直播封面文件
+func insertCoverWrite(liveID LiveID, url string, file string, downloadTime int64) Write {
+	return Write{query: insertCover, args: []interface{}{liveID, url, file, downloadTime}}
+}
+
+// insertFollowerWrite 保存一次获取的主播的粉丝数和关注数
+func insertFollowerWrite(uid UID, snapshotTime int64, fansCount int, followingCount int) Write {
+	return Write{query: insertFollower, args: []interface{}{uid, snapshotTime, fansCount, followingCount}}
+}
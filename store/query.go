@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 在写入的连接上执行只读查询时的限制，查询期间不能写入数据库。只读打开的数据库不限制
+const (
+	readQueryTimeout = 10 * time.Second // 查询的最长时间，超过时中断查询
+	readQueryMaxRows = 10000            // 最多返回的行数
+)
+
+// 只读查询可以使用的第一个关键词
+var readOnlyKeywords = []string{"SELECT", "WITH", "VALUES", "EXPLAIN"}
+
+// QueryResult 是只读查询的结果
+type QueryResult struct {
+	Columns   []string        // 列名
+	Rows      [][]interface{} // 每行的值，NULL为nil，BLOB转换为string
+	Truncated bool            // 结果超过最多返回的行数，后面的行没有返回
+}
+
+// 检查query是否为单条只读语句，返回去掉结尾分号的语句
+func checkReadOnly(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	end := statementEnd(query)
+	if strings.TrimSpace(query[end:]) != "" {
+		return "", errors.New("只能执行一条语句")
+	}
+	query = strings.TrimSpace(query[:end])
+	if query == "" {
+		return "", errors.New("查询语句为空")
+	}
+	// 开头的注释里的关键词不算
+	first := strings.FieldsFunc(skipLeadingComments(query), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(first) == 0 {
+		return "", errors.New("无法识别查询语句")
+	}
+	for _, kw := range readOnlyKeywords {
+		if strings.EqualFold(first[0], kw) {
+			return query, nil
+		}
+	}
+	return "", errors.New("只能执行SELECT、WITH、VALUES或EXPLAIN开头的只读查询")
+}
+
+// 去掉开头的空白和注释
+func skipLeadingComments(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			n := strings.Index(query, "\n")
+			if n < 0 {
+				return ""
+			}
+			query = query[n+1:]
+		case strings.HasPrefix(query, "/*"):
+			n := strings.Index(query[2:], "*/")
+			if n < 0 {
+				return ""
+			}
+			query = query[n+4:]
+		default:
+			return query
+		}
+	}
+}
+
+// 返回第一条语句结尾的分号之后的位置，跳过字符串、引号里的名字和注释，没有分号时返回len(query)
+func statementEnd(query string) int {
+	for i := 0; i < len(query); i++ {
+		var closing string
+		switch {
+		case query[i] == ';':
+			return i + 1
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			closing = query[i : i+1]
+		case query[i] == '[':
+			closing = "]"
+		case strings.HasPrefix(query[i:], "--"):
+			closing = "\n"
+		case strings.HasPrefix(query[i:], "/*"):
+			closing = "*/"
+			i++
+		default:
+			continue
+		}
+		// 引号里连续两个引号是转义，跳过后会从下一个引号重新开始匹配
+		n := strings.Index(query[i+1:], closing)
+		if n < 0 {
+			return len(query)
+		}
+		i += n + len(closing)
+	}
+	return len(query)
+}
+
+// ReadQuery 执行只读的SQL查询，{acfunlive}和{titleHistory}会被替换为包括归档数据库的合并查询。
+// 数据库不是只读打开时查询会阻塞写入，限制查询的时间和返回的行数
+func (s *SQLite) ReadQuery(ctx context.Context, query string) (*QueryResult, error) {
+	query, err := checkReadOnly(query)
+	if err != nil {
+		return nil, err
+	}
+	maxRows := 0
+	if !s.readOnly {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, readQueryTimeout)
+		defer cancel()
+		maxRows = readQueryMaxRows
+	}
+	result, err := s.readQuery(ctx, query, maxRows)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("查询超过 %v，已中断：%w", readQueryTimeout, err)
+	}
+	return result, err
+}
+
+// 执行只读查询，maxRows大于0时最多返回这么多行
+func (s *SQLite) readQuery(ctx context.Context, query string, maxRows int) (*QueryResult, error) {
+	// 只有一个数据库连接，query_only在查询期间拒绝所有写入
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.ExecContext(ctx, `PRAGMA query_only = ON;`); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = s.db.ExecContext(context.Background(), `PRAGMA query_only = OFF;`)
+	}()
+
+	rows, err := s.db.QueryContext(ctx, s.federate(query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Columns: columns}
+	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+		row := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
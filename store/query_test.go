@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	for _, tt := range []struct {
+		query, want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"  select * from acfunlive;  ", "select * from acfunlive;"},
+		{"WITH a AS (SELECT 1) SELECT * FROM a", "WITH a AS (SELECT 1) SELECT * FROM a"},
+		{"VALUES (1)", "VALUES (1)"},
+		{"EXPLAIN SELECT 1", "EXPLAIN SELECT 1"},
+		{"SELECT ';' /* ; */", "SELECT ';' /* ; */"},
+		{"SELECT 'a;b' -- 注释;\n", "SELECT 'a;b' -- 注释;"},
+		{"/* 注释 */ -- 注释\nSELECT 1", "/* 注释 */ -- 注释\nSELECT 1"},
+	} {
+		got, err := checkReadOnly(tt.query)
+		if err != nil || got != tt.want {
+			t.Errorf("checkReadOnly(%q) = %q, %v，应该为 %q", tt.query, got, err, tt.want)
+		}
+	}
+	for _, query := range []string{
+		"",
+		";",
+		"DELETE FROM acfunlive",
+		"PRAGMA query_only = OFF",
+		"ATTACH DATABASE 'a.db' AS a",
+		"SELECT 1; DELETE FROM acfunlive",
+		"SELECT 1;;",
+		"/* SELECT */ DELETE FROM acfunlive",
+		"-- SELECT\nDELETE FROM acfunlive",
+		"/* SELECT",
+	} {
+		if _, err := checkReadOnly(query); err == nil {
+			t.Errorf("checkReadOnly(%q) 应该返回错误", query)
+		}
+	}
+}
+
+func TestReadQuery(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, ":memory:", Options{})
+	if _, err := s.InsertLive(ctx, testLive("a", 1, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.ReadQuery(ctx, "SELECT liveID, uid FROM {acfunlive}")
+	if err != nil || len(result.Rows) != 1 || result.Rows[0][0] != "a" || result.Truncated {
+		t.Errorf("查询结果为 %+v，%v", result, err)
+	}
+
+	// WITH开头的写入语句由query_only拒绝，之后仍然可以写入
+	for _, query := range []string{
+		"WITH x AS (SELECT 1) DELETE FROM acfunlive",
+		"WITH x AS (SELECT 'b') INSERT INTO acfunlive (liveID) SELECT * FROM x",
+	} {
+		if _, err = s.ReadQuery(ctx, query); err == nil {
+			t.Errorf("%s 应该返回错误", query)
+		}
+	}
+	if ok, err := s.Exists(ctx, "a"); err != nil || !ok {
+		t.Errorf("只读查询删除了数据：%v", err)
+	}
+	if _, err = s.InsertLive(ctx, testLive("b", 1, 2000)); err != nil {
+		t.Errorf("只读查询后不能写入：%v", err)
+	}
+
+	// 超过最多返回的行数时只返回前面的行
+	result, err = s.ReadQuery(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT x FROM c")
+	if err != nil || len(result.Rows) != readQueryMaxRows || !result.Truncated {
+		t.Errorf("无限的查询返回 %d 行，是否截断为 %v：%v", len(result.Rows), result != nil && result.Truncated, err)
+	}
+
+	// 超时的查询被中断，不会一直阻塞写入
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err = s.ReadQuery(timeout, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c"); err == nil {
+		t.Error("超时的查询没有返回错误")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("超时的查询 %v 后才返回", d)
+	}
+	if _, err = s.InsertLive(ctx, testLive("c", 1, 3000)); err != nil {
+		t.Errorf("查询超时后不能写入：%v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 全站直播间按在线人数的排名快照，time为获取直播间列表的时间，单位为毫秒
+	createRankingTable = `CREATE TABLE IF NOT EXISTS ranking (
+		time INTEGER NOT NULL,
+		rank INTEGER NOT NULL,
+		liveID TEXT NOT NULL,
+		uid INTEGER NOT NULL,
+		onlineCount INTEGER NOT NULL,
+		PRIMARY KEY (time, rank)
+	);
+	`
+	createRankingIndex = `CREATE INDEX IF NOT EXISTS rankingLiveIDIndex ON ranking (liveID, time);`
+)
+
+// RankEntry 是排名里的一个直播间
+type RankEntry struct {
+	Rank        int    // 排名，从1开始
+	LiveID      LiveID // 直播ID
+	UID         UID    // 主播uid
+	OnlineCount int    // 在线人数
+}
+
+// Ranking 是直播间在某个时间的排名
+type Ranking struct {
+	Time int64 // 排名的时间，单位为毫秒
+	RankEntry
+}
+
+// InsertRanking 在一个事务里保存时间为t（毫秒）的排名快照
+func (s *SQLite) InsertRanking(ctx context.Context, t int64, list []RankEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertRanking)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range list {
+		if _, err = stmt.ExecContext(ctx, t, e.Rank, e.LiveID, e.UID, e.OnlineCount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QueryRankings 按时间从旧到新查询直播进入排名的记录
+func (s *SQLite) QueryRankings(ctx context.Context, liveID LiveID) ([]Ranking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectRankings(ctx, liveID)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 直播每分钟的在线人数、点赞数和弹幕数的采样。归档直播时采样不会移到归档数据库
+	createSampleTable = `CREATE TABLE IF NOT EXISTS liveSample (
+		liveID TEXT NOT NULL,
+		sampleTime INTEGER NOT NULL,
+		watchingCount INTEGER NOT NULL,
+		likeCount INTEGER NOT NULL,
+		danmakuCount INTEGER NOT NULL,
+		PRIMARY KEY (liveID, sampleTime)
+	);
+	`
+	// 每次获取直播间列表时直播间的在线人数和点赞数。归档直播时采样不会移到归档数据库
+	createViewerSampleTable = `CREATE TABLE IF NOT EXISTS viewerSample (
+		liveID TEXT NOT NULL,
+		sampleTime INTEGER NOT NULL,
+		onlineCount INTEGER NOT NULL,
+		likeCount INTEGER NOT NULL,
+		PRIMARY KEY (liveID, sampleTime)
+	);
+	`
+)
+
+// Sample 是直播某一分钟的采样
+type Sample struct {
+	LiveID        LiveID // 直播ID
+	Time          int64  // 采样时间，单位为毫秒
+	WatchingCount int    // 在线人数
+	LikeCount     int    // 累计点赞数
+	DanmakuCount  int    // 上一次采样后的弹幕数量
+}
+
+// ViewerSample 是获取直播间列表时直播间的在线人数和点赞数
+type ViewerSample struct {
+	LiveID      LiveID // 直播ID
+	Time        int64  // 获取直播间列表的时间，单位为毫秒
+	OnlineCount int    // 在线人数
+	LikeCount   int    // 累计点赞数
+}
+
+// SampleWrite 保存直播的一次采样
+func SampleWrite(s *Sample) Write {
+	return insertSampleWrite(s.LiveID, s.Time, s.WatchingCount, s.LikeCount, s.DanmakuCount)
+}
+
+// QuerySamples 按时间从旧到新查询直播每分钟的采样
+func (s *SQLite) QuerySamples(ctx context.Context, liveID LiveID) ([]Sample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectSamples(ctx, liveID)
+}
+
+// ViewerSampleWrites 保存一次获取直播间列表时的在线人数和点赞数
+func ViewerSampleWrites(list []ViewerSample) []Write {
+	writes := make([]Write, len(list))
+	for i, v := range list {
+		writes[i] = insertViewerSampleWrite(v.LiveID, v.Time, v.OnlineCount, v.LikeCount)
+	}
+	return writes
+}
+
+// QueryViewerSamples 按时间从旧到新查询直播每次获取直播间列表时的在线人数和点赞数
+func (s *SQLite) QueryViewerSamples(ctx context.Context, liveID LiveID) ([]ViewerSample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectViewerSamples(ctx, liveID)
+}
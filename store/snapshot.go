@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// Snapshot 把数据库的一致快照写入path，year不为0时写入该年份的归档数据库，path不能已经存在
+func (s *SQLite) Snapshot(ctx context.Context, year int, path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schema := "main"
+	if year != 0 {
+		schema = ""
+		for _, a := range s.archives {
+			if a.year == year {
+				schema = a.schema
+			}
+		}
+		if schema == "" {
+			return fmt.Errorf("没有 %d 年的归档数据库：%w", year, ErrNotFound)
+		}
+	}
+	// modernc.org/sqlite没有提供backup API，VACUUM INTO在一个读事务里复制数据，同样能得到一致的快照
+	_, err := s.db.ExecContext(ctx, `VACUUM `+schema+` INTO ?;`, path)
+	return err
+}
@@ -0,0 +1,792 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const forEachBatch = 1000 // ForEachLive每次查询的直播数量
+
+// acfunlive表查询时使用的列
+const liveColumns = `liveID, uid, name, streamName, startTime, title, duration, playbackURL, backupURL, liveCutNum, suggestedTitle, access, recordFile`
+
+const (
+	createTable = `CREATE TABLE IF NOT EXISTS acfunlive (
+		liveID TEXT PRIMARY KEY,
+		uid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		streamName TEXT NOT NULL UNIQUE,
+		startTime INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		duration INTEGER NOT NULL,
+		playbackURL TEXT NOT NULL,
+		backupURL TEXT NOT NULL,
+		liveCutNum INTEGER NOT NULL DEFAULT 0,
+		suggestedTitle TEXT NOT NULL DEFAULT '',
+		access TEXT NOT NULL DEFAULT '',
+		recordFile TEXT NOT NULL DEFAULT '',
+		deletedAt INTEGER NOT NULL DEFAULT 0
+	);
+	`
+	createUIDIndex       = `CREATE INDEX IF NOT EXISTS uidIndex ON acfunlive (uid);`
+	createStartTimeIndex = `CREATE INDEX IF NOT EXISTS startTimeIndex ON acfunlive (startTime);`
+	createDurationIndex  = `CREATE INDEX IF NOT EXISTS durationIndex ON acfunlive (duration);`
+	// 正在直播的liveID，重启后用来恢复上次运行时的直播间列表
+	createActiveTable = `CREATE TABLE IF NOT EXISTS activeLive (
+		liveID TEXT PRIMARY KEY
+	);
+	`
+	// 直播剪辑编号的历史记录，直播剪辑可能会重新生成
+	createLiveCutTable = `CREATE TABLE IF NOT EXISTS liveCutHistory (
+		liveID TEXT NOT NULL,
+		liveCutNum INTEGER NOT NULL,
+		fetchTime INTEGER NOT NULL,
+		UNIQUE (liveID, liveCutNum)
+	);
+	`
+	// 直播间标题的变更记录，第一条为开播时的标题
+	createTitleTable = `CREATE TABLE IF NOT EXISTS titleHistory (
+		liveID TEXT NOT NULL,
+		title TEXT NOT NULL,
+		changeTime INTEGER NOT NULL
+	);
+	`
+	createTitleIndex = `CREATE INDEX IF NOT EXISTS titleLiveIDIndex ON titleHistory (liveID);`
+	// 主播用过的昵称，firstSeen和lastSeen为第一次和最后一次看到该昵称的时间
+	createStreamerTable = `CREATE TABLE IF NOT EXISTS streamerName (
+		uid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		firstSeen INTEGER NOT NULL,
+		lastSeen INTEGER NOT NULL,
+		PRIMARY KEY (uid, name)
+	);
+	`
+	createStreamerNameIndex = `CREATE INDEX IF NOT EXISTS streamerNameIndex ON streamerName (name);`
+	selectStreamerTable     = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'streamerName');`
+	// 从已有的直播数据生成昵称记录
+	backfillStreamer = `INSERT OR IGNORE INTO streamerName (uid, name, firstSeen, lastSeen)
+		SELECT uid, name, MIN(startTime), MAX(startTime + duration) FROM acfunlive GROUP BY uid, name;
+	`
+)
+
+// SQLite 是使用sqlite数据库的Store
+type SQLite struct {
+	mu sync.RWMutex // sqlite同一时间只能有一个写入
+	db *sql.DB
+
+	dir      string     // 数据库文件所在的文件夹
+	base     string     // 数据库文件名去掉扩展名的部分，归档数据库的文件名为base-年份.db
+	archives []archive  // 已经附加的归档数据库，按年份排序
+	cipher   *urlCipher // 加密录播链接和等待发送的通知、事件，为nil时不加密
+	readOnly bool       // 只读打开，不创建或更新表
+
+	computed      []ComputedColumn // 查询直播数据时计算的列
+	selectColumns string           // 查询直播数据时使用的列，{liveColumns}会被替换为这些列
+}
+
+// Options 是打开数据库时的选项
+type Options struct {
+	EncryptionKey string           // 加密录播链接和等待发送的通知、事件的密钥，为空时不加密，设置后旧的明文录播链接会被加密
+	Computed      []ComputedColumn // 查询直播数据时计算的列
+	ReadOnly      bool             // 只读打开数据库，不创建或更新表和触发器，数据库文件需要已经存在
+}
+
+var _ Store = (*SQLite)(nil)
+
+// OpenSQLite 打开sqlite数据库，创建或更新表并准备语句
+func OpenSQLite(ctx context.Context, path string, opts Options) (s *SQLite, e error) {
+	dsn := path
+	if opts.ReadOnly {
+		dsn = readOnlyDSN(path)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s = &SQLite{
+		db:       db,
+		dir:      filepath.Dir(path),
+		base:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		readOnly: opts.ReadOnly,
+
+		selectColumns: liveColumns,
+	}
+	// 返回错误时s已经被设为nil
+	opened := s
+	defer func() {
+		if e != nil {
+			_ = opened.Close()
+		}
+	}()
+	// sqlite同一时间只能有一个写入，归档数据库附加在这个连接上，所以连接需要一直保留
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	if err = db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	if opts.ReadOnly {
+		if err = s.setCipher(ctx, opts.EncryptionKey); err != nil {
+			return nil, err
+		}
+		if err = s.attachArchives(ctx); err != nil {
+			return nil, fmt.Errorf("附加归档数据库失败：%w", err)
+		}
+		if err = s.setComputed(ctx, opts.Computed); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if err = s.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("创建数据库的表失败：%w", err)
+	}
+	if err = s.setCipher(ctx, opts.EncryptionKey); err != nil {
+		return nil, err
+	}
+	if err = s.attachArchives(ctx); err != nil {
+		return nil, fmt.Errorf("附加归档数据库失败：%w", err)
+	}
+	if err = s.setupStatsTriggers(ctx); err != nil {
+		return nil, fmt.Errorf("创建统计的触发器失败：%w", err)
+	}
+	if err = s.setupFanTriggers(ctx); err != nil {
+		return nil, fmt.Errorf("创建观众统计的触发器失败：%w", err)
+	}
+	if err = s.setupChangeTriggers(ctx); err != nil {
+		return nil, fmt.Errorf("创建变更记录的触发器失败：%w", err)
+	}
+	if err = s.setComputed(ctx, opts.Computed); err != nil {
+		return nil, err
+	}
+	schemas := []string{"main"}
+	for _, a := range s.archives {
+		schemas = append(schemas, a.schema)
+	}
+	for _, schema := range schemas {
+		if _, err = s.encryptPlainURLs(ctx, schema); err != nil {
+			return nil, fmt.Errorf("加密录播链接失败：%w", err)
+		}
+	}
+	return s, nil
+}
+
+// 用数据库里的盐生成加密的密钥，只读打开时不生成盐
+func (s *SQLite) setCipher(ctx context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+	salt, err := s.cryptSalt(ctx, !s.readOnly)
+	if err != nil {
+		return fmt.Errorf("读取生成密钥的盐失败：%w", err)
+	}
+	s.cipher, err = newURLCipher(key, salt)
+	return err
+}
+
+// 只读打开数据库文件的URI，文件不存在时打开失败
+func readOnlyDSN(path string) string {
+	return "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path) + "?mode=ro"
+}
+
+// 创建表，旧版本的数据库添加缺少的列
+func (s *SQLite) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, createTable); err != nil {
+		return err
+	}
+	if err := s.addLiveColumns(ctx, "main"); err != nil {
+		return err
+	}
+
+	var hasStreamer bool
+	if err := s.db.QueryRowContext(ctx, selectStreamerTable).Scan(&hasStreamer); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		createUIDIndex,
+		createStartTimeIndex,
+		createDurationIndex,
+		createActiveTable,
+		createLiveCutTable,
+		createTitleTable,
+		createTitleIndex,
+		createStreamerTable,
+		createStreamerNameIndex,
+		createMonthlyStatsTable,
+		createScheduleTable,
+		createDanmakuTable,
+		createDanmakuIndex,
+		createDanmakuFTS,
+		createDanmakuInsertTrigger,
+		createDanmakuDeleteTrigger,
+		createDanmakuSessionTable,
+		createChatStatsTable,
+		createRankingTable,
+		createRankingIndex,
+		createModerationTable,
+		createModerationIndex,
+		createSampleTable,
+		createViewerSampleTable,
+		createFanClubTable,
+		createStreamTable,
+		createChangeTable,
+		createChangeTimeIndex,
+		createGiftTable,
+		createGiftIndex,
+		createGiftTotalTable,
+		createFanTable,
+		createFanIndex,
+		createSyncTable,
+		createLiveCutStatusTable,
+		createLiveCutLookupTable,
+		createLiveStorageTable,
+		createOutboxTable,
+		createJobCursorTable,
+		createTenantTable,
+		createTenantKeyTable,
+		createTenantWatchTable,
+		createAvatarTable,
+		createCoverTable,
+		createFollowerTable,
+		createNotifyTable,
+		createNotifyIndex,
+		createCryptSaltTable,
+	} {
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	// 旧版本的弹幕表没有来源
+	if err := s.addColumn(ctx, "main", "danmaku", "source", "TEXT NOT NULL DEFAULT 'live'"); err != nil {
+		return err
+	}
+	// 旧版本的弹幕表没有守护徽章
+	for _, c := range [][2]string{
+		{"medalUID", "INTEGER NOT NULL DEFAULT 0"},
+		{"medalName", "TEXT NOT NULL DEFAULT ''"},
+		{"medalLevel", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := s.addColumn(ctx, "main", "danmaku", c[0], c[1]); err != nil {
+			return err
+		}
+	}
+	if !hasStreamer {
+		// 第一次创建昵称表时从已有的直播数据生成昵称记录
+		if _, err := s.db.ExecContext(ctx, backfillStreamer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 旧版本的acfunlive表没有以下的列
+func (s *SQLite) addLiveColumns(ctx context.Context, schema string) error {
+	for _, c := range [][2]string{
+		{"suggestedTitle", "TEXT NOT NULL DEFAULT ''"},
+		{"deletedAt", "INTEGER NOT NULL DEFAULT 0"},
+		{"access", "TEXT NOT NULL DEFAULT ''"},
+		{"recordFile", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := s.addColumn(ctx, schema, "acfunlive", c[0], c[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 表里没有指定的列时添加该列
+func (s *SQLite) addColumn(ctx context.Context, schema, table, column, definition string) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, ?);`, table, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s %s;", schema, table, column, definition))
+	return err
+}
+
+// Ping 检查数据库连接是否可用
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close 关闭数据库
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// InsertLive 插入直播数据，liveID已存在时返回false，liveID或uid无效时返回错误
+func (s *SQLite) InsertLive(ctx context.Context, l *Live) (bool, error) {
+	n, err := s.execWrite(ctx, insertLiveWrite(l))
+	return n != 0, err
+}
+
+// ImportLives 在一个事务里插入多场直播，liveID已存在的直播会被跳过
+func (s *SQLite) ImportLives(ctx context.Context, lives []Live) (imported, skipped int, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	for i := range lives {
+		w := insertLiveWrite(&lives[i])
+		args, err := s.writeArgs(w)
+		if err != nil {
+			return 0, 0, fmt.Errorf("导入liveID为 %s 的直播数据出现错误：%w", lives[i].LiveID, err)
+		}
+		result, err := tx.ExecContext(ctx, w.query, args...)
+		if err != nil {
+			return 0, 0, fmt.Errorf("导入liveID为 %s 的直播数据出现错误：%w", lives[i].LiveID, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			skipped++
+		} else {
+			imported++
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return imported, skipped, nil
+}
+
+// FinalizeLive 保存下播后获取到的直播时长
+func (s *SQLite) FinalizeLive(ctx context.Context, liveID LiveID, duration int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().updateDuration(ctx, duration, liveID)
+}
+
+// UpdateLiveCut 记录直播剪辑编号，只有之前没有编号时才会更新直播数据，返回之前的编号
+func (s *SQLite) UpdateLiveCut(ctx context.Context, liveID LiveID, num int) (oldNum int, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	q := s.qtx(tx)
+	if oldNum, err = q.selectLiveCutNum(ctx, liveID); err != nil {
+		return 0, err
+	}
+	if oldNum == num {
+		return oldNum, nil
+	}
+	if oldNum == 0 {
+		if err = q.updateLiveCutNum(ctx, num, liveID); err != nil {
+			return 0, err
+		}
+	}
+	if err = q.insertLiveCut(ctx, liveID, num, time.Now().UnixMilli()); err != nil {
+		return 0, err
+	}
+	return oldNum, tx.Commit()
+}
+
+// UpdateSuggestedTitle 保存没有标题的直播的建议标题
+func (s *SQLite) UpdateSuggestedTitle(ctx context.Context, liveID LiveID, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().updateSuggested(ctx, title, liveID)
+}
+
+// UpdateAccess 更新直播间的访问限制
+func (s *SQLite) UpdateAccess(ctx context.Context, liveID LiveID, access string) error {
+	_, err := s.execWrite(ctx, updateAccessWrite(access, liveID))
+	return err
+}
+
+// UpdateRecordFile 保存直播的本地录播文件名，返回是否有直播被更新
+func (s *SQLite) UpdateRecordFile(ctx context.Context, liveID LiveID, file string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.q().updateRecordFile(ctx, file, liveID)
+	return n != 0, err
+}
+
+// UpdatePlayback 保存直播的录播链接，返回是否有直播被更新
+func (s *SQLite) UpdatePlayback(ctx context.Context, liveID LiveID, url, backupURL string) (bool, error) {
+	l, err := s.encryptLive(&Live{PlaybackURL: url, BackupURL: backupURL})
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.q().updatePlayback(ctx, l.PlaybackURL, l.BackupURL, liveID)
+	return n != 0, err
+}
+
+// 扫描一行直播数据并解密录播链接，列的顺序和liveColumns一致，之后是计算列，最后是extra
+func (s *SQLite) scanLive(rows *sql.Rows, l *Live, extra ...interface{}) error {
+	computed := s.computedDest()
+	dest := append([]interface{}{&l.LiveID, &l.UID, &l.Name, &l.StreamName, &l.StartTime, &l.Title,
+		&l.Duration, &l.PlaybackURL, &l.BackupURL, &l.LiveCutNum, &l.SuggestedTitle, &l.Access, &l.RecordFile,
+	}, computed...)
+	dest = append(dest, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	s.setComputedValues(l, computed)
+	return s.decryptLive(l)
+}
+
+// QueryLive 查询指定liveID的直播，包括已删除的直播，不存在时返回ErrNotFound
+func (s *SQLite) QueryLive(ctx context.Context, liveID LiveID) (*Live, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	lives, err := s.q().selectLive(ctx, liveID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lives) == 0 {
+		return nil, ErrNotFound
+	}
+	return &lives[0], nil
+}
+
+// QueryByUID 按开始时间从新到旧查询指定主播的直播，limit小于等于0时查询所有直播
+func (s *SQLite) QueryByUID(ctx context.Context, uid UID, limit int) ([]Live, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if limit > 0 {
+		return s.q().selectUIDLimit(ctx, uid, limit)
+	}
+	return s.q().selectUID(ctx, uid)
+}
+
+// QueryLives 查询符合条件的没有删除的直播，默认按开始时间从新到旧排列。
+// 条件和排序是动态的，不能写成queries.sql里的固定查询
+func (s *SQLite) QueryLives(ctx context.Context, q LiveQuery) ([]Live, error) {
+	sortColumn := SortStartTime
+	switch q.Sort {
+	case "", SortStartTime:
+	case SortDuration:
+		sortColumn = SortDuration
+	default:
+		return nil, fmt.Errorf("不支持按 %s 排序", q.Sort)
+	}
+	order := "DESC"
+	if q.Ascending {
+		order = "ASC"
+	}
+
+	var b strings.Builder
+	b.WriteString(`SELECT {liveColumns} FROM {acfunlive} WHERE deletedAt = 0`)
+	var args []interface{}
+	if q.LiveID != "" {
+		b.WriteString(` AND liveID = ?`)
+		args = append(args, q.LiveID)
+	}
+	if q.UID != 0 {
+		b.WriteString(` AND uid = ?`)
+		args = append(args, q.UID)
+	}
+	if q.From != 0 {
+		b.WriteString(` AND startTime >= ?`)
+		args = append(args, q.From)
+	}
+	if q.To != 0 {
+		b.WriteString(` AND startTime < ?`)
+		args = append(args, q.To)
+	}
+	if q.Finished {
+		b.WriteString(` AND duration > 0`)
+	}
+	if q.Title != "" {
+		b.WriteString(` AND title LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(q.Title)+"%")
+	}
+	// 加上liveID保证排序稳定，分页时不会重复或遗漏
+	fmt.Fprintf(&b, ` ORDER BY %s %s, liveID %s`, sortColumn, order, order)
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		b.WriteString(` LIMIT ? OFFSET ?`)
+		args = append(args, limit, q.Offset)
+	}
+	b.WriteString(`;`)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rows, err := s.db.QueryContext(ctx, s.federate(b.String()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lives []Live
+	for rows.Next() {
+		var l Live
+		if err = s.scanLive(rows, &l); err != nil {
+			return nil, err
+		}
+		lives = append(lives, l)
+	}
+	return lives, rows.Err()
+}
+
+// QueryUnfinished 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+func (s *SQLite) QueryUnfinished(ctx context.Context, since int64) ([]Live, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectUnfinished(ctx, since)
+}
+
+// ForEachLive 按开始时间从旧到新遍历所有没有删除的直播，f返回错误时停止遍历。
+// 每次查询forEachBatch场直播，查询之间不持有锁，遍历大量直播时不会长时间阻塞写入
+func (s *SQLite) ForEachLive(ctx context.Context, f func(*Live) error) error {
+	var startTime int64 = math.MinInt64
+	var liveID LiveID
+	for {
+		s.mu.RLock()
+		lives, err := s.q().selectAll(ctx, startTime, startTime, liveID, forEachBatch)
+		s.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		for i := range lives {
+			if err = f(&lives[i]); err != nil {
+				return err
+			}
+		}
+		if len(lives) < forEachBatch {
+			return nil
+		}
+		last := lives[len(lives)-1]
+		startTime, liveID = last.StartTime, last.LiveID
+	}
+}
+
+// Exists 查询是否存在指定liveID的直播
+func (s *SQLite) Exists(ctx context.Context, liveID LiveID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectLiveID(ctx, liveID)
+}
+
+// InsertActive 记录正在直播的liveID
+func (s *SQLite) InsertActive(ctx context.Context, liveID LiveID) error {
+	_, err := s.execWrite(ctx, insertActiveWrite(liveID))
+	return err
+}
+
+// DeleteActive 删除已经下播的liveID
+func (s *SQLite) DeleteActive(ctx context.Context, liveID LiveID) error {
+	_, err := s.execWrite(ctx, deleteActiveWrite(liveID))
+	return err
+}
+
+// QueryActive 查询记录为正在直播的直播
+func (s *SQLite) QueryActive(ctx context.Context) ([]Live, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectActive(ctx)
+}
+
+// InsertTitle 记录直播间标题
+func (s *SQLite) InsertTitle(ctx context.Context, liveID LiveID, title string) error {
+	_, err := s.execWrite(ctx, insertTitleWrite(liveID, title, time.Now().UnixMilli()))
+	return err
+}
+
+// QueryTitles 查询直播间标题的变更记录
+func (s *SQLite) QueryTitles(ctx context.Context, liveID LiveID) ([]TitleChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectTitles(ctx, liveID)
+}
+
+// SeeStreamerName 记录看到主播使用的昵称
+func (s *SQLite) SeeStreamerName(ctx context.Context, uid UID, name string) error {
+	now := time.Now().UnixMilli()
+	_, err := s.execWrite(ctx, upsertStreamerWrite(uid, name, now, now))
+	return err
+}
+
+// QueryStreamerNames 查询主播用过的昵称
+func (s *SQLite) QueryStreamerNames(ctx context.Context, uid UID) ([]StreamerName, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectStreamerNames(ctx, uid)
+}
+
+// SearchStreamers 查询用过含有关键词的昵称的主播
+func (s *SQLite) SearchStreamers(ctx context.Context, keyword string) ([]StreamerName, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().searchStreamerNames(ctx, "%"+likeEscaper.Replace(keyword)+"%")
+}
+
+// QueryLatestStreamers 查询所有主播最近使用的昵称
+func (s *SQLite) QueryLatestStreamers(ctx context.Context) ([]StreamerName, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectLatestStreamerNames(ctx)
+}
+
+// 转义LIKE的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SoftDelete 软删除直播数据，返回是否有数据被删除
+func (s *SQLite) SoftDelete(ctx context.Context, liveID LiveID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.q().softDeleteLive(ctx, time.Now().UnixMilli(), liveID)
+	return n != 0, err
+}
+
+// Restore 恢复软删除的直播数据，返回是否有数据被恢复
+func (s *SQLite) Restore(ctx context.Context, liveID LiveID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.q().restoreLive(ctx, liveID)
+	return n != 0, err
+}
+
+// PurgeDeleted 彻底删除在before（毫秒）之前软删除的直播数据和相关的记录，返回删除的直播数量
+func (s *SQLite) PurgeDeleted(ctx context.Context, before int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.q().purgeLive(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	if err = s.deleteOrphans(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeleteOrphans 删除没有对应直播的记录
+func (s *SQLite) DeleteOrphans(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteOrphans(ctx)
+}
+
+func (s *SQLite) deleteOrphans(ctx context.Context) error {
+	q := s.q()
+	for _, del := range []func(context.Context) error{
+		q.deleteOrphanActive,
+		q.deleteOrphanLiveCut,
+		q.deleteOrphanTitle,
+		q.deleteOrphanDanmaku,
+		q.deleteOrphanDanmakuSession,
+		q.deleteOrphanChatStats,
+		q.deleteOrphanModeration,
+		q.deleteOrphanSample,
+		q.deleteOrphanViewerSample,
+		q.deleteOrphanFanClub,
+		q.deleteOrphanStream,
+		q.deleteOrphanCover,
+		q.deleteOrphanGift,
+		q.deleteOrphanGiftTotal,
+		q.deleteOrphanLiveCutStatus,
+		q.deleteOrphanLiveCutLookup,
+		q.deleteOrphanLiveStorage,
+	} {
+		if err := del(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 查询第一列为字符串的结果
+func (s *SQLite) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for rows.Next() {
+		dest := make([]interface{}, len(cols))
+		var str string
+		dest[0] = &str
+		for i := 1; i < len(dest); i++ {
+			dest[i] = new(interface{})
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		list = append(list, str)
+	}
+	return list, rows.Err()
+}
+
+// 检查数据库文件的完整性，PRAGMA的结果列不固定，不放在queries.sql里
+const integrityCheck = `PRAGMA integrity_check;`
+
+// Check 检查数据的完整性和一致性，maxDuration为直播时长的上限（毫秒）
+func (s *SQLite) Check(ctx context.Context, maxDuration int64) (*CheckResult, error) {
+	r := new(CheckResult)
+	integrity, err := s.queryStrings(ctx, integrityCheck)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range integrity {
+		if result != "ok" {
+			r.Integrity = append(r.Integrity, result)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q := s.q()
+	if r.DuplicateLiveIDs, err = q.selectDuplicateLiveIDs(ctx); err != nil {
+		return nil, err
+	}
+	if r.BadDurations, err = q.selectBadDurations(ctx, maxDuration, time.Now().UnixMilli()); err != nil {
+		return nil, err
+	}
+	if r.OrphanPlayback, err = q.selectOrphanPlayback(ctx); err != nil {
+		return nil, err
+	}
+	if r.OrphanActive, err = q.selectOrphanActive(ctx); err != nil {
+		return nil, err
+	}
+	if r.OrphanLiveCut, err = q.selectOrphanLiveCut(ctx); err != nil {
+		return nil, err
+	}
+	if r.MissingLiveCut, err = q.selectMissingLiveCut(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ClearPlayback 清除直播的录播链接
+func (s *SQLite) ClearPlayback(ctx context.Context, liveID LiveID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().clearPlayback(ctx, liveID)
+}
@@ -0,0 +1,461 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 打开测试用的数据库，测试结束时关闭
+func openTestSQLite(t *testing.T, path string, opts Options) *SQLite {
+	t.Helper()
+	s, err := OpenSQLite(context.Background(), path, opts)
+	if err != nil {
+		t.Fatalf("打开数据库 %s 失败：%v", path, err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// 测试用的直播数据
+func testLive(liveID LiveID, uid UID, startTime int64) *Live {
+	return &Live{
+		LiveID:     liveID,
+		UID:        uid,
+		Name:       "主播" + uid.String(),
+		StreamName: "stream-" + liveID.String(),
+		StartTime:  startTime,
+		Title:      "标题",
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "old.db")
+	// 旧版本的acfunlive表没有suggestedTitle、deletedAt、access和recordFile
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`CREATE TABLE acfunlive (
+		liveID TEXT PRIMARY KEY,
+		uid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		streamName TEXT NOT NULL UNIQUE,
+		startTime INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		duration INTEGER NOT NULL,
+		playbackURL TEXT NOT NULL,
+		backupURL TEXT NOT NULL,
+		liveCutNum INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT INTO acfunlive VALUES ('old1', 10, '旧主播', 'old-stream', 1000, '旧标题', 60000, '', '', 0);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = old.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestSQLite(t, path, Options{})
+	l, err := s.QueryLive(ctx, "old1")
+	if err != nil {
+		t.Fatalf("查询旧版本的直播数据失败：%v", err)
+	}
+	if l.UID != 10 || l.Title != "旧标题" || l.Duration != 60000 || l.Access != "" || l.RecordFile != "" {
+		t.Errorf("旧版本的直播数据不正确：%+v", l)
+	}
+	if err = s.UpdateAccess(ctx, "old1", "paid"); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = s.QueryLive(ctx, "old1"); err != nil || l.Access != "paid" {
+		t.Errorf("添加的access列不能使用：%+v %v", l, err)
+	}
+	// 已有的旧直播在第一次创建触发器时生成变更记录
+	changes, err := s.QueryChanges(ctx, ChangeQuery{Limit: 10})
+	if err != nil || len(changes) != 1 || changes[0].LiveID != "old1" {
+		t.Errorf("旧直播的变更记录不正确：%+v %v", changes, err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再次打开时不会重复添加列或生成变更记录
+	s = openTestSQLite(t, path, Options{})
+	if l, err = s.QueryLive(ctx, "old1"); err != nil || l.Access != "paid" {
+		t.Errorf("重新打开后的直播数据不正确：%+v %v", l, err)
+	}
+	if seq, err := s.LastChangeSeq(ctx); err != nil || seq != changes[0].Seq {
+		t.Errorf("重新打开后最后一次变更的seq为 %d，应该为 %d：%v", seq, changes[0].Seq, err)
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, ":memory:", Options{})
+
+	l := testLive("live1", 1, 1000)
+	affected, err := s.WriteBatch(ctx, []Write{
+		InsertLiveWrite(l),
+		InsertActiveWrite(l.LiveID),
+		InsertTitleWrite(l.LiveID, l.Title, l.StartTime),
+		InsertLiveWrite(l),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 1, 1, 0}; !equalInt64s(affected, want) {
+		t.Errorf("修改的行数为 %v，应该为 %v", affected, want)
+	}
+	active, err := s.QueryActive(ctx)
+	if err != nil || len(active) != 1 || active[0].LiveID != l.LiveID {
+		t.Errorf("正在直播的直播不正确：%+v %v", active, err)
+	}
+
+	// 有写入失败时整个事务回滚
+	_, err = s.WriteBatch(ctx, []Write{
+		InsertLiveWrite(testLive("live2", 2, 2000)),
+		InsertLiveWrite(testLive("bad id", 3, 3000)),
+	})
+	if err == nil {
+		t.Fatal("无效的liveID应该写入失败")
+	}
+	if ok, err := s.Exists(ctx, "live2"); err != nil || ok {
+		t.Errorf("写入失败时同一批的其他写入不应该保存：%v %v", ok, err)
+	}
+
+	// streamName重复的直播被忽略，不影响同一批的其他写入
+	dup := testLive("live3", 3, 3000)
+	dup.StreamName = l.StreamName
+	affected, err = s.WriteBatch(ctx, []Write{DeleteActiveWrite(l.LiveID), InsertLiveWrite(dup)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 0}; !equalInt64s(affected, want) {
+		t.Errorf("修改的行数为 %v，应该为 %v", affected, want)
+	}
+	if active, err = s.QueryActive(ctx); err != nil || len(active) != 0 {
+		t.Errorf("正在直播的直播应该已经删除：%+v %v", active, err)
+	}
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestURLEncryption(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "crypt.db")
+	const playback, backup = "https://example.com/playback.m3u8", "https://example.com/backup.m3u8"
+
+	// 没有密钥时保存明文
+	s := openTestSQLite(t, path, Options{})
+	plain := testLive("plain", 1, 1000)
+	plain.PlaybackURL, plain.BackupURL = playback, backup
+	if _, err := s.InsertLive(ctx, plain); err != nil {
+		t.Fatal(err)
+	}
+	// 旧版本用SHA-256密钥加密的录播链接
+	legacy := testLive("legacy", 3, 3000)
+	if _, err := s.InsertLive(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE acfunlive SET playbackURL = ?, backupURL = ? WHERE liveID = 'legacy';`,
+		legacyEncrypt(t, "key", playback), legacyEncrypt(t, "key", backup)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 设置密钥后旧的明文和旧版本加密的录播链接被重新加密，新插入的直播也加密
+	s = openTestSQLite(t, path, Options{EncryptionKey: "key"})
+	enc := testLive("enc", 2, 2000)
+	enc.PlaybackURL = playback
+	if _, err := s.InsertLive(ctx, enc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdatePlayback(ctx, "enc", playback, backup); err != nil {
+		t.Fatal(err)
+	}
+	for _, liveID := range []LiveID{"plain", "enc", "legacy"} {
+		var p, b string
+		if err := s.db.QueryRowContext(ctx, `SELECT playbackURL, backupURL FROM acfunlive WHERE liveID = ?;`, liveID).Scan(&p, &b); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(p, encryptedPrefix) || !strings.HasPrefix(b, encryptedPrefix) {
+			t.Errorf("liveID为 %s 的录播链接没有加密：%s %s", liveID, p, b)
+		}
+		l, err := s.QueryLive(ctx, liveID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.PlaybackURL != playback || l.BackupURL != backup {
+			t.Errorf("liveID为 %s 的录播链接解密后为 %s %s", liveID, l.PlaybackURL, l.BackupURL)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有密钥或者密钥错误时不能读取加密的录播链接
+	for _, key := range []string{"", "wrong"} {
+		s = openTestSQLite(t, path, Options{EncryptionKey: key})
+		if _, err := s.QueryLive(ctx, "enc"); err == nil {
+			t.Errorf("密钥为 %q 时不应该能解密录播链接", key)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 用旧版本的SHA-256密钥加密
+func legacyEncrypt(t *testing.T, key, text string) string {
+	t.Helper()
+	c, err := newURLCipher(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, c.legacy.NonceSize())
+	return legacyEncryptedPrefix + base64.RawURLEncoding.EncodeToString(c.legacy.Seal(nonce, nonce, []byte(text), nil))
+}
+
+func TestPayloadEncryption(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payload.db")
+	const payload = `{"target":"https://example.com/hook?token=a"}`
+
+	s := openTestSQLite(t, path, Options{EncryptionKey: "key"})
+	if _, err := s.WriteBatch(ctx, []Write{
+		NotifyWrite("liveHook", 1, "a", payload, 1000),
+		OutboxWrite("start", "a", payload, 1000),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"notifyOutbox", "eventOutbox"} {
+		var p string
+		if err := s.db.QueryRowContext(ctx, `SELECT payload FROM `+table+`;`).Scan(&p); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(p, encryptedPrefix) {
+			t.Errorf("%s 的内容没有加密：%s", table, p)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后用保存的盐生成同样的密钥
+	s = openTestSQLite(t, path, Options{EncryptionKey: "key"})
+	notifications, err := s.QueryDueNotifications(ctx, 1000, 10)
+	if err != nil || len(notifications) != 1 || notifications[0].Payload != payload {
+		t.Errorf("查询到的通知为 %+v，%v", notifications, err)
+	}
+	events, err := s.QueryOutbox(ctx, 10)
+	if err != nil || len(events) != 1 || events[0].Payload != payload {
+		t.Errorf("查询到的事件为 %+v，%v", events, err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestSQLite(t, path, Options{EncryptionKey: "wrong"})
+	if _, err = s.QueryDueNotifications(ctx, 1000, 10); err == nil {
+		t.Error("密钥错误时不应该能解密通知")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.db")
+	s := openTestSQLite(t, path, Options{})
+
+	old := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local).UnixMilli()
+	now := time.Now().UnixMilli()
+	for _, l := range []*Live{testLive("old1", 1, old), testLive("old2", 2, old+1000), testLive("new1", 1, now)} {
+		if _, err := s.InsertLive(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 正在直播的直播不归档
+	if err := s.InsertActive(ctx, "old2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertTitle(ctx, "old1", "新标题"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Archive(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[2020] != 1 {
+		t.Fatalf("归档的直播数量为 %v，应该只有2020年的1场", result)
+	}
+
+	check := func(s *SQLite) {
+		t.Helper()
+		l, err := s.QueryLive(ctx, "old1")
+		if err != nil || l.StartTime != old {
+			t.Errorf("查询归档的直播失败：%+v %v", l, err)
+		}
+		lives, err := s.QueryByUID(ctx, 1, 10)
+		if err != nil || len(lives) != 2 || lives[0].LiveID != "new1" || lives[1].LiveID != "old1" {
+			t.Errorf("同时查询主数据库和归档数据库的结果不正确：%+v %v", lives, err)
+		}
+		titles, err := s.QueryTitles(ctx, "old1")
+		if err != nil || len(titles) != 1 || titles[0].Title != "新标题" {
+			t.Errorf("归档的标题历史不正确：%+v %v", titles, err)
+		}
+	}
+	check(s)
+	var n int
+	if err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM main.acfunlive WHERE liveID = 'old1';`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("归档的直播还在主数据库里：%d %v", n, err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开时自动附加归档数据库
+	s = openTestSQLite(t, path, Options{})
+	check(s)
+	r, err := s.Check(ctx, int64(72*time.Hour/time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.DuplicateLiveIDs) != 0 {
+		t.Errorf("不应该有重复的liveID：%v", r.DuplicateLiveIDs)
+	}
+
+	// 主数据库里再插入归档过的liveID时检查会发现重复
+	if _, err = s.InsertLive(ctx, testLive("old1", 1, old)); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = s.Check(ctx, int64(72*time.Hour/time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.DuplicateLiveIDs) != 1 || r.DuplicateLiveIDs[0] != "old1" {
+		t.Errorf("重复的liveID为 %v，应该为 [old1]", r.DuplicateLiveIDs)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if _, err := OpenSQLite(ctx, filepath.Join(dir, "missing.db"), Options{ReadOnly: true}); err == nil {
+		t.Error("只读打开不存在的数据库时没有返回错误")
+	}
+
+	// 文件名里的%不会被当作URI的转义
+	path := filepath.Join(dir, "live 100%.db")
+	s := openTestSQLite(t, path, Options{})
+	old := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local).UnixMilli()
+	for _, l := range []*Live{testLive("old1", 1, old), testLive("new1", 1, time.Now().UnixMilli())} {
+		if _, err := s.InsertLive(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Archive(ctx, time.Now().UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入的程序还在运行时也可以只读打开，归档数据库也会附加
+	ro := openTestSQLite(t, path, Options{ReadOnly: true})
+	lives, err := ro.QueryByUID(ctx, 1, 10)
+	if err != nil || len(lives) != 2 {
+		t.Errorf("只读打开后查询的结果不正确：%+v %v", lives, err)
+	}
+	if _, err = ro.InsertLive(ctx, testLive("new2", 2, time.Now().UnixMilli())); err == nil {
+		t.Error("只读打开的数据库可以写入")
+	}
+	if ok, err := s.Exists(ctx, "new2"); err != nil || ok {
+		t.Errorf("只读打开的数据库写入了数据：%v", err)
+	}
+}
+
+func TestQueryChanges(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, ":memory:", Options{})
+
+	for _, l := range []*Live{testLive("a", 1, 1000), testLive("b", 2, 2000), testLive("c", 3, 3000)} {
+		if _, err := s.InsertLive(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := s.QueryChanges(ctx, ChangeQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeLiveIDs(changes); got != "a b c" {
+		t.Fatalf("变更的顺序为 %s，应该为 a b c", got)
+	}
+	for _, c := range changes {
+		if c.Live == nil || c.Live.LiveID != c.LiveID || c.Deleted {
+			t.Errorf("变更的直播数据不正确：%+v", c)
+		}
+	}
+	last := changes[len(changes)-1].Seq
+
+	// 修改和删除的直播移到最后，每场直播只返回最后一次变更
+	if err = s.FinalizeLive(ctx, "a", 60000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SoftDelete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FinalizeLive(ctx, "a", 70000); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = s.QueryChanges(ctx, ChangeQuery{After: last, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeLiveIDs(changes); got != "b a" {
+		t.Fatalf("seq %d 之后变更的顺序为 %s，应该为 b a", last, got)
+	}
+	if !changes[0].Deleted || changes[0].Live == nil {
+		t.Errorf("软删除的直播应该有直播数据并标记为删除：%+v", changes[0])
+	}
+	if changes[1].Deleted || changes[1].Live == nil || changes[1].Live.Duration != 70000 {
+		t.Errorf("修改的直播数据不正确：%+v", changes[1].Live)
+	}
+
+	// 彻底删除后只有liveID
+	if _, err = s.PurgeDeleted(ctx, time.Now().Add(time.Minute).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = s.QueryChanges(ctx, ChangeQuery{After: last, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeLiveIDs(changes); got != "a" {
+		t.Fatalf("limit为1时返回的变更为 %s，应该为 a", got)
+	}
+	changes, err = s.QueryChanges(ctx, ChangeQuery{After: changes[0].Seq, Limit: 10})
+	if err != nil || len(changes) != 1 || changes[0].LiveID != "b" || !changes[0].Deleted || changes[0].Live != nil {
+		t.Errorf("彻底删除的直播的变更不正确：%+v %v", changes, err)
+	}
+}
+
+func changeLiveIDs(changes []LiveChange) string {
+	ids := make([]string, len(changes))
+	for i, c := range changes {
+		ids[i] = c.LiveID.String()
+	}
+	return strings.Join(ids, " ")
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	// 主播每个月的直播统计，由触发器在写入acfunlive表和ranking表时增量更新
+	createMonthlyStatsTable = `CREATE TABLE IF NOT EXISTS monthlyStats (
+		uid INTEGER NOT NULL,
+		month TEXT NOT NULL,
+		liveCount INTEGER NOT NULL,
+		totalDuration INTEGER NOT NULL,
+		maxViewers INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (uid, month)
+	);
+	`
+	createMonthlyStatsIndex = `CREATE INDEX IF NOT EXISTS monthlyStatsMonthIndex ON monthlyStats (month, totalDuration);`
+	selectStatsTrigger      = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'monthlyStatsInsert');`
+	// 归档和彻底删除直播时统计不变，所以没有DELETE触发器
+	createStatsInsertTrigger = `CREATE TRIGGER IF NOT EXISTS monthlyStatsInsert AFTER INSERT ON acfunlive WHEN new.deletedAt = 0 BEGIN
+		INSERT OR IGNORE INTO monthlyStats (uid, month, liveCount, totalDuration)
+			VALUES (new.uid, strftime('%Y-%m', new.startTime / 1000, 'unixepoch', 'localtime'), 0, 0);
+		UPDATE monthlyStats SET liveCount = liveCount + 1, totalDuration = totalDuration + new.duration
+			WHERE uid = new.uid AND month = strftime('%Y-%m', new.startTime / 1000, 'unixepoch', 'localtime');
+	END;
+	`
+	createStatsUpdateTrigger = `CREATE TRIGGER IF NOT EXISTS monthlyStatsUpdate AFTER UPDATE OF uid, startTime, duration, deletedAt ON acfunlive BEGIN
+		UPDATE monthlyStats SET liveCount = liveCount - 1, totalDuration = totalDuration - old.duration
+			WHERE old.deletedAt = 0 AND uid = old.uid AND month = strftime('%Y-%m', old.startTime / 1000, 'unixepoch', 'localtime');
+		DELETE FROM monthlyStats
+			WHERE old.deletedAt = 0 AND uid = old.uid AND month = strftime('%Y-%m', old.startTime / 1000, 'unixepoch', 'localtime') AND liveCount <= 0;
+		INSERT OR IGNORE INTO monthlyStats (uid, month, liveCount, totalDuration)
+			SELECT new.uid, strftime('%Y-%m', new.startTime / 1000, 'unixepoch', 'localtime'), 0, 0 WHERE new.deletedAt = 0;
+		UPDATE monthlyStats SET liveCount = liveCount + 1, totalDuration = totalDuration + new.duration
+			WHERE new.deletedAt = 0 AND uid = new.uid AND month = strftime('%Y-%m', new.startTime / 1000, 'unixepoch', 'localtime');
+	END;
+	`
+	// 最高在线人数来自人气排名的快照，删除直播时不会降低
+	createStatsRankingTrigger = `CREATE TRIGGER IF NOT EXISTS monthlyStatsRanking AFTER INSERT ON ranking BEGIN
+		UPDATE monthlyStats SET maxViewers = new.onlineCount
+			WHERE maxViewers < new.onlineCount AND (uid, month) = (
+				SELECT uid, strftime('%Y-%m', startTime / 1000, 'unixepoch', 'localtime')
+				FROM acfunlive WHERE liveID = new.liveID AND deletedAt = 0
+			);
+	END;
+	`
+	// 主播在一周里每个小时开播的次数，由acfunlive表的数据计算得到
+	createScheduleTable = `CREATE TABLE IF NOT EXISTS liveSchedule (
+		uid INTEGER NOT NULL,
+		weekday INTEGER NOT NULL,
+		hour INTEGER NOT NULL,
+		liveCount INTEGER NOT NULL,
+		PRIMARY KEY (uid, weekday, hour)
+	);
+	`
+)
+
+// MonthlyStats 是主播一个月的直播统计
+type MonthlyStats struct {
+	UID           UID    // 主播uid
+	Month         string // 月份，格式为2006-01
+	LiveCount     int    // 直播次数
+	TotalDuration int64  // 直播总时长，单位为毫秒
+	MaxViewers    int    // 进入人气排名时的最高在线人数，没有进入排名时为0
+}
+
+// TopStreamer 是一个月里直播总时长排前的主播
+type TopStreamer struct {
+	MonthlyStats
+	Name string // 主播最近使用的昵称
+}
+
+// ScheduleSlot 是主播在一周里某个小时开播的次数
+type ScheduleSlot struct {
+	Weekday   int // 星期几，0为星期日
+	Hour      int // 开播的小时
+	LiveCount int // 开播次数
+}
+
+// 创建增量更新每月统计的触发器，第一次创建时根据已有的直播数据生成统计，需要在附加归档数据库后调用
+func (s *SQLite) setupStatsTriggers(ctx context.Context) error {
+	if err := s.addColumn(ctx, "main", "monthlyStats", "maxViewers", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	var hasTrigger bool
+	if err := s.db.QueryRowContext(ctx, selectStatsTrigger).Scan(&hasTrigger); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		createMonthlyStatsIndex,
+		createStatsInsertTrigger,
+		createStatsUpdateTrigger,
+		createStatsRankingTrigger,
+	} {
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	if !hasTrigger {
+		if _, err := s.RecomputeStats(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 在一个事务里清空统计表并重新生成，返回生成的行数
+func (s *SQLite) rebuild(ctx context.Context, clear func(queries, context.Context) error, rebuild func(queries, context.Context) (int64, error)) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := s.qtx(tx)
+	if err = clear(q, ctx); err != nil {
+		return 0, err
+	}
+	n, err := rebuild(q, ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// RecomputeStats 根据所有直播数据（包括归档的直播）重新生成每月统计，返回统计的行数
+func (s *SQLite) RecomputeStats(ctx context.Context) (int64, error) {
+	return s.rebuild(ctx, queries.deleteMonthlyStats, queries.rebuildMonthlyStats)
+}
+
+// RecomputeSchedule 根据所有直播数据（包括归档的直播）重新生成开播时间分布，返回统计的行数
+func (s *SQLite) RecomputeSchedule(ctx context.Context) (int64, error) {
+	return s.rebuild(ctx, queries.deleteSchedule, queries.rebuildSchedule)
+}
+
+// QueryMonthlyStats 查询主播每个月的直播统计
+func (s *SQLite) QueryMonthlyStats(ctx context.Context, uid UID) ([]MonthlyStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectMonthlyStats(ctx, uid)
+}
+
+// QueryTopStreamers 查询一个月里直播总时长最长的n个主播，month的格式为2006-01
+func (s *SQLite) QueryTopStreamers(ctx context.Context, month string, n int) ([]TopStreamer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectTopStreamers(ctx, month, n)
+}
+
+// QuerySchedule 查询主播的开播时间分布，按开播次数从多到少排列
+func (s *SQLite) QuerySchedule(ctx context.Context, uid UID) ([]ScheduleSlot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectSchedule(ctx, uid)
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+)
+
+// 占用空间的数据种类
+const (
+	StorageDanmaku   = "danmaku"   // 数据库里的弹幕，按每行的数据大小估算，不包括索引
+	StorageCover     = "cover"     // 直播封面文件
+	StorageRecording = "recording" // 外部录播工具保存的录播文件
+	StorageLiveCut   = "livecut"   // 下载的直播剪辑文件
+)
+
+const (
+	// 每场直播的每种数据占用的空间，bytes为字节数
+	createLiveStorageTable = `CREATE TABLE IF NOT EXISTS liveStorage (
+		liveID TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		bytes INTEGER NOT NULL,
+		updateTime INTEGER NOT NULL,
+		PRIMARY KEY (liveID, kind)
+	);
+	`
+)
+
+// StorageSource 是一场直播保存在本地的文件，用来计算占用的空间
+type StorageSource struct {
+	LiveID      LiveID // 直播ID
+	RecordFile  string // 外部录播工具保存的录播文件，没有时为空
+	LiveCutFile string // 下载的直播剪辑文件，没有时为空
+}
+
+// LiveStorage 是一场直播的一种数据占用的空间
+type LiveStorage struct {
+	LiveID    LiveID // 直播ID
+	StartTime int64  // 直播开始时间，单位为毫秒
+	Kind      string // 数据种类，为Storage开头的常量
+	Bytes     int64  // 占用的字节数
+}
+
+// StreamerStorage 是一个主播的一种数据占用的空间
+type StreamerStorage struct {
+	UID   UID    // 主播uid
+	Kind  string // 数据种类，为Storage开头的常量
+	Bytes int64  // 占用的字节数
+}
+
+// LiveStorageWrite 保存直播的一种数据在updateTime（毫秒）时占用的空间，bytes小于等于0时删除记录
+func LiveStorageWrite(liveID LiveID, kind string, bytes, updateTime int64) Write {
+	if bytes <= 0 {
+		return deleteLiveStorageWrite(liveID, kind)
+	}
+	return upsertLiveStorageWrite(liveID, kind, bytes, updateTime)
+}
+
+// QueryDanmakuBytes 估算直播的弹幕在数据库里占用的字节数
+func (s *SQLite) QueryDanmakuBytes(ctx context.Context, liveID LiveID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectDanmakuBytes(ctx, liveID)
+}
+
+// QueryStorageSources 按开始时间从新到旧查询主播没有删除的直播保存在本地的文件
+func (s *SQLite) QueryStorageSources(ctx context.Context, uid UID) ([]StorageSource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectStorageSources(ctx, uid)
+}
+
+// QueryLiveStorage 按开始时间从新到旧查询主播每场直播占用的空间
+func (s *SQLite) QueryLiveStorage(ctx context.Context, uid UID) ([]LiveStorage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectLiveStorage(ctx, uid)
+}
+
+// QueryStreamerStorage 查询每个主播的每种数据占用的空间
+func (s *SQLite) QueryStreamerStorage(ctx context.Context) ([]StreamerStorage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectStreamerStorage(ctx)
+}
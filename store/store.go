@@ -0,0 +1,276 @@
+// Package store 保存直播数据，监控直播的代码只通过Store接口访问数据库，方便更换存储后端
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound 表示查询的直播不存在
+var ErrNotFound = errors.New("直播数据不存在")
+
+// Live 是一场直播的数据
+type Live struct {
+	LiveID         LiveID // 直播ID
+	UID            UID    // 主播uid
+	Name           string // 主播昵称
+	StreamName     string // 直播源ID
+	StartTime      int64  // 直播开始时间，单位为毫秒
+	Title          string // 直播间标题
+	Duration       int64  // 录播时长，单位为毫秒
+	PlaybackURL    string // 录播链接
+	BackupURL      string // 录播备份链接
+	LiveCutNum     int    // 直播剪辑编号
+	SuggestedTitle string // 没有直播间标题时根据弹幕或主播签名生成的建议标题
+	Access         string // 直播间的访问限制，多个限制用逗号分隔，没有限制时为空
+	RecordFile     string // 外部录播工具保存的本地录播文件名
+
+	Computed map[string]interface{} // 查询时计算的列，没有设置计算列时为nil
+}
+
+// LiveQuery 是查询直播的条件，为零值的条件不限制
+type LiveQuery struct {
+	LiveID    LiveID // 直播ID
+	UID       UID    // 主播uid
+	From      int64  // 开始时间不早于From，单位为毫秒
+	To        int64  // 开始时间早于To，单位为毫秒
+	Title     string // 直播间标题含有的关键词
+	Finished  bool   // 只查询已经获取到直播时长的直播
+	Limit     int    // 最多返回的数量
+	Offset    int    // 跳过前面的数量，用于分页
+	Sort      string // 排序的列，为SortStartTime或SortDuration，为空时按开始时间排序
+	Ascending bool   // 是否升序排列，默认为降序
+}
+
+// 查询直播时可以排序的列
+const (
+	SortStartTime = "startTime" // 按开始时间排序
+	SortDuration  = "duration"  // 按直播时长排序
+)
+
+// TitleChange 是直播间标题的变更记录
+type TitleChange struct {
+	Title      string // 直播间标题
+	ChangeTime int64  // 变更时间，单位为毫秒
+}
+
+// StreamerName 是主播用过的昵称
+type StreamerName struct {
+	UID       UID    // 主播uid
+	Name      string // 主播昵称
+	FirstSeen int64  // 第一次看到该昵称的时间，单位为毫秒
+	LastSeen  int64  // 最后一次看到该昵称的时间，单位为毫秒
+}
+
+// Store 是直播数据的存储，实现需要能被多个goroutine同时使用
+type Store interface {
+	// InsertLive 插入直播数据，liveID已存在时返回false，liveID或uid无效时返回错误
+	InsertLive(ctx context.Context, l *Live) (bool, error)
+	// ImportLives 在一个事务里插入多场直播，liveID已存在的直播会被跳过
+	ImportLives(ctx context.Context, lives []Live) (imported, skipped int, err error)
+	// FinalizeLive 保存下播后获取到的直播时长
+	FinalizeLive(ctx context.Context, liveID LiveID, duration int64) error
+	// UpdateLiveCut 记录直播剪辑编号，只有之前没有编号时才会更新直播数据，返回之前的编号
+	UpdateLiveCut(ctx context.Context, liveID LiveID, num int) (oldNum int, err error)
+	// QueryLiveCutChecks 查询uids里的主播在before（毫秒）之前没有确认过的直播剪辑，确认结果用LiveCutStatusWrite保存
+	QueryLiveCutChecks(ctx context.Context, uids []UID, before int64, limit int) ([]LiveCutStatus, error)
+	// QueryRemovedLiveCuts 查询已经被删除的直播剪辑，最近发现的在前面
+	QueryRemovedLiveCuts(ctx context.Context) ([]LiveCutStatus, error)
+	// UpdateSuggestedTitle 保存没有标题的直播的建议标题
+	UpdateSuggestedTitle(ctx context.Context, liveID LiveID, title string) error
+	// UpdateAccess 更新直播间的访问限制
+	UpdateAccess(ctx context.Context, liveID LiveID, access string) error
+	// UpdateRecordFile 保存直播的本地录播文件名，返回是否有直播被更新
+	UpdateRecordFile(ctx context.Context, liveID LiveID, file string) (bool, error)
+	// UpdatePlayback 保存直播的录播链接，返回是否有直播被更新
+	UpdatePlayback(ctx context.Context, liveID LiveID, url, backupURL string) (bool, error)
+	// QueryLive 查询指定liveID的直播，包括已删除的直播，不存在时返回ErrNotFound
+	QueryLive(ctx context.Context, liveID LiveID) (*Live, error)
+	// QueryByUID 按开始时间从新到旧查询指定主播的直播，limit小于等于0时查询所有直播
+	QueryByUID(ctx context.Context, uid UID, limit int) ([]Live, error)
+	// QueryLives 查询符合条件的没有删除的直播，默认按开始时间从新到旧排列
+	QueryLives(ctx context.Context, q LiveQuery) ([]Live, error)
+	// QueryUnfinished 查询开始时间在since（毫秒）之后但还没有直播时长的直播
+	QueryUnfinished(ctx context.Context, since int64) ([]Live, error)
+	// ForEachLive 按开始时间从旧到新分批遍历所有没有删除的直播，f返回错误时停止遍历
+	ForEachLive(ctx context.Context, f func(*Live) error) error
+	// Exists 查询是否存在指定liveID的直播
+	Exists(ctx context.Context, liveID LiveID) (bool, error)
+
+	// InsertActive 记录正在直播的liveID
+	InsertActive(ctx context.Context, liveID LiveID) error
+	// DeleteActive 删除已经下播的liveID
+	DeleteActive(ctx context.Context, liveID LiveID) error
+	// QueryActive 查询记录为正在直播的直播
+	QueryActive(ctx context.Context) ([]Live, error)
+
+	// InsertTitle 记录直播间标题
+	InsertTitle(ctx context.Context, liveID LiveID, title string) error
+	// QueryTitles 查询直播间标题的变更记录
+	QueryTitles(ctx context.Context, liveID LiveID) ([]TitleChange, error)
+
+	// SeeStreamerName 记录看到主播使用的昵称
+	SeeStreamerName(ctx context.Context, uid UID, name string) error
+	// QueryStreamerNames 查询主播用过的昵称
+	QueryStreamerNames(ctx context.Context, uid UID) ([]StreamerName, error)
+	// SearchStreamers 查询用过含有关键词的昵称的主播
+	SearchStreamers(ctx context.Context, keyword string) ([]StreamerName, error)
+	// QueryLatestStreamers 查询所有主播最近使用的昵称
+	QueryLatestStreamers(ctx context.Context) ([]StreamerName, error)
+
+	// WriteBatch 在一个事务里按顺序执行多条写入，返回每条写入修改的行数，有写入失败时整个事务回滚
+	WriteBatch(ctx context.Context, writes []Write) ([]int64, error)
+
+	// SoftDelete 软删除直播数据，返回是否有数据被删除
+	SoftDelete(ctx context.Context, liveID LiveID) (bool, error)
+	// Restore 恢复软删除的直播数据，返回是否有数据被恢复
+	Restore(ctx context.Context, liveID LiveID) (bool, error)
+	// PurgeDeleted 彻底删除在before（毫秒）之前软删除的直播数据和相关的记录，返回删除的直播数量
+	PurgeDeleted(ctx context.Context, before int64) (int64, error)
+	// QueryChanges 按seq从小到大查询直播数据的变更，每场直播只返回最后一次变更，用于增量同步
+	QueryChanges(ctx context.Context, q ChangeQuery) ([]LiveChange, error)
+	// LastChangeSeq 返回最后一次变更的seq，没有变更时返回0
+	LastChangeSeq(ctx context.Context) (int64, error)
+	// QuerySyncSeq 查询从source同步到的seq，还没有同步时返回0，同步的数据用MirrorLiveWrites和SyncSeqWrite保存
+	QuerySyncSeq(ctx context.Context, source string) (int64, error)
+
+	// Archive 把在before（毫秒）之前开播的直播按开播年份移到归档存储，归档的直播仍然可以查询，返回每年归档的直播数量
+	Archive(ctx context.Context, before int64) (map[int]int64, error)
+
+	// InsertDanmaku 保存弹幕
+	InsertDanmaku(ctx context.Context, list []Danmaku) error
+	// SearchDanmaku 按发送时间搜索含有所有关键词的弹幕
+	SearchDanmaku(ctx context.Context, q DanmakuQuery) ([]DanmakuMatch, error)
+	// QueryFans 按弹幕数量从多到少查询主播直播间里的前n个观众，礼物用GiftWrite保存
+	QueryFans(ctx context.Context, uid UID, n int) ([]Fan, error)
+	// QueryGiftTotals 按花费的AC币从多到少查询直播每种礼物的合计，合计用GiftTotalWrite保存
+	QueryGiftTotals(ctx context.Context, liveID LiveID) ([]GiftTotal, error)
+	// QueryIncome 按开始时间从旧到新查询主播每场直播收到的礼物的合计
+	QueryIncome(ctx context.Context, uid UID) ([]Income, error)
+	// RecomputeFans 根据所有弹幕和礼物重新生成观众统计，返回统计的行数
+	RecomputeFans(ctx context.Context) (int64, error)
+	// RecomputeChatStats 根据所有弹幕重新生成每场直播的弹幕统计，返回统计的行数
+	RecomputeChatStats(ctx context.Context) (int64, error)
+	// QueryDanmakuBytes 估算直播的弹幕在数据库里占用的字节数
+	QueryDanmakuBytes(ctx context.Context, liveID LiveID) (int64, error)
+	// CountDanmaku 查询直播来源为source的弹幕数量，source为Danmaku开头的常量
+	CountDanmaku(ctx context.Context, liveID LiveID, source string) (int64, error)
+	// QueryDanmakuPeaks 把直播的弹幕按bucket（毫秒）分段，返回弹幕最多的n个时间段，按时间从早到晚排列，n小于0时返回所有时间段
+	QueryDanmakuPeaks(ctx context.Context, liveID LiveID, bucket int64, n int) ([]DanmakuPeak, error)
+	// QueryTimedDanmaku 按发送时间查询直播的所有弹幕和弹幕在直播里的时间
+	QueryTimedDanmaku(ctx context.Context, liveID LiveID) ([]TimedDanmaku, error)
+	// QueryDanmakuSession 查询直播的弹幕记录，没有记录时返回nil，记录用DanmakuSessionOpenWrite和DanmakuSessionCloseWrite保存
+	QueryDanmakuSession(ctx context.Context, liveID LiveID) (*DanmakuSession, error)
+	// QueryChatStats 查询直播的弹幕统计，没有统计时返回nil，统计用ChatStatsWrite生成
+	QueryChatStats(ctx context.Context, liveID LiveID) (*ChatStats, error)
+	// CloseStaleDanmakuSessions 把上次运行时没有结束的弹幕记录标记为中断并合计礼物和弹幕统计，返回标记的数量
+	CloseStaleDanmakuSessions(ctx context.Context) (int64, error)
+
+	// InsertRanking 保存时间为t（毫秒）的直播间人气排名快照
+	InsertRanking(ctx context.Context, t int64, list []RankEntry) error
+	// QueryRankings 按时间从旧到新查询直播进入排名的记录
+	QueryRankings(ctx context.Context, liveID LiveID) ([]Ranking, error)
+
+	// QueryModeration 按时间从旧到新查询直播间的管理事件，管理事件用ModerationWrite保存
+	QueryModeration(ctx context.Context, liveID LiveID) ([]ModerationEvent, error)
+
+	// QuerySamples 按时间从旧到新查询直播每分钟的在线人数和点赞数，采样用SampleWrite保存
+	QuerySamples(ctx context.Context, liveID LiveID) ([]Sample, error)
+	// QueryViewerSamples 按时间从旧到新查询直播每次获取直播间列表时的在线人数和点赞数，采样用ViewerSampleWrites保存
+	QueryViewerSamples(ctx context.Context, liveID LiveID) ([]ViewerSample, error)
+	// QueryLiveStreams 按开始时间从旧到新查询主播每场直播的直播源，直播源用StreamQualityWrites保存
+	QueryLiveStreams(ctx context.Context, uid UID) ([]LiveStream, error)
+	// QueryFanClub 按时间从旧到新查询直播开始和结束时主播的守护团信息，用FanClubWrite保存
+	QueryFanClub(ctx context.Context, liveID LiveID) ([]FanClub, error)
+
+	// QueryStorageSources 按开始时间从新到旧查询主播没有删除的直播保存在本地的文件
+	QueryStorageSources(ctx context.Context, uid UID) ([]StorageSource, error)
+	// QueryLiveStorage 按开始时间从新到旧查询主播每场直播占用的空间，占用的空间用LiveStorageWrite保存
+	QueryLiveStorage(ctx context.Context, uid UID) ([]LiveStorage, error)
+	// QueryStreamerStorage 查询每个主播的每种数据占用的空间
+	QueryStreamerStorage(ctx context.Context) ([]StreamerStorage, error)
+
+	// QueryOutbox 按顺序查询最早的limit个等待发送的事件，事件用OutboxWrite保存
+	QueryOutbox(ctx context.Context, limit int) ([]OutboxEvent, error)
+	// AckOutbox 删除序号不大于id的已经发送的事件，返回删除的数量
+	AckOutbox(ctx context.Context, id int64) (int64, error)
+	// QueryDueNotifications 按顺序查询下次发送时间不晚于now（毫秒）的最早的limit个通知，通知用NotifyWrite保存
+	QueryDueNotifications(ctx context.Context, now int64, limit int) ([]Notification, error)
+	// QueryNotifications 按顺序查询所有等待发送的通知
+	QueryNotifications(ctx context.Context) ([]Notification, error)
+	// DeleteNotification 删除已经发送或放弃发送的通知
+	DeleteNotification(ctx context.Context, id int64) error
+	// DelayNotification 记录通知发送失败，在nextTime（毫秒）之后重试
+	DelayNotification(ctx context.Context, id int64, nextTime int64, lastError string) error
+
+	// QueryJobCursor 查询批处理任务上次中断时处理到的位置，进度用JobCursorWrite保存
+	QueryJobCursor(ctx context.Context, job string) (string, error)
+
+	// AddTenant 添加共用实例的用户，返回用户ID
+	AddTenant(ctx context.Context, name string, createTime int64) (int64, error)
+	// RemoveTenant 删除用户和用户的API key、关注的主播，返回用户是否存在
+	RemoveTenant(ctx context.Context, id int64) (bool, error)
+	// QueryTenants 按用户ID查询所有用户
+	QueryTenants(ctx context.Context) ([]Tenant, error)
+	// QueryTenant 按用户名查询用户，用户不存在时返回nil
+	QueryTenant(ctx context.Context, name string) (*Tenant, error)
+	// QueryTenantByKey 查询API key的SHA-256为keyHash的用户，没有时返回nil
+	QueryTenantByKey(ctx context.Context, keyHash string) (*Tenant, error)
+	// AddTenantKey 给用户添加API key，keyHash为key的SHA-256的十六进制
+	AddTenantKey(ctx context.Context, id int64, keyHash string, createTime int64) error
+	// RevokeTenantKeys 删除用户所有的API key，返回删除的数量
+	RevokeTenantKeys(ctx context.Context, id int64) (int64, error)
+	// SetTenantHook 修改用户的webhook，url为空时不通知
+	SetTenantHook(ctx context.Context, id int64, url, format string) error
+	// QueryTenantWatch 按uid查询用户关注的主播
+	QueryTenantWatch(ctx context.Context, id int64) ([]UID, error)
+	// SetTenantWatch 让用户关注或取消关注主播，返回关注状态是否改变
+	SetTenantWatch(ctx context.Context, id int64, uid UID, watch bool) (bool, error)
+	// QueryWatchingTenants 查询关注了主播的用户
+	QueryWatchingTenants(ctx context.Context, uid UID) ([]Tenant, error)
+	// QueryAvatars 按第一次看到的时间查询主播用过的头像
+	QueryAvatars(ctx context.Context, uid UID) ([]Avatar, error)
+	// QueryCovers 按开始时间从旧到新查询主播下载过的直播封面，封面文件用CoverWrite保存
+	QueryCovers(ctx context.Context, uid UID) ([]LiveCover, error)
+	// QueryFollowers 按时间从旧到新查询主播的粉丝数和关注数，用FollowerWrite保存
+	QueryFollowers(ctx context.Context, uid UID) ([]Follower, error)
+
+	// RecomputeStats 根据所有直播数据重新生成每月统计，返回统计的行数
+	RecomputeStats(ctx context.Context) (int64, error)
+	// RecomputeSchedule 根据所有直播数据重新生成开播时间分布，返回统计的行数
+	RecomputeSchedule(ctx context.Context) (int64, error)
+	// QueryMonthlyStats 查询主播每个月的直播统计
+	QueryMonthlyStats(ctx context.Context, uid UID) ([]MonthlyStats, error)
+	// QueryTopStreamers 查询一个月里直播总时长最长的n个主播
+	QueryTopStreamers(ctx context.Context, month string, n int) ([]TopStreamer, error)
+	// QuerySchedule 查询主播的开播时间分布，按开播次数从多到少排列
+	QuerySchedule(ctx context.Context, uid UID) ([]ScheduleSlot, error)
+
+	// Snapshot 把数据库的一致快照写入path，year不为0时写入该年份的归档数据库
+	Snapshot(ctx context.Context, year int, path string) error
+	// ReadQuery 执行只读的SQL查询，拒绝写入数据的语句
+	ReadQuery(ctx context.Context, query string) (*QueryResult, error)
+
+	// Check 检查数据的完整性和一致性
+	Check(ctx context.Context, maxDuration int64) (*CheckResult, error)
+	// ClearPlayback 清除直播的录播链接
+	ClearPlayback(ctx context.Context, liveID LiveID) error
+	// DeleteOrphans 删除没有对应直播的记录
+	DeleteOrphans(ctx context.Context) error
+
+	// Ping 检查存储是否可用
+	Ping(ctx context.Context) error
+	// Close 关闭存储
+	Close() error
+}
+
+// CheckResult 是Check发现的问题
+type CheckResult struct {
+	Integrity        []string // 数据库完整性检查的错误
+	DuplicateLiveIDs []LiveID // 在主数据库和归档数据库里都有数据的liveID
+	BadDurations     []LiveID // 直播时长或开始时间异常的liveID
+	MissingLiveCut   []Live   // 已结束但从来没有获取过直播剪辑编号的直播，获取过的用LiveCutLookupWrite记录
+	OrphanPlayback   []LiveID // 录播链接不完整或者还没有结束的liveID
+	OrphanActive     []LiveID // 没有对应直播的activeLive记录
+	OrphanLiveCut    []LiveID // liveCutHistory里没有对应直播的liveID
+}
@@ -0,0 +1,52 @@
+package store
+
+import "context"
+
+const (
+	// 直播开始时的直播源，每个画质一行，host为m3u8链接的域名。归档直播时直播源不会移到归档数据库
+	createStreamTable = `CREATE TABLE IF NOT EXISTS streamQuality (
+		liveID TEXT NOT NULL,
+		qualityType TEXT NOT NULL,
+		qualityName TEXT NOT NULL,
+		bitrate INTEGER NOT NULL,
+		host TEXT NOT NULL,
+		sampleTime INTEGER NOT NULL,
+		PRIMARY KEY (liveID, qualityType)
+	);
+	`
+)
+
+// StreamQuality 是直播开始时的一个画质的直播源
+type StreamQuality struct {
+	LiveID      LiveID // 直播ID
+	QualityType string // 画质类型，如"STANDARD"、"HIGH"、"BLUE_RAY"
+	QualityName string // 画质的中文名字，如"高清"、"蓝光 8M"
+	Bitrate     int    // 直播源标称的码率，不一定是实际码率
+	Host        string // 直播源m3u8链接的域名
+	Time        int64  // 获取直播源的时间，单位为毫秒
+}
+
+// LiveStream 是主播某场直播的一个画质的直播源
+type LiveStream struct {
+	LiveID      LiveID // 直播ID
+	StartTime   int64  // 直播开始的时间，单位为毫秒
+	QualityName string // 画质的中文名字
+	Bitrate     int    // 直播源标称的码率
+	Host        string // 直播源m3u8链接的域名
+}
+
+// StreamQualityWrites 保存直播开始时的所有直播源
+func StreamQualityWrites(list []StreamQuality) []Write {
+	writes := make([]Write, len(list))
+	for i, q := range list {
+		writes[i] = insertStreamWrite(q.LiveID, q.QualityType, q.QualityName, q.Bitrate, q.Host, q.Time)
+	}
+	return writes
+}
+
+// QueryLiveStreams 按开始时间从旧到新查询主播每场直播的直播源，同一场直播按码率从低到高排列
+func (s *SQLite) QueryLiveStreams(ctx context.Context, uid UID) ([]LiveStream, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectLiveStreams(ctx, uid)
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	// 共用一个实例的用户，每个用户有自己的关注列表、通知设置和API key，直播数据所有用户共用
+	createTenantTable = `CREATE TABLE IF NOT EXISTS tenant (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		hookURL TEXT NOT NULL DEFAULT '',
+		hookFormat TEXT NOT NULL DEFAULT '',
+		createTime INTEGER NOT NULL
+	);
+	`
+
+	// 用户的API key，只保存SHA-256的十六进制，一个用户可以有多个key
+	createTenantKeyTable = `CREATE TABLE IF NOT EXISTS tenantKey (
+		keyHash TEXT PRIMARY KEY,
+		tenantID INTEGER NOT NULL,
+		createTime INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS tenantKeyTenantIndex ON tenantKey (tenantID);
+	`
+
+	// 用户关注的主播
+	createTenantWatchTable = `CREATE TABLE IF NOT EXISTS tenantWatch (
+		tenantID INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		PRIMARY KEY (tenantID, uid)
+	);
+	CREATE INDEX IF NOT EXISTS tenantWatchUIDIndex ON tenantWatch (uid);
+	`
+)
+
+// Tenant 是共用一个实例的用户
+type Tenant struct {
+	ID         int64  // 用户ID
+	Name       string // 用户名
+	HookURL    string // 关注的主播开播和下播时通知的webhook链接，为空时不通知
+	HookFormat string // webhook的请求体格式
+	CreateTime int64  // 创建用户的时间，单位为毫秒
+}
+
+// AddTenant 添加用户，返回用户ID
+func (s *SQLite) AddTenant(ctx context.Context, name string, createTime int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().insertTenant(ctx, name, createTime)
+}
+
+// RemoveTenant 删除用户和用户的API key、关注的主播，返回用户是否存在
+func (s *SQLite) RemoveTenant(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	q := s.qtx(tx)
+	n, err := q.deleteTenant(ctx, id)
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if err = q.deleteTenantKeys(ctx, id); err != nil {
+		return false, err
+	}
+	if err = q.deleteTenantWatches(ctx, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// QueryTenants 按用户ID查询所有用户
+func (s *SQLite) QueryTenants(ctx context.Context) ([]Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectTenants(ctx)
+}
+
+// QueryTenant 按用户名查询用户，用户不存在时返回nil
+func (s *SQLite) QueryTenant(ctx context.Context, name string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, err := s.q().selectTenantByName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// QueryTenantByKey 查询API key的SHA-256为keyHash的用户，没有时返回nil
+func (s *SQLite) QueryTenantByKey(ctx context.Context, keyHash string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, err := s.q().selectTenantByKey(ctx, keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// AddTenantKey 给用户添加API key，keyHash为key的SHA-256的十六进制
+func (s *SQLite) AddTenantKey(ctx context.Context, id int64, keyHash string, createTime int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().insertTenantKey(ctx, keyHash, id, createTime)
+}
+
+// RevokeTenantKeys 删除用户所有的API key，返回删除的数量
+func (s *SQLite) RevokeTenantKeys(ctx context.Context, id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().revokeTenantKeys(ctx, id)
+}
+
+// SetTenantHook 修改用户的webhook，url为空时不通知
+func (s *SQLite) SetTenantHook(ctx context.Context, id int64, url, format string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q().updateTenantHook(ctx, url, format, id)
+}
+
+// QueryTenantWatch 按uid查询用户关注的主播
+func (s *SQLite) QueryTenantWatch(ctx context.Context, id int64) ([]UID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectTenantWatch(ctx, id)
+}
+
+// SetTenantWatch 让用户关注或取消关注主播，返回关注状态是否改变
+func (s *SQLite) SetTenantWatch(ctx context.Context, id int64, uid UID, watch bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	var err error
+	if watch {
+		n, err = s.q().insertTenantWatch(ctx, id, uid)
+	} else {
+		n, err = s.q().deleteTenantWatch(ctx, id, uid)
+	}
+	return n != 0, err
+}
+
+// QueryWatchingTenants 查询关注了主播的用户
+func (s *SQLite) QueryWatchingTenants(ctx context.Context, uid UID) ([]Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q().selectWatchingTenants(ctx, uid)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 获取并保存关注的主播的直播开始时的画质、码率和直播源的域名
+func recordStreamQualities(uid store.UID, liveID store.LiveID) {
+	if !isWatched(uid) {
+		return
+	}
+	var list []store.StreamQuality
+	err := runThrice(func() error {
+		dac, err := ac.SetLiverUID(int64(uid))
+		if err != nil {
+			return err
+		}
+		info := dac.GetStreamInfo()
+		if store.LiveID(info.LiveID) != liveID {
+			return fmt.Errorf("直播源的liveID为 %s", info.LiveID)
+		}
+		now := time.Now().UnixMilli()
+		list = list[:0]
+		for _, s := range info.StreamList {
+			q := store.StreamQuality{
+				LiveID:      liveID,
+				QualityType: s.QualityType,
+				QualityName: s.QualityName,
+				Bitrate:     s.Bitrate,
+				Time:        now,
+			}
+			if u, err := url.Parse(s.URL); err == nil {
+				q.Host = u.Host
+			}
+			list = append(list, q)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("获取uid为 %d 的主播的liveID为 %s 的直播源失败：%v", uid, liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		return
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的直播的直播源", liveID), nil, store.StreamQualityWrites(list)...)
+}
+
+// 按开播时间打印主播每场直播的画质和码率，最高码率变化时提示
+func printLiveStreams(ctx context.Context, uid store.UID) {
+	list, err := db.QueryLiveStreams(ctx, uid)
+	if err != nil {
+		log.Printf("查询uid为 %d 的主播的直播源出现错误：%v", uid, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("没有uid为 %d 的主播的直播源记录，只记录关注的主播的直播", uid)
+		return
+	}
+	lastBest := 0
+	for i := 0; i < len(list); {
+		j := i
+		var qualities []string
+		hosts := make(map[string]bool)
+		var hostList []string
+		for ; j < len(list) && list[j].LiveID == list[i].LiveID; j++ {
+			qualities = append(qualities, fmt.Sprintf("%s（%d）", list[j].QualityName, list[j].Bitrate))
+			if h := list[j].Host; h != "" && !hosts[h] {
+				hosts[h] = true
+				hostList = append(hostList, h)
+			}
+		}
+		// 同一场直播按码率从低到高排列，最后一个是最高画质
+		best := list[j-1]
+		fmt.Printf("%s %s 画质：%s 域名：%s\n", time.UnixMilli(best.StartTime).Format(timeLayout), best.LiveID,
+			strings.Join(qualities, " "), strings.Join(hostList, " "))
+		if lastBest != 0 && best.Bitrate != lastBest {
+			fmt.Printf("  最高画质变为 %s（%d）\n", best.QualityName, best.Bitrate)
+		}
+		lastBest = best.Bitrate
+		i = j
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 记录看到主播使用的昵称
+func seeStreamerName(uid store.UID, name string) {
+	queueWrite(fmt.Sprintf("记录uid为 %d 的主播的昵称 %s", uid, name), nil,
+		store.StreamerNameWrite(uid, name, time.Now().UnixMilli()),
+	)
+}
+
+// 打印主播用过的昵称
+func printStreamerNames(list []store.StreamerName) {
+	for _, s := range list {
+		fmt.Printf("uid：%d 昵称：%s 首次出现：%s 最后出现：%s\n", s.UID, s.Name,
+			time.UnixMilli(s.FirstSeen).Format(timeLayout), time.UnixMilli(s.LastSeen).Format(timeLayout),
+		)
+	}
+}
+
+// 主播最近使用的昵称，没有昵称记录时返回空字符串
+func latestStreamerName(ctx context.Context, uid store.UID) string {
+	names, err := db.QueryStreamerNames(ctx, uid)
+	if err != nil {
+		return ""
+	}
+	var name string
+	var lastSeen int64
+	for _, n := range names {
+		if n.LastSeen >= lastSeen {
+			name, lastSeen = n.Name, n.LastSeen
+		}
+	}
+	return name
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/orzogc/acfundanmu"
+
+	"acfunlivedb/store"
+)
+
+const (
+	maxTitleCollectors = 50 // 同时统计弹幕的直播间的最大数量
+	maxSuggestedTitle  = 30 // 建议标题的最大字数
+	topPhraseCount     = 3  // 建议标题使用出现次数最多的几条弹幕
+)
+
+// 统计没有标题的直播间的弹幕
+type titleCollector struct {
+	sync.Mutex
+	cancel  context.CancelFunc
+	phrases map[string]int // 弹幕内容和出现次数
+}
+
+var titleCollectors = struct {
+	sync.Mutex
+	m map[store.LiveID]*titleCollector // key为liveID
+}{m: make(map[store.LiveID]*titleCollector)}
+
+// 开始统计没有标题的直播间的弹幕
+func startTitleCollector(ctx context.Context, uid store.UID, liveID store.LiveID) {
+	titleCollectors.Lock()
+	defer titleCollectors.Unlock()
+	if _, ok := titleCollectors.m[liveID]; ok || len(titleCollectors.m) >= maxTitleCollectors {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	tc := &titleCollector{cancel: cancel, phrases: make(map[string]int)}
+	titleCollectors.m[liveID] = tc
+
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer cancel()
+		defer recoverCrash("titleCollector")
+		dac, err := ac.SetLiverUID(int64(uid))
+		if err != nil {
+			log.Printf("连接uid为 %d 的主播的直播间弹幕失败：%v", uid, err)
+			return
+		}
+		dac.OnComment(func(_ *acfundanmu.AcFunLive, c *acfundanmu.Comment) {
+			content := strings.TrimSpace(c.Content)
+			if n := utf8.RuneCountInString(content); n < 2 || n > maxSuggestedTitle {
+				return
+			}
+			tc.Lock()
+			tc.phrases[content]++
+			tc.Unlock()
+		})
+		<-dac.StartDanmu(ctx, true)
+	}()
+}
+
+// 停止统计弹幕，返回出现次数最多的弹幕
+func stopTitleCollector(liveID store.LiveID) []string {
+	titleCollectors.Lock()
+	tc, ok := titleCollectors.m[liveID]
+	delete(titleCollectors.m, liveID)
+	titleCollectors.Unlock()
+	if !ok {
+		return nil
+	}
+	tc.cancel()
+
+	tc.Lock()
+	defer tc.Unlock()
+	phrases := make([]string, 0, len(tc.phrases))
+	for p, n := range tc.phrases {
+		// 只出现一次的弹幕没有代表性
+		if n > 1 {
+			phrases = append(phrases, p)
+		}
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if tc.phrases[phrases[i]] != tc.phrases[phrases[j]] {
+			return tc.phrases[phrases[i]] > tc.phrases[phrases[j]]
+		}
+		return phrases[i] < phrases[j]
+	})
+	if len(phrases) > topPhraseCount {
+		phrases = phrases[:topPhraseCount]
+	}
+	return phrases
+}
+
+// 为没有标题的直播生成建议标题，优先使用弹幕，没有弹幕时使用主播签名
+func suggestTitle(ctx context.Context, uid store.UID, liveID store.LiveID) {
+	title := strings.Join(stopTitleCollector(liveID), " / ")
+	if title == "" {
+		info, err := ac.GetUserInfo(int64(uid))
+		if err != nil {
+			log.Printf("获取uid为 %d 的主播的用户信息失败：%v", uid, err)
+		} else {
+			title = strings.TrimSpace(strings.SplitN(info.Signature, "\n", 2)[0])
+		}
+	}
+	if title == "" {
+		return
+	}
+	if r := []rune(title); len(r) > maxSuggestedTitle {
+		title = string(r[:maxSuggestedTitle])
+	}
+	updateSuggestedTitle(ctx, liveID, title)
+}
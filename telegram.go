@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const defaultTelegramAPI = "https://api.telegram.org" // 默认的Telegram Bot API地址
+
+// Telegram机器人通知的设置
+type telegramConfig struct {
+	Token   string      `json:"token" secret:"true"` // 机器人的token，为空时不发送通知
+	ChatIDs []int64     `json:"chatIDs"`             // 接收通知的聊天ID
+	API     string      `json:"api"`                 // Bot API的地址，为空时使用官方地址，可以设置为反向代理
+	Limit   notifyLimit `json:"limit"`               // 安静时段和频率限制
+}
+
+// 已经发送的直播剪辑通知，key为liveID，下播后不再查询直播剪辑时删除
+var telegramCuts = struct {
+	sync.Mutex
+	m map[store.LiveID]string
+}{m: make(map[store.LiveID]string)}
+
+// 是否需要为这个主播发送Telegram通知，只通知关注的主播
+func telegramEnabled(uid store.UID) bool {
+	return conf.Telegram.Token != "" && len(conf.Telegram.ChatIDs) != 0 && isWatched(uid)
+}
+
+// 发送开播通知
+func telegramLiveStart(l *live) {
+	telegramStartNotify(l, "start", defaultTelegramStartTemplate)
+}
+
+// 发送重连通知，设置了开播通知的模板时使用这个模板，模板里可以用.Event区分
+func telegramLiveReconnect(l *live) {
+	telegramStartNotify(l, "reconnect", defaultTelegramReconnectTemplate)
+}
+
+func telegramStartNotify(l *live, event, def string) {
+	if !telegramEnabled(l.uid) || !notifyRouted(routeTelegram, l.uid, l.title) {
+		return
+	}
+	if !conf.Telegram.Limit.allow("Telegram", l.uid, templateEventName(event)+"通知") {
+		return
+	}
+	sendTelegram(l, renderTemplate(conf.Templates.Telegram.Start, def, newTemplateData(event, l, 0)))
+}
+
+// 发送直播剪辑通知，同一场直播的同一个直播剪辑只通知一次
+func telegramLiveCut(ctx context.Context, uid store.UID, liveID store.LiveID, cutURL string) {
+	if cutURL == "" || !telegramEnabled(uid) {
+		return
+	}
+	telegramCuts.Lock()
+	sent := telegramCuts.m[liveID] == cutURL
+	telegramCuts.m[liveID] = cutURL
+	telegramCuts.Unlock()
+	if sent {
+		return
+	}
+	l, err := queryLive(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播数据出现错误：%v", liveID, err)
+		return
+	}
+	if !notifyRouted(routeTelegram, uid, l.title) || !conf.Telegram.Limit.allow("Telegram", uid, "直播剪辑通知") {
+		return
+	}
+	data := newTemplateData("liveCut", l, l.duration)
+	data.LiveCutURL = cutURL
+	sendTelegram(l, renderTemplate(conf.Templates.Telegram.LiveCut, defaultTelegramLiveCutTemplate, data))
+}
+
+// 删除已经发送的直播剪辑通知的记录，下播后不再需要时调用
+func forgetTelegramCut(liveID store.LiveID) {
+	telegramCuts.Lock()
+	delete(telegramCuts.m, liveID)
+	telegramCuts.Unlock()
+}
+
+// 发送录播通知
+func telegramPlayback(l *live, duration int64, url, backupURL string) {
+	if !telegramEnabled(l.uid) || !notifyRouted(routeTelegram, l.uid, l.title) || !conf.Telegram.Limit.allow("Telegram", l.uid, "录播通知") {
+		return
+	}
+	data := newTemplateData("playback", l, duration)
+	data.PlaybackURL = url
+	data.BackupURL = backupURL
+	sendTelegram(l, renderTemplate(conf.Templates.Telegram.Playback, defaultTelegramPlaybackTemplate, data))
+}
+
+// 直播间标题，没有时使用建议标题
+func liveTitle(l *live) string {
+	if strings.TrimSpace(l.title) != "" {
+		return l.title
+	}
+	if l.suggestedTitle != "" {
+		return l.suggestedTitle
+	}
+	return "无标题"
+}
+
+// 保存到Telegram通知的内容
+type telegramPayload struct {
+	ChatID int64  `json:"chatID"`
+	Text   string `json:"text"`
+}
+
+// 把HTML格式的关于直播l的消息加入通知队列，发送到所有设置的聊天
+func sendTelegram(l *live, text string) {
+	for _, chatID := range conf.Telegram.ChatIDs {
+		queueNotification("telegram", l.uid, l.liveID, &telegramPayload{ChatID: chatID, Text: text})
+	}
+}
+
+// 发送通知队列里的Telegram通知
+func sendTelegramPayload(payload []byte) error {
+	if conf.Telegram.Token == "" {
+		return errNotifyDisabled
+	}
+	var p telegramPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return postTelegram(p.ChatID, p.Text)
+}
+
+// 调用Bot API的sendMessage，错误信息里不含token
+func postTelegram(chatID int64, text string) error {
+	body, err := json.Marshal(struct {
+		ChatID    int64  `json:"chat_id"`
+		Text      string `json:"text"`
+		ParseMode string `json:"parse_mode"`
+	}{chatID, text, "HTML"})
+	checkErr(err)
+	api := conf.Telegram.API
+	if api == "" {
+		api = defaultTelegramAPI
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(api, "/"), conf.Telegram.Token))
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetUserAgent(userAgent)
+	req.Header.SetContentType("application/json")
+	req.SetBody(body)
+	if err := client.Do(req, resp); err != nil {
+		return errors.New(strings.ReplaceAll(err.Error(), conf.Telegram.Token, "******"))
+	}
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil || !result.OK {
+		return fmt.Errorf("Telegram Bot API返回状态码 %d：%s", resp.StatusCode(), result.Description)
+	}
+	return nil
+}
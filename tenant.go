@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const (
+	tenantKeyPrefix       = "aldb_"          // 用户API key的前缀，方便在日志和设置里认出
+	tenantHookDialTimeout = 10 * time.Second // 解析和连接用户webhook的最长时间
+)
+
+// 请求的context里保存用户的key
+type tenantContextKey struct{}
+
+// GET /api/tenant返回的用户设置
+type tenantJSON struct {
+	Name       string `json:"name"`       // 用户名
+	HookURL    string `json:"hookURL"`    // 关注的主播开播和下播时通知的webhook链接，为空时不通知
+	HookFormat string `json:"hookFormat"` // webhook的请求体格式，可以是json、discord或slack
+	CreateTime int64  `json:"createTime"` // 创建用户的时间，单位为毫秒
+}
+
+// PUT /api/tenant的请求，没有的设置保持不变
+type tenantRequest struct {
+	HookURL    *string `json:"hookURL"`
+	HookFormat *string `json:"hookFormat"`
+}
+
+// 生成新的API key，返回key和保存到数据库的SHA-256
+func newTenantKey() (key, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = tenantKeyPrefix + hex.EncodeToString(b)
+	return key, hashTenantKey(key), nil
+}
+
+func hashTenantKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 查询bearer token对应的用户，不是用户的API key时返回nil
+func lookupTenant(ctx context.Context, token string) *store.Tenant {
+	if len(token) <= len(tenantKeyPrefix) || token[:len(tenantKeyPrefix)] != tenantKeyPrefix {
+		return nil
+	}
+	t, err := db.QueryTenantByKey(ctx, hashTenantKey(token))
+	if err != nil {
+		log.Printf("查询API key对应的用户出现错误：%v", err)
+		return nil
+	}
+	return t
+}
+
+// 请求的用户，不是用用户的API key访问时返回nil
+func requestTenant(r *http.Request) *store.Tenant {
+	t, _ := r.Context().Value(tenantContextKey{}).(*store.Tenant)
+	return t
+}
+
+// 用户关注的主播uid
+func tenantWatchSet(ctx context.Context, t *store.Tenant) (map[store.UID]bool, error) {
+	uids, err := db.QueryTenantWatch(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[store.UID]bool, len(uids))
+	for _, uid := range uids {
+		set[uid] = true
+	}
+	return set, nil
+}
+
+// 关注了主播并设置了webhook的用户
+func watchingTenants(uid store.UID) []store.Tenant {
+	tenants, err := db.QueryWatchingTenants(context.Background(), uid)
+	if err != nil {
+		log.Printf("查询关注了uid为 %d 的主播的用户出现错误：%v", uid, err)
+		return nil
+	}
+	hooked := tenants[:0]
+	for _, t := range tenants {
+		if t.HookURL != "" {
+			hooked = append(hooked, t)
+		}
+	}
+	return hooked
+}
+
+// 把通知保存到通知队列，由notifyCycle按每个用户设置的格式发送，失败时重试
+func sendTenantHooks(tenants []store.Tenant, hook *liveHookJSON) {
+	for _, t := range tenants {
+		queueNotification("tenantHook", hook.UID, hook.LiveID, &tenantHookPayload{Tenant: t.Name, Hook: *hook})
+	}
+}
+
+// 保存到通知队列的用户webhook通知，发送时按用户当前的设置生成请求体
+type tenantHookPayload struct {
+	Tenant string       `json:"tenant"` // 用户名
+	Hook   liveHookJSON `json:"hook"`
+}
+
+// 发送通知队列里的用户webhook通知，用户已经删除或不再设置webhook时不再发送
+func sendTenantHookPayload(payload []byte) error {
+	var p tenantHookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	t, err := db.QueryTenant(context.Background(), p.Tenant)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.HookURL == "" {
+		return errNotifyDisabled
+	}
+	body, err := formatLiveHook(t.HookFormat, &p.Hook)
+	if err != nil {
+		return err
+	}
+	return postLiveHook(tenantHookClient, t.HookURL, body, p.Hook.Event, "")
+}
+
+// 检查webhook的设置
+func checkTenantHook(hookURL, format string) error {
+	switch format {
+	case "", liveHookJSONFormat, liveHookDiscordFormat, liveHookSlackFormat:
+	default:
+		return fmt.Errorf("hookFormat %s 只能是 %s、%s 或 %s", format, liveHookJSONFormat, liveHookDiscordFormat, liveHookSlackFormat)
+	}
+	if hookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(hookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("hookURL %s 不是有效的http或https链接", hookURL)
+	}
+	if _, err = lookupPublicIPs(u.Hostname()); err != nil {
+		return fmt.Errorf("hookURL %s 不能使用：%w", hookURL, err)
+	}
+	return nil
+}
+
+// 发送用户webhook的客户端，只连接公网地址，避免用户通过webhook访问本机和内网的服务
+var tenantHookClient = &fasthttp.Client{
+	MaxIdleConnDuration: 90 * time.Second,
+	ReadTimeout:         10 * time.Second,
+	WriteTimeout:        10 * time.Second,
+	Dial:                dialPublic,
+}
+
+// 连接时才解析域名并检查地址，域名在保存设置后改为解析到内网地址时也不会连接
+func dialPublic(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := lookupPublicIPs(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", net.JoinHostPort(ip.String(), port), tenantHookDialTimeout); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// 解析主机的地址，有任何一个地址是本机、内网或链路本地地址时返回错误
+func lookupPublicIPs(host string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tenantHookDialTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败：%w", host, err)
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return nil, fmt.Errorf("%s 的地址 %s 不是公网地址", host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// 运营商级NAT的地址段，net.IP.IsPrivate不包括
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+func toTenantJSON(t *store.Tenant) tenantJSON {
+	return tenantJSON{Name: t.Name, HookURL: t.HookURL, HookFormat: t.HookFormat, CreateTime: t.CreateTime}
+}
+
+// GET /api/tenant 返回用户的设置
+// PUT /api/tenant 修改用户的webhook，只能用用户的API key访问
+func handleTenant(w http.ResponseWriter, r *http.Request) {
+	t := requestTenant(r)
+	if t == nil {
+		writeError(w, http.StatusForbidden, errors.New("需要使用用户的API key访问"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, toTenantJSON(t))
+	case http.MethodPut:
+		var req tenantRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("请求不是有效的JSON：%w", err))
+			return
+		}
+		updated := *t
+		if req.HookURL != nil {
+			updated.HookURL = *req.HookURL
+		}
+		if req.HookFormat != nil {
+			updated.HookFormat = *req.HookFormat
+		}
+		if err := checkTenantHook(updated.HookURL, updated.HookFormat); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := db.SetTenantHook(r.Context(), t.ID, updated.HookURL, updated.HookFormat); err != nil {
+			log.Printf("API修改用户 %s 的webhook出现错误：%v", t.Name, err)
+			writeError(w, http.StatusInternalServerError, errors.New("保存设置出现错误"))
+			return
+		}
+		log.Printf("用户 %s 通过API修改了webhook", t.Name)
+		writeJSON(w, http.StatusOK, toTenantJSON(&updated))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("只支持GET和PUT请求"))
+	}
+}
+
+// 用户关注的主播
+func tenantWatchList(w http.ResponseWriter, r *http.Request, t *store.Tenant) {
+	uids, err := db.QueryTenantWatch(r.Context(), t.ID)
+	if err != nil {
+		log.Printf("API查询用户 %s 关注的主播出现错误：%v", t.Name, err)
+		writeError(w, http.StatusInternalServerError, errors.New("查询关注的主播出现错误"))
+		return
+	}
+	watched := make([]watchJSON, len(uids))
+	for i, uid := range uids {
+		watched[i] = toWatchJSON(r, watchFeatures(uid))
+	}
+	writeJSON(w, http.StatusOK, watched)
+}
+
+// 让用户关注或取消关注主播，返回关注状态是否改变
+func setTenantWatch(w http.ResponseWriter, r *http.Request, t *store.Tenant, uid store.UID, watch bool) (bool, bool) {
+	changed, err := db.SetTenantWatch(r.Context(), t.ID, uid, watch)
+	if err != nil {
+		log.Printf("API修改用户 %s 关注的主播出现错误：%v", t.Name, err)
+		writeError(w, http.StatusInternalServerError, errors.New("保存设置出现错误"))
+		return false, false
+	}
+	if changed && watch {
+		log.Printf("用户 %s 通过API关注uid为 %d 的主播", t.Name, uid)
+	} else if changed {
+		log.Printf("用户 %s 通过API取消关注uid为 %d 的主播", t.Name, uid)
+	}
+	return changed, true
+}
+
+// tenant命令，管理共用实例的用户
+func runTenant(ctx context.Context, args []string) error {
+	const usage = `管理用户的命令为"tenant list"、"tenant add 用户名"、"tenant key 用户名"、"tenant revoke 用户名" 或"tenant remove 用户名"`
+	if len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		return errors.New(usage)
+	}
+	if args[0] == "list" {
+		tenants, err := db.QueryTenants(ctx)
+		if err != nil {
+			return fmt.Errorf("查询用户出现错误：%w", err)
+		}
+		if len(tenants) == 0 {
+			log.Println("没有用户")
+		}
+		for _, t := range tenants {
+			uids, err := db.QueryTenantWatch(ctx, t.ID)
+			if err != nil {
+				return fmt.Errorf("查询用户 %s 关注的主播出现错误：%w", t.Name, err)
+			}
+			// webhook链接里可能有token，只显示主机
+			hook := "没有设置"
+			if t.HookURL != "" {
+				hook = redactURL(t.HookURL)
+			}
+			fmt.Printf("用户：%s 创建时间：%s 关注的主播数量：%d webhook：%s\n",
+				t.Name, time.UnixMilli(t.CreateTime).Format(timeLayout), len(uids), hook)
+		}
+		return nil
+	}
+
+	name := args[1]
+	if args[0] == "add" {
+		if t, err := db.QueryTenant(ctx, name); err != nil {
+			return fmt.Errorf("查询用户 %s 出现错误：%w", name, err)
+		} else if t != nil {
+			return fmt.Errorf("用户 %s 已经存在", name)
+		}
+		id, err := db.AddTenant(ctx, name, time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("添加用户 %s 失败：%w", name, err)
+		}
+		return addTenantKey(ctx, id, name)
+	}
+	t, err := db.QueryTenant(ctx, name)
+	if err != nil {
+		return fmt.Errorf("查询用户 %s 出现错误：%w", name, err)
+	}
+	if t == nil {
+		return fmt.Errorf("没有用户 %s", name)
+	}
+	switch args[0] {
+	case "key":
+		return addTenantKey(ctx, t.ID, name)
+	case "revoke":
+		n, err := db.RevokeTenantKeys(ctx, t.ID)
+		if err != nil {
+			return fmt.Errorf("删除用户 %s 的API key失败：%w", name, err)
+		}
+		log.Printf("删除了用户 %s 的 %d 个API key", name, n)
+	case "remove":
+		if _, err = db.RemoveTenant(ctx, t.ID); err != nil {
+			return fmt.Errorf("删除用户 %s 失败：%w", name, err)
+		}
+		log.Printf("已删除用户 %s 和用户关注的主播、API key", name)
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
+
+// 给用户添加API key并打印出来，key只在这时显示一次
+func addTenantKey(ctx context.Context, id int64, name string) error {
+	key, hash, err := newTenantKey()
+	if err != nil {
+		return fmt.Errorf("生成API key失败：%w", err)
+	}
+	if err = db.AddTenantKey(ctx, id, hash, time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("保存用户 %s 的API key失败：%w", name, err)
+	}
+	// 不写入日志文件，只打印到标准输出
+	fmt.Printf("用户 %s 的API key为 %s ，只显示这一次，请妥善保存\n", name, key)
+	return nil
+}
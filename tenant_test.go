@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 使用测试用的内存数据库作为db，测试结束时恢复
+func useTestDB(t *testing.T) *store.SQLite {
+	t.Helper()
+	s := openTestStore(t)
+	old := db
+	db = s
+	t.Cleanup(func() { db = old })
+	return s
+}
+
+func TestTenantAuth(t *testing.T) {
+	ctx := context.Background()
+	s := useTestDB(t)
+	oldToken := conf.HTTP.APIToken
+	conf.HTTP.APIToken = "admin"
+	t.Cleanup(func() { conf.HTTP.APIToken = oldToken })
+
+	id, err := s.AddTenant(ctx, "用户", time.Now().UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, hash, err := newTenantKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddTenantKey(ctx, id, hash, time.Now().UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+
+	var tenant *store.Tenant
+	handler := requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		tenant = requestTenant(r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	request := func(bearer string) int {
+		tenant = nil
+		r := httptest.NewRequest(http.MethodGet, "/api/tenant", nil)
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	if code := request(key); code != http.StatusNoContent || tenant == nil || tenant.Name != "用户" {
+		t.Errorf("用户的API key返回 %d，用户为 %v", code, tenant)
+	}
+	if code := request("admin"); code != http.StatusNoContent || tenant != nil {
+		t.Errorf("apiToken返回 %d，用户为 %v", code, tenant)
+	}
+	for _, bearer := range []string{"", "aldb_0123", key + "0", hash} {
+		if code := request(bearer); code != http.StatusUnauthorized || tenant != nil {
+			t.Errorf("token %q 返回 %d，应该返回401", bearer, code)
+		}
+	}
+	// 删除key后不能再用
+	if _, err = s.RevokeTenantKeys(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if code := request(key); code != http.StatusUnauthorized {
+		t.Errorf("删除的API key返回 %d，应该返回401", code)
+	}
+}
+
+func TestCheckTenantHook(t *testing.T) {
+	for _, hookURL := range []string{"", "https://1.1.1.1/hook", "http://8.8.8.8:8080/a?token=b"} {
+		if err := checkTenantHook(hookURL, "json"); err != nil {
+			t.Errorf("%s 返回错误：%v", hookURL, err)
+		}
+	}
+	for _, hookURL := range []string{
+		"ftp://1.1.1.1/",
+		"http://127.0.0.1/",
+		"http://localhost:8080/",
+		"http://[::1]/",
+		"http://10.1.2.3/",
+		"http://192.168.1.1/",
+		"http://172.16.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[fe80::1]/",
+		"http://100.64.0.1/",
+		"http://0.0.0.0/",
+		"http://[::ffff:127.0.0.1]/",
+	} {
+		if err := checkTenantHook(hookURL, ""); err == nil {
+			t.Errorf("%s 应该返回错误", hookURL)
+		}
+	}
+	if err := checkTenantHook("https://1.1.1.1/", "xml"); err == nil || !strings.Contains(err.Error(), "hookFormat") {
+		t.Errorf("不支持的格式返回 %v", err)
+	}
+
+	// 发送时也不会连接内网地址
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if conn, err := dialPublic(l.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("连接了本机地址")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	translateTimeout   = 60 * time.Second // 单次翻译的超时时间
+	translateBatchSize = 200              // 导出弹幕时每次翻译的弹幕数量，避免一次传给翻译命令或API的文字太多
+)
+
+// 弹幕翻译的设置，command和api只需设置一个
+type translateConfig struct {
+	Command   string   `json:"command"`             // 翻译命令，弹幕文字逐行从标准输入传入，翻译结果逐行从标准输出读取
+	API       string   `json:"api"`                 // 翻译API链接，POST {"texts":[...]}，返回 {"texts":[...]}
+	Token     string   `json:"token" secret:"true"` // 翻译API的bearer token
+	Languages []string `json:"languages"`           // 只翻译这些语言的弹幕，可以是zh、ja、ko、en和other，为空时全部翻译
+}
+
+// 翻译是否可用
+func (t *translateConfig) enabled() bool {
+	return t.Command != "" || t.API != ""
+}
+
+// 检查翻译设置，翻译命令只有空白时无法运行
+func (t *translateConfig) check() error {
+	if t.Command != "" && len(strings.Fields(t.Command)) == 0 {
+		return errors.New("translate.command 不能只有空白")
+	}
+	return nil
+}
+
+// 简单判断弹幕的语言，返回zh、ja、ko、en或other
+func detectLanguage(text string) string {
+	var han, kana, hangul, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latin++
+		}
+	}
+	switch {
+	case kana > 0:
+		return "ja"
+	case hangul > 0:
+		return "ko"
+	case han > 0:
+		return "zh"
+	case latin > 0:
+		return "en"
+	default:
+		return "other"
+	}
+}
+
+// 是否需要翻译该弹幕
+func (t *translateConfig) match(text string) bool {
+	if len(t.Languages) == 0 {
+		return true
+	}
+	lang := detectLanguage(text)
+	for _, l := range t.Languages {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// 翻译弹幕，不需要翻译的弹幕原样返回，返回的切片和texts一一对应
+func translateTexts(ctx context.Context, texts []string) ([]string, error) {
+	t := &conf.Translate
+	if !t.enabled() {
+		return nil, fmt.Errorf("没有设置翻译命令或翻译API")
+	}
+
+	var index []int
+	var input []string
+	for i, text := range texts {
+		// 换行会打乱逐行对应的结果
+		text = strings.ReplaceAll(text, "\n", " ")
+		if t.match(text) {
+			index = append(index, i)
+			input = append(input, text)
+		}
+	}
+	result := make([]string, len(texts))
+	copy(result, texts)
+	if len(input) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, translateTimeout)
+	defer cancel()
+	var output []string
+	var err error
+	if t.Command != "" {
+		output, err = translateByCommand(ctx, t.Command, input)
+	} else {
+		output, err = translateByAPI(t.API, t.Token, input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(output) != len(input) {
+		return nil, fmt.Errorf("翻译结果数量 %d 和弹幕数量 %d 不一致", len(output), len(input))
+	}
+	for i, j := range index {
+		result[j] = output[i]
+	}
+	return result, nil
+}
+
+// 分批翻译导出的弹幕，没有设置翻译时原样返回
+func translateExport(ctx context.Context, texts []string) ([]string, error) {
+	if !conf.Translate.enabled() {
+		return texts, nil
+	}
+	result := make([]string, 0, len(texts))
+	for start := 0; start < len(texts); start += translateBatchSize {
+		end := start + translateBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := translateTexts(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("翻译第 %d 到 %d 条弹幕失败：%w", start+1, end, err)
+		}
+		result = append(result, batch...)
+	}
+	return result, nil
+}
+
+// 调用外部命令翻译
+func translateByCommand(ctx context.Context, command string, texts []string) ([]string, error) {
+	args := strings.Fields(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(texts, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("运行翻译命令出现错误：%w，%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n"), nil
+}
+
+// 调用翻译API
+func translateByAPI(url, token string, texts []string) ([]string, error) {
+	body, err := json.Marshal(struct {
+		Texts []string `json:"texts"`
+	}{texts})
+	checkErr(err)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.SetBody(body)
+	if err = client.DoTimeout(req, resp, translateTimeout); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("翻译API返回状态码 %d：%s", resp.StatusCode(), string(resp.Body()))
+	}
+
+	var p fastjson.Parser
+	v, err := p.ParseBytes(resp.Body())
+	if err != nil {
+		return nil, fmt.Errorf("解析翻译API的响应失败：%w", err)
+	}
+	list := v.GetArray("texts")
+	output := make([]string, len(list))
+	for i, t := range list {
+		output[i] = string(t.GetStringBytes())
+	}
+	return output, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+)
+
+// 以下变量在编译时通过ldflags设置，例如：
+// go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date +%FT%T%z)"
+var (
+	version   = "dev"     // 版本号
+	commit    = "unknown" // git提交
+	buildTime = "unknown" // 编译时间
+)
+
+// 没有通过ldflags设置时尝试从go编译信息里获取git提交和编译时间
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if commit == "unknown" {
+				commit = s.Value
+				if len(commit) > 12 {
+					commit = commit[:12]
+				}
+			}
+		case "vcs.time":
+			if buildTime == "unknown" {
+				buildTime = s.Value
+			}
+		}
+	}
+}
+
+// 返回版本信息
+func versionInfo() string {
+	return fmt.Sprintf("acfunlivedb %s (commit %s, built %s, %s %s/%s)",
+		version, commit, buildTime, runtime.Version(), runtime.GOOS, runtime.GOARCH,
+	)
+}
+
+// 打印启动信息
+func printBanner() {
+	log.Println(versionInfo())
+	log.Printf("配置文件：%s", configPath)
+	for _, line := range conf.summary() {
+		log.Printf("  %s", line)
+	}
+}
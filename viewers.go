@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 保存关注的主播的直播间在这次获取直播间列表时的在线人数和点赞数
+func recordViewerSamples(t time.Time, list map[store.LiveID]live) {
+	if !conf.RecordViewers || len(list) == 0 {
+		return
+	}
+	uids := watchedUIDs()
+	var samples []store.ViewerSample
+	for _, liveID := range sortedLiveIDs(list) {
+		l := list[liveID]
+		if !containsUID(uids, l.uid) {
+			continue
+		}
+		samples = append(samples, store.ViewerSample{
+			LiveID:      l.liveID,
+			Time:        t.UnixMilli(),
+			OnlineCount: l.onlineCount,
+			LikeCount:   l.likeCount,
+		})
+	}
+	if len(samples) == 0 {
+		return
+	}
+	queueWrite(fmt.Sprintf("保存 %d 个直播间的在线人数", len(samples)), nil, store.ViewerSampleWrites(samples)...)
+}
+
+// 打印直播每次获取直播间列表时的在线人数和点赞数，以及在线人数最多的时间
+func printViewerSamples(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QueryViewerSamples(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播的在线人数记录出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有在线人数记录，需要设置 recordViewers", liveID)
+		return
+	}
+	peak := list[0]
+	for _, v := range list {
+		fmt.Printf("%s 在线人数：%d 点赞数：%d\n", time.UnixMilli(v.Time).Format(timeLayout), v.OnlineCount, v.LikeCount)
+		if v.OnlineCount > peak.OnlineCount {
+			peak = v
+		}
+	}
+	fmt.Printf("在线人数最多为 %d（%s）\n", peak.OnlineCount, time.UnixMilli(peak.Time).Format(timeLayout))
+}
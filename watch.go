@@ -0,0 +1,684 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orzogc/acfundanmu"
+	"github.com/valyala/fasthttp"
+
+	"acfunlivedb/store"
+)
+
+const (
+	maxRoomWatchers      = 50               // 同时连接弹幕的直播间的最大数量
+	danmakuFlushInterval = 10 * time.Second // 保存弹幕的间隔
+	sampleInterval       = time.Minute      // 采样在线人数和点赞数的间隔
+	roomRetryMinDelay    = 10 * time.Second // 直播间弹幕断开后第一次重连的等待时间，之后每次翻倍
+	roomRetryMaxDelay    = 5 * time.Minute  // 直播间弹幕重连的最长等待时间，连接超过这个时间后重新计算
+	defaultCoverDir      = "covers"
+)
+
+// 关注的主播和对这个主播开启的记录功能
+type watchTarget struct {
+	UID     store.UID `json:"uid"`     // 主播uid
+	Danmaku bool      `json:"danmaku"` // 是否记录弹幕
+	Stats   bool      `json:"stats"`   // 是否每分钟记录在线人数、点赞数和弹幕数
+	Cover   bool      `json:"cover"`   // 是否下载直播封面
+}
+
+// 保护运行时可以修改的conf.WatchUIDs和conf.Watch
+var watchMu sync.RWMutex
+
+// 直播间弹幕的连接和每场直播的状态，key为liveID
+var roomWatchers = struct {
+	sync.Mutex
+	m     map[store.LiveID]*roomConn  // 当前的连接，断开后清除
+	rooms map[store.LiveID]*roomState // 断开重连时保留，下播时清除
+}{m: make(map[store.LiveID]*roomConn), rooms: make(map[store.LiveID]*roomState)}
+
+// 一次直播间弹幕连接
+type roomConn struct {
+	cancel context.CancelFunc
+	done   chan struct{} // 连接结束并保存剩下的弹幕后关闭
+}
+
+// 一场直播的直播间弹幕状态
+type roomState struct {
+	danmaku  bool      // 是否开始了弹幕记录，下播时需要结束
+	failures int       // 连续断开的次数
+	retryAt  time.Time // 断开后可以重连的时间
+	stop     int64     // 直播间弹幕因为下播而结束的时间，单位为毫秒，下播处理时用来计算直播时长
+}
+
+// 是否为设置里关注的主播
+func isWatched(uid store.UID) bool {
+	return containsUID(watchedUIDs(), uid)
+}
+
+// 设置里所有关注的主播uid，包括watchUIDs和watch
+func watchedUIDs() []store.UID {
+	watchMu.RLock()
+	defer watchMu.RUnlock()
+	uids := append([]store.UID(nil), conf.WatchUIDs...)
+	for _, t := range conf.Watch {
+		if !containsUID(uids, t.UID) {
+			uids = append(uids, t.UID)
+		}
+	}
+	return uids
+}
+
+// 对主播开启的记录功能，不在watch里的主播的功能都为false
+func watchFeatures(uid store.UID) watchTarget {
+	watchMu.RLock()
+	defer watchMu.RUnlock()
+	t := watchTarget{UID: uid}
+	for _, w := range conf.Watch {
+		if w.UID == uid {
+			t.Danmaku = t.Danmaku || w.Danmaku
+			t.Stats = t.Stats || w.Stats
+			t.Cover = t.Cover || w.Cover
+		}
+	}
+	return t
+}
+
+// 是否对主播开启了任何记录功能
+func (t watchTarget) hasFeatures() bool {
+	return t.Danmaku || t.Stats || t.Cover
+}
+
+// 添加关注的主播或修改对主播开启的记录功能，并保存到设置文件，返回主播之前是否已经关注。
+// 开启了记录功能的主播保存在watch里，否则保存在watchUIDs里，对正在进行的直播不生效
+func setWatch(t watchTarget) (existed bool, err error) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	existed = containsUID(conf.WatchUIDs, t.UID) || containsWatch(conf.Watch, t.UID)
+	var uids []store.UID
+	for _, u := range conf.WatchUIDs {
+		if u != t.UID || !t.hasFeatures() {
+			uids = append(uids, u)
+		}
+	}
+	var targets []watchTarget
+	replaced := false
+	for _, w := range conf.Watch {
+		if w.UID != t.UID {
+			targets = append(targets, w)
+		} else if t.hasFeatures() && !replaced {
+			targets = append(targets, t)
+			replaced = true
+		}
+	}
+	if t.hasFeatures() && !replaced {
+		targets = append(targets, t)
+	}
+	if !t.hasFeatures() && !containsUID(uids, t.UID) {
+		uids = append(uids, t.UID)
+	}
+	if err = writeWatchConfig(configPath, uids, targets); err != nil {
+		return existed, fmt.Errorf("写入设置文件 %s 失败：%w", configPath, err)
+	}
+	conf.WatchUIDs, conf.Watch = uids, targets
+	return existed, nil
+}
+
+// 取消关注主播并保存到设置文件，返回主播之前是否已经关注，对正在进行的直播不生效
+func removeWatch(uid store.UID) (bool, error) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	var uids []store.UID
+	var targets []watchTarget
+	for _, u := range conf.WatchUIDs {
+		if u != uid {
+			uids = append(uids, u)
+		}
+	}
+	for _, w := range conf.Watch {
+		if w.UID != uid {
+			targets = append(targets, w)
+		}
+	}
+	if len(uids) == len(conf.WatchUIDs) && len(targets) == len(conf.Watch) {
+		return false, nil
+	}
+	if err := writeWatchConfig(configPath, uids, targets); err != nil {
+		return true, fmt.Errorf("写入设置文件 %s 失败：%w", configPath, err)
+	}
+	conf.WatchUIDs, conf.Watch = uids, targets
+	return true, nil
+}
+
+// 把多个主播加入watchUIDs并保存到设置文件，已经关注的主播会被跳过
+func addWatchUIDs(added []store.UID) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	uids := append([]store.UID(nil), conf.WatchUIDs...)
+	for _, uid := range added {
+		if !containsUID(uids, uid) && !containsWatch(conf.Watch, uid) {
+			uids = append(uids, uid)
+		}
+	}
+	if err := writeWatchConfig(configPath, uids, conf.Watch); err != nil {
+		return fmt.Errorf("写入设置文件 %s 失败：%w", configPath, err)
+	}
+	conf.WatchUIDs = uids
+	return nil
+}
+
+// 设置里关注的主播和对主播开启的记录功能，只在watchUIDs里的主播的功能都为false
+func watchList() []watchTarget {
+	uids := watchedUIDs()
+	list := make([]watchTarget, len(uids))
+	for i, uid := range uids {
+		list[i] = watchFeatures(uid)
+	}
+	return list
+}
+
+func containsUID(uids []store.UID, uid store.UID) bool {
+	for _, u := range uids {
+		if u == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWatch(targets []watchTarget, uid store.UID) bool {
+	for _, t := range targets {
+		if t.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// 直播间弹幕连接记录的数据
+type roomRecorder struct {
+	sync.Mutex
+	liveID   store.LiveID
+	danmaku  []store.Danmaku // 还没有保存的弹幕
+	gifts    []store.Gift    // 还没有保存的礼物
+	comments int             // 上一次采样后的弹幕数量
+	info     *acfundanmu.DisplayInfo
+}
+
+// 保存缓存的弹幕和礼物
+func (r *roomRecorder) flushDanmaku() {
+	r.Lock()
+	list, gifts := r.danmaku, r.gifts
+	r.danmaku, r.gifts = nil, nil
+	r.Unlock()
+	if len(list) == 0 && len(gifts) == 0 {
+		return
+	}
+	writes := make([]store.Write, 0, len(list)+len(gifts))
+	for i := range list {
+		writes = append(writes, store.DanmakuWrite(&list[i]))
+	}
+	for i := range gifts {
+		writes = append(writes, store.GiftWrite(&gifts[i]))
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的 %d 条弹幕和 %d 次礼物", r.liveID, len(list), len(gifts)), nil, writes...)
+}
+
+// 保存一次在线人数、点赞数和弹幕数的采样，还没有收到直播间状态时不保存
+func (r *roomRecorder) sample() {
+	r.Lock()
+	info, comments := r.info, r.comments
+	r.comments = 0
+	r.Unlock()
+	if info == nil {
+		return
+	}
+	s := &store.Sample{
+		LiveID:        r.liveID,
+		Time:          time.Now().UnixMilli(),
+		WatchingCount: parseCount(info.WatchingCount),
+		LikeCount:     parseCount(info.LikeCount),
+		DanmakuCount:  comments,
+	}
+	queueWrite(fmt.Sprintf("保存liveID为 %s 的直播采样", r.liveID), nil, store.SampleWrite(s))
+}
+
+// 解析直播间显示的数量，如"123"和"1.2万"
+func parseCount(s string) int {
+	s = strings.TrimSpace(s)
+	scale := 1.0
+	if n, ok := strings.CutSuffix(s, "万"); ok {
+		s, scale = n, 1e4
+	} else if n, ok := strings.CutSuffix(s, "亿"); ok {
+		s, scale = n, 1e8
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(f * scale)
+}
+
+// 关注的主播开播时连接直播间弹幕，按设置记录管理事件、弹幕和每分钟的采样，不需要记录时不连接。
+// 断开后由restartRoomWatchers重连，弹幕记录在下播时由stopRoomWatcher结束
+func startRoomWatcher(ctx context.Context, l *live) {
+	uid, liveID := l.uid, l.liveID
+	if !isWatched(uid) {
+		return
+	}
+	features := watchFeatures(uid)
+	features.Danmaku = features.Danmaku || conf.RecordDanmaku
+	// 记录弹幕时也记录管理事件，方便以后和弹幕一起查看
+	moderation := conf.RecordModeration || features.Danmaku
+	if !moderation && !features.Stats {
+		return
+	}
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	if _, ok := roomWatchers.m[liveID]; ok {
+		return
+	}
+	room, ok := roomWatchers.rooms[liveID]
+	if !ok {
+		// 重连不受数量限制
+		if len(roomWatchers.rooms) >= maxRoomWatchers {
+			return
+		}
+		room = &roomState{danmaku: features.Danmaku}
+		roomWatchers.rooms[liveID] = room
+		if features.Danmaku {
+			sess := &store.DanmakuSession{LiveID: liveID, UID: uid, StartTime: l.startTime, OpenTime: time.Now().UnixMilli()}
+			queueWrite(fmt.Sprintf("开始记录liveID为 %s 的弹幕", liveID), nil, store.DanmakuSessionOpenWrite(sess))
+		}
+	}
+	// 开播时没有记录弹幕的直播重连时也不记录，避免弹幕记录没有开始
+	features.Danmaku = room.danmaku
+	ctx, cancel := context.WithCancel(ctx)
+	conn := &roomConn{cancel: cancel, done: make(chan struct{})}
+	roomWatchers.m[liveID] = conn
+
+	recordModeration := func(kind, content string) {
+		e := &store.ModerationEvent{LiveID: liveID, Time: time.Now().UnixMilli(), Kind: kind, Content: content}
+		log.Printf("uid为 %d 的主播的直播间出现%s：%s", uid, moderationText[kind], content)
+		queueWrite(fmt.Sprintf("保存liveID为 %s 的直播间管理事件", liveID), nil, store.ModerationWrite(e))
+	}
+	r := &roomRecorder{liveID: liveID}
+
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer close(conn.done)
+		defer cancel()
+		defer recoverCrash("roomWatcher")
+		connected := time.Now()
+		defer func() {
+			// 不是因为下播或者本程序退出而断开的连接，直播还在列表里时重连
+			if ctx.Err() == nil {
+				roomDisconnected(liveID, conn, time.Since(connected))
+			}
+		}()
+		dac, err := ac.SetLiverUID(int64(uid))
+		if err != nil {
+			log.Printf("连接uid为 %d 的主播的直播间弹幕失败：%v", uid, err)
+			return
+		}
+		if moderation {
+			dac.OnViolationAlert(func(_ *acfundanmu.AcFunLive, content string) {
+				recordModeration(store.ModerationViolationAlert, content)
+			})
+			dac.OnKickedOut(func(_ *acfundanmu.AcFunLive, reason string) {
+				recordModeration(store.ModerationKickedOut, reason)
+			})
+		}
+		if features.Danmaku || features.Stats {
+			dac.OnComment(func(_ *acfundanmu.AcFunLive, c *acfundanmu.Comment) {
+				r.Lock()
+				defer r.Unlock()
+				r.comments++
+				if features.Danmaku {
+					r.danmaku = append(r.danmaku, store.Danmaku{
+						LiveID:   liveID,
+						SendTime: c.SendTime,
+						UID:      c.UserID,
+						Nickname: c.Nickname,
+						Content:  c.Content,
+						Medal: store.Medal{
+							MedalUID:   c.Medal.UperID,
+							MedalName:  c.Medal.ClubName,
+							MedalLevel: c.Medal.Level,
+						},
+					})
+				}
+			})
+		}
+		if features.Danmaku {
+			dac.OnGift(func(_ *acfundanmu.AcFunLive, g *acfundanmu.Gift) {
+				var acCoin int64
+				if g.PayWalletType == 1 {
+					// 付费礼物的价值单位为AC币*1000
+					acCoin = g.Value / 1000
+				}
+				r.Lock()
+				defer r.Unlock()
+				r.gifts = append(r.gifts, store.Gift{
+					LiveID:   liveID,
+					SendTime: g.SendTime,
+					UID:      g.UserID,
+					Nickname: g.Nickname,
+					GiftID:   g.GiftID,
+					GiftName: g.GiftName,
+					Count:    int(g.Count),
+					ACCoin:   acCoin,
+				})
+			})
+		}
+		if features.Stats {
+			dac.OnDisplayInfo(func(_ *acfundanmu.AcFunLive, info *acfundanmu.DisplayInfo) {
+				r.Lock()
+				defer r.Unlock()
+				r.info = info
+			})
+		}
+
+		done := dac.StartDanmu(ctx, true)
+		flushTicker := time.NewTicker(danmakuFlushInterval)
+		defer flushTicker.Stop()
+		sampleTicker := time.NewTicker(sampleInterval)
+		defer sampleTicker.Stop()
+		for {
+			select {
+			case err := <-done:
+				r.flushDanmaku()
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("uid为 %d 的主播的直播间弹幕断开：%v", uid, err)
+				} else {
+					// 没有取消时弹幕正常结束可能是收到了下播信号，比获取直播间列表发现下播更准确
+					recordDanmakuStop(liveID, time.Now().UnixMilli())
+				}
+				return
+			case <-flushTicker.C:
+				r.flushDanmaku()
+			case <-sampleTicker.C:
+				if features.Stats {
+					r.sample()
+				}
+			}
+		}
+	}()
+}
+
+// 把上次运行时没有结束的弹幕记录标记为中断，这时还没有连接任何直播间弹幕
+func closeStaleDanmakuSessions(ctx context.Context) {
+	n, err := db.CloseStaleDanmakuSessions(ctx)
+	if err != nil {
+		log.Printf("标记上次运行时没有结束的弹幕记录出现错误：%v", err)
+		return
+	}
+	if n != 0 {
+		log.Printf("上次运行时有 %d 场直播的弹幕记录没有结束，已标记为中断", n)
+	}
+}
+
+// 直播间弹幕不是因为下播断开时清除连接，之后直播还在直播间列表里的话按退避时间重连
+func roomDisconnected(liveID store.LiveID, conn *roomConn, connected time.Duration) {
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	if roomWatchers.m[liveID] == conn {
+		delete(roomWatchers.m, liveID)
+	}
+	room, ok := roomWatchers.rooms[liveID]
+	if !ok {
+		return
+	}
+	if connected >= roomRetryMaxDelay {
+		room.failures = 0
+	}
+	room.failures++
+	room.retryAt = time.Now().Add(roomRetryDelay(room.failures))
+}
+
+// 连续断开failures次后重连的等待时间
+func roomRetryDelay(failures int) time.Duration {
+	d := roomRetryMinDelay
+	for i := 1; i < failures && d < roomRetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > roomRetryMaxDelay {
+		d = roomRetryMaxDelay
+	}
+	return d
+}
+
+// 重连断开的直播间弹幕，只重连还在直播间列表里并且到了重连时间的直播
+func restartRoomWatchers(ctx context.Context, newList map[store.LiveID]live) {
+	for _, l := range reconnectingRooms(newList, time.Now()) {
+		l := l
+		log.Printf("重新连接uid为 %d 的主播 %s 的liveID为 %s 的直播间弹幕", l.uid, l.name, l.liveID)
+		startRoomWatcher(ctx, &l)
+	}
+}
+
+// 需要重连直播间弹幕的直播，按liveID排序
+func reconnectingRooms(newList map[store.LiveID]live, now time.Time) []live {
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	var lives []live
+	for _, liveID := range sortedLiveIDs(newList) {
+		room, ok := roomWatchers.rooms[liveID]
+		if !ok || now.Before(room.retryAt) {
+			continue
+		}
+		if _, ok := roomWatchers.m[liveID]; !ok {
+			lives = append(lives, newList[liveID])
+		}
+	}
+	return lives
+}
+
+// 记录直播间弹幕因为下播而结束的时间，已经下播的直播不再记录，避免留下的记录不会被清除
+func recordDanmakuStop(liveID store.LiveID, t int64) {
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	if room, ok := roomWatchers.rooms[liveID]; ok {
+		room.stop = t
+	}
+}
+
+// 直播间弹幕是否已经收到下播信号，需要在获取直播间列表时确认
+func danmakuStopped(liveID store.LiveID) bool {
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	room, ok := roomWatchers.rooms[liveID]
+	return ok && room.stop != 0
+}
+
+// 清除没有确认下播的下播信号，reconnect为true时不等待重连时间，下一次获取直播间列表时重连直播间弹幕
+func clearDanmakuStop(liveID store.LiveID, reconnect bool) {
+	roomWatchers.Lock()
+	defer roomWatchers.Unlock()
+	room, ok := roomWatchers.rooms[liveID]
+	if !ok {
+		return
+	}
+	room.stop = 0
+	if reconnect {
+		room.retryAt = time.Time{}
+	}
+}
+
+// 下播时断开直播间弹幕并结束弹幕记录，返回弹幕因为下播而结束的时间，没有收到下播信号时为0
+func stopRoomWatcher(ctx context.Context, liveID store.LiveID) int64 {
+	roomWatchers.Lock()
+	conn := roomWatchers.m[liveID]
+	room, ok := roomWatchers.rooms[liveID]
+	delete(roomWatchers.m, liveID)
+	delete(roomWatchers.rooms, liveID)
+	roomWatchers.Unlock()
+	if conn != nil {
+		conn.cancel()
+		// 等待保存剩下的弹幕
+		<-conn.done
+	}
+	if !ok {
+		return 0
+	}
+	// 本程序退出时直播可能还没有结束，记录留到下次启动时标记为中断
+	if room.danmaku && ctx.Err() == nil {
+		queueWrite(fmt.Sprintf("结束记录liveID为 %s 的弹幕并合计礼物和弹幕", liveID), nil,
+			store.DanmakuSessionCloseWrite(liveID, time.Now().UnixMilli()), store.GiftTotalWrite(liveID), store.ChatStatsWrite(liveID))
+		// 弹幕写入数据库后才能计算占用的空间
+		flushWrites()
+		accountDanmaku(ctx, liveID)
+	}
+	return room.stop
+}
+
+// 为设置了cover的主播在后台下载直播封面
+func startCoverDownload(l *live) {
+	if conf.CoverDir == "" || l.coverURL == "" || !isWatched(l.uid) || !watchFeatures(l.uid).Cover {
+		return
+	}
+	uid, liveID, coverURL := l.uid, l.liveID, l.coverURL
+	liveWG.Add(1)
+	go func() {
+		defer liveWG.Done()
+		defer recoverCrash("downloadCover")
+		var file string
+		err := runThrice(func() error {
+			var err error
+			file, err = downloadCover(uid, liveID, coverURL)
+			return err
+		})
+		if err != nil {
+			log.Printf("下载liveID为 %s 的直播封面失败：%v", liveID, err)
+			return
+		}
+		log.Printf("已保存uid为 %d 的主播的直播封面 %s", uid, file)
+		queueWrite(fmt.Sprintf("保存liveID为 %s 的直播封面文件", liveID), nil, store.CoverWrite(liveID, coverURL, file, time.Now().UnixMilli()))
+		accountFile(liveID, store.StorageCover, file)
+	}()
+}
+
+// 下载直播封面，保存为coverDir/主播的uid/liveID.扩展名，返回保存的文件路径
+func downloadCover(uid store.UID, liveID store.LiveID, coverURL string) (string, error) {
+	body, err := fetchImage(coverURL)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(absPath(conf.CoverDir), uid.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, liveID.String()+imageExt(coverURL))
+	return file, os.WriteFile(file, body, 0644)
+}
+
+// 下载图片
+func fetchImage(imageURL string) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(imageURL)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.SetUserAgent(userAgent)
+	if err := client.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d", imageURL, code)
+	}
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// 图片的扩展名，无法从链接判断时为.jpg
+func imageExt(imageURL string) string {
+	if u, err := url.Parse(imageURL); err == nil {
+		switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+		case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+			return ext
+		}
+	}
+	return ".jpg"
+}
+
+// 打印直播每分钟的采样
+func printSamples(ctx context.Context, liveID store.LiveID) {
+	list, err := db.QuerySamples(ctx, liveID)
+	if err != nil {
+		log.Printf("查询liveID为 %s 的直播采样出现错误：%v", liveID, err)
+		return
+	}
+	if len(list) == 0 {
+		log.Printf("liveID为 %s 的直播没有采样记录", liveID)
+		return
+	}
+	for _, s := range list {
+		fmt.Printf("%s 在线人数：%d 点赞数：%d 弹幕数：%d\n", time.UnixMilli(s.Time).Format(timeLayout), s.WatchingCount, s.LikeCount, s.DanmakuCount)
+	}
+}
+
+// 处理"watch 主播的uid [danmaku] [stats] [cover]"命令，没有列出的记录功能会被关闭
+func watchCommand(uidStr string, options []string) error {
+	uid, err := store.ParseUID(uidStr)
+	if err != nil {
+		return err
+	}
+	t := watchTarget{UID: uid}
+	for _, o := range options {
+		switch o {
+		case "danmaku":
+			t.Danmaku = true
+		case "stats":
+			t.Stats = true
+		case "cover":
+			t.Cover = true
+		default:
+			return fmt.Errorf("不支持的记录功能 %s，可以是 danmaku、stats 或 cover", o)
+		}
+	}
+	existed, err := setWatch(t)
+	if err != nil {
+		return err
+	}
+	if existed {
+		log.Printf("已修改uid为 %d 的主播的记录功能", uid)
+	} else {
+		log.Printf("已关注uid为 %d 的主播", uid)
+	}
+	return nil
+}
+
+// 打印关注的主播和开启的记录功能
+func printWatchList(ctx context.Context) {
+	list := watchList()
+	if len(list) == 0 {
+		log.Println("没有关注的主播")
+		return
+	}
+	for _, t := range list {
+		var features []string
+		if t.Danmaku {
+			features = append(features, "danmaku")
+		}
+		if t.Stats {
+			features = append(features, "stats")
+		}
+		if t.Cover {
+			features = append(features, "cover")
+		}
+		fmt.Printf("%d %s %s\n", t.UID, latestStreamerName(ctx, t.UID), strings.Join(features, " "))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+// 添加一场已经连接过直播间弹幕的直播，测试结束时清除
+func addTestRoom(t *testing.T, liveID store.LiveID, conn *roomConn) *roomState {
+	t.Helper()
+	room := &roomState{}
+	roomWatchers.Lock()
+	roomWatchers.rooms[liveID] = room
+	if conn != nil {
+		roomWatchers.m[liveID] = conn
+	}
+	roomWatchers.Unlock()
+	t.Cleanup(func() {
+		roomWatchers.Lock()
+		defer roomWatchers.Unlock()
+		delete(roomWatchers.m, liveID)
+		delete(roomWatchers.rooms, liveID)
+	})
+	return room
+}
+
+func TestRoomRetryDelay(t *testing.T) {
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	} {
+		if got := roomRetryDelay(tt.failures); got != tt.want {
+			t.Errorf("断开 %d 次后等待 %v，应该等待 %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRoomDisconnected(t *testing.T) {
+	conn := &roomConn{cancel: func() {}, done: make(chan struct{})}
+	room := addTestRoom(t, "a", conn)
+	addTestRoom(t, "b", &roomConn{cancel: func() {}, done: make(chan struct{})})
+
+	roomDisconnected("a", conn, time.Second)
+	roomWatchers.Lock()
+	_, ok := roomWatchers.m["a"]
+	failures, retryAt := room.failures, room.retryAt
+	roomWatchers.Unlock()
+	if ok {
+		t.Error("断开后没有清除连接")
+	}
+	if failures != 1 || time.Until(retryAt) <= 0 {
+		t.Errorf("断开后连续断开 %d 次，重连时间为 %v", failures, retryAt)
+	}
+	// 已经被新的连接替换时不清除
+	roomDisconnected("b", conn, time.Second)
+	roomWatchers.Lock()
+	_, ok = roomWatchers.m["b"]
+	roomWatchers.Unlock()
+	if !ok {
+		t.Error("清除了其他的连接")
+	}
+	// 连接了足够长时间后重新计算退避
+	roomDisconnected("a", conn, roomRetryMaxDelay)
+	if room.failures != 1 {
+		t.Errorf("长时间连接后断开时连续断开 %d 次，应该为1次", room.failures)
+	}
+
+	a := live{liveID: "a", uid: 1}
+	b := live{liveID: "b", uid: 2}
+	c := live{liveID: "c", uid: 3}
+	list := map[store.LiveID]live{"a": a, "b": b, "c": c}
+	if got := reconnectingRooms(list, time.Now()); len(got) != 0 {
+		t.Errorf("没到重连时间时重连 %v", got)
+	}
+	// 只重连断开的并且还在列表里的直播，没有连接过的直播不重连
+	if got, want := reconnectingRooms(list, retryAt.Add(time.Minute)), []live{a}; !reflect.DeepEqual(got, want) {
+		t.Errorf("重连 %v，应该重连 %v", got, want)
+	}
+	if got := reconnectingRooms(map[store.LiveID]live{"b": b}, retryAt.Add(time.Minute)); len(got) != 0 {
+		t.Errorf("不在列表里的直播重连 %v", got)
+	}
+}
+
+func TestStopRoomWatcher(t *testing.T) {
+	cancelled := false
+	conn := &roomConn{cancel: func() { cancelled = true }, done: make(chan struct{})}
+	close(conn.done)
+	addTestRoom(t, "a", conn)
+	recordDanmakuStop("a", 1000)
+	if !danmakuStopped("a") {
+		t.Error("没有记录下播信号")
+	}
+
+	if stop := stopRoomWatcher(context.Background(), "a"); stop != 1000 || !cancelled {
+		t.Errorf("断开后返回 %d，是否取消连接为 %v", stop, cancelled)
+	}
+	// 下播后不再记录
+	recordDanmakuStop("a", 2000)
+	if danmakuStopped("a") || stopRoomWatcher(context.Background(), "a") != 0 {
+		t.Error("下播后仍然记录了下播信号")
+	}
+}
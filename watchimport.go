@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"acfunlivedb/store"
+)
+
+// 从链接里提取主播uid，支持个人主页、直播间和本程序的RSS链接
+var uidURLRegexp = regexp.MustCompile(`(?:acfun\.cn/(?:u|live)/|/feed/)(\d+)`)
+
+// 导入文件里的一个主播
+type watchEntry struct {
+	uid    store.UID // 主播uid，只有昵称时为0
+	name   string    // 主播昵称
+	source string    // 在文件里的位置，用于提示
+}
+
+// OPML文件，其他工具导出的订阅列表
+type opmlDoc struct {
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// 从文字里解析uid，可以是数字或含有uid的链接
+func parseUIDText(s string) store.UID {
+	s = strings.TrimSpace(s)
+	if uid, err := store.ParseUID(s); err == nil {
+		return uid
+	}
+	if m := uidURLRegexp.FindStringSubmatch(s); m != nil {
+		uid, _ := store.ParseUID(m[1])
+		return uid
+	}
+	return 0
+}
+
+// 读取OPML文件里的主播
+func parseWatchOPML(r io.Reader) ([]watchEntry, error) {
+	var doc opmlDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("解析OPML失败：%w", err)
+	}
+	var entries []watchEntry
+	var walk func(list []opmlOutline)
+	walk = func(list []opmlOutline) {
+		for _, o := range list {
+			name := o.Title
+			if name == "" {
+				name = o.Text
+			}
+			uid := parseUIDText(o.XMLURL)
+			if uid == 0 {
+				uid = parseUIDText(o.HTMLURL)
+			}
+			// 没有链接并且有子项的是文件夹
+			if uid != 0 || (len(o.Outlines) == 0 && strings.TrimSpace(name) != "") {
+				entries = append(entries, watchEntry{uid: uid, name: strings.TrimSpace(name), source: name})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Outlines)
+	return entries, nil
+}
+
+// 读取CSV文件里的主播，有表头时使用uid、name和url等列，没有表头时第一列为uid、链接或昵称，第二列为昵称
+func parseWatchCSV(r io.Reader) ([]watchEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析CSV失败：%w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+
+	uidCol, nameCol, urlCol := -1, -1, -1
+	for i, h := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "uid", "id", "userid", "用户id":
+			uidCol = i
+		case "name", "nickname", "username", "昵称", "主播", "用户名":
+			nameCol = i
+		case "url", "link", "homepage", "链接", "主页":
+			urlCol = i
+		}
+	}
+	hasHeader := uidCol >= 0 || nameCol >= 0 || urlCol >= 0
+	if hasHeader {
+		records = records[1:]
+	} else {
+		uidCol, nameCol = 0, 1
+	}
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var entries []watchEntry
+	for i, record := range records {
+		line := i + 1
+		if hasHeader {
+			line++
+		}
+		e := watchEntry{uid: parseUIDText(field(record, uidCol)), name: field(record, nameCol), source: fmt.Sprintf("第 %d 行", line)}
+		if e.uid == 0 {
+			e.uid = parseUIDText(field(record, urlCol))
+		}
+		if !hasHeader && e.uid == 0 {
+			// 没有表头时第一列不是uid就当作昵称
+			e.name = field(record, 0)
+		}
+		if e.uid == 0 && e.name == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// 用数据库里的昵称记录查找主播uid，返回所有用过这个昵称的主播
+func resolveStreamerName(ctx context.Context, name string) ([]store.UID, error) {
+	list, err := db.SearchStreamers(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var uids []store.UID
+	seen := make(map[store.UID]bool)
+	for _, s := range list {
+		if s.Name == name && !seen[s.UID] {
+			seen[s.UID] = true
+			uids = append(uids, s.UID)
+		}
+	}
+	return uids, nil
+}
+
+// 从CSV或OPML文件导入关注的主播，apply为false时只预览
+func importWatchList(ctx context.Context, file string, apply bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var entries []watchEntry
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".opml", ".xml":
+		entries, err = parseWatchOPML(bytes.NewReader(data))
+	default:
+		entries, err = parseWatchCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("文件里没有主播")
+	}
+
+	uids := watchedUIDs()
+	watched := make(map[store.UID]bool, len(uids))
+	for _, uid := range uids {
+		watched[uid] = true
+	}
+	var added []store.UID
+	var unresolved int
+	for _, e := range entries {
+		uid := e.uid
+		if uid == 0 {
+			uids, err := resolveStreamerName(ctx, e.name)
+			if err != nil {
+				return err
+			}
+			switch len(uids) {
+			case 0:
+				fmt.Printf("无法确定uid：%s（%s），数据库里没有这个昵称的记录\n", e.name, e.source)
+				unresolved++
+				continue
+			case 1:
+				uid = uids[0]
+			default:
+				fmt.Printf("无法确定uid：%s（%s），有多个主播用过这个昵称：%v\n", e.name, e.source, uids)
+				unresolved++
+				continue
+			}
+		}
+		name := e.name
+		if name == "" {
+			name = latestStreamerName(ctx, uid)
+		}
+		if watched[uid] {
+			fmt.Printf("已经关注：%d %s\n", uid, name)
+			continue
+		}
+		watched[uid] = true
+		added = append(added, uid)
+		fmt.Printf("新增关注：%d %s\n", uid, name)
+	}
+
+	log.Printf("共 %d 个主播，新增 %d 个，无法确定uid %d 个", len(entries), len(added), unresolved)
+	if len(added) == 0 {
+		return nil
+	}
+	if !apply {
+		log.Println(`以上为预览，确认后请运行"import_watch 文件路径 --apply"写入设置文件`)
+		return nil
+	}
+	if err = addWatchUIDs(added); err != nil {
+		return err
+	}
+	log.Printf("已把 %d 个主播加入设置文件 %s 的watchUIDs", len(added), configPath)
+	return nil
+}
+
+// 修改设置文件里的watchUIDs和watch，保留其他设置和格式
+func writeWatchConfig(path string, uids []store.UID, targets []watchTarget) error {
+	if uids == nil {
+		uids = []store.UID{}
+	}
+	if targets == nil {
+		targets = []watchTarget{}
+	}
+	uidsValue, err := json.Marshal(uids)
+	if err != nil {
+		return err
+	}
+	targetsValue, err := json.MarshalIndent(targets, "    ", "    ")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte("{}\n")
+	} else if err != nil {
+		return err
+	}
+	// 没有的key会加在最前面，先写watch使两个都没有时watchUIDs在前
+	if data, err = replaceTopLevelJSON(data, "watch", targetsValue); err != nil {
+		return err
+	}
+	if data, err = replaceTopLevelJSON(data, "watchUIDs", uidsValue); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 替换JSON对象里key的值，没有这个key时加在最前面
+func replaceTopLevelJSON(data []byte, key string, value []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("设置文件不是JSON对象")
+	}
+	open := int(dec.InputOffset())
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if t == key {
+			end := int(dec.InputOffset())
+			start := end - len(raw)
+			return append(append(append([]byte(nil), data[:start]...), value...), data[end:]...), nil
+		}
+	}
+
+	field := fmt.Sprintf("\n    %q: %s", key, value)
+	rest := bytes.TrimLeft(data[open:], " \t\r\n")
+	if len(rest) > 0 && rest[0] != '}' {
+		field += ","
+		if !bytes.HasPrefix(bytes.TrimLeft(data[open:], " \t\r"), []byte("\n")) {
+			field += "\n    "
+		}
+	} else {
+		field += "\n"
+	}
+	return append(append(append([]byte(nil), data[:open]...), field...), data[open:]...), nil
+}
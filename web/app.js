@@ -0,0 +1,138 @@
+"use strict";
+
+const pageSize = 50;
+let offset = 0;
+
+// 格式化毫秒时间戳为本地时间
+function formatTime(ms) {
+  const d = new Date(ms);
+  const pad = (n) => String(n).padStart(2, "0");
+  return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())} ${pad(d.getHours())}:${pad(d.getMinutes())}`;
+}
+
+// 格式化时长，单位为毫秒
+function formatDuration(ms) {
+  const m = Math.floor(ms / 60000);
+  return `${Math.floor(m / 60)}:${String(m % 60).padStart(2, "0")}`;
+}
+
+function el(tag, props, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, props);
+  e.append(...children);
+  return e;
+}
+
+function link(href, text) {
+  return el("a", { href, target: "_blank", rel: "noopener" }, text);
+}
+
+function streamerLink(s) {
+  return link(`https://live.acfun.cn/live/${s.uid}`, s.name || String(s.uid));
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url);
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+async function loadLive() {
+  const box = document.getElementById("live");
+  try {
+    const list = await getJSON("api/live");
+    box.replaceChildren();
+    if (list.length === 0) {
+      box.append(el("p", { className: "empty" }, "关注的主播都没有在直播"));
+    }
+    const now = Date.now();
+    for (const s of list) {
+      box.append(el("div", { className: "card" },
+        el("div", { className: "name" }, streamerLink(s)),
+        el("div", {}, s.title || s.suggestedTitle || "（没有标题）"),
+        el("div", { className: "meta" }, `${formatTime(s.startTime)} 开播，已直播 ${formatDuration(now - s.startTime)}`)));
+    }
+  } catch (err) {
+    box.replaceChildren(el("p", { className: "error" }, `查询正在直播的主播失败：${err.message}`));
+  }
+}
+
+async function loadSessions() {
+  const params = new URLSearchParams();
+  for (const [k, v] of new FormData(document.getElementById("filter"))) {
+    if (v !== "") {
+      params.set(k, v);
+    }
+  }
+  params.set("limit", pageSize);
+  params.set("offset", offset);
+
+  const body = document.getElementById("sessions");
+  try {
+    const list = await getJSON(`api/sessions?${params}`);
+    body.replaceChildren();
+    for (const s of list) {
+      const title = s.title
+        ? el("td", {}, s.title)
+        : el("td", { className: "suggested", title: "建议标题" }, s.suggestedTitle);
+      const playback = el("td", { className: "nowrap" });
+      if (s.playbackURL) {
+        playback.append(link(s.playbackURL, "录播"));
+      }
+      if (s.backupURL) {
+        playback.append(" ", link(s.backupURL, "备份"));
+      }
+      body.append(el("tr", {},
+        el("td", { className: "nowrap" }, formatTime(s.startTime)),
+        el("td", {}, streamerLink(s)),
+        title,
+        el("td", { className: "nowrap" }, s.duration ? s.durationText : "未知"),
+        playback));
+    }
+    if (list.length === 0) {
+      body.append(el("tr", {}, el("td", { colSpan: 5, className: "empty" }, "没有符合条件的直播")));
+    }
+    document.getElementById("page").textContent = `第 ${offset / pageSize + 1} 页`;
+    document.getElementById("prev").disabled = offset === 0;
+    document.getElementById("next").disabled = list.length < pageSize;
+  } catch (err) {
+    body.replaceChildren(el("tr", {}, el("td", { colSpan: 5, className: "error" }, `查询直播失败：${err.message}`)));
+  }
+}
+
+async function loadHealth() {
+  const status = document.getElementById("status");
+  try {
+    const resp = await fetch("healthz");
+    const h = await resp.json();
+    status.textContent = h.lastFetch ? `最近更新：${formatTime(h.lastFetch)}` : "还没有获取直播间列表";
+    status.className = h.healthy ? "" : "error";
+  } catch (err) {
+    status.textContent = "";
+  }
+}
+
+document.getElementById("filter").addEventListener("submit", (e) => {
+  e.preventDefault();
+  offset = 0;
+  loadSessions();
+});
+document.getElementById("prev").addEventListener("click", () => {
+  offset = Math.max(0, offset - pageSize);
+  loadSessions();
+});
+document.getElementById("next").addEventListener("click", () => {
+  offset += pageSize;
+  loadSessions();
+});
+
+loadLive();
+loadSessions();
+loadHealth();
+setInterval(() => {
+  loadLive();
+  loadHealth();
+}, 60000);
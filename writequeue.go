@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"acfunlivedb/store"
+)
+
+const (
+	writeQueueSize   = 4096            // 写入队列的长度，队列满了时加入写入会等待
+	maxWriteBatch    = 256             // 一个事务最多执行的写入数量
+	slowFlushWarning = 2 * time.Second // 写入数据库超过这个时间时打印警告
+)
+
+// 写入队列里的写入
+type writeRequest struct {
+	writes []store.Write          // 在同一个事务里执行的写入
+	desc   string                 // 写入失败时打印的说明
+	done   func(affected []int64) // 写入成功后调用，参数为每条写入修改的行数，可以为nil
+	synced chan struct{}          // 不为nil时表示这是flushWrites的等待请求，之前的写入完成后关闭
+	target store.Store            // 不为nil时表示这是setWriteTarget的请求，之后的写入改为写入这个数据库
+}
+
+// 写入队列，获取直播间列表的循环只把写入加入队列，由writeCycle在事务里写入数据库，不会因为数据库写入慢而等待
+var writeQueue = struct {
+	ch   chan *writeRequest
+	done chan struct{} // writeCycle结束时关闭
+
+	sync.Mutex
+	total      int64         // 已经完成的写入数量
+	failed     int64         // 失败的写入数量
+	batches    int64         // 已经执行的事务数量
+	lastFlush  time.Duration // 最近一次写入用时
+	maxFlush   time.Duration // 写入用时的最大值
+	totalFlush time.Duration // 写入用时的总和
+}{
+	ch:   make(chan *writeRequest, writeQueueSize),
+	done: make(chan struct{}),
+}
+
+// 把写入加入队列，done在写入成功后由写入队列的goroutine调用
+func queueWrite(desc string, done func(affected []int64), writes ...store.Write) {
+	if len(writes) == 0 {
+		return
+	}
+	writeQueue.ch <- &writeRequest{writes: writes, desc: desc, done: done}
+}
+
+// 等待之前加入队列的写入完成，之后的直接写入可以看到这些写入的数据
+func flushWrites() {
+	synced := make(chan struct{})
+	writeQueue.ch <- &writeRequest{synced: synced}
+	<-synced
+}
+
+// 等待之前加入队列的写入完成，之后的写入改为写入target
+func setWriteTarget(target store.Store) {
+	synced := make(chan struct{})
+	writeQueue.ch <- &writeRequest{synced: synced, target: target}
+	<-synced
+}
+
+// 从队列取出写入，在事务里写入target，队列关闭后写入剩下的数据后返回
+func writeCycle(target store.Store) {
+	defer close(writeQueue.done)
+	for req := range writeQueue.ch {
+		batch := []*writeRequest{req}
+		n := len(req.writes)
+		// 合并队列里已有的写入，切换数据库之后的写入不能和之前的合并
+	collect:
+		for n < maxWriteBatch && batch[len(batch)-1].target == nil {
+			select {
+			case r, ok := <-writeQueue.ch:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, r)
+				n += len(r.writes)
+			default:
+				break collect
+			}
+		}
+		flushBatch(target, batch, n)
+		// 只有这个goroutine读取target，切换时不需要加锁
+		if t := batch[len(batch)-1].target; t != nil {
+			target = t
+		}
+	}
+}
+
+// 在一个事务里执行batch里的写入，失败时逐个写入，避免一条写入出错导致其他写入丢失
+func flushBatch(target store.Store, batch []*writeRequest, n int) {
+	// 关闭程序时队列里剩下的写入也要完成，所以不使用会被取消的ctx
+	ctx := context.Background()
+	writes := make([]store.Write, 0, n)
+	for _, req := range batch {
+		writes = append(writes, req.writes...)
+	}
+
+	defer func() {
+		for _, req := range batch {
+			if req.synced != nil {
+				close(req.synced)
+			}
+		}
+	}()
+	if len(writes) == 0 {
+		return
+	}
+
+	start := time.Now()
+	failed := 0
+	affected, err := target.WriteBatch(ctx, writes)
+	switch {
+	case err == nil:
+		for _, req := range batch {
+			req.finish(affected[:len(req.writes)])
+			affected = affected[len(req.writes):]
+		}
+	case len(batch) == 1:
+		failed = len(writes)
+		log.Printf("%s出现错误：%v", batch[0].desc, err)
+	default:
+		log.Printf("批量写入数据库出现错误，改为逐个写入：%v", err)
+		for _, req := range batch {
+			if len(req.writes) == 0 {
+				continue
+			}
+			affected, err := target.WriteBatch(ctx, req.writes)
+			if err != nil {
+				failed += len(req.writes)
+				log.Printf("%s出现错误：%v", req.desc, err)
+				continue
+			}
+			req.finish(affected)
+		}
+	}
+	elapsed := time.Since(start)
+
+	depth := len(writeQueue.ch)
+	writeQueue.Lock()
+	writeQueue.total += int64(len(writes) - failed)
+	writeQueue.failed += int64(failed)
+	writeQueue.batches++
+	writeQueue.lastFlush = elapsed
+	writeQueue.totalFlush += elapsed
+	if elapsed > writeQueue.maxFlush {
+		writeQueue.maxFlush = elapsed
+	}
+	writeQueue.Unlock()
+	if elapsed > slowFlushWarning {
+		log.Printf("写入 %d 条数据到数据库用时 %s，队列里还有 %d 个写入请求", len(writes), elapsed.Round(time.Millisecond), depth)
+	}
+}
+
+func (req *writeRequest) finish(affected []int64) {
+	if req.done != nil {
+		req.done(affected)
+	}
+}
+
+// 关闭写入队列并等待剩下的写入完成，之后不能再加入写入
+func closeWriteQueue() {
+	close(writeQueue.ch)
+	<-writeQueue.done
+}
+
+// 写入队列的状态，用于expvar
+func writeQueueVars() map[string]interface{} {
+	writeQueue.Lock()
+	defer writeQueue.Unlock()
+	return map[string]interface{}{
+		"depth":        len(writeQueue.ch),
+		"total":        writeQueue.total,
+		"failed":       writeQueue.failed,
+		"batches":      writeQueue.batches,
+		"lastFlushMs":  float64(writeQueue.lastFlush) / float64(time.Millisecond),
+		"maxFlushMs":   float64(writeQueue.maxFlush) / float64(time.Millisecond),
+		"totalFlushMs": float64(writeQueue.totalFlush) / float64(time.Millisecond),
+	}
+}
+
+// 写入队列的状态
+func writeQueueStatus() string {
+	writeQueue.Lock()
+	defer writeQueue.Unlock()
+	var avg time.Duration
+	if writeQueue.batches != 0 {
+		avg = writeQueue.totalFlush / time.Duration(writeQueue.batches)
+	}
+	return fmt.Sprintf("写入队列：等待 %d 个写入请求，已完成 %d 条，失败 %d 条，共 %d 个事务，最近一次用时 %s，平均用时 %s，最长用时 %s",
+		len(writeQueue.ch), writeQueue.total, writeQueue.failed, writeQueue.batches,
+		writeQueue.lastFlush.Round(time.Microsecond), avg.Round(time.Microsecond), writeQueue.maxFlush.Round(time.Microsecond),
+	)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"acfunlivedb/store"
+)
+
+// 打开测试用的内存数据库
+func openTestStore(t *testing.T) *store.SQLite {
+	t.Helper()
+	s, err := store.OpenSQLite(context.Background(), ":memory:", store.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// 启动写入target的写入队列，测试结束时关闭
+func startTestWriteQueue(t *testing.T, target store.Store) {
+	t.Helper()
+	writeQueue.ch = make(chan *writeRequest, writeQueueSize)
+	writeQueue.done = make(chan struct{})
+	go writeCycle(target)
+	t.Cleanup(closeWriteQueue)
+}
+
+func TestSetWriteTarget(t *testing.T) {
+	ctx := context.Background()
+	a, b := openTestStore(t), openTestStore(t)
+	startTestWriteQueue(t, a)
+
+	insert := func(liveID store.LiveID) {
+		queueWrite("插入测试直播", nil, store.InsertLiveWrite(&store.Live{LiveID: liveID, UID: 1, StreamName: liveID.String()}))
+	}
+	// 切换前后的写入在队列里会被合并，切换之后的写入不能写入之前的数据库
+	insert("a1")
+	insert("a2")
+	setWriteTarget(b)
+	insert("b1")
+	setWriteTarget(a)
+	insert("a3")
+	flushWrites()
+
+	for _, tt := range []struct {
+		s     *store.SQLite
+		name  string
+		want  []store.LiveID
+		other []store.LiveID
+	}{
+		{a, "a", []store.LiveID{"a1", "a2", "a3"}, []store.LiveID{"b1"}},
+		{b, "b", []store.LiveID{"b1"}, []store.LiveID{"a1", "a2", "a3"}},
+	} {
+		for _, liveID := range tt.want {
+			if ok, err := tt.s.Exists(ctx, liveID); err != nil || !ok {
+				t.Errorf("数据库%s里没有 %s：%v", tt.name, liveID, err)
+			}
+		}
+		for _, liveID := range tt.other {
+			if ok, err := tt.s.Exists(ctx, liveID); err != nil || ok {
+				t.Errorf("数据库%s里不应该有 %s：%v", tt.name, liveID, err)
+			}
+		}
+	}
+}